@@ -15,17 +15,15 @@ mkdir -p "$bin_dir"
 
 if [ "$target" = "examples" ]
 then 
-    dir="$examples_dir/*"
+    dir="$examples_dir/*.sowo"
     for sowo_file in $dir
     do
         name=$(basename $sowo_file '.sowo')
-        c_file="$bin_dir/$name.c"
-        go run . $sowo_file -o $c_file --save-tokens --save-ast
-        cc -Wall $c_file -o "$bin_dir/$name"
+        go run . build $sowo_file -o "$bin_dir/$name" --exe --keep-c --cflags -Wall --save-tokens --save-ast
     done
 elif [ "$target" = "clean" ]
 then
-    dir="$examples_dir/*"
+    dir="$examples_dir/*.sowo"
     for sowo_file in $dir
     do
         name=$(basename $sowo_file '.sowo')
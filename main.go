@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,12 +11,27 @@ import (
 	sowo "github.com/Supercaly/sowo/src"
 )
 
-// Creates new CompilerOptions from command line arguments.
-func optionsFromCommandLine() sowo.CompilerOptions {
-	args := os.Args
+// Creates new CompilerOptions from the arguments of a command, the
+// arguments after `--` are returned as the arguments of the program.
+func optionsFromCommandLine(command string, args []string) (sowo.CompilerOptions, []string) {
 	options := sowo.CompilerOptions{}
+	var programArgs []string
 
-	for i := 1; i < len(args); i++ {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" && command == "run" {
+			programArgs = args[i+1:]
+			break
+		}
+		if isBuildFlag(args[i]) && command != "build" {
+			fmt.Printf("%s flag can only be used with build\n", args[i])
+			usage()
+			os.Exit(1)
+		}
+		if isPrintFlag(args[i]) && command == "run" {
+			fmt.Printf("%s flag can't be used with run\n", args[i])
+			usage()
+			os.Exit(1)
+		}
 		if args[i] == "-o" || args[i] == "--output" {
 			if i == len(args)-1 {
 				fmt.Println("--output flag must be followed by a file name")
@@ -25,6 +42,16 @@ func optionsFromCommandLine() sowo.CompilerOptions {
 			i++
 			continue
 		}
+		if args[i] == "-I" || args[i] == "--import-path" {
+			if i == len(args)-1 {
+				fmt.Println("--import-path flag must be followed by a directory")
+				usage()
+				os.Exit(1)
+			}
+			options.ImportPaths = append(options.ImportPaths, args[i+1])
+			i++
+			continue
+		}
 		if args[i] == "-t" || args[i] == "--print-tokens" {
 			options.PrintTokens = true
 			continue
@@ -45,10 +72,111 @@ func optionsFromCommandLine() sowo.CompilerOptions {
 			options.SkipCompile = true
 			continue
 		}
+		if strings.HasPrefix(args[i], "--gc=") {
+			gc, err := sowo.GCStrategyFromName(strings.TrimPrefix(args[i], "--gc="))
+			if err != nil {
+				fmt.Println(err)
+				usage()
+				os.Exit(1)
+			}
+			options.GC = gc
+			continue
+		}
+		if strings.HasPrefix(args[i], "--target=") {
+			target := strings.TrimPrefix(args[i], "--target=")
+			if _, err := sowo.BackendWithName(target); err != nil {
+				fmt.Println(err)
+				usage()
+				os.Exit(1)
+			}
+			options.Target = target
+			continue
+		}
+		if args[i] == "--gc-debug" {
+			options.GCDebug = true
+			continue
+		}
+		if args[i] == "--unchecked" {
+			options.Unchecked = true
+			continue
+		}
+		if args[i] == "-e" || args[i] == "--exe" {
+			options.Executable = true
+			continue
+		}
+		if args[i] == "--cc" || args[i] == "--cflags" {
+			if i == len(args)-1 {
+				fmt.Printf("%s flag must be followed by a value\n", args[i])
+				usage()
+				os.Exit(1)
+			}
+			if args[i] == "--cc" {
+				options.CC = args[i+1]
+			} else {
+				options.CFlags = append(options.CFlags, strings.Fields(args[i+1])...)
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "-O") {
+			level, err := sowo.OptLevelFromFlag(args[i])
+			if err != nil {
+				fmt.Println(err)
+				usage()
+				os.Exit(1)
+			}
+			options.OptLevel = level
+			continue
+		}
+		if args[i] == "--interp" {
+			if command != "run" {
+				fmt.Println("--interp flag can only be used with run")
+				usage()
+				os.Exit(1)
+			}
+			options.Interpret = true
+			continue
+		}
+		if args[i] == "--vm" {
+			if command != "run" {
+				fmt.Println("--vm flag can only be used with run")
+				usage()
+				os.Exit(1)
+			}
+			options.VM = true
+			continue
+		}
+		if args[i] == "--bytecode" {
+			options.Target = "bytecode"
+			continue
+		}
+		if args[i] == "--print-bytecode" {
+			if command == "check" {
+				fmt.Println("--print-bytecode flag can't be used with check")
+				usage()
+				os.Exit(1)
+			}
+			options.PrintBytecode = true
+			continue
+		}
+		if args[i] == "--keep-c" {
+			options.KeepC = true
+			continue
+		}
 		if args[i] == "-h" || args[i] == "--help" {
 			usage()
 			os.Exit(0)
 		}
+		if strings.HasPrefix(args[i], "-") {
+			fmt.Printf("Unknown flag %s\n", args[i])
+			usage()
+			os.Exit(1)
+		}
+		if len(options.InputFile) != 0 {
+			fmt.Println("Only one input file can be specified!")
+			usage()
+			os.Exit(1)
+		}
 		options.InputFile = args[i]
 	}
 
@@ -57,36 +185,152 @@ func optionsFromCommandLine() sowo.CompilerOptions {
 		usage()
 		os.Exit(1)
 	}
+	isBytecode := filepath.Ext(options.InputFile) == ".sowoc"
+	if options.Interpret && (options.VM || isBytecode) {
+		fmt.Println("--interp flag can't be used with the virtual machine")
+		usage()
+		os.Exit(1)
+	}
+	if command == "run" && options.PrintBytecode && !options.VM && !isBytecode {
+		fmt.Println("--print-bytecode flag can only be used with run --vm")
+		usage()
+		os.Exit(1)
+	}
+	if isBytecode && command != "run" {
+		fmt.Println("Bytecode files can only be run")
+		usage()
+		os.Exit(1)
+	}
 
 	if len(options.OutputFile) == 0 {
 		inName := strings.TrimSuffix(filepath.Base(options.InputFile), filepath.Ext(options.InputFile))
 		inDir := filepath.Dir(options.InputFile)
-		outNameWithExt := inName + ".c" //".asm"
+		backend, _ := sowo.BackendWithName(options.Target)
+		outNameWithExt := inName + backend.Extension()
+		if options.Executable {
+			outNameWithExt = inName
+		}
 		options.OutputFile = filepath.Join(inDir, outNameWithExt)
 	}
 
-	return options
+	return options, programArgs
+}
+
+// Tells if the flag controls the output of build, the other
+// commands don't write any file.
+func isBuildFlag(flag string) bool {
+	switch flag {
+	case "-o", "--output", "--save-tokens", "--save-ast", "-n", "--no-compile", "-e", "--exe", "--keep-c", "--bytecode":
+		return true
+	}
+	return false
+}
+
+// Tells if the flag prints the program, run doesn't load the
+// program again when it's cached.
+func isPrintFlag(flag string) bool {
+	return flag == "-t" || flag == "--print-tokens" || flag == "-p" || flag == "--print-ast"
+}
+
+// Formats the files given as arguments of the fmt command, they are
+// printed to stdout unless -w is given.
+func formatFiles(args []string) {
+	write := false
+	var files []string
+	for _, arg := range args {
+		if arg == "-w" {
+			write = true
+		} else if arg == "-h" || arg == "--help" {
+			usage()
+			os.Exit(0)
+		} else {
+			files = append(files, arg)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Println("At least an input file must be specified!")
+		usage()
+		os.Exit(1)
+	}
+
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Error opening file %s", file)
+		}
+		formatted := sowo.FormatSource(string(source))
+		if !write {
+			fmt.Print(formatted)
+		} else if formatted != string(source) {
+			if err := ioutil.WriteFile(file, []byte(formatted), 0666); err != nil {
+				log.Fatalf("Error writing to file %s", file)
+			}
+		}
+	}
 }
 
 // Prints the program usage to stdout
 func usage() {
-	fmt.Println("Usage: main.go [options...] [input.sowo]")
+	fmt.Println("Usage: main.go <command> [options...] [input.sowo]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println(" build                : Compile the program for the target or to an executable.")
+	fmt.Println(" run [...] -- args    : Build the program and run it with args, the build is cached.")
+	fmt.Println("                        .sowoc files are run by the virtual machine.")
+	fmt.Println(" check                : Check the program for errors without compiling it.")
+	fmt.Println(" fmt [-w] files...    : Format the files, -w rewrites them instead of printing them.")
+	fmt.Println(" help                 : Prints this help message.")
 	fmt.Println()
 	fmt.Println("Options:")
-	fmt.Println(" -o, --output [input].asm : Specify the output file name.")
-	fmt.Println(" -t, --print-tokens   : Print the tokens.")
-	fmt.Println(" -p, --print-ast      : Print the AST.")
-	fmt.Println(" --save-tokens        : Save the tokens to a file.")
-	fmt.Println(" --save-ast           : Save the AST to a file.")
-	fmt.Println(" -n, --no-compile     : Stop the process before the compilation step.")
+	fmt.Println(" -o, --output file    : Specify the output file name, [input].c by default (build only).")
+	fmt.Println(" -I, --import-path dir : Search imported modules also in dir.")
+	fmt.Println(" -t, --print-tokens   : Print the tokens (not with run).")
+	fmt.Println(" -p, --print-ast      : Print the AST (not with run).")
+	fmt.Println(" --save-tokens        : Save the tokens to a file (build only).")
+	fmt.Println(" --save-ast           : Save the AST to a file (build only).")
+	fmt.Println(" -n, --no-compile     : Stop the process before the compilation step (build only).")
+	fmt.Println(" --gc=none|marksweep  : Select the memory management strategy (default none).")
+	fmt.Printf(" --target=%s : Select the generated code (default c).\n", strings.Join(sowo.BackendNames(), "|"))
+	fmt.Println(" --gc-debug           : Report allocations and leaks when the program exits.")
+	fmt.Println(" --unchecked          : Don't check divisions by zero and indices when the program runs.")
+	fmt.Println(" -e, --exe            : Build an executable with the C compiler (build only).")
+	fmt.Println(" --cc compiler        : C compiler used to build executables (default $CC or cc).")
+	fmt.Println(" --cflags flags       : Pass the flags to the C compiler.")
+	fmt.Println(" -O0|-O1|-O2|-O3|-Os  : Optimisation level of the C compiler (-O is -O2).")
+	fmt.Println(" --keep-c             : Keep the generated file of the executable (build only).")
+	fmt.Println(" --interp             : Run the program with the interpreter, no C compiler is needed (run only).")
+	fmt.Println(" --vm                 : Run the program with the bytecode virtual machine (run only).")
+	fmt.Println(" --bytecode           : Same as --target=bytecode, compile to a [input].sowoc file (build only).")
+	fmt.Println(" --print-bytecode     : Print the bytecode of the program (build and run --vm).")
 	fmt.Println(" -h, --help           : Prints this help message.")
 	fmt.Println()
 }
 
 func main() {
-	// Parse command line args
-	options := optionsFromCommandLine()
+	if len(os.Args) < 2 {
+		fmt.Println("A command must be specified!")
+		usage()
+		os.Exit(1)
+	}
 
-	// Compile the file
-	sowo.SowoCompileFile(options)
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "build":
+		options, _ := optionsFromCommandLine(command, args)
+		sowo.SowoCompileFile(options)
+	case "run":
+		options, programArgs := optionsFromCommandLine(command, args)
+		os.Exit(sowo.SowoRunFile(options, programArgs))
+	case "check":
+		options, _ := optionsFromCommandLine(command, args)
+		sowo.SowoCheckFile(options)
+	case "fmt":
+		formatFiles(args)
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Printf("Unknown command %s\n", command)
+		usage()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,65 @@
+package src
+
+import (
+	"fmt"
+	"log"
+)
+
+// Represents a code generator for a target, selected by its name with
+// the --target flag. The compiler driver only goes through this interface,
+// so a new target is added by implementing it and listing it in backends.
+type Backend interface {
+	// Name of the target (e.g. `c`).
+	Name() string
+	// Extension of the files holding the generated code (e.g. `.c`).
+	Extension() string
+	// Returns the code of a type checked program.
+	Emit(program Ast, options CompilerOptions) ([]byte, error)
+}
+
+// Represents a backend whose code can be built into an executable,
+// used by build --exe and by run.
+type ExecutableBackend interface {
+	Backend
+	// Builds the executable from the file holding the emitted code.
+	BuildExecutable(sourceFile string, exeFile string, options CompilerOptions) error
+}
+
+// Backends of every target, the first one is the default.
+var backends = []Backend{
+	cBackend{},
+	x86_64Backend{},
+	llvmBackend{},
+	wasmBackend{},
+	bytecodeBackend{},
+}
+
+// Returns the backend of the target with given name.
+func BackendWithName(name string) (Backend, error) {
+	if name == "" {
+		return backends[0], nil
+	}
+	for _, backend := range backends {
+		if backend.Name() == name {
+			return backend, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown target '%s'", name)
+}
+
+// Returns the names of the targets.
+func BackendNames() (names []string) {
+	for _, backend := range backends {
+		names = append(names, backend.Name())
+	}
+	return names
+}
+
+// Returns the backend of the target in the options.
+func targetBackend(options CompilerOptions) Backend {
+	backend, err := BackendWithName(options.Target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return backend
+}
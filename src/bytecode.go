@@ -0,0 +1,539 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// A program compiled to the stack based bytecode run by the virtual
+// machine, see compileBytecode and runBytecode. Only the builtin types
+// are referred by the bytecode so that it doesn't depend on the types
+// interned by the compiler and can be saved to `.sowoc` files.
+type Bytecode struct {
+	// String constants, the names and the source files.
+	Strings   []string
+	Functions []BytecodeFunction
+	// Functions implementing the methods of an interface for
+	// a type, in the order the interface declares them.
+	Vtables [][]int
+	// Source locations of the instructions that can fail.
+	Locations []BytecodeLocation
+	Globals   int
+	// Function initialising the globals and the entry point.
+	Init int
+	Main int
+	// main takes the command line arguments.
+	MainArgs bool
+	// main returns a result, its error has type MainError.
+	MainResult bool
+	MainError  TypeAnnotation
+	// Integer overflows aren't checked.
+	Unchecked bool
+}
+
+type BytecodeFunction struct {
+	Name string
+	// Number of arguments and of local slots, the arguments and the
+	// captured variables of function literals are the first slots.
+	Params int
+	Slots  int
+	Code   []byte
+}
+
+type BytecodeLocation struct {
+	// Index of the file in the strings.
+	File int
+	Line int
+	Col  int
+}
+
+// Instructions are an opcode followed by its operands, encoded as
+// signed varints except jump targets that are 4 bytes offsets in
+// the code of the function so that they can be patched.
+type Opcode byte
+
+const (
+	BcInt Opcode = iota
+	BcFloat
+	BcString
+	BcPop
+	BcLoadLocal
+	BcStoreLocal
+	BcBoxLocal
+	BcLoadBoxed
+	BcStoreBoxed
+	BcLocalAddr
+	BcLoadGlobal
+	BcStoreGlobal
+	BcGlobalAddr
+	BcLoad
+	BcStore
+	BcNew
+	BcAdd
+	BcSub
+	BcMul
+	BcDiv
+	BcFAdd
+	BcFSub
+	BcFMul
+	BcFDiv
+	BcConcat
+	BcEqual
+	BcLess
+	BcGreater
+	BcLessEqual
+	BcGreaterEqual
+	BcJump
+	BcJumpIfFalse
+	BcCall
+	BcCallExtern
+	BcCallClosure
+	BcCallInterface
+	BcReturn
+	BcClosure
+	BcExternRef
+	BcInterface
+	BcOk
+	BcOkVoid
+	BcErr
+	BcTry
+	BcResultMethod
+	BcConvert
+	BcIndexString
+	BcIndexSlice
+	BcSliceString
+	BcLen
+	BcSliceLen
+	BcFormat
+	BcPrint
+	BcBuiltin
+)
+
+// Kinds of operands, they tell the disassembler how to show them.
+type bytecodeOperand int
+
+const (
+	operandInt bytecodeOperand = iota
+	operandFloat
+	operandString
+	operandSlot
+	operandFunc
+	operandJump
+	operandType
+	operandCompare
+	operandLocation
+	operandMethod
+)
+
+type opcodeInfo struct {
+	name     string
+	operands []bytecodeOperand
+}
+
+var opcodeInfos = [...]opcodeInfo{
+	BcInt:           {"int", []bytecodeOperand{operandInt}},
+	BcFloat:         {"float", []bytecodeOperand{operandFloat}},
+	BcString:        {"string", []bytecodeOperand{operandString}},
+	BcPop:           {"pop", nil},
+	BcLoadLocal:     {"load_local", []bytecodeOperand{operandSlot}},
+	BcStoreLocal:    {"store_local", []bytecodeOperand{operandSlot}},
+	BcBoxLocal:      {"box_local", []bytecodeOperand{operandSlot}},
+	BcLoadBoxed:     {"load_boxed", []bytecodeOperand{operandSlot}},
+	BcStoreBoxed:    {"store_boxed", []bytecodeOperand{operandSlot}},
+	BcLocalAddr:     {"local_addr", []bytecodeOperand{operandSlot}},
+	BcLoadGlobal:    {"load_global", []bytecodeOperand{operandSlot}},
+	BcStoreGlobal:   {"store_global", []bytecodeOperand{operandSlot}},
+	BcGlobalAddr:    {"global_addr", []bytecodeOperand{operandSlot}},
+	BcLoad:          {"load", []bytecodeOperand{operandLocation}},
+	BcStore:         {"store", []bytecodeOperand{operandLocation}},
+	BcNew:           {"new", nil},
+	BcAdd:           {"add", []bytecodeOperand{operandType, operandLocation}},
+	BcSub:           {"sub", []bytecodeOperand{operandType, operandLocation}},
+	BcMul:           {"mul", []bytecodeOperand{operandType, operandLocation}},
+	BcDiv:           {"div", []bytecodeOperand{operandType, operandLocation}},
+	BcFAdd:          {"fadd", []bytecodeOperand{operandType}},
+	BcFSub:          {"fsub", []bytecodeOperand{operandType}},
+	BcFMul:          {"fmul", []bytecodeOperand{operandType}},
+	BcFDiv:          {"fdiv", []bytecodeOperand{operandType}},
+	BcConcat:        {"concat", nil},
+	BcEqual:         {"equal", []bytecodeOperand{operandCompare}},
+	BcLess:          {"less", []bytecodeOperand{operandCompare}},
+	BcGreater:       {"greater", []bytecodeOperand{operandCompare}},
+	BcLessEqual:     {"less_equal", []bytecodeOperand{operandCompare}},
+	BcGreaterEqual:  {"greater_equal", []bytecodeOperand{operandCompare}},
+	BcJump:          {"jump", []bytecodeOperand{operandJump}},
+	BcJumpIfFalse:   {"jump_if_false", []bytecodeOperand{operandJump}},
+	BcCall:          {"call", []bytecodeOperand{operandFunc, operandInt}},
+	BcCallExtern:    {"call_extern", []bytecodeOperand{operandString}},
+	BcCallClosure:   {"call_closure", []bytecodeOperand{operandInt, operandLocation}},
+	BcCallInterface: {"call_interface", []bytecodeOperand{operandInt, operandInt, operandString, operandLocation}},
+	BcReturn:        {"return", nil},
+	BcClosure:       {"closure", []bytecodeOperand{operandFunc, operandInt}},
+	BcExternRef:     {"extern_ref", []bytecodeOperand{operandString}},
+	BcInterface:     {"interface", []bytecodeOperand{operandInt}},
+	BcOk:            {"ok", nil},
+	BcOkVoid:        {"ok_void", nil},
+	BcErr:           {"err", nil},
+	BcTry:           {"try", nil},
+	BcResultMethod:  {"result_method", []bytecodeOperand{operandMethod, operandLocation}},
+	BcConvert:       {"convert", []bytecodeOperand{operandType, operandType, operandLocation}},
+	BcIndexString:   {"index_string", []bytecodeOperand{operandLocation}},
+	BcIndexSlice:    {"index_slice", []bytecodeOperand{operandLocation}},
+	BcSliceString:   {"slice_string", []bytecodeOperand{operandInt, operandLocation}},
+	BcLen:           {"len", nil},
+	BcSliceLen:      {"slice_len", nil},
+	BcFormat:        {"format", []bytecodeOperand{operandType}},
+	BcPrint:         {"print", []bytecodeOperand{operandInt}},
+	BcBuiltin:       {"builtin", []bytecodeOperand{operandString, operandInt, operandLocation}},
+}
+
+// How values are compared, the operand of the comparison opcodes.
+const (
+	compareSigned = iota
+	compareUnsigned
+	compareFloat
+	compareChar
+	compareString
+	compareReference
+)
+
+var compareNames = [...]string{"signed", "unsigned", "float", "char", "string", "reference"}
+
+// Methods of results, the operand of BcResultMethod.
+var bytecodeResultMethods = [...]string{"is_ok", "is_err", "value", "error", "value_or"}
+
+// Flags of the bounds given to BcSliceString.
+const (
+	sliceHasFrom = 1 << iota
+	sliceHasTo
+)
+
+// Decodes the instruction at offset in the code.
+// Returns its opcode, its operands and the offset of the next one.
+func decodeInstruction(code []byte, offset int) (Opcode, []int64, int, error) {
+	op := Opcode(code[offset])
+	if int(op) >= len(opcodeInfos) {
+		return 0, nil, 0, fmt.Errorf("unknown opcode %d at offset %d", op, offset)
+	}
+	offset++
+	var operands []int64
+	for _, kind := range opcodeInfos[op].operands {
+		if kind == operandJump {
+			if offset+4 > len(code) {
+				return 0, nil, 0, fmt.Errorf("truncated instruction at offset %d", offset)
+			}
+			operands = append(operands, int64(binary.LittleEndian.Uint32(code[offset:])))
+			offset += 4
+			continue
+		}
+		value, n := binary.Varint(code[offset:])
+		if n <= 0 {
+			return 0, nil, 0, fmt.Errorf("truncated instruction at offset %d", offset)
+		}
+		operands = append(operands, value)
+		offset += n
+	}
+	return op, operands, offset, nil
+}
+
+// Returns a readable listing of the bytecode, one instruction per line.
+func disassembleBytecode(b *Bytecode) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "globals %d, init %s, main %s\n", b.Globals, b.Functions[b.Init].Name, b.Functions[b.Main].Name)
+	for i, vtable := range b.Vtables {
+		var names []string
+		for _, fn := range vtable {
+			names = append(names, b.Functions[fn].Name)
+		}
+		fmt.Fprintf(&out, "vtable %d: %s\n", i, strings.Join(names, ", "))
+	}
+	for i, fn := range b.Functions {
+		fmt.Fprintf(&out, "\nfunction %d %s (params %d, slots %d)\n", i, fn.Name, fn.Params, fn.Slots)
+		for offset := 0; offset < len(fn.Code); {
+			op, operands, next, err := decodeInstruction(fn.Code, offset)
+			if err != nil {
+				fmt.Fprintf(&out, "    %04d  <%s>\n", offset, err)
+				break
+			}
+			info := opcodeInfos[op]
+			line := fmt.Sprintf("    %04d  %s", offset, info.name)
+			for j, operand := range operands {
+				line += " " + b.formatOperand(info.operands[j], operand)
+			}
+			out.WriteString(line + "\n")
+			offset = next
+		}
+	}
+	return out.String()
+}
+
+func (b *Bytecode) formatOperand(kind bytecodeOperand, operand int64) string {
+	inRange := func(n int) bool { return operand >= 0 && operand < int64(n) }
+	switch kind {
+	case operandFloat:
+		return fmt.Sprint(math.Float64frombits(uint64(operand)))
+	case operandString:
+		if inRange(len(b.Strings)) {
+			return fmt.Sprintf("%q", b.Strings[operand])
+		}
+	case operandFunc:
+		if inRange(len(b.Functions)) {
+			return b.Functions[operand].Name
+		}
+	case operandJump:
+		return fmt.Sprintf("%04d", operand)
+	case operandType:
+		return TypeAnnotation(operand).String()
+	case operandCompare:
+		if inRange(len(compareNames)) {
+			return compareNames[operand]
+		}
+	case operandLocation:
+		if inRange(len(b.Locations)) {
+			l := b.Locations[operand]
+			return fmt.Sprintf("(%s:%d:%d)", b.Strings[l.File], l.Line, l.Col)
+		}
+	case operandMethod:
+		if inRange(len(bytecodeResultMethods)) {
+			return bytecodeResultMethods[operand]
+		}
+	}
+	return fmt.Sprint(operand)
+}
+
+// Header of the `.sowoc` files and version of their format.
+const bytecodeMagic = "sowoc"
+const bytecodeVersion = 1
+
+// Writes the bytecode in the `.sowoc` format: the header followed
+// by the tables of the bytecode, every number is a varint.
+func writeBytecode(w io.Writer, b *Bytecode) error {
+	out := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeInt := func(value int) {
+		n := binary.PutVarint(buf, int64(value))
+		out.Write(buf[:n])
+	}
+	writeBytes := func(data []byte) {
+		writeInt(len(data))
+		out.Write(data)
+	}
+	writeBool := func(value bool) {
+		if value {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+	}
+
+	out.WriteString(bytecodeMagic)
+	writeInt(bytecodeVersion)
+	writeInt(len(b.Strings))
+	for _, s := range b.Strings {
+		writeBytes([]byte(s))
+	}
+	writeInt(len(b.Functions))
+	for _, fn := range b.Functions {
+		writeBytes([]byte(fn.Name))
+		writeInt(fn.Params)
+		writeInt(fn.Slots)
+		writeBytes(fn.Code)
+	}
+	writeInt(len(b.Vtables))
+	for _, vtable := range b.Vtables {
+		writeInt(len(vtable))
+		for _, fn := range vtable {
+			writeInt(fn)
+		}
+	}
+	writeInt(len(b.Locations))
+	for _, l := range b.Locations {
+		writeInt(l.File)
+		writeInt(l.Line)
+		writeInt(l.Col)
+	}
+	writeInt(b.Globals)
+	writeInt(b.Init)
+	writeInt(b.Main)
+	writeBool(b.MainArgs)
+	writeBool(b.MainResult)
+	writeInt(int(b.MainError))
+	writeBool(b.Unchecked)
+	return out.Flush()
+}
+
+// Reads bytecode written by writeBytecode, the tables are checked
+// so that the virtual machine can trust the indices they contain.
+func readBytecode(r io.Reader) (*Bytecode, error) {
+	in := bufio.NewReader(r)
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != bytecodeMagic {
+		return nil, errors.New("not a sowo bytecode file")
+	}
+	var err error
+	readInt := func() int {
+		if err != nil {
+			return 0
+		}
+		var value int64
+		value, err = binary.ReadVarint(in)
+		if err == nil && (value < 0 || value > math.MaxInt32) {
+			err = fmt.Errorf("invalid number %d", value)
+		}
+		return int(value)
+	}
+	readBytes := func() []byte {
+		n := readInt()
+		if err != nil {
+			return nil
+		}
+		// Copied as it's read, so that a corrupted length can't
+		// allocate more memory than the file holds.
+		var data bytes.Buffer
+		_, err = io.CopyN(&data, in, int64(n))
+		return data.Bytes()
+	}
+	// Lengths of the tables, read one at a time so that
+	// a corrupted file can't allocate too much memory.
+	readLen := readInt
+
+	if version := readInt(); err == nil && version != bytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d", version)
+	}
+	b := &Bytecode{}
+	for i, n := 0, readLen(); i < n && err == nil; i++ {
+		b.Strings = append(b.Strings, string(readBytes()))
+	}
+	for i, n := 0, readLen(); i < n && err == nil; i++ {
+		fn := BytecodeFunction{Name: string(readBytes())}
+		fn.Params = readInt()
+		fn.Slots = readInt()
+		fn.Code = readBytes()
+		b.Functions = append(b.Functions, fn)
+	}
+	for i, n := 0, readLen(); i < n && err == nil; i++ {
+		var vtable []int
+		for j, m := 0, readLen(); j < m && err == nil; j++ {
+			vtable = append(vtable, readInt())
+		}
+		b.Vtables = append(b.Vtables, vtable)
+	}
+	for i, n := 0, readLen(); i < n && err == nil; i++ {
+		b.Locations = append(b.Locations, BytecodeLocation{File: readInt(), Line: readInt(), Col: readInt()})
+	}
+	b.Globals = readInt()
+	b.Init = readInt()
+	b.Main = readInt()
+	b.MainArgs = readInt() != 0
+	b.MainResult = readInt() != 0
+	b.MainError = TypeAnnotation(readInt())
+	b.Unchecked = readInt() != 0
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("invalid bytecode file: %s", err)
+	}
+	if err := verifyBytecode(b); err != nil {
+		return nil, fmt.Errorf("invalid bytecode file: %s", err)
+	}
+	return b, nil
+}
+
+// Checks that the instructions can be decoded and that their operands
+// refer to existing functions, strings, locals and jump targets. The
+// heights and the types of the stack aren't checked, runBytecode
+// reports the instructions using them wrong as invalid bytecode.
+func verifyBytecode(b *Bytecode) error {
+	funcInRange := func(fn int) bool { return fn >= 0 && fn < len(b.Functions) }
+	if !funcInRange(b.Init) || !funcInRange(b.Main) {
+		return errors.New("entry point out of range")
+	}
+	if b.MainError > TypeChar {
+		return errors.New("invalid error type of main")
+	}
+	for _, vtable := range b.Vtables {
+		for _, fn := range vtable {
+			if !funcInRange(fn) {
+				return errors.New("vtable function out of range")
+			}
+		}
+	}
+	for _, l := range b.Locations {
+		if l.File >= len(b.Strings) {
+			return errors.New("location file out of range")
+		}
+	}
+	for _, fn := range b.Functions {
+		if fn.Params > fn.Slots {
+			return fmt.Errorf("function %s has more params than slots", fn.Name)
+		}
+		starts := map[int64]bool{}
+		var jumps []int64
+		var last Opcode
+		for offset := 0; offset < len(fn.Code); {
+			starts[int64(offset)] = true
+			op, operands, next, err := decodeInstruction(fn.Code, offset)
+			if err != nil {
+				return fmt.Errorf("function %s: %s", fn.Name, err)
+			}
+			for i, kind := range opcodeInfos[op].operands {
+				operand := operands[i]
+				var limit int
+				switch kind {
+				case operandString:
+					limit = len(b.Strings)
+				case operandSlot:
+					limit = fn.Slots
+					if op == BcLoadGlobal || op == BcStoreGlobal || op == BcGlobalAddr {
+						limit = b.Globals
+					}
+				case operandFunc:
+					limit = len(b.Functions)
+				case operandLocation:
+					limit = len(b.Locations)
+				case operandType:
+					limit = int(TypeChar) + 1
+				case operandCompare:
+					limit = len(compareNames)
+				case operandMethod:
+					limit = len(bytecodeResultMethods)
+				case operandJump:
+					jumps = append(jumps, operand)
+					continue
+				default:
+					if operand < 0 {
+						return fmt.Errorf("function %s: negative operand at offset %d", fn.Name, offset)
+					}
+					continue
+				}
+				if operand < 0 || operand >= int64(limit) {
+					return fmt.Errorf("function %s: operand out of range at offset %d", fn.Name, offset)
+				}
+			}
+			if op == BcInterface && operands[0] >= int64(len(b.Vtables)) {
+				return fmt.Errorf("function %s: vtable out of range at offset %d", fn.Name, offset)
+			}
+			if op == BcCall && operands[1] != int64(b.Functions[operands[0]].Params) {
+				return fmt.Errorf("function %s: wrong number of arguments at offset %d", fn.Name, offset)
+			}
+			last = op
+			offset = next
+		}
+		if last != BcReturn {
+			return fmt.Errorf("function %s doesn't end with a return", fn.Name)
+		}
+		for _, target := range jumps {
+			if !starts[target] {
+				return fmt.Errorf("function %s: jump to %d is not an instruction", fn.Name, target)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,625 @@
+package src
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+)
+
+// Compiles the type checked tree to bytecode. Generic functions get
+// an instance for every list of type arguments they are called with,
+// so that the bytecode only refers to builtin types. Local variables
+// whose address is taken are boxed in cells like the interpreter does.
+type bytecodeCompiler struct {
+	program   *Bytecode
+	strings   map[string]int
+	globals   map[string]int
+	funcDefs  map[string]*Ast
+	functions map[string]int
+	vtables   map[string]int
+	locations map[BytecodeLocation]int
+	sources   map[string]string
+	// Functions declared but not compiled yet.
+	pending []bytecodeFunctionDef
+
+	// State of the function being compiled.
+	code     []byte
+	scopes   []map[string]bytecodeLocal
+	slots    int
+	boxed    map[string]bool
+	bindings map[TypeAnnotation]TypeAnnotation
+	file     string
+	name     string
+	literals int
+}
+
+type bytecodeLocal struct {
+	slot  int
+	boxed bool
+}
+
+// A function, method or function literal to compile. Function
+// literals get their captured variables after their params.
+type bytecodeFunctionDef struct {
+	index    int
+	def      *Ast
+	captures []*Ast
+	bindings map[TypeAnnotation]TypeAnnotation
+	file     string
+}
+
+// Generates bytecode files run by the virtual machine.
+type bytecodeBackend struct{}
+
+func (bytecodeBackend) Name() string      { return "bytecode" }
+func (bytecodeBackend) Extension() string { return ".sowoc" }
+
+func (bytecodeBackend) Emit(program Ast, options CompilerOptions) ([]byte, error) {
+	var code bytes.Buffer
+	if err := writeBytecode(&code, compileBytecode(program, options)); err != nil {
+		return nil, err
+	}
+	return code.Bytes(), nil
+}
+
+// Compiles a type checked program to bytecode.
+func compileBytecode(ast Ast, options CompilerOptions) *Bytecode {
+	if ast.Type != AstProgram {
+		log.Fatalf("[Bytecode]: Unsupported top level %s", ast.Type)
+	}
+	c := &bytecodeCompiler{
+		program:   &Bytecode{Unchecked: options.Unchecked},
+		strings:   map[string]int{},
+		globals:   map[string]int{},
+		funcDefs:  map[string]*Ast{},
+		functions: map[string]int{},
+		vtables:   map[string]int{},
+		locations: map[BytecodeLocation]int{},
+		sources:   map[string]string{},
+	}
+	for _, module := range ast.Children {
+		c.sources[module.Name] = module.StringDataValue
+		for _, def := range module.Children {
+			switch def.Type {
+			case AstFunction:
+				c.funcDefs[irSymbolName(def.Module, def.Name)] = def
+			case AstMethod:
+				c.funcDefs[irMethodName(def.Module, methodReceiverType(def), def.Name)] = def
+			case AstGlobalVariable, AstGlobalConstant:
+				c.globals[irSymbolName(def.Module, def.Name)] = len(c.globals)
+			}
+		}
+	}
+	c.program.Globals = len(c.globals)
+
+	// Globals are initialised in the order they are declared
+	c.program.Init = len(c.program.Functions)
+	c.program.Functions = append(c.program.Functions, BytecodeFunction{Name: "<init>"})
+	c.startFunction("<init>", nil, "")
+	for _, module := range ast.Children {
+		c.file = module.StringDataValue
+		for _, def := range module.Children {
+			if def.Type == AstGlobalVariable || def.Type == AstGlobalConstant {
+				c.compileExpression(def.Children[1])
+				c.emit(BcStoreGlobal, c.globals[irSymbolName(def.Module, def.Name)])
+			}
+		}
+	}
+	c.endFunction(c.program.Init, 0)
+
+	// The main module is the last one, its main function is the entry point
+	entryModule := ast.Children[len(ast.Children)-1]
+	main := c.funcDefs[irSymbolName(entryModule.Name, "main")]
+	c.program.Main = c.function(irSymbolName(entryModule.Name, "main"), main, nil)
+	c.program.MainArgs = len(main.Children[0].Children) == 1
+	if returnType := main.Children[1].Children[0].DataType; isResultType(returnType) {
+		c.program.MainResult = true
+		_, c.program.MainError = resultTypes(returnType)
+	}
+
+	for len(c.pending) > 0 {
+		next := c.pending[0]
+		c.pending = c.pending[1:]
+		c.compileFunction(next)
+	}
+	return c.program
+}
+
+// Returns the index of the function with given name, declaring it
+// the first time so that its body is compiled later.
+func (c *bytecodeCompiler) function(name string, def *Ast, bindings map[TypeAnnotation]TypeAnnotation) int {
+	if index, ok := c.functions[name]; ok {
+		return index
+	}
+	index := len(c.program.Functions)
+	c.functions[name] = index
+	c.program.Functions = append(c.program.Functions, BytecodeFunction{Name: name})
+	c.pending = append(c.pending, bytecodeFunctionDef{index: index, def: def, bindings: bindings, file: c.sources[def.Module]})
+	return index
+}
+
+func (c *bytecodeCompiler) compileFunction(fn bytecodeFunctionDef) {
+	c.startFunction(c.program.Functions[fn.index].Name, fn.bindings, fn.file)
+	c.scanAddressTaken(fn.def.Children[2])
+	params := fn.def.Children[0].Children
+	for _, param := range append(append([]*Ast{}, params...), fn.captures...) {
+		if local := c.declareLocal(param.Name); local.boxed {
+			c.emit(BcBoxLocal, local.slot)
+		}
+	}
+	c.compileBlock(fn.def.Children[2])
+	c.endFunction(fn.index, len(params))
+}
+
+func (c *bytecodeCompiler) startFunction(name string, bindings map[TypeAnnotation]TypeAnnotation, file string) {
+	c.name = name
+	c.literals = 0
+	c.code = nil
+	c.scopes = []map[string]bytecodeLocal{{}}
+	c.slots = 0
+	c.boxed = map[string]bool{}
+	c.bindings = bindings
+	c.file = file
+}
+
+// Ends the function returning a zero value, the value of void
+// functions, when the end of its body is reached.
+func (c *bytecodeCompiler) endFunction(index int, params int) {
+	c.emit(BcInt, 0)
+	c.emit(BcReturn)
+	fn := &c.program.Functions[index]
+	fn.Params = params
+	fn.Slots = c.slots
+	fn.Code = c.code
+}
+
+// Finds the local variables whose address is taken, they are
+// stored in cells so that pointers to them stay valid.
+func (c *bytecodeCompiler) scanAddressTaken(ast *Ast) {
+	if ast.Type == AstAddressOf && ast.Children[0].Type == AstVariableRef && ast.Children[0].Module == "" {
+		c.boxed[ast.Children[0].Name] = true
+	}
+	for _, child := range ast.Children {
+		if child != nil {
+			c.scanAddressTaken(child)
+		}
+	}
+}
+
+func (c *bytecodeCompiler) declareLocal(name string) bytecodeLocal {
+	local := bytecodeLocal{slot: c.slots, boxed: c.boxed[name]}
+	c.slots++
+	c.scopes[len(c.scopes)-1][name] = local
+	return local
+}
+
+// Looks up a local variable from the innermost block.
+func (c *bytecodeCompiler) local(name string) (bytecodeLocal, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if local, ok := c.scopes[i][name]; ok {
+			return local, true
+		}
+	}
+	return bytecodeLocal{}, false
+}
+
+func (c *bytecodeCompiler) global(module string, name string) int {
+	index, ok := c.globals[irSymbolName(module, name)]
+	if !ok {
+		log.Fatalf("[Bytecode]: Unknown variable %s", name)
+	}
+	return index
+}
+
+func (c *bytecodeCompiler) typeOf(t TypeAnnotation) TypeAnnotation {
+	if c.bindings == nil {
+		return t
+	}
+	return substituteType(t, c.bindings)
+}
+
+func (c *bytecodeCompiler) emit(op Opcode, operands ...int) {
+	c.code = append(c.code, byte(op))
+	var buf [binary.MaxVarintLen64]byte
+	for _, operand := range operands {
+		n := binary.PutVarint(buf[:], int64(operand))
+		c.code = append(c.code, buf[:n]...)
+	}
+}
+
+// Emits a jump whose target is patched later.
+// Returns the offset of the target in the code.
+func (c *bytecodeCompiler) emitJump(op Opcode) int {
+	c.code = append(c.code, byte(op), 0, 0, 0, 0)
+	return len(c.code) - 4
+}
+
+// Makes the jump at offset go to the end of the code.
+func (c *bytecodeCompiler) patchJump(offset int) {
+	c.patchJumpTo(offset, len(c.code))
+}
+
+func (c *bytecodeCompiler) patchJumpTo(offset int, target int) {
+	binary.LittleEndian.PutUint32(c.code[offset:], uint32(target))
+}
+
+func (c *bytecodeCompiler) stringIndex(s string) int {
+	index, ok := c.strings[s]
+	if !ok {
+		index = len(c.program.Strings)
+		c.strings[s] = index
+		c.program.Strings = append(c.program.Strings, s)
+	}
+	return index
+}
+
+// Returns the index of the location of the node, used to report failures.
+func (c *bytecodeCompiler) location(ast *Ast) int {
+	location := BytecodeLocation{File: c.stringIndex(c.file), Line: ast.Line, Col: ast.Col}
+	index, ok := c.locations[location]
+	if !ok {
+		index = len(c.program.Locations)
+		c.locations[location] = index
+		c.program.Locations = append(c.program.Locations, location)
+	}
+	return index
+}
+
+func (c *bytecodeCompiler) compileBlock(ast *Ast) {
+	c.scopes = append(c.scopes, map[string]bytecodeLocal{})
+	defer func() { c.scopes = c.scopes[:len(c.scopes)-1] }()
+
+	for _, statement := range ast.Children {
+		switch statement.Type {
+		case AstLocalVariable:
+			c.compileExpression(statement.Children[1])
+			local := c.declareLocal(statement.Children[0].Name)
+			c.emit(BcStoreLocal, local.slot)
+			if local.boxed {
+				c.emit(BcBoxLocal, local.slot)
+			}
+		case AstAssignment:
+			c.compileExpression(statement.Children[0])
+			c.compileStore(statement.Module, statement.Name)
+		case AstDerefAssignment:
+			c.compileExpression(statement.Children[0])
+			c.compileExpression(statement.Children[1])
+			c.emit(BcStore, c.location(statement.Children[0]))
+		case AstIf:
+			c.compileExpression(statement.Children[0])
+			elseJump := c.emitJump(BcJumpIfFalse)
+			c.compileBlock(statement.Children[1])
+			if len(statement.Children) == 3 {
+				endJump := c.emitJump(BcJump)
+				c.patchJump(elseJump)
+				c.compileBlock(statement.Children[2])
+				c.patchJump(endJump)
+			} else {
+				c.patchJump(elseJump)
+			}
+		case AstWhile:
+			start := len(c.code)
+			c.compileExpression(statement.Children[0])
+			endJump := c.emitJump(BcJumpIfFalse)
+			c.compileBlock(statement.Children[1])
+			c.patchJumpTo(c.emitJump(BcJump), start)
+			c.patchJump(endJump)
+		case AstReturn:
+			c.compileExpression(statement.Children[0])
+			c.emit(BcReturn)
+		case AstFuncCall, AstClosureCall, AstMethodCall, AstTry:
+			c.compileExpression(statement)
+			c.emit(BcPop)
+		case AstPrint:
+			// All the values are formatted before printing as for a call of printf
+			for _, param := range statement.Children {
+				c.compileExpression(param)
+				c.emit(BcFormat, int(c.typeOf(param.DataType)))
+			}
+			c.emit(BcPrint, len(statement.Children))
+		default:
+			log.Fatalf("[Bytecode]: Unsupported statement %s", statement.Type)
+		}
+	}
+}
+
+func (c *bytecodeCompiler) compileLoad(module string, name string) {
+	if module == "" {
+		if local, ok := c.local(name); ok {
+			if local.boxed {
+				c.emit(BcLoadBoxed, local.slot)
+			} else {
+				c.emit(BcLoadLocal, local.slot)
+			}
+			return
+		}
+	}
+	c.emit(BcLoadGlobal, c.global(module, name))
+}
+
+func (c *bytecodeCompiler) compileStore(module string, name string) {
+	if module == "" {
+		if local, ok := c.local(name); ok {
+			if local.boxed {
+				c.emit(BcStoreBoxed, local.slot)
+			} else {
+				c.emit(BcStoreLocal, local.slot)
+			}
+			return
+		}
+	}
+	c.emit(BcStoreGlobal, c.global(module, name))
+}
+
+func (c *bytecodeCompiler) compileArgs(args []*Ast) {
+	for _, arg := range args {
+		c.compileExpression(arg)
+	}
+}
+
+func (c *bytecodeCompiler) compileExpression(ast *Ast) {
+	switch ast.Type {
+	case AstNumberLiteral:
+		if t := c.typeOf(ast.DataType); isFloatType(t) {
+			c.emit(BcFloat, int(math.Float64bits(interpFloat(float64(ast.NumberDataValue), t))))
+		} else {
+			c.emit(BcInt, ast.NumberDataValue)
+		}
+	case AstFloatLiteral:
+		c.emit(BcFloat, int(math.Float64bits(interpFloat(ast.FloatDataValue, c.typeOf(ast.DataType)))))
+	case AstBooleanLiteral:
+		if ast.BooleanDataValue {
+			c.emit(BcInt, 1)
+		} else {
+			c.emit(BcInt, 0)
+		}
+	case AstStringLiteral:
+		c.emit(BcString, c.stringIndex(ast.StringDataValue))
+	case AstCharLiteral:
+		c.emit(BcInt, int(ast.CharDataValue))
+	case AstBinaryOp:
+		c.compileBinaryOp(ast)
+	case AstVariableRef:
+		c.compileLoad(ast.Module, ast.Name)
+	case AstFuncCall:
+		c.compileFuncCall(ast)
+	case AstFuncRef:
+		if def, ok := c.funcDefs[irSymbolName(ast.Module, ast.Name)]; ok {
+			c.emit(BcClosure, c.function(irSymbolName(ast.Module, ast.Name), def, nil), 0)
+		} else {
+			// C functions are referred with their own name
+			c.emit(BcExternRef, c.stringIndex(ast.Name))
+		}
+	case AstFuncLiteral:
+		c.literals++
+		name := fmt.Sprintf("%s$literal%d", c.name, c.literals)
+		index := len(c.program.Functions)
+		c.program.Functions = append(c.program.Functions, BytecodeFunction{Name: name})
+		captures := ast.Children[3].Children
+		c.pending = append(c.pending, bytecodeFunctionDef{index: index, def: ast, captures: captures, bindings: c.bindings, file: c.file})
+		for _, capture := range captures {
+			c.compileLoad("", capture.Name)
+		}
+		c.emit(BcClosure, index, len(captures))
+	case AstClosureCall:
+		// The callee is evaluated first, it's kept in a slot of its
+		// own while the arguments are evaluated
+		callee := c.slots
+		c.slots++
+		c.compileExpression(ast.Children[0])
+		c.emit(BcStoreLocal, callee)
+		c.compileArgs(ast.Children[1:])
+		c.emit(BcLoadLocal, callee)
+		c.emit(BcCallClosure, len(ast.Children)-1, c.location(ast))
+	case AstMethodCall:
+		c.compileMethodCall(ast)
+	case AstInterfaceValue:
+		c.compileExpression(ast.Children[0])
+		c.emit(BcInterface, c.vtable(c.typeOf(ast.DataType), c.typeOf(ast.Children[0].DataType), ast.Children[1:]))
+	case AstResultOk:
+		if len(ast.Children) == 0 {
+			c.emit(BcOkVoid)
+		} else {
+			c.compileExpression(ast.Children[0])
+			c.emit(BcOk)
+		}
+	case AstResultErr:
+		c.compileExpression(ast.Children[0])
+		c.emit(BcErr)
+	case AstTry:
+		c.compileExpression(ast.Children[0])
+		c.emit(BcTry)
+	case AstConversion:
+		c.compileExpression(ast.Children[0])
+		from, to := c.typeOf(ast.Children[0].DataType), c.typeOf(ast.DataType)
+		if from != to {
+			c.emit(BcConvert, int(from), int(to), c.location(ast))
+		}
+	case AstNew:
+		c.emit(BcNew)
+	case AstAddressOf:
+		target := ast.Children[0]
+		if target.Type == AstDereference {
+			c.compileExpression(target.Children[0])
+		} else if local, ok := c.local(target.Name); ok && target.Module == "" {
+			c.emit(BcLocalAddr, local.slot)
+		} else {
+			c.emit(BcGlobalAddr, c.global(target.Module, target.Name))
+		}
+	case AstDereference:
+		c.compileExpression(ast.Children[0])
+		c.emit(BcLoad, c.location(ast.Children[0]))
+	case AstIndex:
+		c.compileExpression(ast.Children[0])
+		c.compileExpression(ast.Children[1])
+		if isSliceType(c.typeOf(ast.Children[0].DataType)) {
+			c.emit(BcIndexSlice, c.location(ast))
+		} else {
+			c.emit(BcIndexString, c.location(ast))
+		}
+	case AstSlice:
+		c.compileExpression(ast.Children[0])
+		bounds := 0
+		if ast.Children[1].Type != AstNoop {
+			c.compileExpression(ast.Children[1])
+			bounds |= sliceHasFrom
+		}
+		if ast.Children[2].Type != AstNoop {
+			c.compileExpression(ast.Children[2])
+			bounds |= sliceHasTo
+		}
+		c.emit(BcSliceString, bounds, c.location(ast))
+	default:
+		log.Fatalf("[Bytecode]: Unsupported expression %s", ast.Type)
+	}
+}
+
+func (c *bytecodeCompiler) compileBinaryOp(ast *Ast) {
+	t := c.typeOf(ast.Children[0].DataType)
+	c.compileExpression(ast.Children[0])
+	c.compileExpression(ast.Children[1])
+	switch {
+	case t == TypeString && ast.Operator == OpPlus:
+		c.emit(BcConcat)
+		return
+	case isIntegerType(t) && isArithmeticOperator(ast.Operator):
+		ops := map[BinaryOperator]Opcode{OpPlus: BcAdd, OpMinus: BcSub, OpTimes: BcMul, OpDivide: BcDiv}
+		c.emit(ops[ast.Operator], int(t), c.location(ast))
+		return
+	case isFloatType(t) && isArithmeticOperator(ast.Operator):
+		ops := map[BinaryOperator]Opcode{OpPlus: BcFAdd, OpMinus: BcFSub, OpTimes: BcFMul, OpDivide: BcFDiv}
+		c.emit(ops[ast.Operator], int(t))
+		return
+	}
+
+	compare := compareReference
+	switch {
+	case t == TypeU64:
+		compare = compareUnsigned
+	case isIntegerType(t) || t == TypeBoolean:
+		compare = compareSigned
+	case isFloatType(t):
+		compare = compareFloat
+	case t == TypeChar:
+		compare = compareChar
+	case t == TypeString:
+		compare = compareString
+	}
+	switch ast.Operator {
+	case OpEquals:
+		c.emit(BcEqual, compare)
+	case OpLessThen:
+		c.emit(BcLess, compare)
+	case OpGreaterThen:
+		c.emit(BcGreater, compare)
+	case OpLessThenEqual:
+		c.emit(BcLessEqual, compare)
+	case OpGreaterThenEqual:
+		c.emit(BcGreaterEqual, compare)
+	default:
+		log.Fatalf("[Bytecode]: Unsupported operator %s for type '%s'", ast.Operator, t)
+	}
+}
+
+func (c *bytecodeCompiler) compileFuncCall(ast *Ast) {
+	c.compileArgs(ast.Children)
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, c.typeOf(arg.DataType))
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[Bytecode]: %s", err)
+		}
+		switch builtin.CName {
+		case "sowo_str_len":
+			c.emit(BcLen)
+		case "sowo_slice_len":
+			c.emit(BcSliceLen)
+		default:
+			c.emit(BcBuiltin, c.stringIndex(builtin.CName), len(ast.Children), c.location(ast))
+		}
+		return
+	}
+
+	name := irSymbolName(ast.Module, ast.Name)
+	def, ok := c.funcDefs[name]
+	if !ok {
+		c.emit(BcCallExtern, c.stringIndex(ast.Name))
+		return
+	}
+	var bindings map[TypeAnnotation]TypeAnnotation
+	if len(ast.TypeArgs) > 0 {
+		// Every list of type arguments gets its own instance
+		bindings = map[TypeAnnotation]TypeAnnotation{}
+		var typeArgs []TypeAnnotation
+		for i, typeParam := range funcTypeParams(def) {
+			bindings[typeParam] = c.typeOf(ast.TypeArgs[i])
+			typeArgs = append(typeArgs, bindings[typeParam])
+		}
+		name += irTypeArgsSuffix(typeArgs)
+	}
+	c.emit(BcCall, c.function(name, def, bindings), len(ast.Children))
+}
+
+// Compiles a method call, methods of interfaces are called through
+// the vtable of the interface value and the methods of results are
+// instructions.
+func (c *bytecodeCompiler) compileMethodCall(ast *Ast) {
+	receiverType := c.typeOf(ast.Children[0].DataType)
+	c.compileArgs(ast.Children)
+	switch {
+	case isResultType(receiverType):
+		for i, name := range bytecodeResultMethods {
+			if name == ast.Name {
+				c.emit(BcResultMethod, i, c.location(ast))
+				return
+			}
+		}
+		log.Fatalf("[Bytecode]: Unknown method %s of results", ast.Name)
+	case isInterfaceType(receiverType):
+		for i, method := range interfaceMethods(receiverType) {
+			if method.Name == ast.Name {
+				c.emit(BcCallInterface, i, len(ast.Children), c.stringIndex(ast.Name), c.location(ast))
+				return
+			}
+		}
+		log.Fatalf("[Bytecode]: Unknown method %s of type '%s'", ast.Name, receiverType)
+	}
+	name := irMethodName(ast.Module, receiverType, ast.Name)
+	def, ok := c.funcDefs[name]
+	if !ok {
+		log.Fatalf("[Bytecode]: Unknown method %s of type '%s'", ast.Name, receiverType)
+	}
+	c.emit(BcCall, c.function(name, def, nil), len(ast.Children))
+}
+
+// Returns the vtable with the methods of the value type implementing
+// the interface, in the order the interface declares them.
+func (c *bytecodeCompiler) vtable(iface TypeAnnotation, valueType TypeAnnotation, refs []*Ast) int {
+	key := irTypeName(iface) + "/" + irTypeName(valueType)
+	if index, ok := c.vtables[key]; ok {
+		return index
+	}
+	var vtable []int
+	for _, method := range interfaceMethods(iface) {
+		for _, ref := range refs {
+			if ref.Name == method.Name {
+				name := irMethodName(ref.Module, valueType, ref.Name)
+				def, ok := c.funcDefs[name]
+				if !ok {
+					log.Fatalf("[Bytecode]: Unknown method %s of type '%s'", ref.Name, valueType)
+				}
+				vtable = append(vtable, c.function(name, def, nil))
+			}
+		}
+	}
+	index := len(c.program.Vtables)
+	c.vtables[key] = index
+	c.program.Vtables = append(c.program.Vtables, vtable)
+	return index
+}
@@ -0,0 +1,47 @@
+package src
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// A corrupted length is an error and doesn't allocate the memory it asks.
+func TestReadBytecodeHugeLength(t *testing.T) {
+	var file bytes.Buffer
+	buf := make([]byte, binary.MaxVarintLen64)
+	file.WriteString(bytecodeMagic)
+	for _, value := range []int64{bytecodeVersion, 1, math.MaxInt32} {
+		n := binary.PutVarint(buf, value)
+		file.Write(buf[:n])
+	}
+	_, err := readBytecode(&file)
+	if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Fatalf("expected an unexpected EOF error, got %v", err)
+	}
+}
+
+// Bytecode written by writeBytecode is read back unchanged.
+func TestReadBytecodeRoundTrip(t *testing.T) {
+	program := &Bytecode{
+		Strings: []string{"main.sowo"},
+		Functions: []BytecodeFunction{
+			{Name: "init", Code: []byte{byte(BcInt), 0, byte(BcReturn)}},
+			{Name: "main", Code: []byte{byte(BcInt), 2, byte(BcReturn)}},
+		},
+		Main: 1,
+	}
+	var file bytes.Buffer
+	if err := writeBytecode(&file, program); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readBytecode(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Functions) != 2 || !bytes.Equal(read.Functions[1].Code, program.Functions[1].Code) {
+		t.Fatalf("functions changed: %+v", read.Functions)
+	}
+}
@@ -0,0 +1,123 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Function values are emitted as a sowo_closure, made of a C function
+// pointer and of an environment holding the captured variables. The C
+// function takes the environment as first argument followed by the
+// arguments of the sowo function.
+
+// Functions generated while emitting the program: the bodies of the
+// function literals and the wrappers of the functions used as values.
+var closurePrototypes []string
+var closureFunctions []string
+var closureCount int
+var funcRefWrappers map[string]bool
+
+// Returns the C type of the function pointer of a closure.
+func irClosurePointerType(t TypeAnnotation) string {
+	params, returnType := funcTypeSignature(t)
+	cParams := []string{"void *"}
+	for _, param := range params {
+		cParams = append(cParams, irDataType(param))
+	}
+	return fmt.Sprintf("%s (*)(%s)", irDataType(returnType), strings.Join(cParams, ", "))
+}
+
+// Emits a call of a function value.
+func irClosureCall(ast Ast) (value string) {
+	setup, operands := irOperands(ast.Children...)
+	callee := operands[0]
+	if setup == "" && !irIsSimple(*ast.Children[0]) {
+		// The callee is used twice, it's evaluated once
+		setup, callee = irTemp(setup, ast.Children[0].DataType, callee)
+	}
+	value += fmt.Sprintf("((%s)%s.fn)(%s.env", irClosurePointerType(ast.Children[0].DataType), callee, callee)
+	for _, arg := range operands[1:] {
+		value += ", " + arg
+	}
+	value += ")"
+	return irSequence(setup, value)
+}
+
+// Emits a function used as a value, the function is called
+// through a wrapper that ignores the environment.
+func irFuncRef(ast Ast) string {
+	name := irSymbolName(ast.Module, ast.Name)
+	wrapper := "sowo_fn__" + name
+	if !funcRefWrappers[wrapper] {
+		funcRefWrappers[wrapper] = true
+		params, returnType := funcTypeSignature(ast.DataType)
+		cParams := []string{"void *env"}
+		var args []string
+		for i, param := range params {
+			cParams = append(cParams, fmt.Sprintf("%s arg%d", irDataType(param), i))
+			args = append(args, fmt.Sprintf("arg%d", i))
+		}
+		signature := fmt.Sprintf("static %s %s(%s)", irDataType(returnType), wrapper, strings.Join(cParams, ", "))
+		call := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+		if returnType != TypeVoid {
+			call = "return " + call
+		}
+		closurePrototypes = append(closurePrototypes, signature+";\n")
+		closureFunctions = append(closureFunctions, fmt.Sprintf("%s {\n%s;\n}\n", signature, call))
+	}
+	return fmt.Sprintf("((sowo_closure){(void (*)(void))%s, NULL})", wrapper)
+}
+
+// Emits a function literal as a C function plus a constructor that
+// copies the captured variables in a new environment. The captured
+// variables are copied back to locals at the start of the function,
+// so the body is emitted like the one of any other function.
+func irFuncLiteral(ast Ast) string {
+	closureCount++
+	name := fmt.Sprintf("sowo_closure_%d", closureCount)
+	env := fmt.Sprintf("struct sowo_env_%d", closureCount)
+	captures := ast.Children[3].Children
+	returnType := irType(*ast.Children[1].Children[0])
+	var args []string
+	for _, capture := range captures {
+		args = append(args, irVariableRef("", capture.Name))
+	}
+	defer irStartBody(*ast.Children[2])()
+
+	params := "void *sowo_env"
+	if len(ast.Children[0].Children) > 0 {
+		params += ", " + irFuncParam(*ast.Children[0])
+	}
+	signature := fmt.Sprintf("static %s %s(%s)", returnType, name, params)
+	var body, constructorParams, constructorBody string
+	body += irBoxParams(*ast.Children[0])
+	for i, capture := range captures {
+		body += irLocalVariable(*capture, fmt.Sprintf("((%s *)sowo_env)->%s", env, capture.Name))
+		if i > 0 {
+			constructorParams += ", "
+		}
+		constructorParams += irVariable(*capture)
+		constructorBody += fmt.Sprintf("env->%s = %s;\n", capture.Name, capture.Name)
+	}
+	body += irBody(*ast.Children[2])
+
+	constructor := fmt.Sprintf("static sowo_closure %s_new(%s)", name, constructorParams)
+	if len(captures) == 0 {
+		constructor = fmt.Sprintf("static sowo_closure %s_new(void)", name)
+		constructorBody = fmt.Sprintf("return (sowo_closure){(void (*)(void))%s, NULL};\n", name)
+	} else {
+		var fields string
+		for _, capture := range captures {
+			fields += irVariable(*capture) + ";\n"
+		}
+		closureFunctions = append(closureFunctions, fmt.Sprintf("%s {\n%s};\n", env, fields))
+		constructorBody = fmt.Sprintf("%s *env = sowo_alloc(sizeof(%s));\n", env, env) + constructorBody
+		constructorBody += fmt.Sprintf("return (sowo_closure){(void (*)(void))%s, env};\n", name)
+	}
+
+	closurePrototypes = append(closurePrototypes, signature+";\n", constructor+";\n")
+	closureFunctions = append(closureFunctions,
+		fmt.Sprintf("%s {\n%s}\n", signature, body),
+		fmt.Sprintf("%s {\n%s}\n", constructor, constructorBody))
+	return fmt.Sprintf("%s_new(%s)", name, strings.Join(args, ", "))
+}
@@ -7,27 +7,230 @@ import (
 	"strings"
 )
 
+// Emits the C entry point. The sowo main can take the command line
+// arguments as a []string and its return value is the exit code, when
+// it doesn't return a value the program always exits with 0. A main
+// returning a result is emitted as a separate function, its error is
+// printed and the program exits with 1.
 func irMain(ast Ast) (value string) {
-	value += "int main(int argc, char **argv) {\n"
-	value += irBody(*ast.Children[2])
-	value += "return 0;\n"
+	defer irStartBody(*ast.Children[2])()
+	returnType := ast.Children[1].Children[0].DataType
+	var body string
+	if isResultType(returnType) {
+		value += fmt.Sprintf("static %s sowo_main(%s) {\n%s%s}\n", irDataType(returnType),
+			irFuncParam(*ast.Children[0]), irBoxParams(*ast.Children[0]), irBody(*ast.Children[2]))
+		args := ""
+		if len(ast.Children[0].Children) == 1 {
+			args = "sowo_args(sowo_argc, sowo_argv)"
+		}
+		valueType, errorType := resultTypes(returnType)
+		placeholder, errorValue := irPrintFormat(errorType, "sowo_result.error")
+		body += fmt.Sprintf("%s sowo_result = sowo_main(%s);\n", irDataType(returnType), args)
+		body += fmt.Sprintf("if (!sowo_result.ok) {\nfprintf(stderr, \"error: %s\\n\", %s);\nreturn 1;\n}\n",
+			placeholder, errorValue)
+		if valueType == TypeVoid {
+			body += "return 0;\n"
+		} else {
+			body += "return sowo_result.value;\n"
+		}
+	} else {
+		if params := ast.Children[0].Children; len(params) == 1 {
+			body += irLocalVariable(*params[0], "sowo_args(sowo_argc, sowo_argv)")
+		}
+		body += irBody(*ast.Children[2])
+		if returnType == TypeVoid {
+			body += "return 0;\n"
+		}
+	}
+	value += "int main(int sowo_argc, char **sowo_argv) {\n"
+	value += "sowo_gc_init(__builtin_frame_address(0));\n"
+	value += "sowo_init_globals();\n"
+	value += body
 	value += "}\n"
 	return value
 }
 
-func irFunction(ast Ast) (value string) {
+// Path of the source file of the code being emitted, and
+// path of the source file of every module by module name.
+var irSourceFile string
+var irSourceFiles map[string]string
+
+// True if the operations that can fail are checked when the program
+// runs, unchecked operations have undefined behaviour on failure.
+var irChecked bool
+
+// Returns the C arguments locating the node in the
+// source, passed to the runtime to report failures.
+func irLocation(ast Ast) string {
+	return fmt.Sprintf("%s, %d, %d", irStringLiteral(irSourceFile), ast.Line, ast.Col)
+}
+
+// Counter naming the temporaries of the operands.
+var irTempCount int
+
+// Returns the C expressions of the operands of an operation. Operands
+// are evaluated from left to right, while C doesn't specify the order:
+// when the order can be observed the operands are stored in temporaries,
+// declared by the setup code to run before the operation (see irSequence).
+func irOperands(operands ...*Ast) (setup string, values []string) {
+	dynamic, effects := 0, false
+	for _, operand := range operands {
+		if !irIsConstant(*operand) {
+			dynamic++
+		}
+		effects = effects || !irIsSimple(*operand)
+	}
+	ordered := dynamic > 1 && effects
+	for _, operand := range operands {
+		value := irExpression(*operand)
+		if ordered && !irIsConstant(*operand) {
+			var temp string
+			setup, temp = irTemp(setup, operand.DataType, value)
+			value = temp
+		}
+		values = append(values, value)
+	}
+	return setup, values
+}
+
+// Appends to the setup code a new temporary holding the value.
+func irTemp(setup string, t TypeAnnotation, value string) (string, string) {
+	irTempCount++
+	temp := fmt.Sprintf("sowo_tmp_%d", irTempCount)
+	return setup + fmt.Sprintf("%s %s = %s;\n", irDataType(t), temp, value), temp
+}
+
+// Returns the expression running the setup code of irOperands before
+// the operation, in a statement expression like irTry.
+func irSequence(setup string, value string) string {
+	if setup == "" {
+		return value
+	}
+	return fmt.Sprintf("({\n%s%s;\n})", setup, value)
+}
+
+// Tells if the value of the expression never changes.
+func irIsConstant(ast Ast) bool {
+	switch ast.Type {
+	case AstNumberLiteral, AstFloatLiteral, AstBooleanLiteral, AstStringLiteral, AstCharLiteral, AstFuncRef:
+		return true
+	}
+	return false
+}
+
+// Tells if evaluating the expression has no effects: it can't change
+// variables, print or stop the program.
+func irIsSimple(ast Ast) bool {
+	switch ast.Type {
+	case AstVariableRef:
+		return true
+	case AstAddressOf:
+		return ast.Children[0].Type == AstVariableRef
+	}
+	return irIsConstant(ast)
+}
+
+// Emits an arithmetic operation between integers. Checked operations
+// stop the program on overflow and on division by zero, the unchecked
+// ones wrap around. In both cases the C code has no undefined behaviour
+// on overflow.
+func irIntegerOperation(ast Ast) string {
+	var op string
+	switch ast.Operator {
+	case OpPlus:
+		op = "add"
+	case OpMinus:
+		op = "sub"
+	case OpTimes:
+		op = "mul"
+	case OpDivide:
+		op = "div"
+	default:
+		log.Fatalf("[Frontend]: Unsupported integer operator %s", ast.Operator)
+	}
+	setup, operands := irOperands(ast.Children[0], ast.Children[1])
+	name := irTypeName(ast.Children[0].DataType)
+	if !irChecked {
+		return irSequence(setup, fmt.Sprintf("sowo_wrap_%s_%s(%s, %s)", op, name, operands[0], operands[1]))
+	}
+	return irSequence(setup, fmt.Sprintf("sowo_checked_%s_%s(%s, %s, %s)", op, name, operands[0], operands[1], irLocation(ast)))
+}
+
+// Returns the C name of a module level symbol, symbols are prefixed
+// with the name of their module so that the symbols of different
+// modules (or of the C library) never clash.
+func irSymbolName(module string, name string) string {
+	_, member := splitQualifiedName(name)
+	if module == "" {
+		return member
+	}
+	return module + "__" + member
+}
+
+// Returns the storage class of a top level definition, definitions
+// that are not public can only be used in their module.
+func irStorageClass(ast Ast) string {
+	if ast.Public {
+		return ""
+	}
+	return "static "
+}
+
+func irFunctionSignature(ast Ast) (value string) {
 	returnType := irType(*ast.Children[1].Children[0])
-	value += fmt.Sprintf("%s %s(", returnType, ast.Name)
+	value += irStorageClass(ast)
+	value += fmt.Sprintf("%s %s(", returnType, irSymbolName(ast.Module, ast.Name))
 	value += irFuncParam(*ast.Children[0])
-	value += ") {\n"
+	value += ")"
+	return value
+}
+
+func irFunction(ast Ast) (value string) {
+	defer irStartBody(*ast.Children[2])()
+	value += irFunctionSignature(ast)
+	value += " {\n"
+	value += irBoxParams(*ast.Children[0])
 	value += irBody(*ast.Children[2])
 	value += "}\n"
 	return value
 }
 
+// Local variables of the function being emitted whose address is taken,
+// they are stored in cells allocated by the runtime so that the pointers
+// to them stay valid once the function returns.
+var irBoxed map[string]bool
+
+// Finds the local variables whose address is taken in the body of a
+// function, function literals are emitted as functions of their own.
+func irAddressTaken(ast *Ast, boxed map[string]bool) {
+	if ast.Type == AstAddressOf && ast.Children[0].Type == AstVariableRef && ast.Children[0].Module == "" {
+		boxed[ast.Children[0].Name] = true
+	}
+	if ast.Type == AstFuncLiteral {
+		return
+	}
+	for _, child := range ast.Children {
+		irAddressTaken(child, boxed)
+	}
+}
+
+// Starts emitting the body of a function, returns the function
+// restoring the state of the enclosing one.
+func irStartBody(body Ast) func() {
+	enclosing := irBoxed
+	irBoxed = map[string]bool{}
+	irAddressTaken(&body, irBoxed)
+	return func() { irBoxed = enclosing }
+}
+
 func irFuncParam(ast Ast) (value string) {
 	for i, arg := range ast.Children {
-		value += irVariable(*arg)
+		if irBoxed[arg.Name] {
+			// Copied to a cell by irBoxParams
+			value += fmt.Sprintf("%s sowo_arg_%s", irType(*arg.Children[0]), arg.Name)
+		} else {
+			value += irVariable(*arg)
+		}
 		if i != len(ast.Children)-1 {
 			value += ", "
 		}
@@ -35,8 +238,39 @@ func irFuncParam(ast Ast) (value string) {
 	return value
 }
 
+// Copies the params whose address is taken to their cells.
+func irBoxParams(ast Ast) (value string) {
+	for _, arg := range ast.Children {
+		if irBoxed[arg.Name] {
+			value += irLocalVariable(*arg, "sowo_arg_"+arg.Name)
+		}
+	}
+	return value
+}
+
+// Declares a local variable with its initial value.
+func irLocalVariable(ast Ast, initValue string) string {
+	if irBoxed[ast.Name] {
+		t := irType(*ast.Children[0])
+		return fmt.Sprintf("%s *%s = sowo_alloc(sizeof(%s));\n*%s = %s;\n", t, ast.Name, t, ast.Name, initValue)
+	}
+	return fmt.Sprintf("%s = %s;\n", irVariable(ast), initValue)
+}
+
+// Returns the C expression of a variable, a local or a global.
+func irVariableRef(module string, name string) string {
+	if module == "" && irBoxed[name] {
+		return "(*" + name + ")"
+	}
+	return irSymbolName(module, name)
+}
+
 func irType(ast Ast) (value string) {
-	switch ast.DataType {
+	return irDataType(ast.DataType)
+}
+
+func irDataType(t TypeAnnotation) (value string) {
+	switch t {
 	case TypeVoid:
 		value = "void"
 	case TypeBoolean:
@@ -45,8 +279,86 @@ func irType(ast Ast) (value string) {
 		value = "int"
 	case TypeString:
 		value = "char*"
+	case TypeI8:
+		value = "int8_t"
+	case TypeI16:
+		value = "int16_t"
+	case TypeI32:
+		value = "int32_t"
+	case TypeI64:
+		value = "int64_t"
+	case TypeU8:
+		value = "uint8_t"
+	case TypeU16:
+		value = "uint16_t"
+	case TypeU32:
+		value = "uint32_t"
+	case TypeU64:
+		value = "uint64_t"
+	case TypeF32:
+		value = "float"
+	case TypeF64:
+		value = "double"
+	case TypeChar:
+		value = "char"
 	default:
-		log.Fatalf("[Frontend]: Unsupported type %s", ast.Type)
+		if isPointerType(t) {
+			value = irDataType(pointerElem(t)) + "*"
+		} else if isSliceType(t) {
+			value = "sowo_slice"
+		} else if isFuncType(t) {
+			value = "sowo_closure"
+		} else if isInterfaceType(t) {
+			value = "sowo_interface"
+		} else if isResultType(t) {
+			value = "sowo_" + irTypeName(t)
+		} else {
+			log.Fatalf("[Frontend]: Unsupported type %s", t)
+		}
+	}
+	return value
+}
+
+// Escapes a byte so it can be placed inside a C literal
+// delimited by the quote character.
+func irEscapeByte(b byte, quote byte) string {
+	switch {
+	case b == quote || b == '\\':
+		return "\\" + string(b)
+	case b == '\n':
+		return "\\n"
+	case b == '\t':
+		return "\\t"
+	case b == '\r':
+		return "\\r"
+	case b >= ' ' && b <= '~':
+		return string(b)
+	default:
+		// Octal escapes are always three digits, so a following
+		// digit is never read as part of the escape
+		return fmt.Sprintf("\\%03o", b)
+	}
+}
+
+func irStringLiteral(s string) string {
+	var value strings.Builder
+	value.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		value.WriteString(irEscapeByte(s[i], '"'))
+	}
+	value.WriteByte('"')
+	return value.String()
+}
+
+func irCharLiteral(c byte) string {
+	return "'" + irEscapeByte(c, '\'') + "'"
+}
+
+// Formats a float literal so that C never reads it as an integer.
+func irFloatLiteral(f float64) string {
+	value := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(value, ".eEn") {
+		value += ".0"
 	}
 	return value
 }
@@ -87,7 +399,13 @@ func irOperator(op BinaryOperator) string {
 func irExpression(ast Ast) (value string) {
 	switch ast.Type {
 	case AstNumberLiteral:
-		value += strconv.Itoa(ast.NumberDataValue)
+		if ast.DataType == TypeU64 {
+			value += strconv.FormatUint(uint64(ast.NumberDataValue), 10) + "ULL"
+		} else {
+			value += strconv.Itoa(ast.NumberDataValue)
+		}
+	case AstFloatLiteral:
+		value += irFloatLiteral(ast.FloatDataValue)
 	case AstBooleanLiteral:
 		if ast.BooleanDataValue {
 			value += "1"
@@ -95,77 +413,293 @@ func irExpression(ast Ast) (value string) {
 			value += "0"
 		}
 	case AstStringLiteral:
-		value += fmt.Sprintf("\"%s\"", ast.StringDataValue)
+		value += irStringLiteral(ast.StringDataValue)
+	case AstCharLiteral:
+		value += irCharLiteral(ast.CharDataValue)
 	case AstBinaryOp:
-		value += "("
-		value += irExpression(*ast.Children[0])
-		value += irOperator(ast.Operator)
-		value += irExpression(*ast.Children[1])
-		value += ")"
+		if ast.Children[0].DataType == TypeString {
+			value += irStringOperation(ast)
+			break
+		}
+		if isIntegerType(ast.Children[0].DataType) && isArithmeticOperator(ast.Operator) {
+			value += irIntegerOperation(ast)
+			break
+		}
+		setup, operands := irOperands(ast.Children[0], ast.Children[1])
+		value += irSequence(setup, "("+operands[0]+irOperator(ast.Operator)+operands[1]+")")
 	case AstVariableRef:
-		value += ast.Name
+		value += irVariableRef(ast.Module, ast.Name)
 	case AstFuncCall:
 		value += irFuncCall(ast)
+	case AstFuncRef:
+		value += irFuncRef(ast)
+	case AstFuncLiteral:
+		value += irFuncLiteral(ast)
+	case AstClosureCall:
+		value += irClosureCall(ast)
+	case AstMethodCall:
+		value += irMethodCall(ast)
+	case AstInterfaceValue:
+		value += irInterfaceValue(ast)
+	case AstResultOk, AstResultErr:
+		value += irResultValue(ast)
+	case AstTry:
+		value += irTry(ast)
+	case AstConversion:
+		value += irConversion(ast)
+	case AstNew:
+		allocType := ast.Children[0].DataType
+		if allocType == TypeString {
+			value += "sowo_new_str()"
+		} else {
+			value += fmt.Sprintf("((%s*)sowo_alloc(sizeof(%s)))", irDataType(allocType), irDataType(allocType))
+		}
+	case AstAddressOf:
+		value += fmt.Sprintf("(&%s)", irExpression(*ast.Children[0]))
+	case AstDereference:
+		value += fmt.Sprintf("(*%s)", irExpression(*ast.Children[0]))
+	case AstIndex:
+		setup, operands := irOperands(ast.Children[0], ast.Children[1])
+		if isSliceType(ast.Children[0].DataType) {
+			elemType := irDataType(ast.DataType)
+			value += irSequence(setup, fmt.Sprintf("(*(%s*)sowo_slice_at(%s, %s, sizeof(%s), %s))",
+				elemType, operands[0], operands[1], elemType, irLocation(ast)))
+		} else {
+			value += irSequence(setup, fmt.Sprintf("sowo_str_index(%s, %s, %s)", operands[0], operands[1], irLocation(ast)))
+		}
+	case AstSlice:
+		bounds := []*Ast{ast.Children[0]}
+		for _, bound := range ast.Children[1:] {
+			if bound.Type != AstNoop {
+				bounds = append(bounds, bound)
+			}
+		}
+		setup, operands := irOperands(bounds...)
+		from := "0"
+		if ast.Children[1].Type != AstNoop {
+			from = operands[1]
+		}
+		if ast.Children[2].Type == AstNoop {
+			value += irSequence(setup, fmt.Sprintf("sowo_str_suffix(%s, %s, %s)", operands[0], from, irLocation(ast)))
+		} else {
+			to := operands[len(operands)-1]
+			value += irSequence(setup, fmt.Sprintf("sowo_str_slice(%s, %s, %s, %s)", operands[0], from, to, irLocation(ast)))
+		}
 	default:
 		log.Fatalf("[Frontend]: Unsupported expression %s", ast.Type)
 	}
 	return value
 }
 
-func irFuncCall(ast Ast) (value string) {
-	value += fmt.Sprintf("%s(", ast.Name)
-	for i, param := range ast.Children {
-		value += irExpression(*param)
-		if i != len(ast.Children)-1 {
-			value += ", "
-		}
+// Emits a binary operation between strings as a call to the runtime.
+func irStringOperation(ast Ast) string {
+	setup, operands := irOperands(ast.Children[0], ast.Children[1])
+	switch ast.Operator {
+	case OpPlus:
+		return irSequence(setup, fmt.Sprintf("sowo_str_concat(%s, %s)", operands[0], operands[1]))
+	case OpEquals:
+		return irSequence(setup, fmt.Sprintf("sowo_str_equals(%s, %s)", operands[0], operands[1]))
+	default:
+		log.Fatalf("[Frontend]: Unsupported string operator %s", ast.Operator)
+	}
+	return ""
+}
+
+func irConversion(ast Ast) string {
+	from := ast.Children[0].DataType
+	expr := irExpression(*ast.Children[0])
+	switch {
+	case ast.DataType == TypeString && from == TypeChar:
+		return fmt.Sprintf("sowo_char_to_str(%s)", expr)
+	case ast.DataType == TypeString && (from == TypeU64 || from == TypeU32):
+		return fmt.Sprintf("sowo_uint_to_str(%s)", expr)
+	case ast.DataType == TypeString && from != TypeString:
+		return fmt.Sprintf("sowo_int_to_str(%s)", expr)
+	case from == TypeString && ast.DataType != TypeString:
+		return fmt.Sprintf("((%s)sowo_str_to_int(%s, %s))", irDataType(ast.DataType), expr, irLocation(ast))
+	case isFloatType(from) && isSignedType(ast.DataType):
+		return fmt.Sprintf("((%s)sowo_float_to_int(%s, %d, %s))", irDataType(ast.DataType), expr, llvmBits(ast.DataType), irLocation(ast))
+	case isFloatType(from) && isIntegerType(ast.DataType):
+		return fmt.Sprintf("((%s)sowo_float_to_uint(%s, %d, %s))", irDataType(ast.DataType), expr, llvmBits(ast.DataType), irLocation(ast))
+	}
+	return fmt.Sprintf("((%s)%s)", irDataType(ast.DataType), expr)
+}
+
+// A generic function instantiated with concrete types.
+type genericInstance struct {
+	funcDef  *Ast
+	typeArgs []TypeAnnotation
+	name     string
+}
+
+// Generic functions of the program by C name and the instances used by
+// the code emitted so far, the instances are emitted after the other
+// functions since emitting an instance may require new ones.
+var genericFuncs map[string]*Ast
+var genericInstances map[string]bool
+var pendingInstances []genericInstance
+
+// Returns the suffix appended to the C name of the instance
+// of a generic function (e.g. `max__int` for `max[int]`).
+func irTypeArgsSuffix(typeArgs []TypeAnnotation) (value string) {
+	for _, t := range typeArgs {
+		value += "__" + irTypeName(t)
 	}
-	value += ")"
 	return value
 }
 
+// Returns a name for the type that can be used in a C identifier.
+func irTypeName(t TypeAnnotation) string {
+	switch {
+	case isPointerType(t):
+		return "ptr_" + irTypeName(pointerElem(t))
+	case isSliceType(t):
+		return "slice_" + irTypeName(sliceElem(t))
+	case isInterfaceType(t):
+		return "iface_" + strings.ReplaceAll(t.String(), ".", "__")
+	case isResultType(t):
+		valueType, errorType := resultTypes(t)
+		return "result_" + irTypeName(valueType) + "_or_" + irTypeName(errorType)
+	case isFuncType(t):
+		params, returnType := funcTypeSignature(t)
+		name := "fn"
+		for _, param := range params {
+			name += "_" + irTypeName(param)
+		}
+		return name + "_to_" + irTypeName(returnType)
+	}
+	return strings.ToLower(t.String())
+}
+
+// Returns the C name of the instance of a generic function
+// called with given type arguments, requesting it to be emitted.
+func irGenericInstanceName(ast Ast) string {
+	genericName := irSymbolName(ast.Module, ast.Name)
+	_, member := splitQualifiedName(ast.Name)
+	instance := genericInstance{
+		funcDef:  genericFuncs[genericName],
+		typeArgs: ast.TypeArgs,
+		name:     member + irTypeArgsSuffix(ast.TypeArgs),
+	}
+	if instance.funcDef == nil {
+		log.Fatalf("[Frontend]: Unknown generic function %s", ast.Name)
+	}
+	name := irSymbolName(ast.Module, instance.name)
+	if !genericInstances[name] {
+		genericInstances[name] = true
+		pendingInstances = append(pendingInstances, instance)
+	}
+	return name
+}
+
+// Emits a generic function with the type parameters replaced by the
+// type arguments, instances are private to the C translation unit.
+func irGenericInstance(instance genericInstance, frontend *CFrontend) {
+	bindings := map[TypeAnnotation]TypeAnnotation{}
+	for i, typeParam := range funcTypeParams(instance.funcDef) {
+		bindings[typeParam] = instance.typeArgs[i]
+	}
+	funcDef := substituteAst(instance.funcDef, bindings)
+	irSourceFile = irSourceFiles[funcDef.Module]
+	funcDef.Name = instance.name
+	funcDef.Public = false
+	funcDef.Children = funcDef.Children[:3]
+	frontend.Prototypes = append(frontend.Prototypes, irFunctionSignature(*funcDef)+";\n")
+	frontend.Functions = append(frontend.Functions, irFunction(*funcDef))
+}
+
+func irFuncCall(ast Ast) string {
+	name := irSymbolName(ast.Module, ast.Name)
+	located := false
+	if len(ast.TypeArgs) > 0 {
+		name = irGenericInstanceName(ast)
+	}
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, arg.DataType)
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[Frontend]: %s", err)
+		}
+		name = builtin.CName
+		located = builtin.Located
+	}
+	setup, args := irOperands(ast.Children...)
+	if located {
+		args = append(args, irLocation(ast))
+	}
+	return irSequence(setup, fmt.Sprintf("%s(%s)", name, strings.Join(args, ", ")))
+}
+
+// Returns the printf placeholder of a value of given type,
+// and the expression converted to the type of the placeholder.
+func irPrintFormat(t TypeAnnotation, expr string) (string, string) {
+	switch t {
+	case TypeInteger, TypeBoolean:
+		return "%d", expr
+	case TypeI8, TypeI16, TypeI32, TypeI64:
+		return "%lld", fmt.Sprintf("(long long)%s", expr)
+	case TypeU8, TypeU16, TypeU32, TypeU64:
+		return "%llu", fmt.Sprintf("(unsigned long long)%s", expr)
+	case TypeF32, TypeF64:
+		return "%g", expr
+	case TypeChar:
+		return "%c", expr
+	case TypeString:
+		return "%s", expr
+	default:
+		log.Fatalf("[Frontend]: Unsupported parameter %s", t)
+	}
+	return "", ""
+}
+
 func irPrint(ast Ast) (value string) {
 	var placeholders []string
 	var valueStrings []string
-	for _, param := range ast.Children {
-		paramType := param.DataType
-		switch paramType {
-		case TypeInteger, TypeBoolean:
-			placeholders = append(placeholders, "%d")
-			valueStrings = append(valueStrings, irExpression(*param))
-		case TypeString:
-			placeholders = append(placeholders, "%s")
-			valueStrings = append(valueStrings, irExpression(*param))
-		default:
-			log.Fatalf("[Frontend]: Unsupported parameter %s", paramType)
-		}
+	setup, values := irOperands(ast.Children...)
+	for i, param := range ast.Children {
+		placeholder, valueString := irPrintFormat(param.DataType, values[i])
+		placeholders = append(placeholders, placeholder)
+		valueStrings = append(valueStrings, valueString)
 	}
 	placeholders = append(placeholders, "%s")
 	valueStrings = append(valueStrings, "\"\\n\"")
-	value += fmt.Sprintf("printf(\"%s\", %s);\n",
+	value += fmt.Sprintf("printf(\"%s\", %s)",
 		strings.Join(placeholders[:], " "),
 		strings.Join(valueStrings[:], ","))
-	return value
+	return irSequence(setup, value) + ";\n"
 }
 
 func irBody(ast Ast) (value string) {
 	for _, statement := range ast.Children {
 		switch statement.Type {
 		case AstLocalVariable:
-			value += fmt.Sprintf("%s = %s;\n", irVariable(*statement.Children[0]), irExpression(*statement.Children[1]))
+			value += irLocalVariable(*statement.Children[0], irExpression(*statement.Children[1]))
 		case AstAssignment:
-			value += fmt.Sprintf("%s = %s;\n", statement.Name, irExpression(*statement.Children[0]))
+			value += fmt.Sprintf("%s = %s;\n", irVariableRef(statement.Module, statement.Name), irExpression(*statement.Children[0]))
+		case AstDerefAssignment:
+			setup, operands := irOperands(statement.Children[0], statement.Children[1])
+			value += irSequence(setup, fmt.Sprintf("*%s = %s", operands[0], operands[1])) + ";\n"
 		case AstIf:
-			value += fmt.Sprintf("if %s {\n%s}\n", irExpression(*statement.Children[0]), irBody(*statement.Children[1]))
+			value += fmt.Sprintf("if (%s) {\n%s}\n", irExpression(*statement.Children[0]), irBody(*statement.Children[1]))
 			if len(statement.Children) == 3 {
 				value += fmt.Sprintf("else {\n%s}\n", irBody(*statement.Children[2]))
 			}
 		case AstWhile:
-			value += fmt.Sprintf("while %s {\n%s}\n", irExpression(*statement.Children[0]), irBody(*statement.Children[1]))
+			value += fmt.Sprintf("while (%s) {\n%s}\n", irExpression(*statement.Children[0]), irBody(*statement.Children[1]))
 		case AstReturn:
 			value += fmt.Sprintf("return %s;\n", irExpression(*statement.Children[0]))
 		case AstFuncCall:
 			value += fmt.Sprintf("%s;\n", irFuncCall(*statement))
+		case AstClosureCall:
+			value += fmt.Sprintf("%s;\n", irClosureCall(*statement))
+		case AstMethodCall:
+			value += fmt.Sprintf("%s;\n", irMethodCall(*statement))
+		case AstTry:
+			value += fmt.Sprintf("%s;\n", irTry(*statement))
 		case AstPrint:
 			value += irPrint(*statement)
 		default:
@@ -175,6 +709,53 @@ func irBody(ast Ast) (value string) {
 	return value
 }
 
+// Emits a global variable, every global starts with the zero value of
+// its type and gets its initial value in the globals init function, in
+// declaration order.
+func irGlobal(ast Ast, frontend *CFrontend) {
+	varType := ast.Children[0].Children[0].DataType
+	name := irSymbolName(ast.Module, ast.Name)
+	zero := ""
+	if varType == TypeString {
+		zero = " = \"\""
+	}
+	frontend.Globals = append(frontend.Globals, fmt.Sprintf("%s%s %s%s;\n", irStorageClass(ast), irDataType(varType), name, zero))
+	frontend.GlobalsInit += fmt.Sprintf("%s = %s;\n", name, irExpression(*ast.Children[1]))
+
+	// Globals holding references must be scanned by the collector
+	if holdsReference(varType) {
+		frontend.GlobalsInit += fmt.Sprintf("sowo_gc_add_root(&%s, sizeof(%s));\n", name, name)
+	}
+}
+
+// Emits the declaration of a C function, functions declared in a
+// header only need the header to be included. Local headers (starting
+// with `.` or `/`) are included with quotes, the others with brackets.
+func irExternFunction(ast Ast, frontend *CFrontend) {
+	header := ast.StringDataValue
+	if header != "" {
+		if strings.HasPrefix(header, ".") || strings.HasPrefix(header, "/") {
+			header = fmt.Sprintf("\"%s\"", header)
+		} else {
+			header = fmt.Sprintf("<%s>", header)
+		}
+		for _, i := range frontend.Imports {
+			if i == header {
+				return
+			}
+		}
+		frontend.Imports = append(frontend.Imports, header)
+		return
+	}
+
+	params := irFuncParam(*ast.Children[0])
+	if params == "" {
+		params = "void"
+	}
+	frontend.Prototypes = append(frontend.Prototypes,
+		fmt.Sprintf("%s %s(%s);\n", irType(*ast.Children[1].Children[0]), ast.Name, params))
+}
+
 func irImports(imports []string) (value string) {
 	for _, i := range imports {
 		value += fmt.Sprintf("#include %s\n", i)
@@ -182,35 +763,141 @@ func irImports(imports []string) (value string) {
 	return value
 }
 
-func generateIR(ast Ast) (value string) {
+// Returns the defines selecting the runtime features.
+func irRuntimeDefines(options CompilerOptions) (value string) {
+	if options.GC == GCMarkSweep {
+		value += "#define SOWO_GC_MARKSWEEP\n"
+	}
+	if options.GCDebug {
+		value += "#define SOWO_GC_DEBUG\n"
+	}
+	if options.Unchecked {
+		value += "#define SOWO_UNCHECKED\n"
+	}
+	return value
+}
+
+// Generates C code, built into executables by the C compiler.
+type cBackend struct{}
+
+func (cBackend) Name() string      { return "c" }
+func (cBackend) Extension() string { return ".c" }
+
+func (cBackend) Emit(program Ast, options CompilerOptions) ([]byte, error) {
+	return []byte(generateIR(program, options)), nil
+}
+
+func (cBackend) BuildExecutable(sourceFile string, exeFile string, options CompilerOptions) error {
+	return compileC([]string{sourceFile}, exeFile, options)
+}
+
+// Returns the runtime library as a C file of its own, linked with
+// the programs compiled to assembly.
+func irRuntimeLibrary(options CompilerOptions) string {
+	imports := append([]string{"<stdio.h>", "<stdint.h>"}, cRuntimeImports...)
+	return irImports(imports) + irRuntimeDefines(options) + cRuntime
+}
+
+func generateIR(ast Ast, options CompilerOptions) (value string) {
 	frontend := CFrontend{}
-	frontend.Imports = append(frontend.Imports, "<stdio.h>")
-	switch ast.Type {
-	case AstModule:
-		for _, child := range ast.Children {
-			if child.Type != AstFunction {
-				log.Fatalf("[Frontend]: Unexpected '%s' in module!", child.Type)
+	genericFuncs = map[string]*Ast{}
+	genericInstances = map[string]bool{}
+	pendingInstances = nil
+	closurePrototypes = nil
+	closureFunctions = nil
+	closureCount = 0
+	funcRefWrappers = map[string]bool{}
+	vtables = map[string]string{}
+	tryCount = 0
+	irChecked = !options.Unchecked
+	irSourceFiles = map[string]string{}
+	if ast.Type == AstProgram {
+		for _, module := range ast.Children {
+			irSourceFiles[module.Name] = module.StringDataValue
+			for _, child := range module.Children {
+				if funcTypeParams(child) != nil {
+					genericFuncs[irSymbolName(child.Module, child.Name)] = child
+				}
 			}
-			if child.Name == "main" {
-				frontend.MainFunction = irMain(*child)
-			} else {
-				frontend.Functions = append(frontend.Functions, irFunction(*child))
+		}
+	}
+	frontend.Imports = append(frontend.Imports, "<stdio.h>", "<stdint.h>")
+	frontend.Imports = append(frontend.Imports, cRuntimeImports...)
+	switch ast.Type {
+	case AstProgram:
+		// The main module is the last one, its main function is the entry point
+		entryModule := ast.Children[len(ast.Children)-1]
+		for _, module := range ast.Children {
+			irSourceFile = module.StringDataValue
+			for _, child := range module.Children {
+				switch child.Type {
+				case AstGlobalVariable, AstGlobalConstant:
+					irGlobal(*child, &frontend)
+				case AstFunction:
+					if funcTypeParams(child) != nil {
+						// Emitted only when instantiated
+						continue
+					}
+					if module == entryModule && child.Name == "main" {
+						frontend.MainFunction = irMain(*child)
+					} else {
+						frontend.Prototypes = append(frontend.Prototypes, irFunctionSignature(*child)+";\n")
+						frontend.Functions = append(frontend.Functions, irFunction(*child))
+					}
+				case AstMethod:
+					method := *child
+					method.Name = irTypeName(methodReceiverType(child)) + "__" + child.Name
+					frontend.Prototypes = append(frontend.Prototypes, irFunctionSignature(method)+";\n")
+					frontend.Functions = append(frontend.Functions, irFunction(method))
+				case AstInterface:
+					irInterface(*child, &frontend)
+				case AstExternFunction:
+					irExternFunction(*child, &frontend)
+				case AstImport:
+				default:
+					log.Fatalf("[Frontend]: Unexpected '%s' in module!", child.Type)
+				}
 			}
 		}
 	default:
 		log.Fatalf("[Frontend]: Unsupported top level %s", ast.Type)
 	}
+	for len(pendingInstances) > 0 {
+		instance := pendingInstances[0]
+		pendingInstances = pendingInstances[1:]
+		irGenericInstance(instance, &frontend)
+	}
+	frontend.Prototypes = append(frontend.Prototypes, closurePrototypes...)
+	frontend.Functions = append(frontend.Functions, closureFunctions...)
+	// Emitted last since instantiating generic functions creates new types
+	frontend.Types = append(irResultTypes(), frontend.Types...)
 
 	value += irImports(frontend.Imports)
+	value += irRuntimeDefines(options)
+	value += cRuntime
+	for _, t := range frontend.Types {
+		value += t
+	}
+	for _, g := range frontend.Globals {
+		value += g
+	}
+	for _, p := range frontend.Prototypes {
+		value += p
+	}
 	for _, f := range frontend.Functions {
 		value += f
 	}
+	value += fmt.Sprintf("void sowo_init_globals(void) {\n%s}\n", frontend.GlobalsInit)
 	value += frontend.MainFunction
 	return value
 }
 
 type CFrontend struct {
 	Imports      []string
+	Types        []string
+	Globals      []string
+	GlobalsInit  string
+	Prototypes   []string
 	MainFunction string
 	Functions    []string
 }
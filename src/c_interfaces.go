@@ -0,0 +1,131 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Interface values are emitted as a sowo_interface, made of a pointer
+// to a copy of the value and of a pointer to the vtable of its type.
+// The vtable of an interface is a struct with a function pointer per
+// method, taking the pointer to the value as first argument.
+
+// Vtables emitted so far by their content.
+var vtables map[string]string
+
+// Returns the C name of a method, methods are prefixed
+// with their receiver type (e.g. `main__string__shout`).
+func irMethodName(module string, receiverType TypeAnnotation, name string) string {
+	return irSymbolName(module, irTypeName(receiverType)+"__"+name)
+}
+
+// Returns the C function implementing a method of an interface,
+// it calls the method in the vtable of the interface value.
+func irInterfaceDispatchName(iface TypeAnnotation, method string) string {
+	return "sowo_call_" + irTypeName(iface) + "__" + method
+}
+
+func irVtableStruct(iface TypeAnnotation) string {
+	return "struct sowo_vtable_" + irTypeName(iface)
+}
+
+// Emits the vtable struct of an interface and the
+// functions calling its methods through a vtable.
+func irInterface(ast Ast, frontend *CFrontend) {
+	iface := ast.DataType
+	var fields string
+	for _, method := range interfaceMethods(iface) {
+		params, returnType := funcTypeSignature(method.Type)
+		cParams := []string{"void *"}
+		for _, param := range params {
+			cParams = append(cParams, irDataType(param))
+		}
+		fields += fmt.Sprintf("%s (*%s)(%s);\n", irDataType(returnType), method.Name, strings.Join(cParams, ", "))
+
+		cParams = []string{"sowo_interface self"}
+		args := []string{"self.data"}
+		for i, param := range params {
+			cParams = append(cParams, fmt.Sprintf("%s arg%d", irDataType(param), i))
+			args = append(args, fmt.Sprintf("arg%d", i))
+		}
+		signature := fmt.Sprintf("static %s %s(%s)", irDataType(returnType),
+			irInterfaceDispatchName(iface, method.Name), strings.Join(cParams, ", "))
+		call := fmt.Sprintf("((const %s *)self.vtable)->%s(%s)", irVtableStruct(iface), method.Name, strings.Join(args, ", "))
+		if returnType != TypeVoid {
+			call = "return " + call
+		}
+		frontend.Prototypes = append(frontend.Prototypes, signature+";\n")
+		frontend.Functions = append(frontend.Functions, fmt.Sprintf("%s {\n%s;\n}\n", signature, call))
+	}
+	if fields == "" {
+		// C structs can't be empty
+		fields = "char unused;\n"
+	}
+	frontend.Types = append(frontend.Types, fmt.Sprintf("%s {\n%s};\n", irVtableStruct(iface), fields))
+}
+
+// Returns the vtable of the type for the interface, the methods
+// are called through wrappers taking a pointer to the value.
+func irVtable(iface TypeAnnotation, valueType TypeAnnotation, methods []*Ast) string {
+	key := irTypeName(iface) + "/" + irTypeName(valueType)
+	for _, method := range methods {
+		key += "/" + irMethodName(method.Module, valueType, method.Name)
+	}
+	if name, ok := vtables[key]; ok {
+		return name
+	}
+	name := fmt.Sprintf("sowo_vtable_%d", len(vtables)+1)
+	vtables[key] = name
+
+	var wrappers []string
+	for i, required := range interfaceMethods(iface) {
+		params, returnType := funcTypeSignature(required.Type)
+		wrapper := fmt.Sprintf("%s__%s", name, required.Name)
+		cParams := []string{"void *self"}
+		args := []string{fmt.Sprintf("*(%s *)self", irDataType(valueType))}
+		for j, param := range params {
+			cParams = append(cParams, fmt.Sprintf("%s arg%d", irDataType(param), j))
+			args = append(args, fmt.Sprintf("arg%d", j))
+		}
+		signature := fmt.Sprintf("static %s %s(%s)", irDataType(returnType), wrapper, strings.Join(cParams, ", "))
+		call := fmt.Sprintf("%s(%s)", irMethodName(methods[i].Module, valueType, methods[i].Name), strings.Join(args, ", "))
+		if returnType != TypeVoid {
+			call = "return " + call
+		}
+		closurePrototypes = append(closurePrototypes, signature+";\n")
+		closureFunctions = append(closureFunctions, fmt.Sprintf("%s {\n%s;\n}\n", signature, call))
+		wrappers = append(wrappers, wrapper)
+	}
+	if len(wrappers) == 0 {
+		wrappers = append(wrappers, "0")
+	}
+	vtable := fmt.Sprintf("static const %s %s", irVtableStruct(iface), name)
+	closurePrototypes = append(closurePrototypes, vtable+";\n")
+	closureFunctions = append(closureFunctions, fmt.Sprintf("%s = {%s};\n", vtable, strings.Join(wrappers, ", ")))
+	return name
+}
+
+// Emits a value converted to an interface, the value is copied on the heap.
+func irInterfaceValue(ast Ast) string {
+	value := *ast.Children[0]
+	vtable := irVtable(ast.DataType, value.DataType, ast.Children[1:])
+	valueType := irDataType(value.DataType)
+	return fmt.Sprintf("((sowo_interface){sowo_box(&(%s){%s}, sizeof(%s)), &%s})",
+		valueType, irExpression(value), valueType, vtable)
+}
+
+// Emits a method call, calls on interfaces go through the vtable.
+func irMethodCall(ast Ast) (value string) {
+	receiverType := ast.Children[0].DataType
+	if isResultType(receiverType) {
+		return irResultMethodCall(ast)
+	}
+	if isInterfaceType(receiverType) {
+		value += irInterfaceDispatchName(receiverType, ast.Name) + "("
+	} else {
+		value += irMethodName(ast.Module, receiverType, ast.Name) + "("
+	}
+	setup, operands := irOperands(ast.Children...)
+	value += strings.Join(operands, ", ") + ")"
+	return irSequence(setup, value)
+}
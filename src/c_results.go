@@ -0,0 +1,115 @@
+package src
+
+import (
+	"fmt"
+)
+
+// Results are emitted as a struct per result type, holding a flag
+// telling if the result is ok, the value and the error.
+
+// Number of error propagations emitted so far, used to name the
+// temporaries holding the propagated results.
+var tryCount int
+
+// Returns true if the type has a C counterpart, the types used by
+// generic functions before being instantiated and the names of the
+// declared types before being resolved don't.
+func isEmittedType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	if !ok {
+		return true
+	}
+	switch c.Kind {
+	case KindTypeParam, KindNamed:
+		return false
+	case KindInterface:
+		return true
+	}
+	for _, param := range c.Params {
+		if !isEmittedType(param) {
+			return false
+		}
+	}
+	return isEmittedType(c.Elem)
+}
+
+// Emits the structs of the result types used by the program, with the
+// functions implementing their methods. Compound types are interned
+// after the types they are made of, so every struct is emitted after
+// the structs of its fields.
+func irResultTypes() (types []string) {
+	for i, c := range compoundTypes {
+		t := firstCompoundType + TypeAnnotation(i)
+		if c.Kind != KindResult || !isEmittedType(t) {
+			continue
+		}
+		name := irDataType(t)
+		valueType, errorType := resultTypes(t)
+		fields := "int ok;\n"
+		if valueType != TypeVoid {
+			fields += fmt.Sprintf("%s value;\n", irDataType(valueType))
+		}
+		fields += fmt.Sprintf("%s error;\n", irDataType(errorType))
+		value := fmt.Sprintf("typedef struct %s {\n%s} %s;\n", name, fields, name)
+
+		location := "const char *file, int line, int col"
+		valueCheck := "if (!r.ok) {\nsowo_panic(file, line, col, \"value of a failed result\");\n}\n"
+		if valueType == TypeVoid {
+			value += fmt.Sprintf("static inline void %s_value(%s r, %s) {\n%s}\n", name, name, location, valueCheck)
+		} else {
+			value += fmt.Sprintf("static inline %s %s_value(%s r, %s) {\n%sreturn r.value;\n}\n",
+				irDataType(valueType), name, name, location, valueCheck)
+			value += fmt.Sprintf("static inline %s %s_value_or(%s r, %s value) {\nreturn r.ok ? r.value : value;\n}\n",
+				irDataType(valueType), name, name, irDataType(valueType))
+		}
+		value += fmt.Sprintf("static inline %s %s_error(%s r, %s) {\n"+
+			"if (r.ok) {\nsowo_panic(file, line, col, \"error of a successful result\");\n}\nreturn r.error;\n}\n",
+			irDataType(errorType), name, name, location)
+		types = append(types, value)
+	}
+	return types
+}
+
+// Emits `ok(value)` and `err(error)`.
+func irResultValue(ast Ast) string {
+	name := irDataType(ast.DataType)
+	if ast.Type == AstResultErr {
+		return fmt.Sprintf("((%s){.ok = 0, .error = %s})", name, irExpression(*ast.Children[0]))
+	}
+	if len(ast.Children) == 0 {
+		return fmt.Sprintf("((%s){.ok = 1})", name)
+	}
+	return fmt.Sprintf("((%s){.ok = 1, .value = %s})", name, irExpression(*ast.Children[0]))
+}
+
+// Emits the propagation of the error of a result as a statement
+// expression, returning the error from the enclosing function. The
+// second child holds the result type returned by the function.
+func irTry(ast Ast) string {
+	tryCount++
+	result := fmt.Sprintf("sowo_try_%d", tryCount)
+	value := fmt.Sprintf("({\n%s %s = %s;\n", irDataType(ast.Children[0].DataType), result, irExpression(*ast.Children[0]))
+	value += fmt.Sprintf("if (!%s.ok) {\nreturn (%s){.ok = 0, .error = %s.error};\n}\n",
+		result, irDataType(ast.Children[1].DataType), result)
+	if ast.DataType == TypeVoid {
+		value += "(void)0;\n"
+	} else {
+		value += fmt.Sprintf("%s.value;\n", result)
+	}
+	return value + "})"
+}
+
+// Emits a call of a method of a result.
+func irResultMethodCall(ast Ast) string {
+	setup, operands := irOperands(ast.Children...)
+	receiver := operands[0]
+	switch ast.Name {
+	case "is_ok":
+		return fmt.Sprintf("(%s).ok", receiver)
+	case "is_err":
+		return fmt.Sprintf("(!(%s).ok)", receiver)
+	case "value_or":
+		return irSequence(setup, fmt.Sprintf("%s_value_or(%s, %s)", irDataType(ast.Children[0].DataType), receiver, operands[1]))
+	}
+	return fmt.Sprintf("%s_%s(%s, %s)", irDataType(ast.Children[0].DataType), ast.Name, receiver, irLocation(ast))
+}
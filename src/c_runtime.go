@@ -0,0 +1,527 @@
+package src
+
+// Headers needed by the runtime library.
+var cRuntimeImports = []string{"<stdlib.h>", "<string.h>", "<stdarg.h>", "<errno.h>", "<setjmp.h>", "<ctype.h>", "<limits.h>"}
+
+// C source of the runtime library emitted at the top of every
+// generated program.
+//
+// Every value allocated by the runtime is tracked in a list of blocks,
+// so the generated code never has to free memory by itself. By default
+// blocks are released only when the program exits; when SOWO_GC_MARKSWEEP
+// is defined a conservative mark-and-sweep collector frees the blocks that
+// are no longer reachable from the stack or from a registered root.
+// SOWO_GC_DEBUG prints allocation statistics and leaks at exit.
+//
+// The operations that can fail take the position in the sowo source of
+// the operation, reported by sowo_panic. When SOWO_UNCHECKED is defined
+// the checks are skipped and failures have undefined behaviour.
+const cRuntime = `
+void sowo_runtime_error(const char *format, ...) {
+    va_list args;
+    va_start(args, format);
+    fprintf(stderr, "Runtime error: ");
+    vfprintf(stderr, format, args);
+    fprintf(stderr, "\n");
+    va_end(args);
+    exit(1);
+}
+
+// Stops the program reporting the sowo operation that failed.
+void sowo_panic(const char *file, int line, int col, const char *format, ...) {
+    va_list args;
+    va_start(args, format);
+    fprintf(stderr, "%s:%d:%d: panic: ", file, line, col);
+    vfprintf(stderr, format, args);
+    fprintf(stderr, "\n");
+    va_end(args);
+    exit(1);
+}
+
+// Integer arithmetic never has undefined behaviour. The checked
+// operations stop the program when the result doesn't fit in the type,
+// the wrapping ones (used when SOWO_UNCHECKED is defined) return the
+// result modulo 2^bits computing it on unsigned values.
+// MIN is the minimum value of the type T, U is an unsigned type at
+// least as large as T.
+#define SOWO_INTEGER_OPS(name, T, U, MIN) \
+static inline T sowo_wrap_add_##name(T a, T b) { return (T)((U)a + (U)b); } \
+static inline T sowo_wrap_sub_##name(T a, T b) { return (T)((U)a - (U)b); } \
+static inline T sowo_wrap_mul_##name(T a, T b) { return (T)((U)a * (U)b); } \
+static inline T sowo_wrap_div_##name(T a, T b) { \
+    /* The minimum signed value divided by -1 doesn't fit */ \
+    if (MIN != 0 && b == (T)-1) return (T)(0 - (U)a); \
+    return a / b; \
+} \
+static inline T sowo_checked_add_##name(T a, T b, const char *file, int line, int col) { \
+    T result; \
+    if (__builtin_add_overflow(a, b, &result)) sowo_panic(file, line, col, "integer overflow in addition"); \
+    return result; \
+} \
+static inline T sowo_checked_sub_##name(T a, T b, const char *file, int line, int col) { \
+    T result; \
+    if (__builtin_sub_overflow(a, b, &result)) sowo_panic(file, line, col, "integer overflow in subtraction"); \
+    return result; \
+} \
+static inline T sowo_checked_mul_##name(T a, T b, const char *file, int line, int col) { \
+    T result; \
+    if (__builtin_mul_overflow(a, b, &result)) sowo_panic(file, line, col, "integer overflow in multiplication"); \
+    return result; \
+} \
+static inline T sowo_checked_div_##name(T a, T b, const char *file, int line, int col) { \
+    if (b == 0) sowo_panic(file, line, col, "integer division by zero"); \
+    if (MIN != 0 && b == (T)-1 && a == MIN) { \
+        sowo_panic(file, line, col, "integer overflow in division"); \
+    } \
+    return a / b; \
+}
+
+SOWO_INTEGER_OPS(integer, int, unsigned int, INT_MIN)
+SOWO_INTEGER_OPS(i8, int8_t, unsigned int, INT8_MIN)
+SOWO_INTEGER_OPS(i16, int16_t, unsigned int, INT16_MIN)
+SOWO_INTEGER_OPS(i32, int32_t, uint32_t, INT32_MIN)
+SOWO_INTEGER_OPS(i64, int64_t, uint64_t, INT64_MIN)
+SOWO_INTEGER_OPS(u8, uint8_t, unsigned int, 0)
+SOWO_INTEGER_OPS(u16, uint16_t, unsigned int, 0)
+SOWO_INTEGER_OPS(u32, uint32_t, uint32_t, 0)
+SOWO_INTEGER_OPS(u64, uint64_t, uint64_t, 0)
+
+typedef union sowo_block {
+    struct {
+        union sowo_block *next;
+        size_t size;
+        int marked;
+    } header;
+    long double align;
+} sowo_block;
+
+typedef struct sowo_slice {
+    long long len;
+    void *data;
+} sowo_slice;
+
+// A function value, fn is called with env as first argument.
+typedef struct sowo_closure {
+    void (*fn)(void);
+    void *env;
+} sowo_closure;
+
+// A value converted to an interface, vtable points to the
+// methods implementing the interface for the type of the value.
+typedef struct sowo_interface {
+    void *data;
+    const void *vtable;
+} sowo_interface;
+
+typedef struct sowo_root {
+    void *start;
+    size_t size;
+} sowo_root;
+
+static sowo_block *sowo_blocks = NULL;
+static size_t sowo_block_count = 0;
+static size_t sowo_allocated_bytes = 0;
+static size_t sowo_total_allocations = 0;
+static void *sowo_stack_bottom = NULL;
+static sowo_root *sowo_roots = NULL;
+static size_t sowo_root_count = 0;
+
+// Registers a memory area (e.g. a global variable) that may contain
+// pointers to blocks.
+void sowo_gc_add_root(void *start, size_t size) {
+    sowo_roots = realloc(sowo_roots, (sowo_root_count + 1) * sizeof(sowo_root));
+    if (sowo_roots == NULL) {
+        sowo_runtime_error("out of memory");
+    }
+    sowo_roots[sowo_root_count].start = start;
+    sowo_roots[sowo_root_count].size = size;
+    sowo_root_count++;
+}
+
+#ifdef SOWO_GC_MARKSWEEP
+static size_t sowo_collections = 0;
+static size_t sowo_freed_blocks = 0;
+static size_t sowo_next_collection = 1 << 20;
+static sowo_block **sowo_sorted_blocks = NULL;
+static sowo_block **sowo_mark_stack = NULL;
+static size_t sowo_mark_stack_size = 0;
+
+static int sowo_compare_blocks(const void *a, const void *b) {
+    uintptr_t x = (uintptr_t)*(sowo_block *const *)a;
+    uintptr_t y = (uintptr_t)*(sowo_block *const *)b;
+    return (x > y) - (x < y);
+}
+
+// Returns the block containing the address, if any.
+static sowo_block *sowo_find_block(uintptr_t address) {
+    size_t low = 0;
+    size_t high = sowo_block_count;
+    while (low < high) {
+        size_t mid = low + (high - low) / 2;
+        sowo_block *block = sowo_sorted_blocks[mid];
+        uintptr_t start = (uintptr_t)(block + 1);
+        if (address < start) {
+            high = mid;
+        } else if (address >= start + block->header.size) {
+            low = mid + 1;
+        } else {
+            return block;
+        }
+    }
+    return NULL;
+}
+
+// Marks every block pointed by a word in the memory area.
+static void sowo_mark_area(void *start, void *end) {
+    uintptr_t from = ((uintptr_t)start + sizeof(void *) - 1) & ~(uintptr_t)(sizeof(void *) - 1);
+    for (uintptr_t p = from; p + sizeof(void *) <= (uintptr_t)end; p += sizeof(void *)) {
+        sowo_block *block = sowo_find_block(*(uintptr_t *)p);
+        if (block != NULL && !block->header.marked) {
+            block->header.marked = 1;
+            sowo_mark_stack[sowo_mark_stack_size++] = block;
+        }
+    }
+}
+
+static void sowo_mark_reachable(void) {
+    while (sowo_mark_stack_size > 0) {
+        sowo_block *block = sowo_mark_stack[--sowo_mark_stack_size];
+        sowo_mark_area(block + 1, (char *)(block + 1) + block->header.size);
+    }
+}
+
+static void sowo_sweep(void) {
+    sowo_block **link = &sowo_blocks;
+    while (*link != NULL) {
+        sowo_block *block = *link;
+        if (block->header.marked) {
+            block->header.marked = 0;
+            link = &block->header.next;
+        } else {
+            *link = block->header.next;
+            sowo_allocated_bytes -= block->header.size;
+            sowo_block_count--;
+            sowo_freed_blocks++;
+            free(block);
+        }
+    }
+}
+
+static void __attribute__((noinline)) sowo_collect(void) {
+    if (sowo_stack_bottom == NULL) {
+        return;
+    }
+    sowo_sorted_blocks = malloc(sowo_block_count * sizeof(sowo_block *));
+    sowo_mark_stack = malloc(sowo_block_count * sizeof(sowo_block *));
+    if (sowo_block_count > 0 && (sowo_sorted_blocks == NULL || sowo_mark_stack == NULL)) {
+        sowo_runtime_error("out of memory");
+    }
+    size_t i = 0;
+    for (sowo_block *block = sowo_blocks; block != NULL; block = block->header.next) {
+        sowo_sorted_blocks[i++] = block;
+    }
+    qsort(sowo_sorted_blocks, sowo_block_count, sizeof(sowo_block *), sowo_compare_blocks);
+
+    // Spill the registers on the stack so they are scanned as well
+    jmp_buf registers;
+    setjmp(registers);
+    sowo_mark_area(&registers, (char *)&registers + sizeof(registers));
+    sowo_mark_area(__builtin_frame_address(0), sowo_stack_bottom);
+    sowo_mark_reachable();
+    for (size_t r = 0; r < sowo_root_count; r++) {
+        sowo_mark_area(sowo_roots[r].start, (char *)sowo_roots[r].start + sowo_roots[r].size);
+        sowo_mark_reachable();
+    }
+    sowo_sweep();
+
+    free(sowo_sorted_blocks);
+    free(sowo_mark_stack);
+    sowo_collections++;
+    if (sowo_next_collection < 2 * sowo_allocated_bytes) {
+        sowo_next_collection = 2 * sowo_allocated_bytes;
+    }
+}
+#endif
+
+void sowo_free_all(void) {
+#ifdef SOWO_GC_DEBUG
+    fprintf(stderr, "[gc] %zu allocations\n", sowo_total_allocations);
+#ifdef SOWO_GC_MARKSWEEP
+    fprintf(stderr, "[gc] %zu collections, %zu blocks freed by the collector\n",
+            sowo_collections, sowo_freed_blocks);
+#endif
+    if (sowo_block_count > 0) {
+        fprintf(stderr, "[gc] %zu blocks (%zu bytes) still allocated at exit\n",
+                sowo_block_count, sowo_allocated_bytes);
+    }
+#endif
+    while (sowo_blocks != NULL) {
+        sowo_block *next = sowo_blocks->header.next;
+        free(sowo_blocks);
+        sowo_blocks = next;
+    }
+    free(sowo_roots);
+}
+
+// Must be called at the start of main with the address of its frame.
+void sowo_gc_init(void *stack_bottom) {
+    sowo_stack_bottom = stack_bottom;
+    atexit(sowo_free_all);
+}
+
+// Allocates a zero initialized block of memory.
+void *sowo_alloc(size_t size) {
+#ifdef SOWO_GC_MARKSWEEP
+    if (sowo_allocated_bytes + size > sowo_next_collection) {
+        sowo_collect();
+    }
+#endif
+    sowo_block *block = calloc(1, sizeof(sowo_block) + size);
+    if (block == NULL) {
+        sowo_runtime_error("out of memory");
+    }
+    block->header.next = sowo_blocks;
+    block->header.size = size;
+    sowo_blocks = block;
+    sowo_block_count++;
+    sowo_allocated_bytes += size;
+    sowo_total_allocations++;
+    return block + 1;
+}
+
+// Returns a copy of the value allocated on the heap.
+void *sowo_box(const void *value, size_t size) {
+    void *result = sowo_alloc(size);
+    memcpy(result, value, size);
+    return result;
+}
+
+// Allocates a new string variable initialized to the empty string.
+char **sowo_new_str(void) {
+    char **result = sowo_alloc(sizeof(char *));
+    *result = "";
+    return result;
+}
+
+int sowo_slice_len(sowo_slice s) {
+    return (int)s.len;
+}
+
+// Returns the address of an element of a slice.
+void *sowo_slice_at(sowo_slice s, long long i, size_t elem_size, const char *file, int line, int col) {
+#ifndef SOWO_UNCHECKED
+    if (i < 0 || i >= s.len) {
+        sowo_panic(file, line, col, "index %lld out of range for slice of length %lld", i, s.len);
+    }
+#endif
+    return (char *)s.data + i * elem_size;
+}
+
+// Returns the command line arguments, the first one is the program name.
+sowo_slice sowo_args(int argc, char **argv) {
+    sowo_slice args;
+    args.len = argc;
+    args.data = sowo_alloc(argc * sizeof(char *));
+    memcpy(args.data, argv, argc * sizeof(char *));
+    return args;
+}
+
+int sowo_str_len(const char *s) {
+    return (int)strlen(s);
+}
+
+char *sowo_str_concat(const char *a, const char *b) {
+    size_t a_len = strlen(a);
+    size_t b_len = strlen(b);
+    char *result = sowo_alloc(a_len + b_len + 1);
+    memcpy(result, a, a_len);
+    memcpy(result + a_len, b, b_len + 1);
+    return result;
+}
+
+int sowo_str_equals(const char *a, const char *b) {
+    return strcmp(a, b) == 0;
+}
+
+char sowo_str_index(const char *s, long long i, const char *file, int line, int col) {
+#ifndef SOWO_UNCHECKED
+    long long len = (long long)strlen(s);
+    if (i < 0 || i >= len) {
+        sowo_panic(file, line, col, "index %lld out of range for string of length %lld", i, len);
+    }
+#endif
+    return s[i];
+}
+
+char *sowo_str_slice(const char *s, long long from, long long to, const char *file, int line, int col) {
+#ifndef SOWO_UNCHECKED
+    long long len = (long long)strlen(s);
+    if (from < 0 || to > len || from > to) {
+        sowo_panic(file, line, col, "slice [%lld:%lld] out of range for string of length %lld", from, to, len);
+    }
+#endif
+    char *result = sowo_alloc(to - from + 1);
+    memcpy(result, s + from, to - from);
+    result[to - from] = '\0';
+    return result;
+}
+
+char *sowo_str_suffix(const char *s, long long from, const char *file, int line, int col) {
+    return sowo_str_slice(s, from, (long long)strlen(s), file, line, col);
+}
+
+char *sowo_int_to_str(long long value) {
+    char buffer[32];
+    snprintf(buffer, sizeof(buffer), "%lld", value);
+    return sowo_str_concat(buffer, "");
+}
+
+char *sowo_uint_to_str(unsigned long long value) {
+    char buffer[32];
+    snprintf(buffer, sizeof(buffer), "%llu", value);
+    return sowo_str_concat(buffer, "");
+}
+
+char *sowo_char_to_str(char c) {
+    char *result = sowo_alloc(2);
+    result[0] = c;
+    result[1] = '\0';
+    return result;
+}
+
+long long sowo_str_to_int(const char *s, const char *file, int line, int col) {
+    char *end;
+    errno = 0;
+    long long value = strtoll(s, &end, 10);
+    if (*s == '\0' || *end != '\0' || errno == ERANGE) {
+        sowo_panic(file, line, col, "cannot convert \"%s\" to an integer", s);
+    }
+    return value;
+}
+
+// Converts a float to an integer type of given bits truncating toward
+// zero. Values out of the range of the type stop the program, when
+// SOWO_UNCHECKED is defined they saturate instead and NaN converts to 0.
+long long sowo_float_to_int(double value, int bits, const char *file, int line, int col) {
+    long long max = (long long)((1ULL << (bits - 1)) - 1);
+    double limit = (double)(1ULL << (bits - 1));
+    // -limit - 1 rounds to -limit for 64 bits, no double is between them
+    if ((value >= -limit || value > -limit - 1) && value < limit) {
+        return (long long)value;
+    }
+#ifndef SOWO_UNCHECKED
+    sowo_panic(file, line, col, "integer overflow in conversion");
+#endif
+    if (value != value) {
+        return 0;
+    }
+    return value < 0 ? -max - 1 : max;
+}
+
+unsigned long long sowo_float_to_uint(double value, int bits, const char *file, int line, int col) {
+    double limit = (double)(1ULL << (bits - 1)) * 2;
+    if (value > -1 && value < limit) {
+        return (unsigned long long)value;
+    }
+#ifndef SOWO_UNCHECKED
+    sowo_panic(file, line, col, "integer overflow in conversion");
+#endif
+    if (value != value || value < 0) {
+        return 0;
+    }
+    return bits == 64 ? ULLONG_MAX : (1ULL << bits) - 1;
+}
+
+// Assertions are checked even when SOWO_UNCHECKED is defined.
+void sowo_assert(int cond, const char *message, const char *file, int line, int col) {
+    if (!cond) {
+        sowo_panic(file, line, col, "assertion failed: %s", message);
+    }
+}
+
+// Reads a line from stdin without the line break,
+// returns the empty string at the end of the input.
+char *sowo_read_line(void) {
+    size_t capacity = 64;
+    size_t len = 0;
+    char *buffer = malloc(capacity);
+    int c;
+    while (buffer != NULL && (c = getchar()) != EOF && c != '\n') {
+        if (len + 1 == capacity) {
+            capacity *= 2;
+            if ((buffer = realloc(buffer, capacity)) == NULL) {
+                break;
+            }
+        }
+        buffer[len++] = (char)c;
+    }
+    if (buffer == NULL) {
+        sowo_runtime_error("out of memory");
+    }
+    if (len > 0 && buffer[len - 1] == '\r') {
+        len--;
+    }
+    buffer[len] = '\0';
+    char *result = sowo_str_concat(buffer, "");
+    free(buffer);
+    return result;
+}
+
+int sowo_read_int(const char *file, int line, int col) {
+    long long value = sowo_str_to_int(sowo_read_line(), file, line, col);
+    if (value < INT_MIN || value > INT_MAX) {
+        sowo_panic(file, line, col, "%lld does not fit in an int", value);
+    }
+    return (int)value;
+}
+
+int sowo_str_index_of(const char *s, const char *sub) {
+    const char *found = strstr(s, sub);
+    return found == NULL ? -1 : (int)(found - s);
+}
+
+int sowo_str_contains(const char *s, const char *sub) {
+    return strstr(s, sub) != NULL;
+}
+
+int sowo_str_starts_with(const char *s, const char *prefix) {
+    return strncmp(s, prefix, strlen(prefix)) == 0;
+}
+
+int sowo_str_ends_with(const char *s, const char *suffix) {
+    size_t s_len = strlen(s);
+    size_t suffix_len = strlen(suffix);
+    return suffix_len <= s_len && strcmp(s + s_len - suffix_len, suffix) == 0;
+}
+
+char *sowo_str_to_upper(const char *s) {
+    char *result = sowo_str_concat(s, "");
+    for (char *c = result; *c != '\0'; c++) {
+        *c = (char)toupper((unsigned char)*c);
+    }
+    return result;
+}
+
+char *sowo_str_to_lower(const char *s) {
+    char *result = sowo_str_concat(s, "");
+    for (char *c = result; *c != '\0'; c++) {
+        *c = (char)tolower((unsigned char)*c);
+    }
+    return result;
+}
+
+char *sowo_str_trim(const char *s) {
+    long long from = 0;
+    long long to = (long long)strlen(s);
+    while (from < to && isspace((unsigned char)s[from])) {
+        from++;
+    }
+    while (to > from && isspace((unsigned char)s[to - 1])) {
+        to--;
+    }
+    char *result = sowo_alloc(to - from + 1);
+    memcpy(result, s + from, to - from);
+    result[to - from] = '\0';
+    return result;
+}
+`
@@ -0,0 +1,76 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Returns the C compiler used to build executables, the one given
+// in the options or the one in the CC environment variable.
+func cCompiler(options CompilerOptions) string {
+	if options.CC != "" {
+		return options.CC
+	}
+	if cc := os.Getenv("CC"); cc != "" {
+		return cc
+	}
+	return "cc"
+}
+
+// Compiles the C and assembly files into an executable with the C compiler.
+func compileC(sources []string, exeFile string, options CompilerOptions) error {
+	cc := cCompiler(options)
+	var args []string
+	if options.OptLevel != "" {
+		args = append(args, "-O"+options.OptLevel)
+	}
+	args = append(args, options.CFlags...)
+	args = append(args, sources...)
+	args = append(args, "-o", exeFile)
+
+	cmd := exec.Command(cc, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("cannot run C compiler '%s': %s", cc, err)
+		}
+		return fmt.Errorf("%s %s failed:\n%s", cc, strings.Join(args, " "), strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// Compiles the files into an executable with the runtime library, used
+// by the backends that don't include the runtime in the generated code.
+func compileWithRuntime(sources []string, exeFile string, options CompilerOptions) error {
+	runtime, err := ioutil.TempFile("", "sowo_runtime*.c")
+	if err != nil {
+		return fmt.Errorf("cannot create the runtime library: %s", err)
+	}
+	defer os.Remove(runtime.Name())
+	_, err = runtime.WriteString(irRuntimeLibrary(options))
+	runtime.Close()
+	if err != nil {
+		return fmt.Errorf("cannot write the runtime library: %s", err)
+	}
+	return compileC(append(sources, runtime.Name()), exeFile, options)
+}
+
+// Returns the optimisation level of a -O flag (e.g. `-O2`),
+// -O alone selects level 2.
+func OptLevelFromFlag(flag string) (string, error) {
+	level := strings.TrimPrefix(flag, "-O")
+	switch level {
+	case "":
+		return "2", nil
+	case "0", "1", "2", "3", "s":
+		return level, nil
+	default:
+		return "", fmt.Errorf("unknown optimisation level '%s'", flag)
+	}
+}
@@ -1,6 +1,7 @@
 package src
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -10,15 +11,64 @@ import (
 
 // Compiles a sowo program file given some options
 func SowoCompileFile(options CompilerOptions) {
-	// Read input file
-	content, err := ioutil.ReadFile(options.InputFile)
-	if err != nil {
-		log.Fatalf("Error opening file %s", options.InputFile)
+	ast := loadAndCheckProgram(options)
+	backend := targetBackend(options)
+
+	if options.PrintBytecode {
+		fmt.Print(disassembleBytecode(compileBytecode(*ast, options)))
 	}
 
-	// Tokenize
-	lexer := Lexer{Input: string(content)}
-	tokens := lexer.tokenize()
+	if !options.SkipCompile {
+		// Compile
+		code, err := backend.Emit(*ast, options)
+		if err != nil {
+			log.Fatalf("[Backend]: %s: %s", backend.Name(), err)
+		}
+
+		// Write compiled code to file, executables are built
+		// from a file next to them
+		sourceFile := options.OutputFile
+		var exeBackend ExecutableBackend
+		if options.Executable {
+			var ok bool
+			if exeBackend, ok = backend.(ExecutableBackend); !ok {
+				log.Fatalf("Target %s can't build executables", backend.Name())
+			}
+			sourceFile = strings.TrimSuffix(options.OutputFile, filepath.Ext(options.OutputFile)) + backend.Extension()
+			if sourceFile == options.OutputFile {
+				log.Fatalf("Executable %s can't have the %s extension", options.OutputFile, backend.Extension())
+			}
+		}
+		err = ioutil.WriteFile(sourceFile, code, 0777)
+		if err != nil {
+			log.Fatalf("Error writing to file %s", sourceFile)
+		}
+
+		if options.Executable {
+			err := exeBackend.BuildExecutable(sourceFile, options.OutputFile, options)
+			if !options.KeepC {
+				os.Remove(sourceFile)
+			}
+			if err != nil {
+				log.Fatalf("[CC]: %s", err)
+			}
+		}
+	}
+}
+
+// Checks a sowo program file without compiling it, the
+// errors are reported as in SowoCompileFile.
+func SowoCheckFile(options CompilerOptions) {
+	loadAndCheckProgram(options)
+}
+
+// Loads the program in the input file and checks its types, the
+// tokens and the AST are printed and saved as the options say.
+func loadAndCheckProgram(options CompilerOptions) *Ast {
+	// Load the main module and its imports
+	loader := ModuleLoader{SearchPath: options.ImportPaths}
+	ast := loader.loadProgram(options.InputFile)
+	tokens := loader.Tokens
 	if options.PrintTokens {
 		DumpTokens(os.Stdout, tokens)
 	}
@@ -32,12 +82,8 @@ func SowoCompileFile(options CompilerOptions) {
 		DumpTokens(f, tokens)
 	}
 
-	// Parse
-	parser := Parser{Tokens: tokens}
-	ast := parser.parseModule()
-
 	// Check types
-	checkTypeOfModule(ast)
+	checkTypeOfProgram(ast)
 
 	if options.PrintAst {
 		DumpAst(os.Stdout, *ast)
@@ -52,14 +98,5 @@ func SowoCompileFile(options CompilerOptions) {
 		DumpAst(f, *ast)
 	}
 
-	if !options.SkipCompile {
-		// Compile
-		ir := generateIR(*ast)
-
-		// Write compiled asm to file
-		err = ioutil.WriteFile(options.OutputFile, []byte(ir), 0777)
-		if err != nil {
-			log.Fatalf("Error writing to file %s", options.OutputFile)
-		}
-	}
+	return ast
 }
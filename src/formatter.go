@@ -0,0 +1,217 @@
+package src
+
+import (
+	"strings"
+)
+
+// Text used for one level of indentation in formatted sources.
+const formatIndent = "    "
+
+// Rewrites a sowo source with the standard layout: one statement per
+// line, blocks indented by four spaces and operators surrounded by
+// spaces. Comments and single blank lines are kept.
+func FormatSource(source string) string {
+	lexer := Lexer{Input: source, KeepComments: true}
+	f := formatter{source: source, tokens: lexer.tokenize(), lineOffsets: []int{0}}
+	for i, c := range source {
+		if c == '\n' {
+			f.lineOffsets = append(f.lineOffsets, i+1)
+		}
+	}
+	for f.i = range f.tokens {
+		f.formatToken()
+	}
+	if f.out.Len() > 0 {
+		f.out.WriteString("\n")
+	}
+	return f.out.String()
+}
+
+type formatter struct {
+	out    strings.Builder
+	source string
+	tokens []Token
+	// Offset in the source of the first character of every line.
+	lineOffsets []int
+	// Index of the token being formatted.
+	i      int
+	indent int
+	// A line break is due before the next token.
+	lineStart bool
+	// The previous tokens written, comments excluded.
+	prev, prev2 Token
+	// Source line of the last token written, comments included.
+	lastLine int
+	// Tokens written on the current line.
+	lineTokens int
+	// For every open bracket tells if it's an index or a slice
+	// expression, where the colons are not followed by a space.
+	brackets []bool
+	// Depth of the open brackets of an attribute, the attribute
+	// ends on its own line when it's back to 0.
+	attribute int
+}
+
+func (f *formatter) formatToken() {
+	t := f.tokens[f.i]
+	if t.Type == TokenComment {
+		if f.i > 0 && t.Line == f.lastLine {
+			// Trailing comment, it stays on the line of the code
+			f.out.WriteString(" " + t.Value)
+		} else {
+			f.newLine(t)
+			f.out.WriteString(t.Value)
+		}
+		f.lineStart = true
+		f.lastLine = t.Line
+		return
+	}
+
+	if t.Type == TokenCloseCurly {
+		f.indent--
+		f.lineStart = true
+	}
+	if f.i == 0 || f.lineStart {
+		f.newLine(t)
+	} else if f.spaceBefore(t) {
+		f.out.WriteString(" ")
+	}
+	f.out.WriteString(f.tokenSource(t))
+	f.lineTokens++
+
+	switch t.Type {
+	case TokenOpenCurly:
+		f.indent++
+		f.lineStart = true
+	case TokenSemicolon:
+		f.lineStart = true
+	case TokenCloseCurly:
+		f.lineStart = !f.nextIs(TokenElse, TokenSemicolon, TokenCloseParen, TokenComma)
+	case TokenHash:
+		f.attribute = 1
+	case TokenOpenBracket:
+		if f.attribute > 0 {
+			f.attribute++
+		}
+		f.brackets = append(f.brackets, isOperandEnd(f.prev) && f.prev2.Type != TokenFunc)
+	case TokenCloseBracket:
+		if len(f.brackets) > 0 {
+			f.brackets = f.brackets[:len(f.brackets)-1]
+		}
+		if f.attribute > 0 {
+			f.attribute--
+			if f.attribute == 1 {
+				f.attribute = 0
+				f.lineStart = true
+			}
+		}
+	}
+	f.prev2, f.prev = f.prev, t
+	f.lastLine = t.Line
+}
+
+// Starts a new line for the token, the blank lines of the source
+// between two statements are collapsed in a single one.
+func (f *formatter) newLine(t Token) {
+	if f.out.Len() > 0 {
+		f.out.WriteString("\n")
+		if t.Line > f.lastLine+1 && f.prev.Type != TokenOpenCurly && t.Type != TokenCloseCurly {
+			f.out.WriteString("\n")
+		}
+	}
+	f.out.WriteString(strings.Repeat(formatIndent, f.indent))
+	f.lineStart = false
+	f.lineTokens = 0
+}
+
+// Tells if the next token that is not a comment has one of given types.
+func (f *formatter) nextIs(types ...TokenType) bool {
+	for _, next := range f.tokens[f.i+1:] {
+		if next.Type == TokenComment {
+			continue
+		}
+		for _, t := range types {
+			if next.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// Tells if the token can be the last one of an operand, so that
+// a following `*` or `&` is a binary operator.
+func isOperandEnd(t Token) bool {
+	switch t.Type {
+	case TokenSymbol, TokenNumberLiteral, TokenFloatLiteral, TokenStringLiteral, TokenCharLiteral,
+		TokenTrue, TokenFalse, TokenCloseParen, TokenCloseBracket, TokenQuestion:
+		return true
+	}
+	return false
+}
+
+func isBinaryOperator(t Token, prev Token) bool {
+	switch t.Type {
+	case TokenEqual, TokenEqualEqual, TokenLessThen, TokenGreaterThen, TokenLessThenEqual,
+		TokenGreaterThenEqual, TokenPlus, TokenMinus, TokenSlash:
+		return true
+	case TokenAsterisk, TokenAmpersand:
+		return isOperandEnd(prev)
+	}
+	return false
+}
+
+// Tells if a space separates the token from the previous one on the same line.
+func (f *formatter) spaceBefore(t Token) bool {
+	prev := f.prev
+	inIndex := len(f.brackets) > 0 && f.brackets[len(f.brackets)-1]
+	switch {
+	case isBinaryOperator(t, prev) || isBinaryOperator(prev, f.prev2):
+		return true
+	case t.Type == TokenColon:
+		return false
+	case prev.Type == TokenColon:
+		return !inIndex
+	case prev.Type == TokenComma, t.Type == TokenOpenCurly:
+		return true
+	}
+
+	switch t.Type {
+	case TokenComma, TokenSemicolon, TokenCloseParen, TokenCloseBracket, TokenDot, TokenQuestion:
+		return false
+	}
+	switch prev.Type {
+	case TokenOpenParen, TokenOpenBracket, TokenDot, TokenHash, TokenAsterisk, TokenAmpersand:
+		return false
+	case TokenIf, TokenWhile, TokenReturn, TokenVar, TokenConst, TokenPub, TokenExtern,
+		TokenImport, TokenInterface, TokenElse:
+		return true
+	case TokenFunc:
+		// Methods are declared as `fun (receiver: T) name()`
+		return t.Type != TokenOpenParen || f.indent == 0 && (f.lineTokens == 1 || f.lineTokens == 2 && f.prev2.Type == TokenPub)
+	}
+	switch t.Type {
+	case TokenOpenParen, TokenOpenBracket:
+		return false
+	}
+	// Words are separated, `[]T` is not
+	return prev.Type != TokenCloseBracket
+}
+
+// Returns the source text of the token, literals are copied from
+// the source so that their escape sequences are kept.
+func (f *formatter) tokenSource(t Token) string {
+	var quote byte
+	switch t.Type {
+	case TokenStringLiteral:
+		quote = '"'
+	case TokenCharLiteral:
+		quote = '\''
+	default:
+		return t.Value
+	}
+	offset := f.lineOffsets[t.Line-1] + t.Col - 1
+	_, tail := chopQuoted(f.source[offset:], quote)
+	return f.source[offset : len(f.source)-len(tail)]
+}
@@ -0,0 +1,116 @@
+package src
+
+import (
+	"fmt"
+)
+
+// Returns the type parameters of a function, nil if it's not generic.
+func funcTypeParams(funcDef *Ast) (params []TypeAnnotation) {
+	if funcDef.Type != AstFunction || len(funcDef.Children) < 4 {
+		return nil
+	}
+	for _, param := range funcDef.Children[3].Children {
+		params = append(params, param.DataType)
+	}
+	return params
+}
+
+// Returns true if the type can be used for a type parameter
+// with given constraint. Type parameters satisfy their own
+// constraint and every weaker one.
+func satisfiesConstraint(t TypeAnnotation, constraint TypeConstraint) bool {
+	if isTypeParam(t) {
+		return typeParamConstraint(t) >= constraint
+	}
+	switch constraint {
+	case ConstraintNumeric:
+		return isNumericType(t)
+	case ConstraintComparable:
+		return t != TypeVoid && !isSliceType(t) && !isFuncType(t) && !isInterfaceType(t) && !isResultType(t)
+	}
+	return t != TypeVoid
+}
+
+// Replaces the bound type parameters in the type.
+func substituteType(t TypeAnnotation, bindings map[TypeAnnotation]TypeAnnotation) TypeAnnotation {
+	if bound, ok := bindings[t]; ok {
+		return bound
+	}
+	if isPointerType(t) {
+		return pointerTo(substituteType(pointerElem(t), bindings))
+	}
+	if isSliceType(t) {
+		return sliceOf(substituteType(sliceElem(t), bindings))
+	}
+	if isFuncType(t) {
+		params, returnType := funcTypeSignature(t)
+		var substituted []TypeAnnotation
+		for _, param := range params {
+			substituted = append(substituted, substituteType(param, bindings))
+		}
+		return funcType(substituted, substituteType(returnType, bindings))
+	}
+	if isResultType(t) {
+		valueType, errorType := resultTypes(t)
+		return resultOf(substituteType(valueType, bindings), substituteType(errorType, bindings))
+	}
+	return t
+}
+
+// Binds the type parameters appearing in the parameter type to the matching
+// parts of the argument type. Mismatches are left to the type checker.
+func unifyTypes(param TypeAnnotation, arg TypeAnnotation, bindings map[TypeAnnotation]TypeAnnotation) error {
+	switch {
+	case isTypeParam(param):
+		if bound, ok := bindings[param]; ok {
+			if bound != arg {
+				return fmt.Errorf("type parameter %s is both '%s' and '%s'", param, bound, arg)
+			}
+			return nil
+		}
+		if !satisfiesConstraint(arg, typeParamConstraint(param)) {
+			return fmt.Errorf("type '%s' does not satisfy constraint %s of %s", arg, typeParamConstraint(param), param)
+		}
+		bindings[param] = arg
+	case isPointerType(param) && isPointerType(arg):
+		return unifyTypes(pointerElem(param), pointerElem(arg), bindings)
+	case isSliceType(param) && isSliceType(arg):
+		return unifyTypes(sliceElem(param), sliceElem(arg), bindings)
+	case isFuncType(param) && isFuncType(arg):
+		params, returnType := funcTypeSignature(param)
+		argParams, argReturnType := funcTypeSignature(arg)
+		if len(params) != len(argParams) {
+			return nil
+		}
+		for i := range params {
+			if err := unifyTypes(params[i], argParams[i], bindings); err != nil {
+				return err
+			}
+		}
+		return unifyTypes(returnType, argReturnType, bindings)
+	case isResultType(param) && isResultType(arg):
+		valueType, errorType := resultTypes(param)
+		argValueType, argErrorType := resultTypes(arg)
+		if err := unifyTypes(valueType, argValueType, bindings); err != nil {
+			return err
+		}
+		return unifyTypes(errorType, argErrorType, bindings)
+	}
+	return nil
+}
+
+// Returns a copy of the tree with the bound type parameters replaced,
+// used to instantiate the body of a generic function.
+func substituteAst(ast *Ast, bindings map[TypeAnnotation]TypeAnnotation) *Ast {
+	result := *ast
+	result.DataType = substituteType(ast.DataType, bindings)
+	result.Children = nil
+	for _, child := range ast.Children {
+		result.Children = append(result.Children, substituteAst(child, bindings))
+	}
+	result.TypeArgs = nil
+	for _, typeArg := range ast.TypeArgs {
+		result.TypeArgs = append(result.TypeArgs, substituteType(typeArg, bindings))
+	}
+	return &result
+}
@@ -0,0 +1,190 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Returns the module imported with given alias by the module.
+func moduleImportedBy(module *Ast, alias string) (*Ast, bool) {
+	for _, def := range module.Children {
+		if def.Type == AstImport && def.Name == alias {
+			return programModules[def.Module], true
+		}
+	}
+	return nil, false
+}
+
+// Returns the type a name used in the module refers to.
+func resolveType(t TypeAnnotation, module *Ast) TypeAnnotation {
+	c, ok := compoundTypeOf(t)
+	if !ok {
+		return t
+	}
+	switch c.Kind {
+	case KindNamed:
+		alias, member := splitQualifiedName(c.Name)
+		declaring := module
+		if alias != "" {
+			if declaring, ok = moduleImportedBy(module, alias); !ok {
+				log.Fatalf("[Type Check]: Unknown type '%s', no imported module with name %s", c.Name, alias)
+			}
+		}
+		for _, def := range declaring.Children {
+			if def.Type == AstInterface && def.Name == member {
+				if alias != "" && !def.Public {
+					log.Fatalf("[Type Check]: Interface %s is not public in module %s", member, alias)
+				}
+				return interfaceType(declaring.Name + "." + member)
+			}
+		}
+		log.Fatalf("[Type Check]: Unknown type '%s'", c.Name)
+	case KindPointer:
+		return pointerTo(resolveType(c.Elem, module))
+	case KindSlice:
+		return sliceOf(resolveType(c.Elem, module))
+	case KindFunction:
+		var params []TypeAnnotation
+		for _, param := range c.Params {
+			params = append(params, resolveType(param, module))
+		}
+		return funcType(params, resolveType(c.Elem, module))
+	case KindResult:
+		return resultOf(resolveType(c.Elem, module), resolveType(c.Params[0], module))
+	}
+	return t
+}
+
+func resolveAstTypes(ast *Ast, module *Ast) {
+	ast.DataType = resolveType(ast.DataType, module)
+	for i, typeArg := range ast.TypeArgs {
+		ast.TypeArgs[i] = resolveType(typeArg, module)
+	}
+	for _, child := range ast.Children {
+		resolveAstTypes(child, module)
+	}
+}
+
+// Replaces the names of the declared types used in the program with
+// the types they refer to. The parser can't resolve them since a type
+// can be declared after its use or in another module.
+func resolveNamedTypes(program *Ast) {
+	for _, module := range program.Children {
+		for _, def := range module.Children {
+			if def.Type == AstInterface {
+				interfaceType(module.Name + "." + def.Name)
+			}
+		}
+	}
+	for _, module := range program.Children {
+		resolveAstTypes(module, module)
+	}
+	for _, module := range program.Children {
+		for _, def := range module.Children {
+			if def.Type != AstInterface {
+				continue
+			}
+			var methods []InterfaceMethod
+			for _, method := range def.Children {
+				methods = append(methods, InterfaceMethod{Name: method.Name, Type: method.DataType})
+			}
+			setInterfaceMethods(def.DataType, methods)
+		}
+	}
+}
+
+// Returns the receiver type of a method definition.
+func methodReceiverType(method *Ast) TypeAnnotation {
+	return method.Children[0].Children[0].Children[0].DataType
+}
+
+// Returns the type of a method without its receiver.
+func methodType(method *Ast) TypeAnnotation {
+	var params []TypeAnnotation
+	for _, param := range method.Children[0].Children[1:] {
+		params = append(params, param.Children[0].DataType)
+	}
+	return funcType(params, method.Children[1].Children[0].DataType)
+}
+
+// Returns the method of the type with given name, looking at the
+// methods of the current module and the public methods of the
+// modules it imports.
+func methodDefWithName(receiverType TypeAnnotation, name string) (*Ast, error) {
+	modules := []*Ast{currentModule}
+	for _, def := range currentModule.Children {
+		if def.Type == AstImport {
+			modules = append(modules, programModules[def.Module])
+		}
+	}
+	var found *Ast
+	for i, module := range modules {
+		for _, def := range module.Children {
+			if def.Type != AstMethod || def.Name != name || methodReceiverType(def) != receiverType {
+				continue
+			}
+			if i > 0 && !def.Public {
+				continue
+			}
+			if found != nil && found != def {
+				return nil, fmt.Errorf("method %s of type '%s' is defined in modules %s and %s",
+					name, receiverType, found.Module, def.Module)
+			}
+			found = def
+		}
+		if i == 0 && found != nil {
+			// The methods of the current module hide the imported ones
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("type '%s' has no method %s", receiverType, name)
+	}
+	return found, nil
+}
+
+// Returns the parameter types and the return type of a method.
+func methodSignature(receiverType TypeAnnotation, name string) ([]TypeAnnotation, TypeAnnotation, error) {
+	if isResultType(receiverType) {
+		return resultMethodSignature(receiverType, name)
+	}
+	if isInterfaceType(receiverType) {
+		for _, method := range interfaceMethods(receiverType) {
+			if method.Name == name {
+				params, returnType := funcTypeSignature(method.Type)
+				return params, returnType, nil
+			}
+		}
+		return nil, TypeVoid, fmt.Errorf("interface '%s' has no method %s", receiverType, name)
+	}
+	method, err := methodDefWithName(receiverType, name)
+	if err != nil {
+		return nil, TypeVoid, err
+	}
+	params, returnType := funcTypeSignature(methodType(method))
+	return params, returnType, nil
+}
+
+// Returns the methods of the type implementing the interface, in the
+// order of the interface, or an error naming the missing methods.
+func interfaceImplementation(t TypeAnnotation, iface TypeAnnotation) ([]*Ast, error) {
+	if isInterfaceType(t) || t == TypeVoid {
+		return nil, fmt.Errorf("type '%s' can't be used as interface '%s'", t, iface)
+	}
+	var methods []*Ast
+	var missing []string
+	for _, required := range interfaceMethods(iface) {
+		method, err := methodDefWithName(t, required.Name)
+		if err != nil || methodType(method) != required.Type {
+			missing = append(missing, fmt.Sprintf("%s %s", required.Name, required.Type))
+			continue
+		}
+		methods = append(methods, method)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("type '%s' does not implement interface '%s', missing methods: %s",
+			t, iface, strings.Join(missing, ", "))
+	}
+	return methods, nil
+}
@@ -0,0 +1,460 @@
+package src
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Operations on the values of the interpreter, they behave like
+// the C runtime used by the compiled programs.
+
+// Returns the value truncated to the bits of the integer type, like a C cast.
+func interpWrapInteger(value int64, t TypeAnnotation) int64 {
+	switch t {
+	case TypeI8:
+		return int64(int8(value))
+	case TypeI16:
+		return int64(int16(value))
+	case TypeInteger, TypeI32:
+		return int64(int32(value))
+	case TypeU8:
+		return int64(uint8(value))
+	case TypeU16:
+		return int64(uint16(value))
+	case TypeU32:
+		return int64(uint32(value))
+	}
+	return value
+}
+
+// Returns the value rounded to the precision of the float type.
+func interpFloat(value float64, t TypeAnnotation) float64 {
+	if t == TypeF32 {
+		return float64(float32(value))
+	}
+	return value
+}
+
+// Returns the value a variable of given type has before being assigned.
+func interpZeroValue(t TypeAnnotation) interpValue {
+	switch {
+	case isIntegerType(t):
+		return int64(0)
+	case isFloatType(t):
+		return float64(0)
+	case t == TypeBoolean:
+		return false
+	case t == TypeChar:
+		return byte(0)
+	case t == TypeString:
+		return ""
+	case isPointerType(t):
+		return (*interpValue)(nil)
+	case isSliceType(t):
+		return []interpValue(nil)
+	case isFuncType(t):
+		return (*interpClosure)(nil)
+	case isInterfaceType(t):
+		return interpInterface{}
+	case isResultType(t):
+		valueType, errorType := resultTypes(t)
+		return interpResult{value: interpZeroValue(valueType), err: interpZeroValue(errorType)}
+	}
+	return nil
+}
+
+// Runs a program with the standard streams given, the failures and
+// the exits of the program are turned into its exit code.
+func interpRun(stdin io.Reader, stdout io.Writer, stderr io.Writer, options CompilerOptions, run func() int) (code int) {
+	interpStdin = bufio.NewReader(stdin)
+	interpStdout = bufio.NewWriter(stdout)
+	interpChecked = !options.Unchecked
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case interpExit:
+				code = r.code
+			case interpPanic:
+				fmt.Fprintf(stderr, "%s: panic: %s\n", r.location, r.message)
+				code = 1
+			default:
+				panic(r)
+			}
+		}
+		interpStdout.Flush()
+	}()
+	return run()
+}
+
+func interpBinaryOp(f *interpFrame, ast *Ast) interpValue {
+	operandType := f.typeOf(ast.Children[0].DataType)
+	lhs := interpExpression(f, ast.Children[0])
+	rhs := interpExpression(f, ast.Children[1])
+	switch {
+	case operandType == TypeString:
+		if ast.Operator == OpPlus {
+			return lhs.(string) + rhs.(string)
+		}
+	case isIntegerType(operandType) && isArithmeticOperator(ast.Operator):
+		result, failure := interpIntegerOperation(ast.Operator, lhs.(int64), rhs.(int64), operandType)
+		if failure != "" {
+			f.panicf(ast, "%s", failure)
+		}
+		return result
+	case isFloatType(operandType) && isArithmeticOperator(ast.Operator):
+		a, b := lhs.(float64), rhs.(float64)
+		switch ast.Operator {
+		case OpPlus:
+			return interpFloat(a+b, operandType)
+		case OpMinus:
+			return interpFloat(a-b, operandType)
+		case OpTimes:
+			return interpFloat(a*b, operandType)
+		case OpDivide:
+			return interpFloat(a/b, operandType)
+		}
+	}
+	if ast.Operator == OpEquals {
+		return lhs == rhs
+	}
+
+	// Ordering of numbers and chars, C chars are signed
+	var less, greater bool
+	switch a := lhs.(type) {
+	case int64:
+		b := rhs.(int64)
+		if operandType == TypeU64 {
+			less, greater = uint64(a) < uint64(b), uint64(a) > uint64(b)
+		} else {
+			less, greater = a < b, a > b
+		}
+	case float64:
+		less, greater = a < rhs.(float64), a > rhs.(float64)
+	case byte:
+		less, greater = int8(a) < int8(rhs.(byte)), int8(a) > int8(rhs.(byte))
+	default:
+		log.Fatalf("[Interpreter]: Unsupported operator %s for type '%s'", ast.Operator, operandType)
+	}
+	switch ast.Operator {
+	case OpLessThen:
+		return less
+	case OpGreaterThen:
+		return greater
+	case OpLessThenEqual:
+		return !greater
+	case OpGreaterThenEqual:
+		return !less
+	}
+	log.Fatalf("[Interpreter]: Unsupported operator %s for type '%s'", ast.Operator, operandType)
+	return nil
+}
+
+// Computes an arithmetic operation between integers, see irIntegerOperation.
+// Divisions by zero always stop the program, in C they have undefined
+// behaviour when the operations are not checked.
+// Returns the result and the failure message when the operation fails.
+func interpIntegerOperation(op BinaryOperator, a int64, b int64, t TypeAnnotation) (int64, string) {
+	if op == OpDivide && b == 0 {
+		return 0, "integer division by zero"
+	}
+
+	var result int64
+	var overflow bool
+	switch t {
+	case TypeI64:
+		switch op {
+		case OpPlus:
+			result = a + b
+			overflow = (a > 0 && b > 0 && result < 0) || (a < 0 && b < 0 && result >= 0)
+		case OpMinus:
+			result = a - b
+			overflow = (a >= 0 && b < 0 && result < 0) || (a < 0 && b > 0 && result >= 0)
+		case OpTimes:
+			result = a * b
+			overflow = a != 0 && (result/a != b || (a == -1 && b == math.MinInt64))
+		case OpDivide:
+			overflow = a == math.MinInt64 && b == -1
+			if overflow {
+				result = a
+			} else {
+				result = a / b
+			}
+		}
+	case TypeU64:
+		ua, ub := uint64(a), uint64(b)
+		var r uint64
+		switch op {
+		case OpPlus:
+			r = ua + ub
+			overflow = r < ua
+		case OpMinus:
+			r = ua - ub
+			overflow = ua < ub
+		case OpTimes:
+			var hi uint64
+			hi, r = bits.Mul64(ua, ub)
+			overflow = hi != 0
+		case OpDivide:
+			r = ua / ub
+		}
+		result = int64(r)
+	default:
+		// The results of the smaller types always fit in 64 bits
+		switch op {
+		case OpPlus:
+			result = a + b
+		case OpMinus:
+			result = a - b
+		case OpTimes:
+			result = int64(uint64(a) * uint64(b))
+		case OpDivide:
+			result = a / b
+		}
+		wrapped := interpWrapInteger(result, t)
+		overflow = wrapped != result
+		result = wrapped
+	}
+
+	if overflow && interpChecked {
+		var operation string
+		switch op {
+		case OpPlus:
+			operation = "addition"
+		case OpMinus:
+			operation = "subtraction"
+		case OpTimes:
+			operation = "multiplication"
+		case OpDivide:
+			operation = "division"
+		}
+		return result, fmt.Sprintf("integer overflow in %s", operation)
+	}
+	return result, ""
+}
+
+func interpConversion(f *interpFrame, ast *Ast) interpValue {
+	value := interpExpression(f, ast.Children[0])
+	result, failure := interpConvert(value, f.typeOf(ast.Children[0].DataType), f.typeOf(ast.DataType))
+	if failure != "" {
+		f.panicf(ast, "%s", failure)
+	}
+	return result
+}
+
+// Converts a value between builtin types like the C runtime.
+// Returns the result and the failure message when the conversion fails.
+func interpConvert(value interpValue, from TypeAnnotation, to TypeAnnotation) (interpValue, string) {
+	switch {
+	case from == to:
+		return value, ""
+	case to == TypeString && from == TypeChar:
+		return string([]byte{value.(byte)}), ""
+	case to == TypeString && (from == TypeU64 || from == TypeU32):
+		return strconv.FormatUint(uint64(value.(int64)), 10), ""
+	case to == TypeString:
+		return strconv.FormatInt(value.(int64), 10), ""
+	case from == TypeString:
+		integer, failure := interpStringToInt(value.(string))
+		return interpWrapInteger(integer, to), failure
+	}
+
+	// Numbers and chars, converted through the widest type
+	var integer int64
+	var float float64
+	switch v := value.(type) {
+	case int64:
+		integer, float = v, float64(v)
+		if from == TypeU64 {
+			float = float64(uint64(v))
+		}
+	case float64:
+		float = v
+		if !isFloatType(to) {
+			var ok bool
+			integer, ok = interpFloatToInt(v, to)
+			if !ok && interpChecked {
+				return integer, "integer overflow in conversion"
+			}
+		}
+	case byte:
+		integer, float = int64(int8(v)), float64(int8(v))
+	}
+	switch {
+	case isFloatType(to):
+		return interpFloat(float, to), ""
+	case to == TypeChar:
+		return byte(integer), ""
+	}
+	return interpWrapInteger(integer, to), ""
+}
+
+// Converts a float to an integer type truncating toward zero like
+// sowo_float_to_int, out of range values saturate (NaN converts to 0)
+// and ok is false.
+func interpFloatToInt(value float64, t TypeAnnotation) (result int64, ok bool) {
+	bits := uint(llvmBits(t))
+	if !isSignedType(t) {
+		limit := math.Ldexp(1, int(bits))
+		switch {
+		case value > -1 && value < limit:
+			return int64(uint64(value)), true
+		case value >= limit:
+			return interpWrapInteger(-1, t), false
+		}
+		return 0, false
+	}
+	limit := math.Ldexp(1, int(bits)-1)
+	max := int64(1)<<(bits-1) - 1
+	switch {
+	case (value >= -limit || value > -limit-1) && value < limit:
+		return int64(value), true
+	case value >= limit:
+		return max, false
+	case value < 0:
+		return -max - 1, false
+	}
+	return 0, false
+}
+
+// Converts a string to an integer like strtoll, the whole
+// string must be a number in the range of an i64.
+// Returns the failure message when it's not.
+func interpStringToInt(s string) (int64, string) {
+	value, err := strconv.ParseInt(strings.TrimLeft(s, " \t\n\v\f\r"), 10, 64)
+	if err != nil {
+		return 0, fmt.Sprintf("cannot convert \"%s\" to an integer", s)
+	}
+	return value, ""
+}
+
+func interpIndex(f *interpFrame, ast *Ast) interpValue {
+	base := interpExpression(f, ast.Children[0])
+	index := interpExpression(f, ast.Children[1]).(int64)
+	if slice, ok := base.([]interpValue); ok {
+		if index < 0 || index >= int64(len(slice)) {
+			f.panicf(ast, "index %d out of range for slice of length %d", index, len(slice))
+		}
+		return slice[index]
+	}
+	s := base.(string)
+	if index < 0 || index >= int64(len(s)) {
+		f.panicf(ast, "index %d out of range for string of length %d", index, len(s))
+	}
+	return s[index]
+}
+
+func interpSlice(f *interpFrame, ast *Ast) interpValue {
+	s := interpExpression(f, ast.Children[0]).(string)
+	from, to := int64(0), int64(len(s))
+	if ast.Children[1].Type != AstNoop {
+		from = interpExpression(f, ast.Children[1]).(int64)
+	}
+	if ast.Children[2].Type != AstNoop {
+		to = interpExpression(f, ast.Children[2]).(int64)
+	}
+	if from < 0 || to > int64(len(s)) || from > to {
+		f.panicf(ast, "slice [%d:%d] out of range for string of length %d", from, to, len(s))
+	}
+	return s[from:to]
+}
+
+// Calls a function of the runtime library, selected by its C name.
+// Returns the result and the failure message when the call fails.
+func interpBuiltin(cName string, args []interpValue) (interpValue, string) {
+	switch cName {
+	case "sowo_str_len":
+		return int64(len(args[0].(string))), ""
+	case "sowo_slice_len":
+		return int64(int32(len(args[0].([]interpValue)))), ""
+	case "exit":
+		panic(interpExit{code: int(int32(args[0].(int64)))})
+	case "sowo_assert":
+		if !args[0].(bool) {
+			return nil, fmt.Sprintf("assertion failed: %s", args[1].(string))
+		}
+		return nil, ""
+	case "sowo_read_line":
+		return interpReadLine(), ""
+	case "sowo_read_int":
+		value, failure := interpStringToInt(interpReadLine())
+		if failure == "" && (value < math.MinInt32 || value > math.MaxInt32) {
+			failure = fmt.Sprintf("%d does not fit in an int", value)
+		}
+		return value, failure
+	case "sowo_str_contains":
+		return strings.Contains(args[0].(string), args[1].(string)), ""
+	case "sowo_str_index_of":
+		return int64(strings.Index(args[0].(string), args[1].(string))), ""
+	case "sowo_str_starts_with":
+		return strings.HasPrefix(args[0].(string), args[1].(string)), ""
+	case "sowo_str_ends_with":
+		return strings.HasSuffix(args[0].(string), args[1].(string)), ""
+	case "sowo_str_to_upper":
+		return interpChangeCase(args[0].(string), 'a', 'z', 'A'), ""
+	case "sowo_str_to_lower":
+		return interpChangeCase(args[0].(string), 'A', 'Z', 'a'), ""
+	case "sowo_str_trim":
+		return strings.Trim(args[0].(string), " \t\n\v\f\r"), ""
+	}
+	log.Fatalf("[Interpreter]: Unsupported builtin %s", cName)
+	return nil, ""
+}
+
+// Moves the letters between from and to to the letters starting at
+// base, only ASCII letters change case in the C locale.
+func interpChangeCase(s string, from byte, to byte, base byte) string {
+	result := []byte(s)
+	for i, c := range result {
+		if c >= from && c <= to {
+			result[i] = c - from + base
+		}
+	}
+	return string(result)
+}
+
+// Reads a line from stdin without the line break, see sowo_read_line.
+func interpReadLine() string {
+	interpStdout.Flush()
+	line, _ := interpStdin.ReadString('\n')
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
+
+// Formats a value like the placeholder printf uses for its type.
+func interpFormat(value interpValue, t TypeAnnotation) string {
+	switch v := value.(type) {
+	case int64:
+		if t == TypeU64 {
+			return strconv.FormatUint(uint64(v), 10)
+		}
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		case math.IsNaN(v):
+			return "nan"
+		}
+		return strconv.FormatFloat(v, 'g', 6, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case byte:
+		return string([]byte{v})
+	case string:
+		return v
+	}
+	log.Fatalf("[Interpreter]: Unsupported parameter %s", t)
+	return ""
+}
@@ -0,0 +1,457 @@
+package src
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+)
+
+// The interpreter evaluates the type checked tree directly, without
+// a C toolchain. Values are represented by Go values:
+//   - integers by int64 truncated to the bits of their type (u64
+//     values keep their bits), chars by byte, booleans by bool
+//   - floats by float64 rounded to the precision of their type
+//   - strings by string and slices by []interpValue
+//   - pointers by *interpValue, variables are stored in cells so
+//     that their address can be taken
+//   - function values by *interpClosure, interface values by
+//     interpInterface and results by interpResult
+type interpValue interface{}
+
+// A function value, the captured variables are copied
+// to new locals every time the function is called.
+type interpClosure struct {
+	funcDef  *Ast
+	captures map[string]interpValue
+	bindings map[TypeAnnotation]TypeAnnotation
+	file     string
+}
+
+// A value converted to an interface with the methods
+// implementing the interface for the type of the value.
+type interpInterface struct {
+	value   interpValue
+	methods map[string]*Ast
+}
+
+type interpResult struct {
+	ok    bool
+	value interpValue
+	err   interpValue
+}
+
+// Panics used to unwind the interpreted program: a returned value
+// propagating an error, the end of the program and a failed operation.
+type interpReturn struct {
+	value interpValue
+}
+
+type interpExit struct {
+	code int
+}
+
+type interpPanic struct {
+	location string
+	message  string
+}
+
+// A call of a function being interpreted.
+type interpFrame struct {
+	// Local variables by name, from the outermost block to the innermost.
+	scopes []map[string]*interpValue
+	// Types bound to the type parameters of a generic function.
+	bindings map[TypeAnnotation]TypeAnnotation
+	// Source file of the function, used to locate failures.
+	file string
+}
+
+// State of the program being interpreted: the globals, functions and
+// methods by C name and the standard streams of the program.
+var interpGlobals map[string]*interpValue
+var interpFuncs map[string]*Ast
+var interpMethods map[string]*Ast
+var interpSourceFiles map[string]string
+var interpStdin *bufio.Reader
+var interpStdout *bufio.Writer
+var interpChecked bool
+
+// Runs a type checked program, args are the command line arguments
+// of the program starting with its name. Returns the exit code.
+func interpretProgram(ast Ast, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer, options CompilerOptions) int {
+	interpGlobals = map[string]*interpValue{}
+	interpFuncs = map[string]*Ast{}
+	interpMethods = map[string]*Ast{}
+	interpSourceFiles = map[string]string{}
+	return interpRun(stdin, stdout, stderr, options, func() int {
+		return interpMain(ast, args, stderr)
+	})
+}
+
+func interpMain(ast Ast, args []string, stderr io.Writer) int {
+	if ast.Type != AstProgram {
+		log.Fatalf("[Interpreter]: Unsupported top level %s", ast.Type)
+	}
+	for _, module := range ast.Children {
+		interpSourceFiles[module.Name] = module.StringDataValue
+		for _, def := range module.Children {
+			switch def.Type {
+			case AstFunction:
+				interpFuncs[irSymbolName(def.Module, def.Name)] = def
+			case AstMethod:
+				interpMethods[irMethodName(def.Module, methodReceiverType(def), def.Name)] = def
+			}
+		}
+	}
+	// Globals start zeroed and are initialised in the order they are declared
+	for _, module := range ast.Children {
+		for _, def := range module.Children {
+			if def.Type == AstGlobalVariable || def.Type == AstGlobalConstant {
+				value := interpZeroValue(def.Children[0].Children[0].DataType)
+				interpGlobals[irSymbolName(def.Module, def.Name)] = &value
+			}
+		}
+	}
+	for _, module := range ast.Children {
+		frame := &interpFrame{file: module.StringDataValue}
+		for _, def := range module.Children {
+			if def.Type == AstGlobalVariable || def.Type == AstGlobalConstant {
+				*interpGlobals[irSymbolName(def.Module, def.Name)] = interpExpression(frame, def.Children[1])
+			}
+		}
+	}
+
+	// The main module is the last one, its main function is the entry point
+	entryModule := ast.Children[len(ast.Children)-1]
+	main := interpFuncs[irSymbolName(entryModule.Name, "main")]
+	var mainArgs []interpValue
+	if len(main.Children[0].Children) == 1 {
+		var argValues []interpValue
+		for _, arg := range args {
+			argValues = append(argValues, arg)
+		}
+		mainArgs = append(mainArgs, argValues)
+	}
+	result := interpCall(main, mainArgs, nil, nil, entryModule.StringDataValue)
+
+	returnType := main.Children[1].Children[0].DataType
+	if isResultType(returnType) {
+		r := result.(interpResult)
+		if !r.ok {
+			_, errorType := resultTypes(returnType)
+			fmt.Fprintf(stderr, "error: %s\n", interpFormat(r.err, errorType))
+			return 1
+		}
+		result = r.value
+	}
+	if result == nil {
+		return 0
+	}
+	return int(int32(result.(int64)))
+}
+
+// Calls a function, a method or a function literal with given arguments.
+// Captured variables and type parameters are bound in the new frame.
+func interpCall(funcDef *Ast, args []interpValue, captures map[string]interpValue,
+	bindings map[TypeAnnotation]TypeAnnotation, file string) (result interpValue) {
+	if funcDef.Type == AstExternFunction {
+		interpStdout.Flush()
+		log.Fatalf("[Interpreter]: Cannot call C function %s", funcDef.Name)
+	}
+	locals := map[string]*interpValue{}
+	for name, value := range captures {
+		captured := value
+		locals[name] = &captured
+	}
+	for i, param := range funcDef.Children[0].Children {
+		arg := args[i]
+		locals[param.Name] = &arg
+	}
+	frame := &interpFrame{scopes: []map[string]*interpValue{locals}, bindings: bindings, file: file}
+
+	defer func() {
+		// Errors propagated with ? return from the function
+		if r := recover(); r != nil {
+			ret, ok := r.(interpReturn)
+			if !ok {
+				panic(r)
+			}
+			result = ret.value
+		}
+	}()
+	_, result = interpBlock(frame, funcDef.Children[2])
+	return result
+}
+
+// Executes the statements of a block. Returns true and the
+// returned value when a return statement is executed.
+func interpBlock(f *interpFrame, ast *Ast) (bool, interpValue) {
+	f.scopes = append(f.scopes, map[string]*interpValue{})
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+
+	for _, statement := range ast.Children {
+		switch statement.Type {
+		case AstLocalVariable:
+			value := interpExpression(f, statement.Children[1])
+			f.scopes[len(f.scopes)-1][statement.Children[0].Name] = &value
+		case AstAssignment:
+			*interpVariable(f, statement.Module, statement.Name) = interpExpression(f, statement.Children[0])
+		case AstDerefAssignment:
+			pointer := interpPointer(f, statement.Children[0])
+			*pointer = interpExpression(f, statement.Children[1])
+		case AstIf:
+			if interpExpression(f, statement.Children[0]).(bool) {
+				if returned, value := interpBlock(f, statement.Children[1]); returned {
+					return true, value
+				}
+			} else if len(statement.Children) == 3 {
+				if returned, value := interpBlock(f, statement.Children[2]); returned {
+					return true, value
+				}
+			}
+		case AstWhile:
+			for interpExpression(f, statement.Children[0]).(bool) {
+				if returned, value := interpBlock(f, statement.Children[1]); returned {
+					return true, value
+				}
+			}
+		case AstReturn:
+			return true, interpExpression(f, statement.Children[0])
+		case AstFuncCall, AstClosureCall, AstMethodCall, AstTry:
+			interpExpression(f, statement)
+		case AstPrint:
+			interpPrint(f, statement)
+		default:
+			log.Fatalf("[Interpreter]: Unsupported statement %s", statement.Type)
+		}
+	}
+	return false, nil
+}
+
+// Returns the type with the type parameters of the frame replaced.
+func (f *interpFrame) typeOf(t TypeAnnotation) TypeAnnotation {
+	if f.bindings == nil {
+		return t
+	}
+	return substituteType(t, f.bindings)
+}
+
+// Returns the location of the node in the source, as reported by the C runtime.
+func (f *interpFrame) location(ast *Ast) string {
+	return fmt.Sprintf("%s:%d:%d", f.file, ast.Line, ast.Col)
+}
+
+// Stops the program reporting the operation that failed.
+func (f *interpFrame) panicf(ast *Ast, format string, args ...interface{}) {
+	panic(interpPanic{location: f.location(ast), message: fmt.Sprintf(format, args...)})
+}
+
+// Returns the cell of a variable, globals are looked up by module.
+func interpVariable(f *interpFrame, module string, name string) *interpValue {
+	if module == "" {
+		for i := len(f.scopes) - 1; i >= 0; i-- {
+			if cell, ok := f.scopes[i][name]; ok {
+				return cell
+			}
+		}
+	}
+	cell, ok := interpGlobals[irSymbolName(module, name)]
+	if !ok {
+		log.Fatalf("[Interpreter]: Unknown variable %s", name)
+	}
+	return cell
+}
+
+// Evaluates an expression of pointer type, nil pointers can't be used.
+func interpPointer(f *interpFrame, ast *Ast) *interpValue {
+	pointer := interpExpression(f, ast).(*interpValue)
+	if pointer == nil {
+		f.panicf(ast, "nil pointer dereference")
+	}
+	return pointer
+}
+
+func interpExpression(f *interpFrame, ast *Ast) interpValue {
+	switch ast.Type {
+	case AstNumberLiteral:
+		if isFloatType(f.typeOf(ast.DataType)) {
+			return interpFloat(float64(ast.NumberDataValue), f.typeOf(ast.DataType))
+		}
+		return int64(ast.NumberDataValue)
+	case AstFloatLiteral:
+		return interpFloat(ast.FloatDataValue, f.typeOf(ast.DataType))
+	case AstBooleanLiteral:
+		return ast.BooleanDataValue
+	case AstStringLiteral:
+		return ast.StringDataValue
+	case AstCharLiteral:
+		return ast.CharDataValue
+	case AstBinaryOp:
+		return interpBinaryOp(f, ast)
+	case AstVariableRef:
+		return *interpVariable(f, ast.Module, ast.Name)
+	case AstFuncCall:
+		return interpFuncCall(f, ast)
+	case AstFuncRef:
+		funcDef, ok := interpFuncs[irSymbolName(ast.Module, ast.Name)]
+		if !ok {
+			// C functions are called with their own name
+			funcDef = &Ast{Type: AstExternFunction, Name: ast.Name}
+		}
+		return &interpClosure{funcDef: funcDef, file: interpSourceFiles[funcDef.Module]}
+	case AstFuncLiteral:
+		captures := map[string]interpValue{}
+		for _, capture := range ast.Children[3].Children {
+			captures[capture.Name] = *interpVariable(f, "", capture.Name)
+		}
+		return &interpClosure{funcDef: ast, captures: captures, bindings: f.bindings, file: f.file}
+	case AstClosureCall:
+		closure := interpExpression(f, ast.Children[0]).(*interpClosure)
+		if closure == nil {
+			f.panicf(ast, "call of nil function")
+		}
+		args := interpArgs(f, ast.Children[1:])
+		return interpCall(closure.funcDef, args, closure.captures, closure.bindings, closure.file)
+	case AstMethodCall:
+		return interpMethodCall(f, ast)
+	case AstInterfaceValue:
+		valueType := f.typeOf(ast.Children[0].DataType)
+		methods := map[string]*Ast{}
+		for _, ref := range ast.Children[1:] {
+			methods[ref.Name] = interpMethods[irMethodName(ref.Module, valueType, ref.Name)]
+		}
+		return interpInterface{value: interpExpression(f, ast.Children[0]), methods: methods}
+	case AstResultOk:
+		if len(ast.Children) == 0 {
+			return interpResult{ok: true}
+		}
+		return interpResult{ok: true, value: interpExpression(f, ast.Children[0])}
+	case AstResultErr:
+		return interpResult{err: interpExpression(f, ast.Children[0])}
+	case AstTry:
+		result := interpExpression(f, ast.Children[0]).(interpResult)
+		if !result.ok {
+			panic(interpReturn{value: interpResult{err: result.err}})
+		}
+		return result.value
+	case AstConversion:
+		return interpConversion(f, ast)
+	case AstNew:
+		value := interpZeroValue(f.typeOf(ast.Children[0].DataType))
+		return &value
+	case AstAddressOf:
+		if ast.Children[0].Type == AstDereference {
+			return interpPointer(f, ast.Children[0].Children[0])
+		}
+		return interpVariable(f, ast.Children[0].Module, ast.Children[0].Name)
+	case AstDereference:
+		return *interpPointer(f, ast.Children[0])
+	case AstIndex:
+		return interpIndex(f, ast)
+	case AstSlice:
+		return interpSlice(f, ast)
+	default:
+		log.Fatalf("[Interpreter]: Unsupported expression %s", ast.Type)
+	}
+	return nil
+}
+
+func interpArgs(f *interpFrame, args []*Ast) (values []interpValue) {
+	for _, arg := range args {
+		values = append(values, interpExpression(f, arg))
+	}
+	return values
+}
+
+func interpFuncCall(f *interpFrame, ast *Ast) interpValue {
+	args := interpArgs(f, ast.Children)
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, f.typeOf(arg.DataType))
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[Interpreter]: %s", err)
+		}
+		result, failure := interpBuiltin(builtin.CName, args)
+		if failure != "" {
+			f.panicf(ast, "%s", failure)
+		}
+		return result
+	}
+
+	funcDef, ok := interpFuncs[irSymbolName(ast.Module, ast.Name)]
+	if !ok {
+		funcDef = &Ast{Type: AstExternFunction, Name: ast.Name}
+	}
+	var bindings map[TypeAnnotation]TypeAnnotation
+	if len(ast.TypeArgs) > 0 {
+		bindings = map[TypeAnnotation]TypeAnnotation{}
+		for i, typeParam := range funcTypeParams(funcDef) {
+			bindings[typeParam] = f.typeOf(ast.TypeArgs[i])
+		}
+	}
+	return interpCall(funcDef, args, nil, bindings, interpSourceFiles[funcDef.Module])
+}
+
+// Calls a method, methods of interfaces are looked up in the interface
+// value and the methods of results are builtin.
+func interpMethodCall(f *interpFrame, ast *Ast) interpValue {
+	receiverType := f.typeOf(ast.Children[0].DataType)
+	args := interpArgs(f, ast.Children)
+	switch {
+	case isResultType(receiverType):
+		return interpResultMethod(f, ast, args[0].(interpResult), args[1:])
+	case isInterfaceType(receiverType):
+		iface := args[0].(interpInterface)
+		method := iface.methods[ast.Name]
+		if method == nil {
+			f.panicf(ast, "method %s called on nil interface", ast.Name)
+		}
+		args[0] = iface.value
+		return interpCall(method, args, nil, nil, interpSourceFiles[method.Module])
+	}
+	method, ok := interpMethods[irMethodName(ast.Module, receiverType, ast.Name)]
+	if !ok {
+		log.Fatalf("[Interpreter]: Unknown method %s of type '%s'", ast.Name, receiverType)
+	}
+	return interpCall(method, args, nil, nil, interpSourceFiles[method.Module])
+}
+
+func interpResultMethod(f *interpFrame, ast *Ast, result interpResult, args []interpValue) interpValue {
+	switch ast.Name {
+	case "is_ok":
+		return result.ok
+	case "is_err":
+		return !result.ok
+	case "value_or":
+		if result.ok {
+			return result.value
+		}
+		return args[0]
+	case "value":
+		if !result.ok {
+			f.panicf(ast, "value of a failed result")
+		}
+		return result.value
+	case "error":
+		if result.ok {
+			f.panicf(ast, "error of a successful result")
+		}
+		return result.err
+	}
+	log.Fatalf("[Interpreter]: Unknown method %s of results", ast.Name)
+	return nil
+}
+
+// Prints the values separated by spaces, all the values are
+// evaluated before printing as for a call of printf.
+func interpPrint(f *interpFrame, ast *Ast) {
+	var line string
+	for _, param := range ast.Children {
+		line += interpFormat(interpExpression(f, param), f.typeOf(param.DataType)) + " "
+	}
+	interpStdout.WriteString(line + "\n")
+}
@@ -0,0 +1,162 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Examples the interpreter can't run, it has no foreign functions.
+var interpSkippedExamples = map[string]bool{
+	"ffi.sowo": true,
+}
+
+// A backend whose runs of the programs are compared with the interpreter.
+// run returns the standard output, the standard error and the exit code.
+type differentialBackend struct {
+	name string
+	// Returns why the backend can't run here, empty when it can.
+	unavailable func() string
+	run         func(t *testing.T, options CompilerOptions, args []string) (string, string, int)
+}
+
+var differentialBackends = []differentialBackend{
+	{"c", noCCompiler, func(t *testing.T, options CompilerOptions, args []string) (string, string, int) {
+		return runWithBackend(t, cBackend{}, options, args)
+	}},
+	{"vm", func() string { return "" }, runWithVM},
+	{"x86_64", noX86_64, func(t *testing.T, options CompilerOptions, args []string) (string, string, int) {
+		return runWithBackend(t, x86_64Backend{}, options, args)
+	}},
+}
+
+// Returns the programs of the differential test: the examples and
+// the programs in testdata checking the evaluation order.
+func differentialPrograms(t *testing.T) []string {
+	var files []string
+	for _, pattern := range []string{
+		filepath.Join("..", "examples", "*.sowo"),
+		filepath.Join("testdata", "programs", "*.sowo"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			t.Fatalf("no programs found in %s: %v", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// Runs every program with the interpreter and with every backend,
+// the output and the exit code must be the same.
+func TestBackendsMatchInterpreter(t *testing.T) {
+	for _, file := range differentialPrograms(t) {
+		if interpSkippedExamples[filepath.Base(file)] {
+			continue
+		}
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			options := CompilerOptions{InputFile: file}
+			args := []string{file, "a", "b"}
+
+			var interpOut, interpErr bytes.Buffer
+			interpCode := SowoInterpretFile(options, args, strings.NewReader(""), &interpOut, &interpErr)
+			for _, backend := range differentialBackends {
+				if reason := backend.unavailable(); reason != "" {
+					t.Logf("%s skipped: %s", backend.name, reason)
+					continue
+				}
+				out, errOut, code := backend.run(t, options, args)
+				if interpOut.String() != out {
+					t.Errorf("%s: stdout differs\ninterpreter: %q\n%-12s %q", backend.name, interpOut.String(), backend.name+":", out)
+				}
+				if interpErr.String() != errOut {
+					t.Errorf("%s: stderr differs\ninterpreter: %q\n%-12s %q", backend.name, interpErr.String(), backend.name+":", errOut)
+				}
+				if interpCode != code {
+					t.Errorf("%s: exit code differs: interpreter %d, %s %d", backend.name, interpCode, backend.name, code)
+				}
+			}
+		})
+	}
+}
+
+func noCCompiler() string {
+	if _, err := exec.LookPath(cCompiler(CompilerOptions{})); err != nil {
+		return "no C compiler"
+	}
+	return ""
+}
+
+// The assembly is for x86-64 Linux and is linked by the C compiler.
+func noX86_64() string {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return "not an x86-64 Linux host"
+	}
+	return noCCompiler()
+}
+
+// Compiles the program to bytecode and runs it with the virtual
+// machine, the bytecode goes through a file like with build --bytecode.
+func runWithVM(t *testing.T, options CompilerOptions, args []string) (string, string, int) {
+	var file bytes.Buffer
+	if err := writeBytecode(&file, compileBytecode(*loadAndCheckProgram(options), options)); err != nil {
+		t.Fatal(err)
+	}
+	program, err := readBytecode(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := runBytecode(program, args, strings.NewReader(""), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+// Builds the program with the backend and runs it with given args,
+// the first one is the program name.
+func runWithBackend(t *testing.T, backend ExecutableBackend, options CompilerOptions, args []string) (string, string, int) {
+	dir, err := ioutil.TempDir("", "sowo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	code, err := backend.Emit(*loadAndCheckProgram(options), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceFile := filepath.Join(dir, "main"+backend.Extension())
+	if err := ioutil.WriteFile(sourceFile, code, 0666); err != nil {
+		t.Fatal(err)
+	}
+	exeFile := filepath.Join(dir, "main")
+	if err := backend.BuildExecutable(sourceFile, exeFile, options); err != nil {
+		t.Fatal(err)
+	}
+	return runExecutable(t, exeFile, args)
+}
+
+// Runs the executable with given args and no input, the first
+// arg is the program name.
+func runExecutable(t *testing.T, exeFile string, args []string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exeFile, args[1:]...)
+	cmd.Args[0] = args[0]
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatal(err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	return stdout.String(), stderr.String(), exitCode
+}
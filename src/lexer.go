@@ -4,14 +4,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Struct representing a lexer.
 type Lexer struct {
 	// The program string in input.
 	Input string
+	// Emit the comments as TokenComment instead of dropping them.
+	KeepComments bool
 }
 
 // Converts the program string in input to a list of tokens
@@ -19,7 +23,17 @@ func (lex *Lexer) tokenize() (tokens []Token) {
 	source := lex.Input
 	source = trimSpaceAndNewLine(source)
 
+	// Position of the character at offset in the input
+	offset, line, col := 0, 1, 1
 	for !isEmpty(source) {
+		for ; offset < len(lex.Input)-len(source); offset++ {
+			if lex.Input[offset] == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+		first := len(tokens)
 		if isSymbolStart(getFirst(source)) {
 			// Tokenize a valid symbol
 			textSymbol, tail := chopWhile(source, isSymbol)
@@ -27,121 +41,198 @@ func (lex *Lexer) tokenize() (tokens []Token) {
 
 			switch textSymbol {
 			case "fun":
-				tokens = append(tokens, Token{TokenFunc, textSymbol})
+				tokens = append(tokens, Token{Type: TokenFunc, Value: textSymbol})
 			case "var":
-				tokens = append(tokens, Token{TokenVar, textSymbol})
+				tokens = append(tokens, Token{Type: TokenVar, Value: textSymbol})
 			case "if":
-				tokens = append(tokens, Token{TokenIf, textSymbol})
+				tokens = append(tokens, Token{Type: TokenIf, Value: textSymbol})
 			case "else":
-				tokens = append(tokens, Token{TokenElse, textSymbol})
+				tokens = append(tokens, Token{Type: TokenElse, Value: textSymbol})
 			case "return":
-				tokens = append(tokens, Token{TokenReturn, textSymbol})
+				tokens = append(tokens, Token{Type: TokenReturn, Value: textSymbol})
 			case "while":
-				tokens = append(tokens, Token{TokenWhile, textSymbol})
+				tokens = append(tokens, Token{Type: TokenWhile, Value: textSymbol})
 			case "true":
-				tokens = append(tokens, Token{TokenTrue, textSymbol})
+				tokens = append(tokens, Token{Type: TokenTrue, Value: textSymbol})
 			case "false":
-				tokens = append(tokens, Token{TokenFalse, textSymbol})
+				tokens = append(tokens, Token{Type: TokenFalse, Value: textSymbol})
 			case "print":
-				tokens = append(tokens, Token{TokenPrint, textSymbol})
+				tokens = append(tokens, Token{Type: TokenPrint, Value: textSymbol})
+			case "new":
+				tokens = append(tokens, Token{Type: TokenNew, Value: textSymbol})
+			case "const":
+				tokens = append(tokens, Token{Type: TokenConst, Value: textSymbol})
+			case "import":
+				tokens = append(tokens, Token{Type: TokenImport, Value: textSymbol})
+			case "pub":
+				tokens = append(tokens, Token{Type: TokenPub, Value: textSymbol})
+			case "extern":
+				tokens = append(tokens, Token{Type: TokenExtern, Value: textSymbol})
+			case "interface":
+				tokens = append(tokens, Token{Type: TokenInterface, Value: textSymbol})
+			case "ok":
+				tokens = append(tokens, Token{Type: TokenOk, Value: textSymbol})
+			case "err":
+				tokens = append(tokens, Token{Type: TokenErr, Value: textSymbol})
 			default:
-				tokens = append(tokens, Token{TokenSymbol, textSymbol})
+				tokens = append(tokens, Token{Type: TokenSymbol, Value: textSymbol})
 			}
 		} else if isNumberLiteral(getFirst(source)) {
-			// Tokenize a number literal
+			// Tokenize a number literal, it becomes a float literal
+			// when it has a fractional part or an exponent
 			numberSymbol, tail := chopWhile(source, isNumber)
+			isFloat := false
+			if len(tail) > 1 && tail[0] == '.' && isNumber(rune(tail[1])) {
+				fraction, rest := chopWhile(tail[1:], isNumber)
+				numberSymbol += "." + fraction
+				tail = rest
+				isFloat = true
+			}
+			if exponent, rest, ok := chopExponent(tail); ok {
+				numberSymbol += exponent
+				tail = rest
+				isFloat = true
+			}
 			source = tail
-			tokens = append(tokens, Token{TokenNumberLiteral, numberSymbol})
+			if isFloat {
+				tokens = append(tokens, Token{Type: TokenFloatLiteral, Value: numberSymbol})
+			} else {
+				tokens = append(tokens, Token{Type: TokenNumberLiteral, Value: numberSymbol})
+			}
 		} else if isStringLiteral(getFirst(source)) {
 			// Tokenize a string literal
-			_, source = chopOff(source, 1)
-			strLiteral, tail := chopWhile(source, func(r rune) bool { return !isStringLiteral(r) })
-			_, source = chopOff(tail, 1)
-			tokens = append(tokens, Token{TokenStringLiteral, strLiteral})
+			strLiteral, tail := chopQuoted(source, '"')
+			source = tail
+			// Strings are NUL terminated in the generated programs
+			if strings.IndexByte(strLiteral, 0) >= 0 {
+				log.Fatalf("[Lexer]: String literal %q can't contain the null character", strLiteral)
+			}
+			tokens = append(tokens, Token{Type: TokenStringLiteral, Value: strLiteral})
+		} else if isCharLiteral(getFirst(source)) {
+			// Tokenize a char literal
+			charLiteral, tail := chopQuoted(source, '\'')
+			source = tail
+			if len(charLiteral) != 1 {
+				log.Fatalf("[Lexer]: Char literal '%s' must contain exactly one byte", charLiteral)
+			}
+			tokens = append(tokens, Token{Type: TokenCharLiteral, Value: charLiteral})
 		} else {
 			switch getFirst(source) {
 			case '(':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenOpenParen, tokenStr})
+				tokens = append(tokens, Token{Type: TokenOpenParen, Value: tokenStr})
 			case ')':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenCloseParen, tokenStr})
+				tokens = append(tokens, Token{Type: TokenCloseParen, Value: tokenStr})
 			case '{':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenOpenCurly, tokenStr})
+				tokens = append(tokens, Token{Type: TokenOpenCurly, Value: tokenStr})
 			case '}':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenCloseCurly, tokenStr})
+				tokens = append(tokens, Token{Type: TokenCloseCurly, Value: tokenStr})
+			case '[':
+				tokenStr, tail := chopOff(source, 1)
+				source = tail
+				tokens = append(tokens, Token{Type: TokenOpenBracket, Value: tokenStr})
+			case ']':
+				tokenStr, tail := chopOff(source, 1)
+				source = tail
+				tokens = append(tokens, Token{Type: TokenCloseBracket, Value: tokenStr})
 			case ':':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenColon, tokenStr})
+				tokens = append(tokens, Token{Type: TokenColon, Value: tokenStr})
 			case ',':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenComma, tokenStr})
+				tokens = append(tokens, Token{Type: TokenComma, Value: tokenStr})
 			case ';':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenSemicolon, tokenStr})
+				tokens = append(tokens, Token{Type: TokenSemicolon, Value: tokenStr})
 			case '=':
 				if source[1] == '=' {
 					tokenStr, tail := chopOff(source, 2)
 					source = tail
-					tokens = append(tokens, Token{TokenEqualEqual, tokenStr})
+					tokens = append(tokens, Token{Type: TokenEqualEqual, Value: tokenStr})
 				} else {
 					tokenStr, tail := chopOff(source, 1)
 					source = tail
-					tokens = append(tokens, Token{TokenEqual, tokenStr})
+					tokens = append(tokens, Token{Type: TokenEqual, Value: tokenStr})
 				}
 			case '<':
 				if source[1] == '=' {
 					tokenStr, tail := chopOff(source, 2)
 					source = tail
-					tokens = append(tokens, Token{TokenLessThenEqual, tokenStr})
+					tokens = append(tokens, Token{Type: TokenLessThenEqual, Value: tokenStr})
 				} else {
 					tokenStr, tail := chopOff(source, 1)
 					source = tail
-					tokens = append(tokens, Token{TokenLessThen, tokenStr})
+					tokens = append(tokens, Token{Type: TokenLessThen, Value: tokenStr})
 				}
 			case '>':
 				if source[1] == '=' {
 					tokenStr, tail := chopOff(source, 2)
 					source = tail
-					tokens = append(tokens, Token{TokenGreaterThenEqual, tokenStr})
+					tokens = append(tokens, Token{Type: TokenGreaterThenEqual, Value: tokenStr})
 				} else {
 					tokenStr, tail := chopOff(source, 1)
 					source = tail
-					tokens = append(tokens, Token{TokenGreaterThen, tokenStr})
+					tokens = append(tokens, Token{Type: TokenGreaterThen, Value: tokenStr})
 				}
 			case '+':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenPlus, tokenStr})
+				tokens = append(tokens, Token{Type: TokenPlus, Value: tokenStr})
 			case '-':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenMinus, tokenStr})
+				tokens = append(tokens, Token{Type: TokenMinus, Value: tokenStr})
 			case '*':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenAsterisk, tokenStr})
+				tokens = append(tokens, Token{Type: TokenAsterisk, Value: tokenStr})
 			case '/':
 				tokenStr, tail := chopOff(source, 1)
 				source = tail
-				tokens = append(tokens, Token{TokenSlash, tokenStr})
+				tokens = append(tokens, Token{Type: TokenSlash, Value: tokenStr})
+			case '.':
+				tokenStr, tail := chopOff(source, 1)
+				source = tail
+				tokens = append(tokens, Token{Type: TokenDot, Value: tokenStr})
+			case '&':
+				tokenStr, tail := chopOff(source, 1)
+				source = tail
+				tokens = append(tokens, Token{Type: TokenAmpersand, Value: tokenStr})
+			case '?':
+				tokenStr, tail := chopOff(source, 1)
+				source = tail
+				tokens = append(tokens, Token{Type: TokenQuestion, Value: tokenStr})
 			case '#':
+				if len(source) > 1 && source[1] == '[' {
+					// Start of an attribute (e.g. `#[include("math.h")]`)
+					tokenStr, tail := chopOff(source, 1)
+					source = tail
+					tokens = append(tokens, Token{Type: TokenHash, Value: tokenStr})
+					break
+				}
 				// The comments are dumped since are not needed in next steps
-				_, tail := chopWhile(source, func(r rune) bool { return !isLineBreak(r) })
+				comment, tail := chopWhile(source, func(r rune) bool { return !isLineBreak(r) })
 				source = tail
+				if lex.KeepComments {
+					tokens = append(tokens, Token{Type: TokenComment, Value: strings.TrimRight(comment, " \t\r")})
+				}
 			default:
 				log.Fatal("[Lexer]: Unexpected character '", string(getFirst(source)), "'")
 			}
 		}
+		if len(tokens) > first {
+			tokens[first].Line, tokens[first].Col = line, col
+		}
 		source = trimSpaceAndNewLine(source)
 	}
 	return tokens
@@ -150,7 +241,7 @@ func (lex *Lexer) tokenize() (tokens []Token) {
 // Print all the tokens
 func DumpTokens(w io.Writer, tokens []Token) {
 	for _, token := range tokens {
-		fmt.Fprintf(w, "%s -> \"%s\"\n", token.Type, token.Value)
+		fmt.Fprintf(w, "%s -> %q\n", token.Type, token.Value)
 	}
 }
 
@@ -166,6 +257,79 @@ func chopWhile(in string, predicate func(r rune) bool) (head string, tail string
 	return chopOff(in, n)
 }
 
+// Chops a literal enclosed between two quote characters and returns
+// its content with all the escape sequences replaced.
+// Supported escape sequences are \n, \t, \r, \0, \", \', \\ and \u{...},
+// only char literals can contain \0.
+func chopQuoted(in string, quote byte) (value string, tail string) {
+	var content strings.Builder
+	n := 1
+	for {
+		if n >= len(in) || isLineBreak(rune(in[n])) {
+			log.Fatalf("[Lexer]: Unterminated literal %s", in[:n])
+		}
+		if in[n] == quote {
+			break
+		}
+		if in[n] != '\\' {
+			content.WriteByte(in[n])
+			n++
+			continue
+		}
+
+		if n+1 >= len(in) {
+			log.Fatalf("[Lexer]: Unterminated literal %s", in[:n])
+		}
+		switch in[n+1] {
+		case 'n':
+			content.WriteByte('\n')
+		case 't':
+			content.WriteByte('\t')
+		case 'r':
+			content.WriteByte('\r')
+		case '0':
+			content.WriteByte(0)
+		case '"', '\'', '\\':
+			content.WriteByte(in[n+1])
+		case 'u':
+			end := strings.IndexByte(in[n:], '}')
+			if n+2 >= len(in) || in[n+2] != '{' || end < 0 {
+				log.Fatal("[Lexer]: Unicode escape sequence must have the form \\u{...}")
+			}
+			hex := in[n+3 : n+end]
+			codePoint, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || !utf8.ValidRune(rune(codePoint)) {
+				log.Fatalf("[Lexer]: Invalid unicode code point '%s'", hex)
+			}
+			content.WriteRune(rune(codePoint))
+			n += end + 1
+			continue
+		default:
+			log.Fatalf("[Lexer]: Unknown escape sequence '\\%c'", in[n+1])
+		}
+		n += 2
+	}
+	return content.String(), in[n+1:]
+}
+
+// Chops the exponent of a float literal (e.g. `e-3`) if the
+// input starts with one.
+func chopExponent(in string) (head string, tail string, ok bool) {
+	if len(in) < 2 || (in[0] != 'e' && in[0] != 'E') {
+		return "", in, false
+	}
+	n := 1
+	if in[n] == '+' || in[n] == '-' {
+		n++
+	}
+	if n >= len(in) || !isNumber(rune(in[n])) {
+		return "", in, false
+	}
+	digits, _ := chopWhile(in[n:], isNumber)
+	head, tail = chopOff(in, n+len(digits))
+	return head, tail, true
+}
+
 func trimSpaceAndNewLine(in string) string {
 	return strings.TrimLeftFunc(in, func(r rune) bool {
 		return isSpace(r) || isTab(r) || isLineBreak(r)
@@ -196,6 +360,10 @@ func isStringLiteral(s rune) bool {
 	return s == '"'
 }
 
+func isCharLiteral(s rune) bool {
+	return s == '\''
+}
+
 func isNumber(s rune) bool {
 	return unicode.IsNumber(s)
 }
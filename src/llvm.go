@@ -0,0 +1,1302 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The LLVM backend emits textual LLVM IR from the type checked tree.
+// Local variables are allocas in the entry block of their function, so
+// that the IR is in SSA form without phi nodes and `opt -mem2reg` can
+// promote them to registers. Pointers are typed (e.g. `i32*`) since the
+// text is read by LLVM 14, later versions read them as opaque pointers.
+//
+// Values have the same layout as in the C backend: bools are i1 and
+// become C ints only when passed to C functions, function values are a
+// sowo_closure, interface values a sowo_interface and every result type
+// gets a struct with the ok flag, the value and the error. The program
+// is linked with the runtime library (see cRuntime) compiled from C.
+type llvmGenerator struct {
+	text         strings.Builder
+	types        strings.Builder
+	globals      strings.Builder
+	declarations strings.Builder
+	declared     map[string]bool
+	strings      map[string]string
+	// Result types given a named struct so far.
+	resultTypes map[TypeAnnotation]bool
+	checked     bool
+	sourceFiles map[string]string
+	funcDefs    map[string]*Ast
+	externs     map[string]*Ast
+	// Functions emitted or waiting to be emitted by name.
+	functions map[string]bool
+	pending   []llvmFunctionDef
+	vtables   map[string]string
+	literals  int
+
+	// State of the function being emitted.
+	allocas strings.Builder
+	out     strings.Builder
+	scopes  []map[string]string
+	// Locals whose address is taken, stored in cells (see irBoxed).
+	boxed      map[string]bool
+	values     int
+	labels     int
+	terminated bool
+	file       string
+	returnType TypeAnnotation
+}
+
+// A function to emit: a sowo function, a function literal taking its
+// environment as first argument or a wrapper calling a function.
+type llvmFunctionDef struct {
+	name     string
+	def      *Ast
+	public   bool
+	captures []*Ast
+	file     string
+	// Function called by a wrapper and type of the value whose
+	// method is called by a vtable wrapper.
+	callee    string
+	valueType TypeAnnotation
+	wrapper   bool
+}
+
+// Generates LLVM IR, compiled by llc and linked with the runtime
+// library by the C compiler.
+type llvmBackend struct{}
+
+func (llvmBackend) Name() string      { return "llvm" }
+func (llvmBackend) Extension() string { return ".ll" }
+
+func (llvmBackend) Emit(program Ast, options CompilerOptions) ([]byte, error) {
+	return []byte(generateLLVM(program, options)), nil
+}
+
+func (llvmBackend) BuildExecutable(sourceFile string, exeFile string, options CompilerOptions) error {
+	objectFile := strings.TrimSuffix(sourceFile, filepath.Ext(sourceFile)) + ".o"
+	args := []string{"-filetype=obj", "-relocation-model=pic"}
+	switch options.OptLevel {
+	case "0", "1", "2", "3":
+		args = append(args, "-O"+options.OptLevel)
+	}
+	args = append(args, sourceFile, "-o", objectFile)
+	cmd := exec.Command("llc", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("cannot run llc: %s", err)
+		}
+		return fmt.Errorf("llc %s failed:\n%s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	defer os.Remove(objectFile)
+	return compileWithRuntime([]string{objectFile}, exeFile, options)
+}
+
+// Returns the LLVM IR of a type checked program.
+func generateLLVM(ast Ast, options CompilerOptions) string {
+	if ast.Type != AstProgram {
+		log.Fatalf("[LLVM]: Unsupported top level %s", ast.Type)
+	}
+	l := &llvmGenerator{
+		declared:    map[string]bool{},
+		strings:     map[string]string{},
+		resultTypes: map[TypeAnnotation]bool{},
+		checked:     !options.Unchecked,
+		sourceFiles: map[string]string{},
+		funcDefs:    map[string]*Ast{},
+		externs:     map[string]*Ast{},
+		functions:   map[string]bool{},
+		vtables:     map[string]string{},
+	}
+	for _, module := range ast.Children {
+		l.sourceFiles[module.Name] = module.StringDataValue
+		for _, def := range module.Children {
+			switch def.Type {
+			case AstFunction:
+				l.funcDefs[irSymbolName(def.Module, def.Name)] = def
+			case AstExternFunction:
+				l.externs[def.Name] = def
+			}
+		}
+	}
+
+	l.globalsInit(ast)
+	entryModule := ast.Children[len(ast.Children)-1]
+	l.main(irSymbolName(entryModule.Name, "main"))
+	for _, module := range ast.Children {
+		for _, def := range module.Children {
+			switch {
+			case def.Type == AstFunction && funcTypeParams(def) == nil:
+				l.function(irSymbolName(def.Module, def.Name), def, def.Public)
+			case def.Type == AstMethod:
+				l.function(irMethodName(def.Module, methodReceiverType(def), def.Name), def, def.Public)
+			}
+		}
+	}
+	for len(l.pending) > 0 {
+		next := l.pending[0]
+		l.pending = l.pending[1:]
+		l.emitFunction(next)
+	}
+
+	var value strings.Builder
+	value.WriteString("%sowo_slice = type { i64, i8* }\n")
+	value.WriteString("%sowo_closure = type { i8*, i8* }\n")
+	value.WriteString("%sowo_interface = type { i8*, i8* }\n")
+	value.WriteString(l.types.String())
+	value.WriteString("\n")
+	value.WriteString(l.globals.String())
+	value.WriteString("\n")
+	value.WriteString(l.declarations.String())
+	value.WriteString("\n")
+	value.WriteString(l.text.String())
+	return value.String()
+}
+
+// Requests a function to be emitted, once.
+func (l *llvmGenerator) function(name string, def *Ast, public bool) {
+	if !l.functions[name] {
+		l.functions[name] = true
+		l.pending = append(l.pending, llvmFunctionDef{name: name, def: def, public: public, file: l.sourceFiles[def.Module]})
+	}
+}
+
+// Declares a function of the C library or of the runtime, once.
+func (l *llvmGenerator) declare(name string, declaration string) {
+	if !l.declared[name] {
+		l.declared[name] = true
+		fmt.Fprintf(&l.declarations, "declare %s\n", declaration)
+	}
+}
+
+// Returns the LLVM type of a sowo type.
+func (l *llvmGenerator) llvmType(t TypeAnnotation) string {
+	switch t {
+	case TypeVoid:
+		return "void"
+	case TypeBoolean:
+		return "i1"
+	case TypeInteger, TypeI32, TypeU32:
+		return "i32"
+	case TypeI8, TypeU8, TypeChar:
+		return "i8"
+	case TypeI16, TypeU16:
+		return "i16"
+	case TypeI64, TypeU64:
+		return "i64"
+	case TypeF32:
+		return "float"
+	case TypeF64:
+		return "double"
+	case TypeString:
+		return "i8*"
+	}
+	switch {
+	case isPointerType(t):
+		return l.llvmType(pointerElem(t)) + "*"
+	case isSliceType(t):
+		return "%sowo_slice"
+	case isFuncType(t):
+		return "%sowo_closure"
+	case isInterfaceType(t):
+		return "%sowo_interface"
+	case isResultType(t):
+		name := "%sowo_" + irTypeName(t)
+		if !l.resultTypes[t] {
+			l.resultTypes[t] = true
+			valueType, errorType := resultTypes(t)
+			fields := []string{"i1"}
+			if valueType != TypeVoid {
+				fields = append(fields, l.llvmType(valueType))
+			}
+			fields = append(fields, l.llvmType(errorType))
+			fmt.Fprintf(&l.types, "%s = type { %s }\n", name, strings.Join(fields, ", "))
+		}
+		return name
+	}
+	log.Fatalf("[LLVM]: Unsupported type %s", t)
+	return ""
+}
+
+// Returns the type of a value passed to a C function, bools are ints.
+func (l *llvmGenerator) cType(t TypeAnnotation) string {
+	if t == TypeBoolean {
+		return "i32"
+	}
+	return l.llvmType(t)
+}
+
+// Returns the attribute extending a small integer passed to or
+// returned by a C function, as the C calling convention requires.
+func llvmExtension(t TypeAnnotation) string {
+	switch t {
+	case TypeI8, TypeI16, TypeChar:
+		return "signext "
+	case TypeU8, TypeU16:
+		return "zeroext "
+	}
+	return ""
+}
+
+// Returns the size of a type as a constant expression.
+func (l *llvmGenerator) sizeOf(t string) string {
+	return fmt.Sprintf("ptrtoint (%s* getelementptr (%s, %s* null, i32 1) to i64)", t, t, t)
+}
+
+func isSignedType(t TypeAnnotation) bool {
+	switch t {
+	case TypeInteger, TypeI8, TypeI16, TypeI32, TypeI64, TypeChar:
+		return true
+	}
+	return false
+}
+
+// Returns the number of bits of an integer type.
+func llvmBits(t TypeAnnotation) int {
+	switch t {
+	case TypeBoolean:
+		return 1
+	case TypeI8, TypeU8, TypeChar:
+		return 8
+	case TypeI16, TypeU16:
+		return 16
+	case TypeI64, TypeU64:
+		return 64
+	}
+	return 32
+}
+
+// Formats an integer constant of given type, wrapped to its bits.
+func llvmInteger(value int64, t TypeAnnotation) string {
+	switch llvmBits(t) {
+	case 8:
+		return fmt.Sprint(int8(value))
+	case 16:
+		return fmt.Sprint(int16(value))
+	case 32:
+		return fmt.Sprint(int32(value))
+	}
+	return fmt.Sprint(value)
+}
+
+// Formats a float constant, LLVM takes floats and doubles written
+// as the bits of a double.
+func llvmFloat(value float64, t TypeAnnotation) string {
+	if t == TypeF32 {
+		value = float64(float32(value))
+	}
+	return fmt.Sprintf("0x%016X", math.Float64bits(value))
+}
+
+// Returns a pointer to a string constant.
+func (l *llvmGenerator) stringConstant(s string) string {
+	name, ok := l.strings[s]
+	arrayType := fmt.Sprintf("[%d x i8]", len(s)+1)
+	if !ok {
+		name = fmt.Sprintf("@.str.%d", len(l.strings))
+		l.strings[s] = name
+		var value strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] >= ' ' && s[i] <= '~' && s[i] != '"' && s[i] != '\\' {
+				value.WriteByte(s[i])
+			} else {
+				fmt.Fprintf(&value, "\\%02X", s[i])
+			}
+		}
+		fmt.Fprintf(&l.globals, "%s = private unnamed_addr constant %s c\"%s\\00\"\n", name, arrayType, value.String())
+	}
+	return fmt.Sprintf("getelementptr inbounds (%s, %s* %s, i64 0, i64 0)", arrayType, arrayType, name)
+}
+
+func (l *llvmGenerator) startFunction(returnType TypeAnnotation, file string) {
+	l.allocas.Reset()
+	l.out.Reset()
+	l.scopes = []map[string]string{{}}
+	l.boxed = map[string]bool{}
+	l.values = 0
+	l.labels = 0
+	l.terminated = false
+	l.file = file
+	l.returnType = returnType
+}
+
+// Appends the function to the text, the allocas are placed
+// in the entry block before the body.
+func (l *llvmGenerator) endFunction(signature string) {
+	if !l.terminated {
+		if l.returnType == TypeVoid {
+			l.emit("ret void")
+		} else {
+			l.emit("ret %s zeroinitializer", l.llvmType(l.returnType))
+		}
+	}
+	fmt.Fprintf(&l.text, "define %s {\nentry:\n%s%s}\n\n", signature, l.allocas.String(), l.out.String())
+}
+
+func (l *llvmGenerator) emit(format string, args ...interface{}) {
+	if l.terminated {
+		// Code after a return or a panic is never reached
+		l.placeLabel(l.label())
+	}
+	fmt.Fprintf(&l.out, "  "+format+"\n", args...)
+}
+
+// Emits an instruction ending the current block.
+func (l *llvmGenerator) terminate(format string, args ...interface{}) {
+	l.emit(format, args...)
+	l.terminated = true
+}
+
+// Emits an instruction and returns the value it defines.
+func (l *llvmGenerator) value(format string, args ...interface{}) string {
+	l.values++
+	name := fmt.Sprintf("%%t%d", l.values)
+	l.emit("%s = "+format, append([]interface{}{name}, args...)...)
+	return name
+}
+
+func (l *llvmGenerator) label() string {
+	l.labels++
+	return fmt.Sprintf("L%d", l.labels)
+}
+
+// Starts a new block, the previous one falls through to it.
+func (l *llvmGenerator) placeLabel(label string) {
+	if !l.terminated {
+		fmt.Fprintf(&l.out, "  br label %%%s\n", label)
+	}
+	fmt.Fprintf(&l.out, "%s:\n", label)
+	l.terminated = false
+}
+
+// Declares a local variable of given type, returns its address. The
+// variables whose address is taken get a new cell (see irBoxed).
+func (l *llvmGenerator) declareLocal(name string, t TypeAnnotation) string {
+	var address string
+	if l.boxed[name] {
+		l.declare("sowo_alloc", "i8* @sowo_alloc(i64)")
+		cell := l.value("call i8* @sowo_alloc(i64 %s)", l.sizeOf(l.llvmType(t)))
+		address = l.value("bitcast i8* %s to %s*", cell, l.llvmType(t))
+	} else {
+		l.values++
+		address = fmt.Sprintf("%%%s.%d", name, l.values)
+		fmt.Fprintf(&l.allocas, "  %s = alloca %s\n", address, l.llvmType(t))
+	}
+	l.scopes[len(l.scopes)-1][name] = address
+	return address
+}
+
+// Returns the address of a variable, a local or a global.
+func (l *llvmGenerator) variable(module string, name string) string {
+	if module == "" {
+		for i := len(l.scopes) - 1; i >= 0; i-- {
+			if address, ok := l.scopes[i][name]; ok {
+				return address
+			}
+		}
+	}
+	return "@" + irSymbolName(module, name)
+}
+
+// Emits the initialisation of the globals in the order they are
+// declared, before that they hold the zero value of their type. The
+// globals holding references are roots of the collector.
+func (l *llvmGenerator) globalsInit(ast Ast) {
+	l.startFunction(TypeVoid, "")
+	for _, module := range ast.Children {
+		l.file = module.StringDataValue
+		for _, def := range module.Children {
+			if def.Type != AstGlobalVariable && def.Type != AstGlobalConstant {
+				continue
+			}
+			varType := def.Children[0].Children[0].DataType
+			name := "@" + irSymbolName(def.Module, def.Name)
+			linkage := "internal "
+			if def.Public {
+				linkage = ""
+			}
+			t := l.llvmType(varType)
+			zero := "zeroinitializer"
+			if varType == TypeString {
+				zero = l.stringConstant("")
+			}
+			fmt.Fprintf(&l.globals, "%s = %sglobal %s %s\n", name, linkage, t, zero)
+			l.emit("store %s %s, %s* %s", t, l.expression(def.Children[1]), t, name)
+			if holdsReference(varType) {
+				l.declare("sowo_gc_add_root", "void @sowo_gc_add_root(i8*, i64)")
+				l.emit("call void @sowo_gc_add_root(i8* bitcast (%s* %s to i8*), i64 %s)", t, name, l.sizeOf(t))
+			}
+		}
+	}
+	l.endFunction("internal void @sowo_init_globals()")
+}
+
+// Emits the C entry point calling the sowo main, see irMain.
+func (l *llvmGenerator) main(name string) {
+	def := l.funcDefs[name]
+	l.startFunction(TypeInteger, l.sourceFiles[def.Module])
+	l.declare("llvm.frameaddress.p0i8", "i8* @llvm.frameaddress.p0i8(i32)")
+	l.declare("sowo_gc_init", "void @sowo_gc_init(i8*)")
+	frame := l.value("call i8* @llvm.frameaddress.p0i8(i32 0)")
+	l.emit("call void @sowo_gc_init(i8* %s)", frame)
+	l.emit("call void @sowo_init_globals()")
+	var args string
+	if len(def.Children[0].Children) == 1 {
+		l.declare("sowo_args", "%sowo_slice @sowo_args(i32, i8**)")
+		args = "%sowo_slice " + l.value("call %%sowo_slice @sowo_args(i32 %%argc, i8** %%argv)")
+	}
+	l.function(name, def, false)
+
+	returnType := def.Children[1].Children[0].DataType
+	t := l.llvmType(returnType)
+	if returnType == TypeVoid {
+		l.emit("call void @%s(%s)", name, args)
+		l.terminate("ret i32 0")
+	} else {
+		result := l.value("call %s @%s(%s)", t, name, args)
+		if !isResultType(returnType) {
+			l.terminate("ret i32 %s", result)
+		} else {
+			valueType, errorType := resultTypes(returnType)
+			ok := l.value("extractvalue %s %s, 0", t, result)
+			failed, done := l.label(), l.label()
+			l.terminate("br i1 %s, label %%%s, label %%%s", ok, done, failed)
+			l.placeLabel(failed)
+			errorValue := l.value("extractvalue %s %s, %d", t, result, resultErrorIndex(returnType))
+			format, arg := l.printArgument(errorType, errorValue)
+			if !l.declared["stderr"] {
+				l.declared["stderr"] = true
+				fmt.Fprintf(&l.globals, "@stderr = external global i8*\n")
+			}
+			l.declare("fprintf", "i32 @fprintf(i8*, i8*, ...)")
+			stderr := l.value("load i8*, i8** @stderr")
+			l.emit("call i32 (i8*, i8*, ...) @fprintf(i8* %s, i8* %s, %s)", stderr, l.stringConstant("error: "+format+"\n"), arg)
+			l.terminate("ret i32 1")
+			l.placeLabel(done)
+			if valueType == TypeVoid {
+				l.terminate("ret i32 0")
+			} else {
+				l.terminate("ret i32 %s", l.value("extractvalue %s %s, 1", t, result))
+			}
+		}
+	}
+	l.endFunction("i32 @main(i32 %argc, i8** %argv)")
+}
+
+// Returns the index of the error in the struct of a result.
+func resultErrorIndex(t TypeAnnotation) int {
+	if valueType, _ := resultTypes(t); valueType == TypeVoid {
+		return 1
+	}
+	return 2
+}
+
+func (l *llvmGenerator) emitFunction(fn llvmFunctionDef) {
+	returnType := fn.def.Children[1].Children[0].DataType
+	l.startFunction(returnType, fn.file)
+	var params []string
+	if len(fn.captures) > 0 || fn.wrapper || fn.def.Type == AstFuncLiteral {
+		params = append(params, "i8* %env")
+	}
+	var args []string
+	for i, param := range fn.def.Children[0].Children {
+		t := l.llvmType(param.Children[0].DataType)
+		params = append(params, fmt.Sprintf("%s %%arg%d", t, i))
+		args = append(args, fmt.Sprintf("%s %%arg%d", t, i))
+	}
+	linkage := "internal "
+	if fn.public {
+		linkage = ""
+	}
+	signature := fmt.Sprintf("%s%s @%s(%s)", linkage, l.llvmType(returnType), fn.name, strings.Join(params, ", "))
+
+	if fn.wrapper {
+		l.wrapper(fn, args)
+		l.endFunction(signature)
+		return
+	}
+	irAddressTaken(fn.def.Children[2], l.boxed)
+	if len(fn.captures) > 0 {
+		// The captured variables are copied to locals
+		env := l.value("bitcast i8* %%env to %s*", l.envType(fn.captures))
+		for i, capture := range fn.captures {
+			captureType := capture.Children[0].DataType
+			t := l.llvmType(captureType)
+			field := l.value("getelementptr %s, %s* %s, i32 0, i32 %d", l.envType(fn.captures), l.envType(fn.captures), env, i)
+			value := l.value("load %s, %s* %s", t, t, field)
+			l.emit("store %s %s, %s* %s", t, value, t, l.declareLocal(capture.Name, captureType))
+		}
+	}
+	for i, param := range fn.def.Children[0].Children {
+		paramType := param.Children[0].DataType
+		t := l.llvmType(paramType)
+		l.emit("store %s %%arg%d, %s* %s", t, i, t, l.declareLocal(param.Name, paramType))
+	}
+	l.block(fn.def.Children[2])
+	l.endFunction(signature)
+}
+
+// Emits the body of a wrapper: the functions used as values take an
+// environment they ignore and the methods called through a vtable
+// take a pointer to a copy of their receiver.
+func (l *llvmGenerator) wrapper(fn llvmFunctionDef, args []string) {
+	returnType := fn.def.Children[1].Children[0].DataType
+	var call string
+	if fn.valueType != TypeVoid {
+		t := l.llvmType(fn.valueType)
+		receiver := l.value("bitcast i8* %%env to %s*", t)
+		args = append([]string{t + " " + l.value("load %s, %s* %s", t, t, receiver)}, args...)
+		call = fmt.Sprintf("call %s @%s(%s)", l.llvmType(returnType), fn.callee, strings.Join(args, ", "))
+	} else if extern, ok := l.externs[fn.callee]; ok {
+		var values []string
+		for i := range fn.def.Children[0].Children {
+			values = append(values, fmt.Sprintf("%%arg%d", i))
+		}
+		result := l.callExtern(extern, values)
+		if returnType == TypeVoid {
+			l.terminate("ret void")
+		} else {
+			l.terminate("ret %s %s", l.llvmType(returnType), result)
+		}
+		return
+	} else {
+		call = fmt.Sprintf("call %s @%s(%s)", l.llvmType(returnType), fn.callee, strings.Join(args, ", "))
+	}
+	if returnType == TypeVoid {
+		l.emit("%s", call)
+		l.terminate("ret void")
+	} else {
+		l.terminate("ret %s %s", l.llvmType(returnType), l.value("%s", call))
+	}
+}
+
+// Returns the type of the environment of a function literal.
+func (l *llvmGenerator) envType(captures []*Ast) string {
+	var fields []string
+	for _, capture := range captures {
+		fields = append(fields, l.llvmType(capture.Children[0].DataType))
+	}
+	return "{ " + strings.Join(fields, ", ") + " }"
+}
+
+func (l *llvmGenerator) block(ast *Ast) {
+	l.scopes = append(l.scopes, map[string]string{})
+	defer func() { l.scopes = l.scopes[:len(l.scopes)-1] }()
+
+	for _, statement := range ast.Children {
+		switch statement.Type {
+		case AstLocalVariable:
+			varType := statement.Children[0].Children[0].DataType
+			value := l.expression(statement.Children[1])
+			t := l.llvmType(varType)
+			l.emit("store %s %s, %s* %s", t, value, t, l.declareLocal(statement.Children[0].Name, varType))
+		case AstAssignment:
+			t := l.llvmType(statement.Children[0].DataType)
+			value := l.expression(statement.Children[0])
+			l.emit("store %s %s, %s* %s", t, value, t, l.variable(statement.Module, statement.Name))
+		case AstDerefAssignment:
+			t := l.llvmType(statement.Children[1].DataType)
+			pointer := l.expression(statement.Children[0])
+			value := l.expression(statement.Children[1])
+			l.nilCheck(t+"*", pointer, statement, "nil pointer dereference")
+			l.emit("store %s %s, %s* %s", t, value, t, pointer)
+		case AstIf:
+			condition := l.expression(statement.Children[0])
+			thenLabel, elseLabel, endLabel := l.label(), l.label(), l.label()
+			l.terminate("br i1 %s, label %%%s, label %%%s", condition, thenLabel, elseLabel)
+			l.placeLabel(thenLabel)
+			l.block(statement.Children[1])
+			if !l.terminated {
+				l.terminate("br label %%%s", endLabel)
+			}
+			l.placeLabel(elseLabel)
+			if len(statement.Children) == 3 {
+				l.block(statement.Children[2])
+			}
+			l.placeLabel(endLabel)
+		case AstWhile:
+			conditionLabel, bodyLabel, endLabel := l.label(), l.label(), l.label()
+			l.placeLabel(conditionLabel)
+			condition := l.expression(statement.Children[0])
+			l.terminate("br i1 %s, label %%%s, label %%%s", condition, bodyLabel, endLabel)
+			l.placeLabel(bodyLabel)
+			l.block(statement.Children[1])
+			if !l.terminated {
+				l.terminate("br label %%%s", conditionLabel)
+			}
+			l.placeLabel(endLabel)
+		case AstReturn:
+			value := l.expression(statement.Children[0])
+			if l.returnType == TypeVoid {
+				l.terminate("ret void")
+			} else {
+				l.terminate("ret %s %s", l.llvmType(l.returnType), value)
+			}
+		case AstFuncCall, AstClosureCall, AstMethodCall, AstTry:
+			l.expression(statement)
+		case AstPrint:
+			l.print(statement)
+		default:
+			log.Fatalf("[LLVM]: Unsupported statement %s", statement.Type)
+		}
+	}
+}
+
+// Returns the printf placeholder of a value of given type and the
+// argument passed to printf, see irPrintFormat.
+func (l *llvmGenerator) printArgument(t TypeAnnotation, value string) (string, string) {
+	switch t {
+	case TypeInteger:
+		return "%d", "i32 " + value
+	case TypeBoolean:
+		return "%d", "i32 " + l.value("zext i1 %s to i32", value)
+	case TypeI8, TypeI16, TypeI32:
+		return "%lld", "i64 " + l.value("sext %s %s to i64", l.llvmType(t), value)
+	case TypeU8, TypeU16, TypeU32:
+		return "%llu", "i64 " + l.value("zext %s %s to i64", l.llvmType(t), value)
+	case TypeI64:
+		return "%lld", "i64 " + value
+	case TypeU64:
+		return "%llu", "i64 " + value
+	case TypeF32:
+		return "%g", "double " + l.value("fpext float %s to double", value)
+	case TypeF64:
+		return "%g", "double " + value
+	case TypeChar:
+		return "%c", "i32 " + l.value("sext i8 %s to i32", value)
+	case TypeString:
+		return "%s", "i8* " + value
+	}
+	log.Fatalf("[LLVM]: Unsupported parameter %s", t)
+	return "", ""
+}
+
+func (l *llvmGenerator) print(ast *Ast) {
+	var placeholders, args []string
+	for _, param := range ast.Children {
+		placeholder, arg := l.printArgument(param.DataType, l.expression(param))
+		placeholders = append(placeholders, placeholder)
+		args = append(args, arg)
+	}
+	placeholders = append(placeholders, "%s")
+	args = append(args, "i8* "+l.stringConstant("\n"))
+	format := l.stringConstant(strings.Join(placeholders, " "))
+	l.declare("printf", "i32 @printf(i8*, ...)")
+	l.emit("call i32 (i8*, ...) @printf(i8* %s, %s)", format, strings.Join(args, ", "))
+}
+
+// Stops the program reporting a failed operation, the arguments
+// are formatted in the message.
+func (l *llvmGenerator) panicAt(ast *Ast, message string, args ...string) {
+	l.declare("sowo_panic", "void @sowo_panic(i8*, i32, i32, i8*, ...)")
+	l.emit("call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* %s, i32 %d, i32 %d, i8* %s%s)",
+		l.stringConstant(l.file), ast.Line, ast.Col, l.stringConstant(message), strings.Join(append([]string{""}, args...), ", "))
+	l.terminate("unreachable")
+}
+
+// Stops the program when the condition is true.
+func (l *llvmGenerator) check(condition string, ast *Ast, message string, args ...string) {
+	failed, ok := l.label(), l.label()
+	l.terminate("br i1 %s, label %%%s, label %%%s", condition, failed, ok)
+	l.placeLabel(failed)
+	l.panicAt(ast, message, args...)
+	l.placeLabel(ok)
+}
+
+func (l *llvmGenerator) nilCheck(t string, value string, ast *Ast, message string) {
+	if l.checked {
+		l.check(l.value("icmp eq %s %s, null", t, value), ast, message)
+	}
+}
+
+// Returns the arguments locating the node, taken by the runtime
+// functions that can fail.
+func (l *llvmGenerator) location(ast *Ast) string {
+	return fmt.Sprintf("i8* %s, i32 %d, i32 %d", l.stringConstant(l.file), ast.Line, ast.Col)
+}
+
+// Converts an integer to the i64 taken by the runtime functions.
+func (l *llvmGenerator) toI64(value string, t TypeAnnotation) string {
+	switch {
+	case llvmBits(t) == 64:
+		return value
+	case isSignedType(t):
+		return l.value("sext %s %s to i64", l.llvmType(t), value)
+	}
+	return l.value("zext %s %s to i64", l.llvmType(t), value)
+}
+
+// Evaluates the expression, returns its value.
+func (l *llvmGenerator) expression(ast *Ast) string {
+	switch ast.Type {
+	case AstNumberLiteral:
+		if isFloatType(ast.DataType) {
+			return llvmFloat(float64(ast.NumberDataValue), ast.DataType)
+		}
+		return llvmInteger(int64(ast.NumberDataValue), ast.DataType)
+	case AstFloatLiteral:
+		return llvmFloat(ast.FloatDataValue, ast.DataType)
+	case AstBooleanLiteral:
+		return fmt.Sprint(ast.BooleanDataValue)
+	case AstStringLiteral:
+		return l.stringConstant(ast.StringDataValue)
+	case AstCharLiteral:
+		return fmt.Sprint(int8(ast.CharDataValue))
+	case AstBinaryOp:
+		return l.binaryOp(ast)
+	case AstVariableRef:
+		t := l.llvmType(ast.DataType)
+		return l.value("load %s, %s* %s", t, t, l.variable(ast.Module, ast.Name))
+	case AstFuncCall:
+		return l.funcCall(ast)
+	case AstFuncRef:
+		return l.funcRef(ast)
+	case AstFuncLiteral:
+		return l.funcLiteral(ast)
+	case AstClosureCall:
+		return l.closureCall(ast)
+	case AstMethodCall:
+		return l.methodCall(ast)
+	case AstInterfaceValue:
+		return l.interfaceValue(ast)
+	case AstResultOk, AstResultErr:
+		t := l.llvmType(ast.DataType)
+		index, flag := resultErrorIndex(ast.DataType), "false"
+		if ast.Type == AstResultOk {
+			index, flag = 1, "true"
+		}
+		result := l.value("insertvalue %s zeroinitializer, i1 %s, 0", t, flag)
+		if len(ast.Children) > 0 {
+			value := l.expression(ast.Children[0])
+			result = l.value("insertvalue %s %s, %s %s, %d", t, result, l.llvmType(ast.Children[0].DataType), value, index)
+		}
+		return result
+	case AstTry:
+		return l.try(ast)
+	case AstConversion:
+		return l.conversion(ast, l.expression(ast.Children[0]))
+	case AstNew:
+		allocType := ast.Children[0].DataType
+		if allocType == TypeString {
+			l.declare("sowo_new_str", "i8** @sowo_new_str()")
+			return l.value("call i8** @sowo_new_str()")
+		}
+		t := l.llvmType(allocType)
+		l.declare("sowo_alloc", "i8* @sowo_alloc(i64)")
+		block := l.value("call i8* @sowo_alloc(i64 %s)", l.sizeOf(t))
+		return l.value("bitcast i8* %s to %s*", block, t)
+	case AstAddressOf:
+		target := ast.Children[0]
+		if target.Type == AstDereference {
+			return l.expression(target.Children[0])
+		}
+		return l.variable(target.Module, target.Name)
+	case AstDereference:
+		t := l.llvmType(ast.DataType)
+		pointer := l.expression(ast.Children[0])
+		l.nilCheck(t+"*", pointer, ast, "nil pointer dereference")
+		return l.value("load %s, %s* %s", t, t, pointer)
+	case AstIndex:
+		return l.index(ast)
+	case AstSlice:
+		s := l.expression(ast.Children[0])
+		from := "0"
+		if ast.Children[1].Type != AstNoop {
+			from = l.toI64(l.expression(ast.Children[1]), ast.Children[1].DataType)
+		}
+		if ast.Children[2].Type == AstNoop {
+			l.declare("sowo_str_suffix", "i8* @sowo_str_suffix(i8*, i64, i8*, i32, i32)")
+			return l.value("call i8* @sowo_str_suffix(i8* %s, i64 %s, %s)", s, from, l.location(ast))
+		}
+		to := l.toI64(l.expression(ast.Children[2]), ast.Children[2].DataType)
+		l.declare("sowo_str_slice", "i8* @sowo_str_slice(i8*, i64, i64, i8*, i32, i32)")
+		return l.value("call i8* @sowo_str_slice(i8* %s, i64 %s, i64 %s, %s)", s, from, to, l.location(ast))
+	}
+	log.Fatalf("[LLVM]: Unsupported expression %s", ast.Type)
+	return ""
+}
+
+func (l *llvmGenerator) binaryOp(ast *Ast) string {
+	operandType := ast.Children[0].DataType
+	lhs := l.expression(ast.Children[0])
+	rhs := l.expression(ast.Children[1])
+	t := l.llvmType(operandType)
+
+	switch {
+	case operandType == TypeString && ast.Operator == OpPlus:
+		l.declare("sowo_str_concat", "i8* @sowo_str_concat(i8*, i8*)")
+		return l.value("call i8* @sowo_str_concat(i8* %s, i8* %s)", lhs, rhs)
+	case operandType == TypeString:
+		l.declare("sowo_str_equals", "i32 @sowo_str_equals(i8*, i8*)")
+		equals := l.value("call i32 @sowo_str_equals(i8* %s, i8* %s)", lhs, rhs)
+		return l.value("icmp ne i32 %s, 0", equals)
+	case isIntegerType(operandType) && isArithmeticOperator(ast.Operator):
+		return l.integerOperation(ast, operandType, lhs, rhs)
+	case isFloatType(operandType):
+		instructions := map[BinaryOperator]string{
+			OpPlus: "fadd", OpMinus: "fsub", OpTimes: "fmul", OpDivide: "fdiv",
+			OpEquals: "fcmp oeq", OpLessThen: "fcmp olt", OpGreaterThen: "fcmp ogt",
+			OpLessThenEqual: "fcmp ole", OpGreaterThenEqual: "fcmp oge",
+		}
+		return l.value("%s %s %s, %s", instructions[ast.Operator], t, lhs, rhs)
+	}
+	predicates := map[BinaryOperator][2]string{
+		OpEquals:           {"eq", "eq"},
+		OpLessThen:         {"slt", "ult"},
+		OpGreaterThen:      {"sgt", "ugt"},
+		OpLessThenEqual:    {"sle", "ule"},
+		OpGreaterThenEqual: {"sge", "uge"},
+	}
+	predicate, ok := predicates[ast.Operator]
+	if !ok {
+		log.Fatalf("[LLVM]: Unsupported operator %s for type '%s'", ast.Operator, operandType)
+	}
+	if isSignedType(operandType) {
+		return l.value("icmp %s %s %s, %s", predicate[0], t, lhs, rhs)
+	}
+	return l.value("icmp %s %s %s, %s", predicate[1], t, lhs, rhs)
+}
+
+// Emits an arithmetic operation between integers, see irIntegerOperation.
+// The checked additions, subtractions and multiplications use the LLVM
+// intrinsics reporting the overflow.
+func (l *llvmGenerator) integerOperation(ast *Ast, operandType TypeAnnotation, lhs string, rhs string) string {
+	t := l.llvmType(operandType)
+	signed := isSignedType(operandType)
+	operations := map[BinaryOperator][2]string{
+		OpPlus:   {"add", "addition"},
+		OpMinus:  {"sub", "subtraction"},
+		OpTimes:  {"mul", "multiplication"},
+		OpDivide: {"div", "division"},
+	}
+	operation := operations[ast.Operator]
+
+	if ast.Operator != OpDivide {
+		if !l.checked {
+			return l.value("%s %s %s, %s", operation[0], t, lhs, rhs)
+		}
+		prefix := "u"
+		if signed {
+			prefix = "s"
+		}
+		intrinsic := fmt.Sprintf("llvm.%s%s.with.overflow.%s", prefix, operation[0], t)
+		l.declare(intrinsic, fmt.Sprintf("{ %s, i1 } @%s(%s, %s)", t, intrinsic, t, t))
+		result := l.value("call { %s, i1 } @%s(%s %s, %s %s)", t, intrinsic, t, lhs, t, rhs)
+		l.check(l.value("extractvalue { %s, i1 } %s, 1", t, result), ast, "integer overflow in "+operation[1])
+		return l.value("extractvalue { %s, i1 } %s, 0", t, result)
+	}
+
+	if l.checked {
+		l.check(l.value("icmp eq %s %s, 0", t, rhs), ast, "integer division by zero")
+	}
+	if !signed {
+		return l.value("udiv %s %s, %s", t, lhs, rhs)
+	}
+	// The minimum value divided by -1 doesn't fit, it's negated
+	// instead when unchecked
+	minusOne := l.value("icmp eq %s %s, -1", t, rhs)
+	if l.checked {
+		minimum := l.value("icmp eq %s %s, %s", t, lhs, llvmInteger(math.MinInt64>>(64-llvmBits(operandType)), operandType))
+		l.check(l.value("and i1 %s, %s", minusOne, minimum), ast, "integer overflow in division")
+		return l.value("sdiv %s %s, %s", t, lhs, rhs)
+	}
+	divisor := l.value("select i1 %s, %s 1, %s %s", minusOne, t, t, rhs)
+	quotient := l.value("sdiv %s %s, %s", t, lhs, divisor)
+	negated := l.value("sub %s 0, %s", t, lhs)
+	return l.value("select i1 %s, %s %s, %s %s", minusOne, t, negated, t, quotient)
+}
+
+// Converts a value, see irConversion.
+func (l *llvmGenerator) conversion(ast *Ast, value string) string {
+	from, to := ast.Children[0].DataType, ast.DataType
+	switch {
+	case from == to:
+		return value
+	case to == TypeString && from == TypeChar:
+		l.declare("sowo_char_to_str", "i8* @sowo_char_to_str(i8 signext)")
+		return l.value("call i8* @sowo_char_to_str(i8 signext %s)", value)
+	case to == TypeString && (from == TypeU64 || from == TypeU32):
+		l.declare("sowo_uint_to_str", "i8* @sowo_uint_to_str(i64)")
+		return l.value("call i8* @sowo_uint_to_str(i64 %s)", l.toI64(value, from))
+	case to == TypeString:
+		l.declare("sowo_int_to_str", "i8* @sowo_int_to_str(i64)")
+		return l.value("call i8* @sowo_int_to_str(i64 %s)", l.toI64(value, from))
+	case from == TypeString:
+		l.declare("sowo_str_to_int", "i64 @sowo_str_to_int(i8*, i8*, i32, i32)")
+		result := l.value("call i64 @sowo_str_to_int(i8* %s, %s)", value, l.location(ast))
+		if llvmBits(to) == 64 {
+			return result
+		}
+		return l.value("trunc i64 %s to %s", result, l.llvmType(to))
+	case isFloatType(from) && isFloatType(to):
+		if from == TypeF32 {
+			return l.value("fpext float %s to double", value)
+		}
+		return l.value("fptrunc double %s to float", value)
+	case isFloatType(from):
+		// Out of range values are handled by the runtime
+		if from == TypeF32 {
+			value = l.value("fpext float %s to double", value)
+		}
+		function := "sowo_float_to_uint"
+		if isSignedType(to) {
+			function = "sowo_float_to_int"
+		}
+		l.declare(function, fmt.Sprintf("i64 @%s(double, i32, i8*, i32, i32)", function))
+		result := l.value("call i64 @%s(double %s, i32 %d, %s)", function, value, llvmBits(to), l.location(ast))
+		if llvmBits(to) == 64 {
+			return result
+		}
+		return l.value("trunc i64 %s to %s", result, l.llvmType(to))
+	case isFloatType(to):
+		if isSignedType(from) {
+			return l.value("sitofp %s %s to %s", l.llvmType(from), value, l.llvmType(to))
+		}
+		return l.value("uitofp %s %s to %s", l.llvmType(from), value, l.llvmType(to))
+	}
+	switch fromBits, toBits := llvmBits(from), llvmBits(to); {
+	case fromBits == toBits:
+		return value
+	case fromBits > toBits:
+		return l.value("trunc %s %s to %s", l.llvmType(from), value, l.llvmType(to))
+	case isSignedType(from):
+		return l.value("sext %s %s to %s", l.llvmType(from), value, l.llvmType(to))
+	}
+	return l.value("zext %s %s to %s", l.llvmType(from), value, l.llvmType(to))
+}
+
+func (l *llvmGenerator) index(ast *Ast) string {
+	base := l.expression(ast.Children[0])
+	index := l.toI64(l.expression(ast.Children[1]), ast.Children[1].DataType)
+	if !isSliceType(ast.Children[0].DataType) {
+		l.declare("sowo_str_index", "signext i8 @sowo_str_index(i8*, i64, i8*, i32, i32)")
+		return l.value("call signext i8 @sowo_str_index(i8* %s, i64 %s, %s)", base, index, l.location(ast))
+	}
+	// The slice is passed to the runtime as its two fields,
+	// like the C compiler passes the struct
+	t := l.llvmType(ast.DataType)
+	length := l.value("extractvalue %%sowo_slice %s, 0", base)
+	data := l.value("extractvalue %%sowo_slice %s, 1", base)
+	l.declare("sowo_slice_at", "i8* @sowo_slice_at(i64, i8*, i64, i64, i8*, i32, i32)")
+	element := l.value("call i8* @sowo_slice_at(i64 %s, i8* %s, i64 %s, i64 %s, %s)",
+		length, data, index, l.sizeOf(t), l.location(ast))
+	pointer := l.value("bitcast i8* %s to %s*", element, t)
+	return l.value("load %s, %s* %s", t, t, pointer)
+}
+
+// Calls a function of the C library or of the runtime, bools are
+// passed and returned as ints.
+func (l *llvmGenerator) callC(name string, params []TypeAnnotation, returnType TypeAnnotation, values []string, extra string) string {
+	var declared, args []string
+	for i, param := range params {
+		value := values[i]
+		if param == TypeBoolean {
+			value = l.value("zext i1 %s to i32", value)
+		}
+		declared = append(declared, llvmExtension(param)+l.cType(param))
+		args = append(args, fmt.Sprintf("%s%s %s", llvmExtension(param), l.cType(param), value))
+	}
+	if extra != "" {
+		declared = append(declared, "i8*", "i32", "i32")
+		args = append(args, extra)
+	}
+	returnC := llvmExtension(returnType) + l.cType(returnType)
+	l.declare(name, fmt.Sprintf("%s @%s(%s)", returnC, name, strings.Join(declared, ", ")))
+	call := fmt.Sprintf("call %s @%s(%s)", returnC, name, strings.Join(args, ", "))
+	if returnType == TypeVoid {
+		l.emit("%s", call)
+		return ""
+	}
+	result := l.value("%s", call)
+	if returnType == TypeBoolean {
+		return l.value("icmp ne i32 %s, 0", result)
+	}
+	return result
+}
+
+func (l *llvmGenerator) callExtern(def *Ast, values []string) string {
+	var params []TypeAnnotation
+	for _, param := range def.Children[0].Children {
+		params = append(params, param.Children[0].DataType)
+	}
+	return l.callC(def.Name, params, def.Children[1].Children[0].DataType, values, "")
+}
+
+func (l *llvmGenerator) funcCall(ast *Ast) string {
+	var values, args []string
+	for _, arg := range ast.Children {
+		value := l.expression(arg)
+		values = append(values, value)
+		args = append(args, l.llvmType(arg.DataType)+" "+value)
+	}
+
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, arg.DataType)
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[LLVM]: %s", err)
+		}
+		if builtin.CName == "sowo_slice_len" {
+			length := l.value("extractvalue %%sowo_slice %s, 0", values[0])
+			return l.value("trunc i64 %s to i32", length)
+		}
+		location := ""
+		if builtin.Located {
+			location = l.location(ast)
+		}
+		return l.callC(builtin.CName, builtin.Params, builtin.ReturnType, values, location)
+	}
+	if extern, ok := l.externs[member]; ok && ast.Module == "" {
+		return l.callExtern(extern, values)
+	}
+
+	name := irSymbolName(ast.Module, ast.Name)
+	if def, ok := l.funcDefs[name]; ok && len(ast.TypeArgs) > 0 {
+		// Every list of type arguments gets its own instance
+		bindings := map[TypeAnnotation]TypeAnnotation{}
+		for i, typeParam := range funcTypeParams(def) {
+			bindings[typeParam] = ast.TypeArgs[i]
+		}
+		instance := substituteAst(def, bindings)
+		instance.Children = instance.Children[:3]
+		name += irTypeArgsSuffix(ast.TypeArgs)
+		l.function(name, instance, false)
+	}
+	call := fmt.Sprintf("call %s @%s(%s)", l.llvmType(ast.DataType), name, strings.Join(args, ", "))
+	if ast.DataType == TypeVoid {
+		l.emit("%s", call)
+		return ""
+	}
+	return l.value("%s", call)
+}
+
+// Returns the type of the pointer to the function called through a
+// function value or a vtable, taking an environment or a receiver.
+func (l *llvmGenerator) closurePointerType(params []TypeAnnotation, returnType TypeAnnotation) string {
+	types := []string{"i8*"}
+	for _, param := range params {
+		types = append(types, l.llvmType(param))
+	}
+	return fmt.Sprintf("%s (%s)*", l.llvmType(returnType), strings.Join(types, ", "))
+}
+
+// Returns a function value calling a function through a wrapper
+// that ignores the environment.
+func (l *llvmGenerator) funcRef(ast *Ast) string {
+	name := irSymbolName(ast.Module, ast.Name)
+	wrapper := "sowo_fn__" + name
+	def, ok := l.funcDefs[name]
+	if !ok {
+		name = ast.Name
+		def = l.externs[name]
+	}
+	if !l.functions[wrapper] {
+		l.functions[wrapper] = true
+		l.pending = append(l.pending, llvmFunctionDef{name: wrapper, def: def, callee: name, wrapper: true})
+	}
+	params, returnType := funcTypeSignature(ast.DataType)
+	return fmt.Sprintf("{ i8* bitcast (%s @%s to i8*), i8* null }", l.closurePointerType(params, returnType), wrapper)
+}
+
+// Returns a function value of a function literal, the literal is
+// emitted as a function taking the captured variables in an environment.
+func (l *llvmGenerator) funcLiteral(ast *Ast) string {
+	l.literals++
+	name := fmt.Sprintf("sowo_closure_%d", l.literals)
+	captures := ast.Children[3].Children
+	l.functions[name] = true
+	l.pending = append(l.pending, llvmFunctionDef{name: name, def: ast, captures: captures, file: l.file})
+
+	params, returnType := funcTypeSignature(ast.DataType)
+	fn := fmt.Sprintf("bitcast (%s @%s to i8*)", l.closurePointerType(params, returnType), name)
+	env := "null"
+	if len(captures) > 0 {
+		envType := l.envType(captures)
+		l.declare("sowo_alloc", "i8* @sowo_alloc(i64)")
+		env = l.value("call i8* @sowo_alloc(i64 %s)", l.sizeOf(envType))
+		fields := l.value("bitcast i8* %s to %s*", env, envType)
+		for i, capture := range captures {
+			t := l.llvmType(capture.Children[0].DataType)
+			value := l.value("load %s, %s* %s", t, t, l.variable("", capture.Name))
+			field := l.value("getelementptr %s, %s* %s, i32 0, i32 %d", envType, envType, fields, i)
+			l.emit("store %s %s, %s* %s", t, value, t, field)
+		}
+	}
+	closure := l.value("insertvalue %%sowo_closure undef, i8* %s, 0", fn)
+	return l.value("insertvalue %%sowo_closure %s, i8* %s, 1", closure, env)
+}
+
+func (l *llvmGenerator) closureCall(ast *Ast) string {
+	closure := l.expression(ast.Children[0])
+	args := []string{"i8* " + l.value("extractvalue %%sowo_closure %s, 1", closure)}
+	for _, arg := range ast.Children[1:] {
+		args = append(args, l.llvmType(arg.DataType)+" "+l.expression(arg))
+	}
+	fn := l.value("extractvalue %%sowo_closure %s, 0", closure)
+	l.nilCheck("i8*", fn, ast, "call of nil function")
+	params, returnType := funcTypeSignature(ast.Children[0].DataType)
+	pointer := l.value("bitcast i8* %s to %s", fn, l.closurePointerType(params, returnType))
+	call := fmt.Sprintf("call %s %s(%s)", l.llvmType(returnType), pointer, strings.Join(args, ", "))
+	if returnType == TypeVoid {
+		l.emit("%s", call)
+		return ""
+	}
+	return l.value("%s", call)
+}
+
+// Emits a method call, methods of interfaces are called through the
+// vtable of the interface value and the methods of results are inlined.
+func (l *llvmGenerator) methodCall(ast *Ast) string {
+	receiverType := ast.Children[0].DataType
+	if isResultType(receiverType) {
+		return l.resultMethod(ast)
+	}
+	receiver := l.expression(ast.Children[0])
+	var args []string
+	for _, arg := range ast.Children[1:] {
+		args = append(args, l.llvmType(arg.DataType)+" "+l.expression(arg))
+	}
+	returnType := l.llvmType(ast.DataType)
+	var call string
+	if !isInterfaceType(receiverType) {
+		args = append([]string{l.llvmType(receiverType) + " " + receiver}, args...)
+		call = fmt.Sprintf("call %s @%s(%s)", returnType, irMethodName(ast.Module, receiverType, ast.Name), strings.Join(args, ", "))
+	} else {
+		index := 0
+		var method InterfaceMethod
+		for i, m := range interfaceMethods(receiverType) {
+			if m.Name == ast.Name {
+				index, method = i, m
+			}
+		}
+		vtable := l.value("extractvalue %%sowo_interface %s, 1", receiver)
+		l.nilCheck("i8*", vtable, ast, fmt.Sprintf("method %s called on nil interface", ast.Name))
+		data := l.value("extractvalue %%sowo_interface %s, 0", receiver)
+		methods := l.value("bitcast i8* %s to i8**", vtable)
+		entry := l.value("getelementptr i8*, i8** %s, i32 %d", methods, index)
+		fn := l.value("load i8*, i8** %s", entry)
+		params, methodReturnType := funcTypeSignature(method.Type)
+		pointer := l.value("bitcast i8* %s to %s", fn, l.closurePointerType(params, methodReturnType))
+		args = append([]string{"i8* " + data}, args...)
+		call = fmt.Sprintf("call %s %s(%s)", returnType, pointer, strings.Join(args, ", "))
+	}
+	if ast.DataType == TypeVoid {
+		l.emit("%s", call)
+		return ""
+	}
+	return l.value("%s", call)
+}
+
+// Returns an interface value, the value is copied on the heap.
+func (l *llvmGenerator) interfaceValue(ast *Ast) string {
+	valueType := ast.Children[0].DataType
+	value := l.expression(ast.Children[0])
+	t := l.llvmType(valueType)
+	l.declare("sowo_alloc", "i8* @sowo_alloc(i64)")
+	data := l.value("call i8* @sowo_alloc(i64 %s)", l.sizeOf(t))
+	pointer := l.value("bitcast i8* %s to %s*", data, t)
+	l.emit("store %s %s, %s* %s", t, value, t, pointer)
+	vtable := l.vtable(ast.DataType, valueType, ast.Children[1:])
+	result := l.value("insertvalue %%sowo_interface undef, i8* %s, 0", data)
+	return l.value("insertvalue %%sowo_interface %s, i8* %s, 1", result, vtable)
+}
+
+// Returns a pointer to the vtable of the type for the interface, the
+// methods are called through wrappers taking a pointer to the value.
+func (l *llvmGenerator) vtable(iface TypeAnnotation, valueType TypeAnnotation, refs []*Ast) string {
+	methods := interfaceMethods(iface)
+	arrayType := fmt.Sprintf("[%d x i8*]", len(methods))
+	key := irTypeName(iface) + "/" + irTypeName(valueType)
+	name, ok := l.vtables[key]
+	if !ok {
+		name = fmt.Sprintf("@sowo_vtable_%d", len(l.vtables)+1)
+		l.vtables[key] = name
+		var entries []string
+		for _, method := range methods {
+			for _, ref := range refs {
+				if ref.Name != method.Name {
+					continue
+				}
+				callee := irMethodName(ref.Module, valueType, ref.Name)
+				wrapper := fmt.Sprintf("%s__%s", name[1:], method.Name)
+				l.functions[wrapper] = true
+				l.pending = append(l.pending, llvmFunctionDef{name: wrapper, def: interfaceMethodDef(method), callee: callee, valueType: valueType, wrapper: true})
+				params, returnType := funcTypeSignature(method.Type)
+				entries = append(entries, fmt.Sprintf("i8* bitcast (%s @%s to i8*)", l.closurePointerType(params, returnType), wrapper))
+			}
+		}
+		fmt.Fprintf(&l.globals, "%s = internal constant %s [%s]\n", name, arrayType, strings.Join(entries, ", "))
+	}
+	return fmt.Sprintf("bitcast (%s* %s to i8*)", arrayType, name)
+}
+
+// Returns a definition with the params and the return type of a method
+// of an interface, used to emit the wrappers of the vtables.
+func interfaceMethodDef(method InterfaceMethod) *Ast {
+	params, returnType := funcTypeSignature(method.Type)
+	paramsAst := &Ast{}
+	for i, param := range params {
+		paramsAst.Children = append(paramsAst.Children, &Ast{Name: fmt.Sprintf("arg%d", i), Children: []*Ast{{DataType: param}}})
+	}
+	return &Ast{Children: []*Ast{paramsAst, {Children: []*Ast{{DataType: returnType}}}}}
+}
+
+// Emits a method of a result, see irResultMethodCall.
+func (l *llvmGenerator) resultMethod(ast *Ast) string {
+	resultType := ast.Children[0].DataType
+	t := l.llvmType(resultType)
+	result := l.expression(ast.Children[0])
+	ok := l.value("extractvalue %s %s, 0", t, result)
+	switch ast.Name {
+	case "is_ok":
+		return ok
+	case "is_err":
+		return l.value("xor i1 %s, true", ok)
+	case "value_or":
+		fallback := l.expression(ast.Children[1])
+		value := l.value("extractvalue %s %s, 1", t, result)
+		return l.value("select i1 %s, %s %s, %s %s", ok, l.llvmType(ast.DataType), value, l.llvmType(ast.DataType), fallback)
+	case "value":
+		l.check(l.value("xor i1 %s, true", ok), ast, "value of a failed result")
+		if ast.DataType == TypeVoid {
+			return ""
+		}
+		return l.value("extractvalue %s %s, 1", t, result)
+	case "error":
+		l.check(ok, ast, "error of a successful result")
+		return l.value("extractvalue %s %s, %d", t, result, resultErrorIndex(resultType))
+	}
+	log.Fatalf("[LLVM]: Unknown method %s of results", ast.Name)
+	return ""
+}
+
+// Emits the propagation of the error of a result, see irTry.
+func (l *llvmGenerator) try(ast *Ast) string {
+	resultType, returnType := ast.Children[0].DataType, ast.Children[1].DataType
+	t := l.llvmType(resultType)
+	result := l.expression(ast.Children[0])
+	ok := l.value("extractvalue %s %s, 0", t, result)
+	failed, done := l.label(), l.label()
+	l.terminate("br i1 %s, label %%%s, label %%%s", ok, done, failed)
+	l.placeLabel(failed)
+	_, errorType := resultTypes(resultType)
+	errorValue := l.value("extractvalue %s %s, %d", t, result, resultErrorIndex(resultType))
+	returned := l.value("insertvalue %s zeroinitializer, %s %s, %d",
+		l.llvmType(returnType), l.llvmType(errorType), errorValue, resultErrorIndex(returnType))
+	l.terminate("ret %s %s", l.llvmType(returnType), returned)
+	l.placeLabel(done)
+	if ast.DataType == TypeVoid {
+		return ""
+	}
+	return l.value("extractvalue %s %s, 1", t, result)
+}
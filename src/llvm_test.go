@@ -0,0 +1,74 @@
+package src
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Examples whose LLVM IR is compared with testdata/llvm.
+var llvmGoldenExamples = []string{"expr", "closures", "globals", "results"}
+
+// The IR emitted for the examples must match the golden files, when
+// llc is installed the IR is also built and run like the interpreter.
+func TestLLVMGolden(t *testing.T) {
+	_, llcErr := exec.LookPath("llc")
+	_, ccErr := exec.LookPath(cCompiler(CompilerOptions{}))
+	for _, name := range llvmGoldenExamples {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			options := CompilerOptions{InputFile: filepath.Join("..", "examples", name+".sowo"), Target: "llvm"}
+			backend := llvmBackend{}
+			code, err := backend.Emit(*loadAndCheckProgram(options), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "llvm", name+".ll")
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, code, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(code, expected) {
+				t.Errorf("IR differs from %s, run the tests with -update to rewrite it", golden)
+			}
+
+			if llcErr != nil || ccErr != nil {
+				t.Skip("llc or the C compiler not installed, the IR is not built")
+			}
+			dir, err := ioutil.TempDir("", "sowo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			sourceFile := filepath.Join(dir, "main.ll")
+			if err := ioutil.WriteFile(sourceFile, code, 0666); err != nil {
+				t.Fatal(err)
+			}
+			exeFile := filepath.Join(dir, "main")
+			if err := backend.BuildExecutable(sourceFile, exeFile, options); err != nil {
+				t.Fatal(err)
+			}
+			args := []string{options.InputFile}
+			out, errOut, exitCode := runExecutable(t, exeFile, args)
+			var interpOut, interpErr bytes.Buffer
+			interpCode := SowoInterpretFile(options, args, strings.NewReader(""), &interpOut, &interpErr)
+			if out != interpOut.String() || errOut != interpErr.String() || exitCode != interpCode {
+				t.Errorf("run differs\nllvm:        %q %q %d\ninterpreter: %q %q %d",
+					out, errOut, exitCode, interpOut.String(), interpErr.String(), interpCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package src
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Extension of the sowo source files.
+const sowoFileExtension = ".sowo"
+
+// Loads a program made of a main module and all the
+// modules it imports.
+type ModuleLoader struct {
+	// Directories searched for the imported files that are
+	// not found relative to the importing file.
+	SearchPath []string
+	// Tokens of all the loaded modules in load order.
+	Tokens []Token
+	// Source of every loaded module by file path.
+	Sources map[string]string
+
+	program *Ast
+	// Loaded modules by absolute file path.
+	loaded map[string]*Ast
+	// Files being loaded, used to detect import cycles.
+	loading   []string
+	usedNames map[string]bool
+}
+
+// Returns the name a module is referred with when it's imported
+// without an alias (e.g. `lib/math.sowo` is `math`).
+func moduleNameFromPath(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), sowoFileExtension)
+}
+
+// Loads the program with the main module in given file. The modules
+// of the returned AstProgram are sorted so that every module comes
+// after the modules it imports, the main module is the last one.
+func (l *ModuleLoader) loadProgram(path string) *Ast {
+	l.program = &Ast{Type: AstProgram}
+	l.loaded = map[string]*Ast{}
+	l.Sources = map[string]string{}
+	// The name of the standard library is reserved
+	l.usedNames = map[string]bool{stdModulePath: true}
+	l.loadModule(path)
+	return l.program
+}
+
+func (l *ModuleLoader) loadModule(path string) *Ast {
+	absPath := path
+	if path != stdModulePath {
+		var err error
+		if absPath, err = filepath.Abs(path); err != nil {
+			log.Fatalf("Error opening file %s", path)
+		}
+	}
+	if module, ok := l.loaded[absPath]; ok {
+		return module
+	}
+	for i, loading := range l.loading {
+		if loading == absPath {
+			var cycle []string
+			for _, p := range append(l.loading[i:], absPath) {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			log.Fatalf("[Loader]: Import cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+	l.loading = append(l.loading, absPath)
+
+	source := l.readModule(path)
+	l.Sources[path] = source
+	lexer := Lexer{Input: source}
+	tokens := lexer.tokenize()
+	l.Tokens = append(l.Tokens, tokens...)
+	parser := Parser{Tokens: tokens}
+	module := parser.parseModule()
+	if path == stdModulePath {
+		module.Name = stdModulePath
+	} else {
+		module.Name = l.uniqueModuleName(moduleNameFromPath(path))
+	}
+	module.StringDataValue = path
+
+	for _, def := range module.Children {
+		if def.Type == AstImport {
+			imported := l.loadModule(l.resolveImport(def.StringDataValue, filepath.Dir(path)))
+			def.Module = imported.Name
+		} else {
+			def.Module = module.Name
+		}
+	}
+
+	l.loading = l.loading[:len(l.loading)-1]
+	l.loaded[absPath] = module
+	l.program.Children = append(l.program.Children, module)
+	return module
+}
+
+// Returns the source of the module, the standard library is
+// shipped with the compiler and is never read from disk.
+func (l *ModuleLoader) readModule(path string) string {
+	if path == stdModulePath {
+		return stdModuleSource
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error opening file %s", path)
+	}
+	return string(content)
+}
+
+// Returns the file imported with given path, the path is looked up
+// relative to the importing file first and then in the search path.
+func (l *ModuleLoader) resolveImport(importPath string, fromDir string) string {
+	if importPath == stdModulePath {
+		return stdModulePath
+	}
+	if filepath.Ext(importPath) != sowoFileExtension {
+		importPath += sowoFileExtension
+	}
+
+	var candidates []string
+	if filepath.IsAbs(importPath) {
+		candidates = append(candidates, importPath)
+	} else {
+		candidates = append(candidates, filepath.Join(fromDir, importPath))
+		for _, dir := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(dir, importPath))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	log.Fatalf("[Loader]: Cannot find module '%s', looked in: %s", importPath, strings.Join(candidates, ", "))
+	return ""
+}
+
+// Returns a name for the module that is unique in the program
+// and can be used as part of a C identifier.
+func (l *ModuleLoader) uniqueModuleName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !isSymbol(r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) == 0 || !isSymbolStart(rune(name[0])) {
+		name = "_" + name
+	}
+
+	unique := name
+	for i := 2; l.usedNames[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	l.usedNames[unique] = true
+	return unique
+}
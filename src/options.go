@@ -1,5 +1,19 @@
 package src
 
+import (
+	"fmt"
+)
+
+// Represents the memory management strategy of the compiled program.
+type GCStrategy int
+
+const (
+	// Memory is released only when the program exits.
+	GCNone GCStrategy = iota
+	// A conservative mark-and-sweep collector releases unreachable memory.
+	GCMarkSweep
+)
+
 // Represents a set of options used by the compiler.
 type CompilerOptions struct {
 	PrintTokens bool
@@ -9,4 +23,42 @@ type CompilerOptions struct {
 	SkipCompile bool
 	InputFile   string
 	OutputFile  string
+	// Directories searched for imported modules.
+	ImportPaths []string
+	GC          GCStrategy
+	// Report allocation statistics and leaks when the program exits.
+	GCDebug bool
+	// Don't check divisions by zero, indices out of range and the
+	// other operations that can fail when the program runs.
+	Unchecked bool
+	// Compile the C code into the executable OutputFile.
+	Executable bool
+	// C compiler, its flags and optimisation level (e.g. `2` for -O2)
+	// used to build executables.
+	CC       string
+	CFlags   []string
+	OptLevel string
+	// Keep the C file next to the executable.
+	KeepC bool
+	// Run the program with the interpreter instead of compiling it.
+	Interpret bool
+	// Run the program with the bytecode virtual machine.
+	VM bool
+	// Print the disassembled bytecode of the program.
+	PrintBytecode bool
+	// Name of the backend generating the code for build and run,
+	// see BackendWithName. The C backend is used by default.
+	Target string
+}
+
+// Returns the GCStrategy with given name.
+func GCStrategyFromName(name string) (GCStrategy, error) {
+	switch name {
+	case "none":
+		return GCNone, nil
+	case "marksweep":
+		return GCMarkSweep, nil
+	default:
+		return GCNone, fmt.Errorf("unknown gc strategy '%s'", name)
+	}
 }
@@ -12,7 +12,12 @@ import (
 // Represents the type of a variable.
 // It can be:
 // 	- Void
-//  - Integer
+//  - Integer (plus the sized integers i8..i64 and u8..u64)
+//  - Float (f32 and f64)
+//  - Boolean
+//  - String
+//  - Char (a single byte)
+//  - Compound types like pointers (see CompoundType)
 type TypeAnnotation int
 
 const (
@@ -20,6 +25,17 @@ const (
 	TypeInteger
 	TypeBoolean
 	TypeString
+	TypeI8
+	TypeI16
+	TypeI32
+	TypeI64
+	TypeU8
+	TypeU16
+	TypeU32
+	TypeU64
+	TypeF32
+	TypeF64
+	TypeChar
 )
 
 // Represents the operator of a binary operation.
@@ -43,9 +59,23 @@ type Ast struct {
 	Name             string
 	DataType         TypeAnnotation
 	NumberDataValue  int
+	FloatDataValue   float64
 	BooleanDataValue bool
 	StringDataValue  string
+	CharDataValue    byte
 	Operator         BinaryOperator
+	// Name of the module defining the symbol, it's set on
+	// top level definitions and on references to them.
+	Module string `json:",omitempty"`
+	// True for top level definitions visible from other modules.
+	Public bool `json:",omitempty"`
+	// Types the type parameters of a generic function are
+	// instantiated with at a call site.
+	TypeArgs []TypeAnnotation `json:",omitempty"`
+	// Position in the source of the operations that can fail
+	// when the program runs, reported by the runtime checks.
+	Line int `json:",omitempty"`
+	Col  int `json:",omitempty"`
 }
 
 type AstType int
@@ -65,14 +95,41 @@ const (
 	AstAssignment
 	AstBinaryOp
 	AstNumberLiteral
+	AstFloatLiteral
 	AstBooleanLiteral
 	AstStringLiteral
+	AstCharLiteral
 	AstVariableRef
 	AstIf
 	AstWhile
 	AstFuncCall
 	AstReturn
 	AstPrint
+	AstConversion
+	AstIndex
+	AstSlice
+	AstAddressOf
+	AstDereference
+	AstDerefAssignment
+	AstNew
+	AstGlobalVariable
+	AstGlobalConstant
+	AstImport
+	AstProgram
+	AstExternFunction
+	AstTypeParams
+	AstFuncLiteral
+	AstFuncRef
+	AstClosureCall
+	AstCaptures
+	AstMethod
+	AstMethodCall
+	AstInterface
+	AstInterfaceValue
+	AstMethodRef
+	AstResultOk
+	AstResultErr
+	AstTry
 )
 
 // Represent a parser with methods to
@@ -80,8 +137,14 @@ const (
 type Parser struct {
 	// List of tokens that need to be parsed
 	Tokens []Token
+	// Type parameters of the generic function being parsed by name.
+	typeParams map[string]TypeAnnotation
 }
 
+// Number of generic functions parsed so far, used to give
+// every generic function its own type parameters.
+var genericFuncCount = 0
+
 func (t TypeAnnotation) String() (ret string) {
 	switch t {
 	case TypeVoid:
@@ -92,8 +155,34 @@ func (t TypeAnnotation) String() (ret string) {
 		ret = "Boolean"
 	case TypeString:
 		ret = "String"
+	case TypeI8:
+		ret = "I8"
+	case TypeI16:
+		ret = "I16"
+	case TypeI32:
+		ret = "I32"
+	case TypeI64:
+		ret = "I64"
+	case TypeU8:
+		ret = "U8"
+	case TypeU16:
+		ret = "U16"
+	case TypeU32:
+		ret = "U32"
+	case TypeU64:
+		ret = "U64"
+	case TypeF32:
+		ret = "F32"
+	case TypeF64:
+		ret = "F64"
+	case TypeChar:
+		ret = "Char"
 	default:
-		ret = fmt.Sprintf("Unknown TypeAnnotation %d", t)
+		if c, ok := compoundTypeOf(t); ok {
+			ret = c.String()
+		} else {
+			ret = fmt.Sprintf("Unknown TypeAnnotation %d", t)
+		}
 	}
 	return ret
 }
@@ -158,10 +247,14 @@ func (t AstType) String() (ret string) {
 		ret = "AstBinaryOp"
 	case AstNumberLiteral:
 		ret = "AstNumberLiteral"
+	case AstFloatLiteral:
+		ret = "AstFloatLiteral"
 	case AstBooleanLiteral:
 		ret = "AstBooleanLiteral"
 	case AstStringLiteral:
 		ret = "AstStringLiteral"
+	case AstCharLiteral:
+		ret = "AstCharLiteral"
 	case AstVariableRef:
 		ret = "AstVariableRef"
 	case AstIf:
@@ -174,6 +267,56 @@ func (t AstType) String() (ret string) {
 		ret = "AstReturn"
 	case AstPrint:
 		ret = "AstPrint"
+	case AstConversion:
+		ret = "AstConversion"
+	case AstIndex:
+		ret = "AstIndex"
+	case AstSlice:
+		ret = "AstSlice"
+	case AstAddressOf:
+		ret = "AstAddressOf"
+	case AstDereference:
+		ret = "AstDereference"
+	case AstDerefAssignment:
+		ret = "AstDerefAssignment"
+	case AstNew:
+		ret = "AstNew"
+	case AstGlobalVariable:
+		ret = "AstGlobalVariable"
+	case AstGlobalConstant:
+		ret = "AstGlobalConstant"
+	case AstImport:
+		ret = "AstImport"
+	case AstProgram:
+		ret = "AstProgram"
+	case AstExternFunction:
+		ret = "AstExternFunction"
+	case AstTypeParams:
+		ret = "AstTypeParams"
+	case AstFuncLiteral:
+		ret = "AstFuncLiteral"
+	case AstFuncRef:
+		ret = "AstFuncRef"
+	case AstClosureCall:
+		ret = "AstClosureCall"
+	case AstCaptures:
+		ret = "AstCaptures"
+	case AstMethod:
+		ret = "AstMethod"
+	case AstMethodCall:
+		ret = "AstMethodCall"
+	case AstInterface:
+		ret = "AstInterface"
+	case AstInterfaceValue:
+		ret = "AstInterfaceValue"
+	case AstMethodRef:
+		ret = "AstMethodRef"
+	case AstResultOk:
+		ret = "AstResultOk"
+	case AstResultErr:
+		ret = "AstResultErr"
+	case AstTry:
+		ret = "AstTry"
 	default:
 		ret = fmt.Sprintf("Unknown AstType %d", t)
 	}
@@ -226,32 +369,180 @@ func (p Parser) expectTokenType(expected TokenType) {
 	}
 }
 
+// Records the position of the current token in the node.
+func (p Parser) locate(ast *Ast) {
+	if len(p.Tokens) > 0 {
+		ast.Line, ast.Col = p.Tokens[0].Line, p.Tokens[0].Col
+	}
+}
+
+// Returns the number of tokens of the name at the start of the
+// tokens, names can be qualified by a module (e.g. `math.sqrt`).
+func (p Parser) qualifiedNameLength() int {
+	if len(p.Tokens) > 2 && p.Tokens[1].Type == TokenDot && p.Tokens[2].Type == TokenSymbol {
+		return 3
+	}
+	return 1
+}
+
+// Parses the tokens into a name optionally qualified by a module.
+func (p *Parser) parseQualifiedName() string {
+	p.expectTokenType(TokenSymbol)
+	n := p.qualifiedNameLength()
+	name := p.Tokens[0].Value
+	if n == 3 {
+		name += "." + p.Tokens[2].Value
+	}
+	p.Tokens = p.Tokens[n:]
+	return name
+}
+
+// Returns the type with given name and true, or false
+// if the name is not a known type.
+func typeAnnotationFromName(name string) (TypeAnnotation, bool) {
+	switch name {
+	case "void":
+		return TypeVoid, true
+	case "int":
+		return TypeInteger, true
+	case "bool":
+		return TypeBoolean, true
+	case "string":
+		return TypeString, true
+	case "i8":
+		return TypeI8, true
+	case "i16":
+		return TypeI16, true
+	case "i32":
+		return TypeI32, true
+	case "i64":
+		return TypeI64, true
+	case "u8":
+		return TypeU8, true
+	case "u16":
+		return TypeU16, true
+	case "u32":
+		return TypeU32, true
+	case "u64":
+		return TypeU64, true
+	case "f32":
+		return TypeF32, true
+	case "f64", "float":
+		return TypeF64, true
+	case "char":
+		return TypeChar, true
+	default:
+		return TypeVoid, false
+	}
+}
+
+// Returns the type with given name, looking at the type parameters
+// of the function being parsed before the builtin types.
+func (p *Parser) typeFromName(name string) (TypeAnnotation, bool) {
+	if t, ok := p.typeParams[name]; ok {
+		return t, true
+	}
+	return typeAnnotationFromName(name)
+}
+
 // Parses the tokens into a type annotation.
 func (p *Parser) parseTypeAnnotation() (result *Ast) {
 	result = &Ast{}
 	p.expectTokenType(TokenColon)
 	p.Tokens = p.Tokens[1:]
 
-	p.expectTokenType(TokenSymbol)
+	return &Ast{Type: AstTypeAnnotation, DataType: p.parseType()}
+}
 
-	var returnType TypeAnnotation
-	switch p.Tokens[0].Value {
-	case "void":
-		returnType = TypeVoid
+// Parses the tokens into a type, a type is the name of a builtin or
+// declared type, a pointer to a type (e.g. `&int`), a slice (e.g.
+// `[]string`), a function type (e.g. `fun(int, int): bool`) or a
+// result type (e.g. `Result[int, string]`).
+func (p *Parser) parseType() TypeAnnotation {
+	if p.Tokens[0].Type == TokenFunc {
+		return p.parseFuncType()
+	}
+	if p.Tokens[0].Type == TokenAmpersand {
 		p.Tokens = p.Tokens[1:]
-	case "int":
-		returnType = TypeInteger
+		return pointerTo(p.parseType())
+	}
+	if p.Tokens[0].Type == TokenOpenBracket {
 		p.Tokens = p.Tokens[1:]
-	case "bool":
-		returnType = TypeBoolean
+		p.expectTokenType(TokenCloseBracket)
 		p.Tokens = p.Tokens[1:]
-	case "string":
-		returnType = TypeString
+		return sliceOf(p.parseType())
+	}
+
+	p.expectTokenType(TokenSymbol)
+	if p.Tokens[0].Value == "Result" && len(p.Tokens) > 1 && p.Tokens[1].Type == TokenOpenBracket {
+		return p.parseResultType()
+	}
+	if dataType, ok := p.typeFromName(p.Tokens[0].Value); ok {
 		p.Tokens = p.Tokens[1:]
-	default:
-		log.Fatal("[Parser]: Unknown data type '", p.Tokens[0].Value, "'")
+		return dataType
 	}
-	return &Ast{Type: AstTypeAnnotation, DataType: returnType}
+	// Other names refer to types declared in a module (e.g. interfaces),
+	// they are resolved by the type checker
+	return namedType(p.parseQualifiedName())
+}
+
+// Parses the tokens into a result type (e.g. `Result[int, string]`),
+// holding either a value or an error.
+func (p *Parser) parseResultType() TypeAnnotation {
+	p.Tokens = p.Tokens[1:]
+	p.expectTokenType(TokenOpenBracket)
+	p.Tokens = p.Tokens[1:]
+	valueType := p.parseType()
+	p.expectTokenType(TokenComma)
+	p.Tokens = p.Tokens[1:]
+	errorType := p.parseType()
+	if errorType == TypeVoid {
+		log.Fatal("[Parser]: The error type of a result can't be 'Void'")
+	}
+	p.expectTokenType(TokenCloseBracket)
+	p.Tokens = p.Tokens[1:]
+	return resultOf(valueType, errorType)
+}
+
+// Parses the tokens into a function type, the return
+// type can be omitted for functions returning nothing.
+func (p *Parser) parseFuncType() TypeAnnotation {
+	p.expectTokenType(TokenFunc)
+	p.Tokens = p.Tokens[1:]
+	p.expectTokenType(TokenOpenParen)
+	p.Tokens = p.Tokens[1:]
+
+	var params []TypeAnnotation
+	for len(p.Tokens) > 0 && p.Tokens[0].Type != TokenCloseParen {
+		params = append(params, p.parseType())
+		if p.Tokens[0].Type != TokenComma {
+			break
+		}
+		p.Tokens = p.Tokens[1:]
+	}
+	p.expectTokenType(TokenCloseParen)
+	p.Tokens = p.Tokens[1:]
+
+	returnType := TypeVoid
+	if len(p.Tokens) > 0 && p.Tokens[0].Type == TokenColon {
+		p.Tokens = p.Tokens[1:]
+		returnType = p.parseType()
+	}
+	return funcType(params, returnType)
+}
+
+// Parses the tokens into an anonymous function
+// (e.g. `fun(x: int): int { return x + 1; }`).
+func (p *Parser) parseFuncLiteral() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenFunc)
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, p.parseFuncArgs())
+	result.Children = append(result.Children, p.parseFuncReturnType())
+	result.Children = append(result.Children, p.parseBlock())
+	result.Type = AstFuncLiteral
+	return result
 }
 
 // Parses the tokens into operation's factors.
@@ -259,20 +550,31 @@ func (p *Parser) parseFactor() (result *Ast) {
 	result = &Ast{}
 	switch p.Tokens[0].Type {
 	case TokenSymbol:
-		if len(p.Tokens) > 3 && p.Tokens[1].Type == TokenOpenParen {
+		if _, isType := p.typeFromName(p.Tokens[0].Value); isType &&
+			len(p.Tokens) > 3 && p.Tokens[1].Type == TokenOpenParen {
+			result = p.parseConversion()
+		} else if n := p.qualifiedNameLength(); len(p.Tokens) > n+2 && p.Tokens[n].Type == TokenOpenParen {
 			result = p.parseFuncCall()
 		} else {
 			result.Type = AstVariableRef
-			result.Name = p.Tokens[0].Value
-			p.Tokens = p.Tokens[1:]
+			result.Name = p.parseQualifiedName()
 		}
 	case TokenNumberLiteral:
 		result.Type = AstNumberLiteral
-		number, err := strconv.Atoi(p.Tokens[0].Value)
+		// Values above the maximum int are kept as their bits for u64
+		number, err := strconv.ParseUint(p.Tokens[0].Value, 10, 64)
 		if err != nil {
 			log.Fatal("[Parser]: ", p.Tokens[0].Value, " is not a number!")
 		}
-		result.NumberDataValue = number
+		result.NumberDataValue = int(number)
+		p.Tokens = p.Tokens[1:]
+	case TokenFloatLiteral:
+		result.Type = AstFloatLiteral
+		number, err := strconv.ParseFloat(p.Tokens[0].Value, 64)
+		if err != nil {
+			log.Fatal("[Parser]: ", p.Tokens[0].Value, " is not a float!")
+		}
+		result.FloatDataValue = number
 		p.Tokens = p.Tokens[1:]
 	case TokenTrue, TokenFalse:
 		result.Type = AstBooleanLiteral
@@ -286,14 +588,98 @@ func (p *Parser) parseFactor() (result *Ast) {
 		result.Type = AstStringLiteral
 		result.StringDataValue = p.Tokens[0].Value
 		p.Tokens = p.Tokens[1:]
+	case TokenCharLiteral:
+		result.Type = AstCharLiteral
+		result.CharDataValue = p.Tokens[0].Value[0]
+		p.Tokens = p.Tokens[1:]
 	case TokenOpenParen:
 		p.Tokens = p.Tokens[1:]
 		result = p.parseExpression()
 		p.expectTokenType(TokenCloseParen)
 		p.Tokens = p.Tokens[1:]
+	case TokenNew:
+		result = p.parseNew()
+	case TokenFunc:
+		result = p.parseFuncLiteral()
+	case TokenOk, TokenErr:
+		result = p.parseResultValue()
+	case TokenAmpersand:
+		p.Tokens = p.Tokens[1:]
+		result.Type = AstAddressOf
+		result.Children = append(result.Children, p.parseFactor())
+	case TokenAsterisk:
+		p.Tokens = p.Tokens[1:]
+		result.Type = AstDereference
+		result.Children = append(result.Children, p.parseFactor())
 	default:
 		log.Fatal("[Parser]: Unexpected factor ", p.Tokens[0].Type)
 	}
+
+	return p.parsePostfix(result)
+}
+
+// Parses the tokens into a successful result (e.g. `ok(1)`) or a
+// failed one (e.g. `err("not found")`). The value of results without
+// value is omitted (e.g. `ok()`).
+func (p *Parser) parseResultValue() (result *Ast) {
+	result = &Ast{Type: AstResultOk}
+	if p.Tokens[0].Type == TokenErr {
+		result.Type = AstResultErr
+	}
+	p.Tokens = p.Tokens[1:]
+	result.Children = p.parseCallArgs()
+	return result
+}
+
+// Parses the tokens into a heap allocation (e.g. `new(int)`),
+// the result is a pointer to a zero value of the given type.
+func (p *Parser) parseNew() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenNew)
+	p.Tokens = p.Tokens[1:]
+
+	p.expectTokenType(TokenOpenParen)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstNew
+	result.Children = append(result.Children, &Ast{Type: AstTypeAnnotation, DataType: p.parseType()})
+
+	p.expectTokenType(TokenCloseParen)
+	p.Tokens = p.Tokens[1:]
+	return result
+}
+
+// Parses the tokens into an index (e.g. `s[i]`) or a slice (e.g. `s[a:b]`)
+// of the given expression. Both bounds of a slice can be omitted, a missing
+// bound is represented by an AstNoop.
+func (p *Parser) parseIndex(base *Ast) (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenOpenBracket)
+	p.locate(result)
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, base)
+	if p.Tokens[0].Type == TokenColon {
+		result.Children = append(result.Children, &Ast{Type: AstNoop})
+	} else {
+		result.Children = append(result.Children, p.parseExpression())
+	}
+
+	result.Type = AstIndex
+	if p.Tokens[0].Type == TokenColon {
+		p.Tokens = p.Tokens[1:]
+		if p.Tokens[0].Type == TokenCloseBracket {
+			result.Children = append(result.Children, &Ast{Type: AstNoop})
+		} else {
+			result.Children = append(result.Children, p.parseExpression())
+		}
+		result.Type = AstSlice
+	} else if result.Children[1].Type == AstNoop {
+		log.Fatal("[Parser]: Missing index expression")
+	}
+
+	p.expectTokenType(TokenCloseBracket)
+	p.Tokens = p.Tokens[1:]
 	return result
 }
 
@@ -306,6 +692,7 @@ func (p *Parser) parseBinaryOp() (result *Ast) {
 	}
 
 	result.Operator = tokenToBinaryOp(p.Tokens[0].Type)
+	p.locate(result)
 	p.Tokens = p.Tokens[1:]
 	rhs := p.parseFactor()
 
@@ -347,13 +734,34 @@ func (p *Parser) parseLocalVarDef() (result *Ast) {
 	p.expectTokenType(TokenEqual)
 	p.Tokens = p.Tokens[1:]
 
-	if len(p.Tokens) > 3 &&
-		p.Tokens[0].Type == TokenSymbol &&
-		p.Tokens[1].Type == TokenOpenParen {
-		result.Children = append(result.Children, p.parseFuncCall())
-	} else {
-		result.Children = append(result.Children, p.parseExpression())
+	result.Children = append(result.Children, p.parseExpression())
+
+	p.expectTokenType(TokenSemicolon)
+	p.Tokens = p.Tokens[1:]
+	return result
+}
+
+// Parses the tokens into a module level variable (`var`)
+// or constant (`const`) definition.
+func (p *Parser) parseGlobalVarDef() (result *Ast) {
+	result = &Ast{}
+	switch p.Tokens[0].Type {
+	case TokenVar:
+		result.Type = AstGlobalVariable
+	case TokenConst:
+		result.Type = AstGlobalConstant
+	default:
+		log.Fatal("[Parser]: Expected 'Var' or 'Const' but got '", p.Tokens[0].Type, "'")
 	}
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, p.parseVarDef())
+	result.Name = result.Children[0].Name
+
+	p.expectTokenType(TokenEqual)
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, p.parseExpression())
 
 	p.expectTokenType(TokenSemicolon)
 	p.Tokens = p.Tokens[1:]
@@ -363,20 +771,31 @@ func (p *Parser) parseLocalVarDef() (result *Ast) {
 func (p *Parser) parseAssignment() (result *Ast) {
 	result = &Ast{}
 	result.Type = AstAssignment
-	p.expectTokenType(TokenSymbol)
-	result.Name = p.Tokens[0].Value
+	result.Name = p.parseQualifiedName()
+
+	p.expectTokenType(TokenEqual)
 	p.Tokens = p.Tokens[1:]
 
+	result.Children = append(result.Children, p.parseExpression())
+
+	p.expectTokenType(TokenSemicolon)
+	p.Tokens = p.Tokens[1:]
+	return result
+}
+
+// Parses the tokens into an assignment through a pointer (e.g. `*p = 1;`).
+func (p *Parser) parseDerefAssignment() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenAsterisk)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstDerefAssignment
+	result.Children = append(result.Children, p.parseFactor())
+
 	p.expectTokenType(TokenEqual)
 	p.Tokens = p.Tokens[1:]
 
-	if len(p.Tokens) > 3 &&
-		p.Tokens[0].Type == TokenSymbol &&
-		p.Tokens[1].Type == TokenOpenParen {
-		result.Children = append(result.Children, p.parseFuncCall())
-	} else {
-		result.Children = append(result.Children, p.parseExpression())
-	}
+	result.Children = append(result.Children, p.parseExpression())
 
 	p.expectTokenType(TokenSemicolon)
 	p.Tokens = p.Tokens[1:]
@@ -390,17 +809,21 @@ func (p *Parser) parseStatement() (result *Ast) {
 	case TokenVar:
 		result = p.parseLocalVarDef()
 	case TokenSymbol:
-		if len(p.Tokens) <= 1 {
+		if len(p.Tokens) <= p.qualifiedNameLength() {
 			log.Fatal("more tokens are needed to parse a symbol a statement")
 		}
-		switch p.Tokens[1].Type {
+		switch p.Tokens[p.qualifiedNameLength()].Type {
 		case TokenEqual:
 			result = p.parseAssignment()
 		case TokenOpenParen:
-			result = p.parseFuncCall()
+			result = p.parsePostfix(p.parseFuncCall())
 			p.expectTokenType(TokenSemicolon)
 			p.Tokens = p.Tokens[1:]
+		default:
+			log.Fatal("[Parser]: Unexpected token ", p.Tokens[p.qualifiedNameLength()].Type, " after symbol parsing statement")
 		}
+	case TokenAsterisk:
+		result = p.parseDerefAssignment()
 	case TokenIf:
 		result = p.parseIf()
 	case TokenWhile:
@@ -491,15 +914,20 @@ func (p *Parser) parsePrint() (result *Ast) {
 // Parses the tokens into a function call.
 func (p *Parser) parseFuncCall() (result *Ast) {
 	result = &Ast{}
-	p.expectTokenType(TokenSymbol)
-	result.Name = p.Tokens[0].Value
-	p.Tokens = p.Tokens[1:]
+	p.locate(result)
+	result.Name = p.parseQualifiedName()
+	result.Children = p.parseCallArgs()
+	result.Type = AstFuncCall
+	return result
+}
 
+// Parses the tokens into the arguments of a call.
+func (p *Parser) parseCallArgs() (args []*Ast) {
 	p.expectTokenType(TokenOpenParen)
 	p.Tokens = p.Tokens[1:]
 
 	for p.Tokens[0].Type != TokenCloseParen {
-		result.Children = append(result.Children, p.parseExpression())
+		args = append(args, p.parseExpression())
 
 		if p.Tokens[0].Type != TokenComma {
 			break
@@ -510,8 +938,59 @@ func (p *Parser) parseFuncCall() (result *Ast) {
 
 	p.expectTokenType(TokenCloseParen)
 	p.Tokens = p.Tokens[1:]
+	return args
+}
+
+// Parses the indexing, the calls, the method calls and the error
+// propagations following an expression (e.g. `s[1]`, `adder(1)(2)`,
+// `shape.area()` or `parse(s)?`).
+func (p *Parser) parsePostfix(base *Ast) (result *Ast) {
+	result = base
+	for len(p.Tokens) > 0 {
+		switch p.Tokens[0].Type {
+		case TokenOpenBracket:
+			result = p.parseIndex(result)
+		case TokenOpenParen:
+			call := &Ast{Type: AstClosureCall}
+			p.locate(call)
+			call.Children = append([]*Ast{result}, p.parseCallArgs()...)
+			result = call
+		case TokenDot:
+			p.Tokens = p.Tokens[1:]
+			p.expectTokenType(TokenSymbol)
+			call := &Ast{Type: AstMethodCall, Name: p.Tokens[0].Value}
+			p.locate(call)
+			p.Tokens = p.Tokens[1:]
+			call.Children = append([]*Ast{result}, p.parseCallArgs()...)
+			result = call
+		case TokenQuestion:
+			result = &Ast{Type: AstTry, Children: []*Ast{result}}
+			p.locate(result)
+			p.Tokens = p.Tokens[1:]
+		default:
+			return result
+		}
+	}
+	return result
+}
+
+// Parses the tokens into an explicit type conversion (e.g. `f64(a)`).
+func (p *Parser) parseConversion() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenSymbol)
+	p.locate(result)
+	result.DataType, _ = p.typeFromName(p.Tokens[0].Value)
+	p.Tokens = p.Tokens[1:]
 
-	result.Type = AstFuncCall
+	p.expectTokenType(TokenOpenParen)
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, p.parseExpression())
+
+	p.expectTokenType(TokenCloseParen)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstConversion
 	return result
 }
 
@@ -577,28 +1056,245 @@ func (p *Parser) parseFuncDef() (result *Ast) {
 	p.expectTokenType(TokenFunc)
 	p.Tokens = p.Tokens[1:]
 
+	// Methods have the receiver before the name (e.g. `fun (s: string) shout()`)
+	var receiver *Ast
+	if p.Tokens[0].Type == TokenOpenParen {
+		p.Tokens = p.Tokens[1:]
+		receiver = p.parseVarDef()
+		p.expectTokenType(TokenCloseParen)
+		p.Tokens = p.Tokens[1:]
+	}
+
 	p.expectTokenType(TokenSymbol)
 	result.Name = p.Tokens[0].Value
 	p.Tokens = p.Tokens[1:]
 
+	var typeParams *Ast
+	if p.Tokens[0].Type == TokenOpenBracket {
+		if receiver != nil {
+			log.Fatal("[Parser]: Methods can't be generic")
+		}
+		typeParams = p.parseTypeParams()
+	}
+
 	args := p.parseFuncArgs()
+	if receiver != nil {
+		args.Children = append([]*Ast{receiver}, args.Children...)
+	}
 	returnType := p.parseFuncReturnType()
 	body := p.parseBlock()
+	p.typeParams = nil
 
 	result.Children = append(result.Children, args)
 	result.Children = append(result.Children, returnType)
 	result.Children = append(result.Children, body)
+	if typeParams != nil {
+		result.Children = append(result.Children, typeParams)
+	}
 	result.Type = AstFunction
+	if receiver != nil {
+		result.Type = AstMethod
+	}
+
+	return result
+}
+
+// Parses the tokens into the type parameters of a generic function
+// (e.g. `[T: numeric, U]`), parameters without a constraint accept
+// any type. The parameters are in scope until the end of the function.
+func (p *Parser) parseTypeParams() (result *Ast) {
+	result = &Ast{Type: AstTypeParams}
+	p.expectTokenType(TokenOpenBracket)
+	p.Tokens = p.Tokens[1:]
+
+	genericFuncCount++
+	p.typeParams = map[string]TypeAnnotation{}
+	for len(p.Tokens) > 0 && p.Tokens[0].Type != TokenCloseBracket {
+		p.expectTokenType(TokenSymbol)
+		name := p.Tokens[0].Value
+		p.Tokens = p.Tokens[1:]
+		if _, isType := p.typeFromName(name); isType {
+			log.Fatalf("[Parser]: Type parameter '%s' redefines a type", name)
+		}
+
+		constraint := ConstraintAny
+		if p.Tokens[0].Type == TokenColon {
+			p.Tokens = p.Tokens[1:]
+			p.expectTokenType(TokenSymbol)
+			var ok bool
+			if constraint, ok = typeConstraintFromName(p.Tokens[0].Value); !ok {
+				log.Fatal("[Parser]: Unknown type constraint '", p.Tokens[0].Value, "'")
+			}
+			p.Tokens = p.Tokens[1:]
+		}
+
+		param := typeParam(name, constraint, genericFuncCount)
+		p.typeParams[name] = param
+		result.Children = append(result.Children, &Ast{Type: AstTypeAnnotation, Name: name, DataType: param})
+
+		if p.Tokens[0].Type != TokenComma {
+			break
+		}
+		p.Tokens = p.Tokens[1:]
+	}
+
+	p.expectTokenType(TokenCloseBracket)
+	p.Tokens = p.Tokens[1:]
+	if len(result.Children) == 0 {
+		log.Fatal("[Parser]: Generic functions must have at least one type parameter")
+	}
+	return result
+}
+
+// Parses the tokens into an import declaration (e.g. `import "math";`
+// or `import "lib/math" as m;`). The module is referred with the name
+// of the imported file when no alias is given.
+func (p *Parser) parseImport() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenImport)
+	p.Tokens = p.Tokens[1:]
+
+	p.expectTokenType(TokenStringLiteral)
+	result.StringDataValue = p.Tokens[0].Value
+	p.Tokens = p.Tokens[1:]
+
+	if len(p.Tokens) > 1 && p.Tokens[0].Type == TokenSymbol && p.Tokens[0].Value == "as" {
+		p.Tokens = p.Tokens[1:]
+		p.expectTokenType(TokenSymbol)
+		result.Name = p.Tokens[0].Value
+		p.Tokens = p.Tokens[1:]
+	} else {
+		result.Name = moduleNameFromPath(result.StringDataValue)
+	}
+
+	p.expectTokenType(TokenSemicolon)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstImport
+	return result
+}
+
+// Parses the tokens into the declaration of a function implemented
+// in C (e.g. `extern fun abs(x: int): int;`).
+func (p *Parser) parseExternFuncDecl() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenExtern)
+	p.Tokens = p.Tokens[1:]
+	p.expectTokenType(TokenFunc)
+	p.Tokens = p.Tokens[1:]
+
+	p.expectTokenType(TokenSymbol)
+	result.Name = p.Tokens[0].Value
+	p.Tokens = p.Tokens[1:]
+
+	result.Children = append(result.Children, p.parseFuncArgs())
+	result.Children = append(result.Children, p.parseFuncReturnType())
+	p.expectTokenType(TokenSemicolon)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstExternFunction
+	return result
+}
+
+// Parses the tokens into an interface declaration listing the
+// methods of the types implementing it (e.g. `interface Shape { area(): int; }`).
+func (p *Parser) parseInterface() (result *Ast) {
+	result = &Ast{}
+	p.expectTokenType(TokenInterface)
+	p.Tokens = p.Tokens[1:]
+
+	p.expectTokenType(TokenSymbol)
+	result.Name = p.Tokens[0].Value
+	p.Tokens = p.Tokens[1:]
+
+	p.expectTokenType(TokenOpenCurly)
+	p.Tokens = p.Tokens[1:]
+	for len(p.Tokens) > 0 && p.Tokens[0].Type != TokenCloseCurly {
+		p.expectTokenType(TokenSymbol)
+		method := &Ast{Type: AstTypeAnnotation, Name: p.Tokens[0].Value}
+		p.Tokens = p.Tokens[1:]
 
+		var params []TypeAnnotation
+		for _, param := range p.parseFuncArgs().Children {
+			params = append(params, param.Children[0].DataType)
+		}
+		method.DataType = funcType(params, p.parseFuncReturnType().Children[0].DataType)
+		p.expectTokenType(TokenSemicolon)
+		p.Tokens = p.Tokens[1:]
+		result.Children = append(result.Children, method)
+	}
+	p.expectTokenType(TokenCloseCurly)
+	p.Tokens = p.Tokens[1:]
+
+	result.Type = AstInterface
+	result.DataType = namedType(result.Name)
 	return result
 }
 
+// Parses the tokens into the include attribute of an extern
+// declaration (e.g. `#[include("math.h")]`) and returns the header.
+func (p *Parser) parseIncludeAttribute() string {
+	for _, expected := range []TokenType{TokenHash, TokenOpenBracket} {
+		p.expectTokenType(expected)
+		p.Tokens = p.Tokens[1:]
+	}
+	p.expectTokenType(TokenSymbol)
+	if p.Tokens[0].Value != "include" {
+		log.Fatalf("[Parser]: Unknown attribute '%s'", p.Tokens[0].Value)
+	}
+	p.Tokens = p.Tokens[1:]
+	p.expectTokenType(TokenOpenParen)
+	p.Tokens = p.Tokens[1:]
+	p.expectTokenType(TokenStringLiteral)
+	header := p.Tokens[0].Value
+	p.Tokens = p.Tokens[1:]
+	for _, expected := range []TokenType{TokenCloseParen, TokenCloseBracket} {
+		p.expectTokenType(expected)
+		p.Tokens = p.Tokens[1:]
+	}
+	return header
+}
+
 // Parse a list of tokens into a Module.
 func (p *Parser) parseModule() (result *Ast) {
 	result = &Ast{}
 	result.Type = AstModule
 	for len(p.Tokens) > 0 {
-		result.Children = append(result.Children, p.parseFuncDef())
+		header := ""
+		hasHeader := false
+		if p.Tokens[0].Type == TokenHash {
+			header = p.parseIncludeAttribute()
+			hasHeader = true
+		}
+
+		public := false
+		if p.Tokens[0].Type == TokenPub {
+			p.Tokens = p.Tokens[1:]
+			public = true
+		}
+
+		var def *Ast
+		switch p.Tokens[0].Type {
+		case TokenVar, TokenConst:
+			def = p.parseGlobalVarDef()
+		case TokenImport:
+			if public {
+				log.Fatal("[Parser]: Imports can't be public")
+			}
+			def = p.parseImport()
+		case TokenInterface:
+			def = p.parseInterface()
+		case TokenExtern:
+			def = p.parseExternFuncDecl()
+			def.StringDataValue = header
+		default:
+			def = p.parseFuncDef()
+		}
+		if hasHeader && def.Type != AstExternFunction {
+			log.Fatal("[Parser]: The include attribute can only be used on extern functions")
+		}
+		def.Public = public
+		result.Children = append(result.Children, def)
 	}
 	return result
 }
@@ -0,0 +1,121 @@
+package src
+
+import (
+	"fmt"
+	"log"
+)
+
+// Methods available on every result type, they return the type of
+// the method given the value type and the error type of the result.
+var resultMethods = map[string]func(valueType TypeAnnotation, errorType TypeAnnotation) TypeAnnotation{
+	"is_ok":  func(TypeAnnotation, TypeAnnotation) TypeAnnotation { return funcType(nil, TypeBoolean) },
+	"is_err": func(TypeAnnotation, TypeAnnotation) TypeAnnotation { return funcType(nil, TypeBoolean) },
+	// Stops the program if the result is an error
+	"value": func(valueType TypeAnnotation, _ TypeAnnotation) TypeAnnotation { return funcType(nil, valueType) },
+	// Stops the program if the result is not an error
+	"error": func(_ TypeAnnotation, errorType TypeAnnotation) TypeAnnotation { return funcType(nil, errorType) },
+	"value_or": func(valueType TypeAnnotation, _ TypeAnnotation) TypeAnnotation {
+		return funcType([]TypeAnnotation{valueType}, valueType)
+	},
+}
+
+// Returns the parameter types and the return type of a method of a result.
+func resultMethodSignature(receiverType TypeAnnotation, name string) ([]TypeAnnotation, TypeAnnotation, error) {
+	method, ok := resultMethods[name]
+	valueType, errorType := resultTypes(receiverType)
+	if !ok || (name == "value_or" && valueType == TypeVoid) {
+		return nil, TypeVoid, fmt.Errorf("type '%s' has no method %s", receiverType, name)
+	}
+	params, returnType := funcTypeSignature(method(valueType, errorType))
+	return params, returnType, nil
+}
+
+// Returns the return type of the function, or of the function
+// literal, whose body is being checked.
+func enclosingReturnType() (TypeAnnotation, error) {
+	if len(closureScopes) > 0 {
+		return closureScopes[len(closureScopes)-1].literal.Children[1].Children[0].DataType, nil
+	}
+	if currentFuncDef == nil {
+		return TypeVoid, fmt.Errorf("errors can only be propagated inside functions")
+	}
+	return currentFuncDef.Children[1].Children[0].DataType, nil
+}
+
+// Returns the type of the value of a result whose error is propagated.
+func typeOfTry(ast Ast) (TypeAnnotation, error) {
+	resultType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		return TypeVoid, err
+	}
+	if !isResultType(resultType) {
+		return TypeVoid, fmt.Errorf("cannot propagate the error of value of type '%s', it's not a result", resultType)
+	}
+	valueType, _ := resultTypes(resultType)
+	return valueType, nil
+}
+
+// Checks the propagation of the error of a result (e.g. `parse(s)?`),
+// the error is returned to the caller so the enclosing function must
+// return a result with the same error type.
+func checkTypeOfTry(ast *Ast, expectedType TypeAnnotation) {
+	valueType, err := typeOfTry(*ast)
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
+	}
+	if valueType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, valueType)
+	}
+	returnType, err := enclosingReturnType()
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
+	}
+	if !isResultType(returnType) {
+		log.Fatalf("[Type Check]: Cannot propagate an error from a function returning '%s'", returnType)
+	}
+	resultType, _ := typeOfExpression(*ast.Children[0])
+	_, errorType := resultTypes(resultType)
+	if _, returnedErrorType := resultTypes(returnType); errorType != returnedErrorType {
+		log.Fatalf("[Type Check]: Cannot propagate an error of type '%s' from a function returning '%s'", errorType, returnType)
+	}
+	checkTypeOfExpression(ast.Children[0], resultType)
+	// The returned result type is needed to emit the propagation
+	ast.Children = append(ast.Children[:1], &Ast{Type: AstTypeAnnotation, DataType: returnType})
+	ast.DataType = valueType
+}
+
+// Checks `ok(value)` and `err(error)`, their type
+// is taken from the context they are used in.
+func checkTypeOfResultValue(ast *Ast, expectedType TypeAnnotation) {
+	name := "ok"
+	if ast.Type == AstResultErr {
+		name = "err"
+	}
+	if !isResultType(expectedType) {
+		log.Fatalf("[Type Check]: Expected type '%s' but %s(...) is a result", expectedType, name)
+	}
+	valueType, errorType := resultTypes(expectedType)
+	if ast.Type == AstResultErr {
+		valueType = errorType
+	}
+	if valueType == TypeVoid {
+		if len(ast.Children) != 0 {
+			log.Fatalf("[Type Check]: %s of '%s' expects no arguments but got %d", name, expectedType, len(ast.Children))
+		}
+	} else {
+		if len(ast.Children) != 1 {
+			log.Fatalf("[Type Check]: %s of '%s' expects 1 argument but got %d", name, expectedType, len(ast.Children))
+		}
+		checkTypeOfExpression(ast.Children[0], valueType)
+	}
+	ast.DataType = expectedType
+}
+
+// Stops when a function returning a result is called without using
+// the result, so that errors can't be ignored by mistake.
+func checkResultIsUsed(ast Ast, returnType TypeAnnotation) {
+	if isResultType(returnType) {
+		log.Fatalf("[Type Check]: Result of type '%s' returned by %s is not used, handle it or propagate it with ?",
+			returnType, ast.Name)
+	}
+}
@@ -0,0 +1,168 @@
+package src
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// Builds the program in the input file and runs it with given
+// arguments, the executable is cached and built again only when
+// the sources, the options or the compiler change. The program is
+// interpreted or run by the virtual machine instead when the options
+// ask so, `.sowoc` files are always run by the virtual machine.
+// Returns the exit code of the program, 128 plus the number of the
+// signal when the program is killed by one.
+func SowoRunFile(options CompilerOptions, args []string) int {
+	programArgs := append([]string{options.InputFile}, args...)
+	if options.Interpret {
+		return SowoInterpretFile(options, programArgs, os.Stdin, os.Stdout, os.Stderr)
+	}
+	if options.VM || isBytecodeFile(options.InputFile) {
+		return SowoRunBytecode(options, programArgs, os.Stdin, os.Stdout, os.Stderr)
+	}
+	backend, ok := targetBackend(options).(ExecutableBackend)
+	if !ok {
+		log.Fatalf("Programs compiled for target %s can't be run", options.Target)
+	}
+	loader := ModuleLoader{SearchPath: options.ImportPaths}
+	ast := loader.loadProgram(options.InputFile)
+
+	buildDir := filepath.Join(runCacheDir(), buildHash(loader.Sources, options))
+	exeFile := filepath.Join(buildDir, moduleNameFromPath(options.InputFile))
+	if _, err := os.Stat(exeFile); err != nil {
+		checkTypeOfProgram(ast)
+		code, err := backend.Emit(*ast, options)
+		if err != nil {
+			log.Fatalf("[Backend]: %s: %s", backend.Name(), err)
+		}
+		buildCachedExecutable(backend, code, buildDir, exeFile, options)
+	}
+
+	// The program sees the source file as argv[0], like with --interp and --vm
+	cmd := exec.Command(exeFile, args...)
+	cmd.Args[0] = options.InputFile
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			// Killed by a signal, reported like a shell does
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", options.InputFile, status.Signal())
+				return 128 + int(status.Signal())
+			}
+			return exitErr.ExitCode()
+		}
+		log.Fatalf("Error running %s: %s", exeFile, err)
+	}
+	return 0
+}
+
+// Runs the program in the input file with the interpreter, args are
+// the command line arguments starting with the program name.
+// Returns the exit code of the program.
+func SowoInterpretFile(options CompilerOptions, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	ast := loadAndCheckProgram(options)
+	return interpretProgram(*ast, args, stdin, stdout, stderr, options)
+}
+
+// Runs the program in the input file with the virtual machine, the
+// input is either a sowo source compiled to bytecode or a `.sowoc` file.
+// Returns the exit code of the program.
+func SowoRunBytecode(options CompilerOptions, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var program *Bytecode
+	if isBytecodeFile(options.InputFile) {
+		f, err := os.Open(options.InputFile)
+		if err != nil {
+			log.Fatalf("Error opening file %s", options.InputFile)
+		}
+		defer f.Close()
+		if program, err = readBytecode(f); err != nil {
+			log.Fatalf("[VM]: %s: %s", options.InputFile, err)
+		}
+	} else {
+		program = compileBytecode(*loadAndCheckProgram(options), options)
+	}
+	if options.PrintBytecode {
+		fmt.Fprint(stdout, disassembleBytecode(program))
+	}
+	return runBytecode(program, args, stdin, stdout, stderr)
+}
+
+// Tells if the file holds bytecode saved by build --bytecode.
+func isBytecodeFile(path string) bool {
+	return filepath.Ext(path) == ".sowoc"
+}
+
+// Returns the directory holding the executables built by SowoRunFile.
+func runCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "sowo")
+}
+
+// Compiles the generated code in a temporary directory and moves the
+// executable to its place in the cache, so that it's never seen half written.
+func buildCachedExecutable(backend ExecutableBackend, code []byte, buildDir string, exeFile string, options CompilerOptions) {
+	if err := os.MkdirAll(buildDir, 0777); err != nil {
+		log.Fatalf("Error creating directory %s", buildDir)
+	}
+	tmpDir, err := ioutil.TempDir(buildDir, "build")
+	if err != nil {
+		log.Fatalf("Error creating directory in %s", buildDir)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sourceFile := filepath.Join(tmpDir, "main"+backend.Extension())
+	if err := ioutil.WriteFile(sourceFile, code, 0666); err != nil {
+		log.Fatalf("Error writing to file %s", sourceFile)
+	}
+	tmpExe := filepath.Join(tmpDir, "main")
+	if err := backend.BuildExecutable(sourceFile, tmpExe, options); err != nil {
+		log.Fatalf("[CC]: %s", err)
+	}
+	if err := os.Rename(tmpExe, exeFile); err != nil {
+		log.Fatalf("Error writing to file %s", exeFile)
+	}
+}
+
+// Returns a hash of everything the executable of a program depends on:
+// the sources of its modules, the options changing the generated code,
+// the C compiler with its flags and the sowo compiler itself.
+func buildHash(sources map[string]string, options CompilerOptions) string {
+	h := sha256.New()
+	var paths []string
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(h, "%q %d\n%s\n", path, len(sources[path]), sources[path])
+	}
+	fmt.Fprintf(h, "gc=%d gc-debug=%t unchecked=%t target=%q\n", options.GC, options.GCDebug, options.Unchecked, options.Target)
+	fmt.Fprintf(h, "cc=%q cflags=%q opt=%q\n", cCompiler(options), options.CFlags, options.OptLevel)
+
+	compiler, err := os.Executable()
+	if err == nil {
+		var f *os.File
+		if f, err = os.Open(compiler); err == nil {
+			_, err = io.Copy(h, f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Fatalf("Error reading the compiler executable: %s", err)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package src
+
+// Import path of the standard library shipped with the compiler,
+// it's also the name of its module.
+const stdModulePath = "std"
+
+// Sowo source of the standard library. The functions that need the C
+// library (input, exit, string utilities) are builtins of the `std`
+// module implemented by the runtime, see builtinFuncs.
+const stdModuleSource = `
+# Math
+
+pub fun abs(x: int): int {
+    if (x < 0) {
+        return 0 - x;
+    }
+    return x;
+}
+
+pub fun min(a: int, b: int): int {
+    if (a < b) {
+        return a;
+    }
+    return b;
+}
+
+pub fun max(a: int, b: int): int {
+    if (a > b) {
+        return a;
+    }
+    return b;
+}
+
+pub fun pow(base: int, exp: int): int {
+    assert(exp >= 0, "pow: negative exponent");
+    var result: int = 1;
+    while (exp > 0) {
+        result = result * base;
+        exp = exp - 1;
+    }
+    return result;
+}
+
+# Strings
+
+pub fun repeat(s: string, n: int): string {
+    var result: string = "";
+    while (n > 0) {
+        result = result + s;
+        n = n - 1;
+    }
+    return result;
+}
+`
@@ -0,0 +1,285 @@
+%sowo_slice = type { i64, i8* }
+%sowo_closure = type { i8*, i8* }
+%sowo_interface = type { i8*, i8* }
+
+@closures__greeting = internal global %sowo_closure zeroinitializer
+@.str.0 = private unnamed_addr constant [26 x i8] c"../examples/closures.sowo\00"
+@.str.1 = private unnamed_addr constant [21 x i8] c"call of nil function\00"
+@.str.2 = private unnamed_addr constant [2 x i8] c"\0A\00"
+@.str.3 = private unnamed_addr constant [15 x i8] c"%d %d %d %d %s\00"
+@.str.4 = private unnamed_addr constant [9 x i8] c"captured\00"
+@.str.5 = private unnamed_addr constant [5 x i8] c"sowo\00"
+@.str.6 = private unnamed_addr constant [9 x i8] c"%d %s %s\00"
+@.str.7 = private unnamed_addr constant [3 x i8] c"ab\00"
+@.str.8 = private unnamed_addr constant [6 x i8] c"%s %s\00"
+@.str.9 = private unnamed_addr constant [35 x i8] c"integer overflow in multiplication\00"
+@.str.10 = private unnamed_addr constant [2 x i8] c"!\00"
+@.str.11 = private unnamed_addr constant [9 x i8] c"%s %d %s\00"
+@.str.12 = private unnamed_addr constant [29 x i8] c"integer overflow in addition\00"
+
+declare void @sowo_gc_add_root(i8*, i64)
+declare i8* @llvm.frameaddress.p0i8(i32)
+declare void @sowo_gc_init(i8*)
+declare void @sowo_panic(i8*, i32, i32, i8*, ...)
+declare i32 @printf(i8*, ...)
+declare i8* @sowo_alloc(i64)
+declare { i32, i1 } @llvm.smul.with.overflow.i32(i32, i32)
+declare i8* @sowo_str_concat(i8*, i8*)
+declare { i32, i1 } @llvm.sadd.with.overflow.i32(i32, i32)
+
+define internal void @sowo_init_globals() {
+entry:
+  store %sowo_closure { i8* bitcast (i8* (i8*, i8*)* @sowo_fn__closures__exclaim to i8*), i8* null }, %sowo_closure* @closures__greeting
+  call void @sowo_gc_add_root(i8* bitcast (%sowo_closure* @closures__greeting to i8*), i64 ptrtoint (%sowo_closure* getelementptr (%sowo_closure, %sowo_closure* null, i32 1) to i64))
+  ret void
+}
+
+define i32 @main(i32 %argc, i8** %argv) {
+entry:
+  %t1 = call i8* @llvm.frameaddress.p0i8(i32 0)
+  call void @sowo_gc_init(i8* %t1)
+  call void @sowo_init_globals()
+  call void @closures__main()
+  ret i32 0
+}
+
+define internal i8* @sowo_fn__closures__exclaim(i8* %env, i8* %arg0) {
+entry:
+  %t1 = call i8* @closures__exclaim(i8* %arg0)
+  ret i8* %t1
+}
+
+define internal void @closures__main() {
+entry:
+  %add5.2 = alloca %sowo_closure
+  %add10.4 = alloca %sowo_closure
+  %count.20 = alloca i32
+  %show.27 = alloca %sowo_closure
+  %t1 = call %sowo_closure @closures__adder(i32 5)
+  store %sowo_closure %t1, %sowo_closure* %add5.2
+  %t3 = call %sowo_closure @closures__adder(i32 10)
+  store %sowo_closure %t3, %sowo_closure* %add10.4
+  %t5 = load %sowo_closure, %sowo_closure* %add5.2
+  %t6 = extractvalue %sowo_closure %t5, 1
+  %t7 = extractvalue %sowo_closure %t5, 0
+  %t8 = icmp eq i8* %t7, null
+  br i1 %t8, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 31, i32 11, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L2:
+  %t9 = bitcast i8* %t7 to i32 (i8*, i32)*
+  %t10 = call i32 %t9(i8* %t6, i32 1)
+  %t11 = load %sowo_closure, %sowo_closure* %add10.4
+  %t12 = extractvalue %sowo_closure %t11, 1
+  %t13 = extractvalue %sowo_closure %t11, 0
+  %t14 = icmp eq i8* %t13, null
+  br i1 %t14, label %L3, label %L4
+L3:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 31, i32 20, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L4:
+  %t15 = bitcast i8* %t13 to i32 (i8*, i32)*
+  %t16 = call i32 %t15(i8* %t12, i32 1)
+  %t17 = load %sowo_closure, %sowo_closure* %add5.2
+  %t18 = call i32 @closures__twice(%sowo_closure %t17, i32 0)
+  %t19 = call i32 @closures__twice(%sowo_closure { i8* bitcast (i32 (i8*, i32)* @sowo_fn__closures__double to i8*), i8* null }, i32 3)
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([15 x i8], [15 x i8]* @.str.3, i64 0, i64 0), i32 %t10, i32 %t16, i32 %t18, i32 %t19, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.2, i64 0, i64 0))
+  store i32 1, i32* %count.20
+  %t21 = call i8* @sowo_alloc(i64 ptrtoint ({ i32 }* getelementptr ({ i32 }, { i32 }* null, i32 1) to i64))
+  %t22 = bitcast i8* %t21 to { i32 }*
+  %t23 = load i32, i32* %count.20
+  %t24 = getelementptr { i32 }, { i32 }* %t22, i32 0, i32 0
+  store i32 %t23, i32* %t24
+  %t25 = insertvalue %sowo_closure undef, i8* bitcast (void (i8*, i8*)* @sowo_closure_1 to i8*), 0
+  %t26 = insertvalue %sowo_closure %t25, i8* %t21, 1
+  store %sowo_closure %t26, %sowo_closure* %show.27
+  store i32 100, i32* %count.20
+  %t28 = load %sowo_closure, %sowo_closure* %show.27
+  %t29 = extractvalue %sowo_closure %t28, 1
+  %t30 = extractvalue %sowo_closure %t28, 0
+  %t31 = icmp eq i8* %t30, null
+  br i1 %t31, label %L5, label %L6
+L5:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 38, i32 5, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L6:
+  %t32 = bitcast i8* %t30 to void (i8*, i8*)*
+  call void %t32(i8* %t29, i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.4, i64 0, i64 0))
+  %t33 = call i32 @closures__apply__integer(%sowo_closure { i8* bitcast (i32 (i8*, i32)* @sowo_fn__closures__double to i8*), i8* null }, i32 21)
+  %t34 = load %sowo_closure, %sowo_closure* @closures__greeting
+  %t35 = call i8* @closures__apply__string(%sowo_closure %t34, i8* getelementptr inbounds ([5 x i8], [5 x i8]* @.str.5, i64 0, i64 0))
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.6, i64 0, i64 0), i32 %t33, i8* %t35, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.2, i64 0, i64 0))
+  %t36 = insertvalue %sowo_closure undef, i8* bitcast (i8* (i8*, i8*)* @sowo_closure_2 to i8*), 0
+  %t37 = insertvalue %sowo_closure %t36, i8* null, 1
+  %t38 = call i8* @closures__apply__string(%sowo_closure %t37, i8* getelementptr inbounds ([3 x i8], [3 x i8]* @.str.7, i64 0, i64 0))
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.8, i64 0, i64 0), i8* %t38, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.2, i64 0, i64 0))
+  ret void
+}
+
+define internal i32 @closures__twice(%sowo_closure %arg0, i32 %arg1) {
+entry:
+  %f.1 = alloca %sowo_closure
+  %x.2 = alloca i32
+  store %sowo_closure %arg0, %sowo_closure* %f.1
+  store i32 %arg1, i32* %x.2
+  %t3 = load %sowo_closure, %sowo_closure* %f.1
+  %t4 = extractvalue %sowo_closure %t3, 1
+  %t5 = load %sowo_closure, %sowo_closure* %f.1
+  %t6 = extractvalue %sowo_closure %t5, 1
+  %t7 = load i32, i32* %x.2
+  %t8 = extractvalue %sowo_closure %t5, 0
+  %t9 = icmp eq i8* %t8, null
+  br i1 %t9, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 8, i32 14, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L2:
+  %t10 = bitcast i8* %t8 to i32 (i8*, i32)*
+  %t11 = call i32 %t10(i8* %t6, i32 %t7)
+  %t12 = extractvalue %sowo_closure %t3, 0
+  %t13 = icmp eq i8* %t12, null
+  br i1 %t13, label %L3, label %L4
+L3:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 8, i32 12, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L4:
+  %t14 = bitcast i8* %t12 to i32 (i8*, i32)*
+  %t15 = call i32 %t14(i8* %t4, i32 %t11)
+  ret i32 %t15
+}
+
+define internal i32 @closures__double(i32 %arg0) {
+entry:
+  %x.1 = alloca i32
+  store i32 %arg0, i32* %x.1
+  %t2 = load i32, i32* %x.1
+  %t3 = call { i32, i1 } @llvm.smul.with.overflow.i32(i32 %t2, i32 2)
+  %t4 = extractvalue { i32, i1 } %t3, 1
+  br i1 %t4, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 12, i32 14, i8* getelementptr inbounds ([35 x i8], [35 x i8]* @.str.9, i64 0, i64 0))
+  unreachable
+L2:
+  %t5 = extractvalue { i32, i1 } %t3, 0
+  ret i32 %t5
+}
+
+define internal %sowo_closure @closures__adder(i32 %arg0) {
+entry:
+  %n.1 = alloca i32
+  store i32 %arg0, i32* %n.1
+  %t2 = call i8* @sowo_alloc(i64 ptrtoint ({ i32 }* getelementptr ({ i32 }, { i32 }* null, i32 1) to i64))
+  %t3 = bitcast i8* %t2 to { i32 }*
+  %t4 = load i32, i32* %n.1
+  %t5 = getelementptr { i32 }, { i32 }* %t3, i32 0, i32 0
+  store i32 %t4, i32* %t5
+  %t6 = insertvalue %sowo_closure undef, i8* bitcast (i32 (i8*, i32)* @sowo_closure_3 to i8*), 0
+  %t7 = insertvalue %sowo_closure %t6, i8* %t2, 1
+  ret %sowo_closure %t7
+}
+
+define internal i8* @closures__exclaim(i8* %arg0) {
+entry:
+  %s.1 = alloca i8*
+  store i8* %arg0, i8** %s.1
+  %t2 = load i8*, i8** %s.1
+  %t3 = call i8* @sowo_str_concat(i8* %t2, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.10, i64 0, i64 0))
+  ret i8* %t3
+}
+
+define internal i32 @sowo_fn__closures__double(i8* %env, i32 %arg0) {
+entry:
+  %t1 = call i32 @closures__double(i32 %arg0)
+  ret i32 %t1
+}
+
+define internal void @sowo_closure_1(i8* %env, i8* %arg0) {
+entry:
+  %count.4 = alloca i32
+  %label.5 = alloca i8*
+  %t1 = bitcast i8* %env to { i32 }*
+  %t2 = getelementptr { i32 }, { i32 }* %t1, i32 0, i32 0
+  %t3 = load i32, i32* %t2
+  store i32 %t3, i32* %count.4
+  store i8* %arg0, i8** %label.5
+  %t6 = load i8*, i8** %label.5
+  %t7 = load i32, i32* %count.4
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.11, i64 0, i64 0), i8* %t6, i32 %t7, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.2, i64 0, i64 0))
+  ret void
+}
+
+define internal i32 @closures__apply__integer(%sowo_closure %arg0, i32 %arg1) {
+entry:
+  %f.1 = alloca %sowo_closure
+  %x.2 = alloca i32
+  store %sowo_closure %arg0, %sowo_closure* %f.1
+  store i32 %arg1, i32* %x.2
+  %t3 = load %sowo_closure, %sowo_closure* %f.1
+  %t4 = extractvalue %sowo_closure %t3, 1
+  %t5 = load i32, i32* %x.2
+  %t6 = extractvalue %sowo_closure %t3, 0
+  %t7 = icmp eq i8* %t6, null
+  br i1 %t7, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 4, i32 12, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L2:
+  %t8 = bitcast i8* %t6 to i32 (i8*, i32)*
+  %t9 = call i32 %t8(i8* %t4, i32 %t5)
+  ret i32 %t9
+}
+
+define internal i8* @closures__apply__string(%sowo_closure %arg0, i8* %arg1) {
+entry:
+  %f.1 = alloca %sowo_closure
+  %x.2 = alloca i8*
+  store %sowo_closure %arg0, %sowo_closure* %f.1
+  store i8* %arg1, i8** %x.2
+  %t3 = load %sowo_closure, %sowo_closure* %f.1
+  %t4 = extractvalue %sowo_closure %t3, 1
+  %t5 = load i8*, i8** %x.2
+  %t6 = extractvalue %sowo_closure %t3, 0
+  %t7 = icmp eq i8* %t6, null
+  br i1 %t7, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 4, i32 12, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L2:
+  %t8 = bitcast i8* %t6 to i8* (i8*, i8*)*
+  %t9 = call i8* %t8(i8* %t4, i8* %t5)
+  ret i8* %t9
+}
+
+define internal i8* @sowo_closure_2(i8* %env, i8* %arg0) {
+entry:
+  %s.1 = alloca i8*
+  store i8* %arg0, i8** %s.1
+  %t2 = load i8*, i8** %s.1
+  %t3 = load i8*, i8** %s.1
+  %t4 = call i8* @sowo_str_concat(i8* %t2, i8* %t3)
+  ret i8* %t4
+}
+
+define internal i32 @sowo_closure_3(i8* %env, i32 %arg0) {
+entry:
+  %n.4 = alloca i32
+  %x.5 = alloca i32
+  %t1 = bitcast i8* %env to { i32 }*
+  %t2 = getelementptr { i32 }, { i32 }* %t1, i32 0, i32 0
+  %t3 = load i32, i32* %t2
+  store i32 %t3, i32* %n.4
+  store i32 %arg0, i32* %x.5
+  %t6 = load i32, i32* %x.5
+  %t7 = load i32, i32* %n.4
+  %t8 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 %t6, i32 %t7)
+  %t9 = extractvalue { i32, i1 } %t8, 1
+  br i1 %t9, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([26 x i8], [26 x i8]* @.str.0, i64 0, i64 0), i32 18, i32 18, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.12, i64 0, i64 0))
+  unreachable
+L2:
+  %t10 = extractvalue { i32, i1 } %t8, 0
+  ret i32 %t10
+}
+
@@ -0,0 +1,86 @@
+%sowo_slice = type { i64, i8* }
+%sowo_closure = type { i8*, i8* }
+%sowo_interface = type { i8*, i8* }
+
+@.str.0 = private unnamed_addr constant [22 x i8] c"../examples/expr.sowo\00"
+@.str.1 = private unnamed_addr constant [25 x i8] c"integer division by zero\00"
+@.str.2 = private unnamed_addr constant [29 x i8] c"integer overflow in division\00"
+@.str.3 = private unnamed_addr constant [29 x i8] c"integer overflow in addition\00"
+@.str.4 = private unnamed_addr constant [35 x i8] c"integer overflow in multiplication\00"
+@.str.5 = private unnamed_addr constant [32 x i8] c"integer overflow in subtraction\00"
+
+declare i8* @llvm.frameaddress.p0i8(i32)
+declare void @sowo_gc_init(i8*)
+declare void @sowo_panic(i8*, i32, i32, i8*, ...)
+declare { i32, i1 } @llvm.sadd.with.overflow.i32(i32, i32)
+declare { i32, i1 } @llvm.smul.with.overflow.i32(i32, i32)
+declare { i32, i1 } @llvm.ssub.with.overflow.i32(i32, i32)
+
+define internal void @sowo_init_globals() {
+entry:
+  ret void
+}
+
+define i32 @main(i32 %argc, i8** %argv) {
+entry:
+  %t1 = call i8* @llvm.frameaddress.p0i8(i32 0)
+  call void @sowo_gc_init(i8* %t1)
+  call void @sowo_init_globals()
+  call void @expr__main()
+  ret i32 0
+}
+
+define internal void @expr__main() {
+entry:
+  %a.9 = alloca i32
+  %b.10 = alloca i32
+  %c.12 = alloca i32
+  %t1 = icmp eq i32 3, 0
+  br i1 %t1, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([22 x i8], [22 x i8]* @.str.0, i64 0, i64 0), i32 2, i32 22, i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.1, i64 0, i64 0))
+  unreachable
+L2:
+  %t2 = icmp eq i32 3, -1
+  %t3 = icmp eq i32 2, -2147483648
+  %t4 = and i1 %t2, %t3
+  br i1 %t4, label %L3, label %L4
+L3:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([22 x i8], [22 x i8]* @.str.0, i64 0, i64 0), i32 2, i32 22, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.2, i64 0, i64 0))
+  unreachable
+L4:
+  %t5 = sdiv i32 2, 3
+  %t6 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 1, i32 %t5)
+  %t7 = extractvalue { i32, i1 } %t6, 1
+  br i1 %t7, label %L5, label %L6
+L5:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([22 x i8], [22 x i8]* @.str.0, i64 0, i64 0), i32 2, i32 19, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.3, i64 0, i64 0))
+  unreachable
+L6:
+  %t8 = extractvalue { i32, i1 } %t6, 0
+  store i32 %t8, i32* %a.9
+  store i32 1, i32* %b.10
+  %t11 = load i32, i32* %b.10
+  store i32 %t11, i32* %c.12
+  %t13 = load i32, i32* %a.9
+  %t14 = load i32, i32* %c.12
+  %t15 = call { i32, i1 } @llvm.smul.with.overflow.i32(i32 %t13, i32 %t14)
+  %t16 = extractvalue { i32, i1 } %t15, 1
+  br i1 %t16, label %L7, label %L8
+L7:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([22 x i8], [22 x i8]* @.str.0, i64 0, i64 0), i32 5, i32 12, i8* getelementptr inbounds ([35 x i8], [35 x i8]* @.str.4, i64 0, i64 0))
+  unreachable
+L8:
+  %t17 = extractvalue { i32, i1 } %t15, 0
+  %t18 = call { i32, i1 } @llvm.ssub.with.overflow.i32(i32 %t17, i32 1)
+  %t19 = extractvalue { i32, i1 } %t18, 1
+  br i1 %t19, label %L9, label %L10
+L9:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([22 x i8], [22 x i8]* @.str.0, i64 0, i64 0), i32 5, i32 17, i8* getelementptr inbounds ([32 x i8], [32 x i8]* @.str.5, i64 0, i64 0))
+  unreachable
+L10:
+  %t20 = extractvalue { i32, i1 } %t18, 0
+  store i32 %t20, i32* %b.10
+  ret void
+}
+
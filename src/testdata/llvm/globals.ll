@@ -0,0 +1,116 @@
+%sowo_slice = type { i64, i8* }
+%sowo_closure = type { i8*, i8* }
+%sowo_interface = type { i8*, i8* }
+
+@globals__limit = internal global i32 zeroinitializer
+@.str.0 = private unnamed_addr constant [1 x i8] c"\00"
+@globals__greeting = internal global i8* getelementptr inbounds ([1 x i8], [1 x i8]* @.str.0, i64 0, i64 0)
+@.str.1 = private unnamed_addr constant [6 x i8] c"Hello\00"
+@globals__counter = internal global i32 zeroinitializer
+@.str.2 = private unnamed_addr constant [25 x i8] c"../examples/globals.sowo\00"
+@.str.3 = private unnamed_addr constant [35 x i8] c"integer overflow in multiplication\00"
+@globals__message = internal global i8* getelementptr inbounds ([1 x i8], [1 x i8]* @.str.0, i64 0, i64 0)
+@.str.4 = private unnamed_addr constant [10 x i8] c", globals\00"
+@globals__last = internal global i32* zeroinitializer
+@.str.5 = private unnamed_addr constant [2 x i8] c"\0A\00"
+@.str.6 = private unnamed_addr constant [9 x i8] c"%s %d %s\00"
+@.str.7 = private unnamed_addr constant [24 x i8] c"nil pointer dereference\00"
+@.str.8 = private unnamed_addr constant [9 x i8] c"%d %d %s\00"
+@.str.9 = private unnamed_addr constant [9 x i8] c"shadowed\00"
+@.str.10 = private unnamed_addr constant [6 x i8] c"%s %s\00"
+@.str.11 = private unnamed_addr constant [29 x i8] c"integer overflow in addition\00"
+
+declare void @sowo_gc_add_root(i8*, i64)
+declare { i32, i1 } @llvm.smul.with.overflow.i32(i32, i32)
+declare void @sowo_panic(i8*, i32, i32, i8*, ...)
+declare i8* @sowo_str_concat(i8*, i8*)
+declare i8* @sowo_alloc(i64)
+declare i8* @llvm.frameaddress.p0i8(i32)
+declare void @sowo_gc_init(i8*)
+declare i32 @printf(i8*, ...)
+declare { i32, i1 } @llvm.sadd.with.overflow.i32(i32, i32)
+
+define internal void @sowo_init_globals() {
+entry:
+  store i32 3, i32* @globals__limit
+  store i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.1, i64 0, i64 0), i8** @globals__greeting
+  call void @sowo_gc_add_root(i8* bitcast (i8** @globals__greeting to i8*), i64 ptrtoint (i8** getelementptr (i8*, i8** null, i32 1) to i64))
+  %t1 = load i32, i32* @globals__limit
+  %t2 = call { i32, i1 } @llvm.smul.with.overflow.i32(i32 %t1, i32 2)
+  %t3 = extractvalue { i32, i1 } %t2, 1
+  br i1 %t3, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 3, i32 26, i8* getelementptr inbounds ([35 x i8], [35 x i8]* @.str.3, i64 0, i64 0))
+  unreachable
+L2:
+  %t4 = extractvalue { i32, i1 } %t2, 0
+  store i32 %t4, i32* @globals__counter
+  %t5 = load i8*, i8** @globals__greeting
+  %t6 = call i8* @sowo_str_concat(i8* %t5, i8* getelementptr inbounds ([10 x i8], [10 x i8]* @.str.4, i64 0, i64 0))
+  store i8* %t6, i8** @globals__message
+  call void @sowo_gc_add_root(i8* bitcast (i8** @globals__message to i8*), i64 ptrtoint (i8** getelementptr (i8*, i8** null, i32 1) to i64))
+  %t7 = call i8* @sowo_alloc(i64 ptrtoint (i32* getelementptr (i32, i32* null, i32 1) to i64))
+  %t8 = bitcast i8* %t7 to i32*
+  store i32* %t8, i32** @globals__last
+  call void @sowo_gc_add_root(i8* bitcast (i32** @globals__last to i8*), i64 ptrtoint (i32** getelementptr (i32*, i32** null, i32 1) to i64))
+  ret void
+}
+
+define i32 @main(i32 %argc, i8** %argv) {
+entry:
+  %t1 = call i8* @llvm.frameaddress.p0i8(i32 0)
+  call void @sowo_gc_init(i8* %t1)
+  call void @sowo_init_globals()
+  call void @globals__main()
+  ret i32 0
+}
+
+define internal void @globals__main() {
+entry:
+  %counter.7 = alloca i8*
+  %t1 = load i8*, i8** @globals__message
+  %t2 = load i32, i32* @globals__counter
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.6, i64 0, i64 0), i8* %t1, i32 %t2, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  call void @globals__bump()
+  call void @globals__bump()
+  %t3 = load i32, i32* @globals__counter
+  %t4 = load i32*, i32** @globals__last
+  %t5 = icmp eq i32* %t4, null
+  br i1 %t5, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 0, i32 0, i8* getelementptr inbounds ([24 x i8], [24 x i8]* @.str.7, i64 0, i64 0))
+  unreachable
+L2:
+  %t6 = load i32, i32* %t4
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.8, i64 0, i64 0), i32 %t3, i32 %t6, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  store i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.9, i64 0, i64 0), i8** %counter.7
+  %t8 = load i8*, i8** %counter.7
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.10, i64 0, i64 0), i8* %t8, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  ret void
+}
+
+define internal void @globals__bump() {
+entry:
+  %t1 = load i32, i32* @globals__counter
+  %t2 = load i32, i32* @globals__limit
+  %t3 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 %t1, i32 %t2)
+  %t4 = extractvalue { i32, i1 } %t3, 1
+  br i1 %t4, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 19, i32 23, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.11, i64 0, i64 0))
+  unreachable
+L2:
+  %t5 = extractvalue { i32, i1 } %t3, 0
+  store i32 %t5, i32* @globals__counter
+  %t6 = load i32*, i32** @globals__last
+  %t7 = load i32, i32* @globals__counter
+  %t8 = icmp eq i32* %t6, null
+  br i1 %t8, label %L3, label %L4
+L3:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 0, i32 0, i8* getelementptr inbounds ([24 x i8], [24 x i8]* @.str.7, i64 0, i64 0))
+  unreachable
+L4:
+  store i32 %t7, i32* %t6
+  ret void
+}
+
@@ -0,0 +1,301 @@
+%sowo_slice = type { i64, i8* }
+%sowo_closure = type { i8*, i8* }
+%sowo_interface = type { i8*, i8* }
+%sowo_result_void_or_string = type { i1, i8* }
+%sowo_result_integer_or_string = type { i1, i32, i8* }
+
+@stderr = external global i8*
+@.str.0 = private unnamed_addr constant [11 x i8] c"error: %s\0A\00"
+@.str.1 = private unnamed_addr constant [4 x i8] c"123\00"
+@.str.2 = private unnamed_addr constant [25 x i8] c"../examples/results.sowo\00"
+@.str.3 = private unnamed_addr constant [25 x i8] c"value of a failed result\00"
+@.str.4 = private unnamed_addr constant [29 x i8] c"integer overflow in addition\00"
+@.str.5 = private unnamed_addr constant [2 x i8] c"\0A\00"
+@.str.6 = private unnamed_addr constant [9 x i8] c"%d %d %s\00"
+@.str.7 = private unnamed_addr constant [4 x i8] c"12x\00"
+@.str.8 = private unnamed_addr constant [29 x i8] c"error of a successful result\00"
+@.str.9 = private unnamed_addr constant [12 x i8] c"%d %s %d %s\00"
+@.str.10 = private unnamed_addr constant [2 x i8] c"7\00"
+@.str.11 = private unnamed_addr constant [21 x i8] c"call of nil function\00"
+@.str.12 = private unnamed_addr constant [14 x i8] c"7 is positive\00"
+@.str.13 = private unnamed_addr constant [6 x i8] c"%s %s\00"
+@.str.14 = private unnamed_addr constant [2 x i8] c"0\00"
+@.str.15 = private unnamed_addr constant [12 x i8] c"unreachable\00"
+@.str.16 = private unnamed_addr constant [12 x i8] c"not a digit\00"
+@.str.17 = private unnamed_addr constant [32 x i8] c"integer overflow in subtraction\00"
+@.str.18 = private unnamed_addr constant [13 x i8] c"empty string\00"
+@.str.19 = private unnamed_addr constant [35 x i8] c"integer overflow in multiplication\00"
+@.str.20 = private unnamed_addr constant [13 x i8] c"not positive\00"
+
+declare i8* @llvm.frameaddress.p0i8(i32)
+declare void @sowo_gc_init(i8*)
+declare i32 @fprintf(i8*, i8*, ...)
+declare void @sowo_panic(i8*, i32, i32, i8*, ...)
+declare { i32, i1 } @llvm.sadd.with.overflow.i32(i32, i32)
+declare i32 @printf(i8*, ...)
+declare { i32, i1 } @llvm.ssub.with.overflow.i32(i32, i32)
+declare i32 @sowo_str_len(i8*)
+declare { i32, i1 } @llvm.smul.with.overflow.i32(i32, i32)
+declare signext i8 @sowo_str_index(i8*, i64, i8*, i32, i32)
+
+define internal void @sowo_init_globals() {
+entry:
+  ret void
+}
+
+define i32 @main(i32 %argc, i8** %argv) {
+entry:
+  %t1 = call i8* @llvm.frameaddress.p0i8(i32 0)
+  call void @sowo_gc_init(i8* %t1)
+  call void @sowo_init_globals()
+  %t2 = call %sowo_result_void_or_string @results__main()
+  %t3 = extractvalue %sowo_result_void_or_string %t2, 0
+  br i1 %t3, label %L2, label %L1
+L1:
+  %t4 = extractvalue %sowo_result_void_or_string %t2, 1
+  %t5 = load i8*, i8** @stderr
+  call i32 (i8*, i8*, ...) @fprintf(i8* %t5, i8* getelementptr inbounds ([11 x i8], [11 x i8]* @.str.0, i64 0, i64 0), i8* %t4)
+  ret i32 1
+L2:
+  ret i32 0
+}
+
+define internal %sowo_result_void_or_string @results__main() {
+entry:
+  %parsed.2 = alloca %sowo_result_integer_or_string
+  %failed.14 = alloca %sowo_result_integer_or_string
+  %checked.26 = alloca %sowo_closure
+  %t1 = call %sowo_result_integer_or_string @results__parse_number(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @.str.1, i64 0, i64 0))
+  store %sowo_result_integer_or_string %t1, %sowo_result_integer_or_string* %parsed.2
+  %t3 = load %sowo_result_integer_or_string, %sowo_result_integer_or_string* %parsed.2
+  %t4 = extractvalue %sowo_result_integer_or_string %t3, 0
+  %t5 = zext i1 %t4 to i32
+  %t6 = load %sowo_result_integer_or_string, %sowo_result_integer_or_string* %parsed.2
+  %t7 = extractvalue %sowo_result_integer_or_string %t6, 0
+  %t8 = xor i1 %t7, true
+  br i1 %t8, label %L1, label %L2
+L1:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 36, i32 27, i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.3, i64 0, i64 0))
+  unreachable
+L2:
+  %t9 = extractvalue %sowo_result_integer_or_string %t6, 1
+  %t10 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 %t9, i32 1)
+  %t11 = extractvalue { i32, i1 } %t10, 1
+  br i1 %t11, label %L3, label %L4
+L3:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 36, i32 42, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.4, i64 0, i64 0))
+  unreachable
+L4:
+  %t12 = extractvalue { i32, i1 } %t10, 0
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @.str.6, i64 0, i64 0), i32 %t5, i32 %t12, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  %t13 = call %sowo_result_integer_or_string @results__parse_number(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @.str.7, i64 0, i64 0))
+  store %sowo_result_integer_or_string %t13, %sowo_result_integer_or_string* %failed.14
+  %t15 = load %sowo_result_integer_or_string, %sowo_result_integer_or_string* %failed.14
+  %t16 = extractvalue %sowo_result_integer_or_string %t15, 0
+  %t17 = xor i1 %t16, true
+  %t18 = zext i1 %t17 to i32
+  %t19 = load %sowo_result_integer_or_string, %sowo_result_integer_or_string* %failed.14
+  %t20 = extractvalue %sowo_result_integer_or_string %t19, 0
+  br i1 %t20, label %L5, label %L6
+L5:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 39, i32 28, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.8, i64 0, i64 0))
+  unreachable
+L6:
+  %t21 = extractvalue %sowo_result_integer_or_string %t19, 2
+  %t22 = load %sowo_result_integer_or_string, %sowo_result_integer_or_string* %failed.14
+  %t23 = extractvalue %sowo_result_integer_or_string %t22, 0
+  %t24 = extractvalue %sowo_result_integer_or_string %t22, 1
+  %t25 = select i1 %t23, i32 %t24, i32 0
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([12 x i8], [12 x i8]* @.str.9, i64 0, i64 0), i32 %t18, i8* %t21, i32 %t25, i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  store %sowo_closure { i8* bitcast (%sowo_result_void_or_string (i8*, i32)* @sowo_fn__results__check_positive to i8*), i8* null }, %sowo_closure* %checked.26
+  %t27 = load %sowo_closure, %sowo_closure* %checked.26
+  %t28 = extractvalue %sowo_closure %t27, 1
+  %t29 = call %sowo_result_integer_or_string @results__parse_number(i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.10, i64 0, i64 0))
+  %t30 = extractvalue %sowo_result_integer_or_string %t29, 0
+  br i1 %t30, label %L8, label %L7
+L7:
+  %t31 = extractvalue %sowo_result_integer_or_string %t29, 2
+  %t32 = insertvalue %sowo_result_void_or_string zeroinitializer, i8* %t31, 1
+  ret %sowo_result_void_or_string %t32
+L8:
+  %t33 = extractvalue %sowo_result_integer_or_string %t29, 1
+  %t34 = extractvalue %sowo_closure %t27, 0
+  %t35 = icmp eq i8* %t34, null
+  br i1 %t35, label %L9, label %L10
+L9:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 42, i32 5, i8* getelementptr inbounds ([21 x i8], [21 x i8]* @.str.11, i64 0, i64 0))
+  unreachable
+L10:
+  %t36 = bitcast i8* %t34 to %sowo_result_void_or_string (i8*, i32)*
+  %t37 = call %sowo_result_void_or_string %t36(i8* %t28, i32 %t33)
+  %t38 = extractvalue %sowo_result_void_or_string %t37, 0
+  br i1 %t38, label %L12, label %L11
+L11:
+  %t39 = extractvalue %sowo_result_void_or_string %t37, 1
+  %t40 = insertvalue %sowo_result_void_or_string zeroinitializer, i8* %t39, 1
+  ret %sowo_result_void_or_string %t40
+L12:
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.13, i64 0, i64 0), i8* getelementptr inbounds ([14 x i8], [14 x i8]* @.str.12, i64 0, i64 0), i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  %t41 = call %sowo_result_integer_or_string @results__parse_number(i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.14, i64 0, i64 0))
+  %t42 = extractvalue %sowo_result_integer_or_string %t41, 0
+  br i1 %t42, label %L14, label %L13
+L13:
+  %t43 = extractvalue %sowo_result_integer_or_string %t41, 2
+  %t44 = insertvalue %sowo_result_void_or_string zeroinitializer, i8* %t43, 1
+  ret %sowo_result_void_or_string %t44
+L14:
+  %t45 = extractvalue %sowo_result_integer_or_string %t41, 1
+  %t46 = call %sowo_result_void_or_string @results__check_positive(i32 %t45)
+  %t47 = extractvalue %sowo_result_void_or_string %t46, 0
+  br i1 %t47, label %L16, label %L15
+L15:
+  %t48 = extractvalue %sowo_result_void_or_string %t46, 1
+  %t49 = insertvalue %sowo_result_void_or_string zeroinitializer, i8* %t48, 1
+  ret %sowo_result_void_or_string %t49
+L16:
+  call i32 (i8*, ...) @printf(i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.13, i64 0, i64 0), i8* getelementptr inbounds ([12 x i8], [12 x i8]* @.str.15, i64 0, i64 0), i8* getelementptr inbounds ([2 x i8], [2 x i8]* @.str.5, i64 0, i64 0))
+  %t50 = insertvalue %sowo_result_void_or_string zeroinitializer, i1 true, 0
+  ret %sowo_result_void_or_string %t50
+}
+
+define internal %sowo_result_integer_or_string @results__parse_digit(i8 %arg0) {
+entry:
+  %c.1 = alloca i8
+  store i8 %arg0, i8* %c.1
+  %t2 = load i8, i8* %c.1
+  %t3 = icmp slt i8 %t2, 48
+  br i1 %t3, label %L1, label %L2
+L1:
+  %t4 = insertvalue %sowo_result_integer_or_string zeroinitializer, i1 false, 0
+  %t5 = insertvalue %sowo_result_integer_or_string %t4, i8* getelementptr inbounds ([12 x i8], [12 x i8]* @.str.16, i64 0, i64 0), 2
+  ret %sowo_result_integer_or_string %t5
+L2:
+  br label %L3
+L3:
+  %t6 = load i8, i8* %c.1
+  %t7 = icmp sgt i8 %t6, 57
+  br i1 %t7, label %L4, label %L5
+L4:
+  %t8 = insertvalue %sowo_result_integer_or_string zeroinitializer, i1 false, 0
+  %t9 = insertvalue %sowo_result_integer_or_string %t8, i8* getelementptr inbounds ([12 x i8], [12 x i8]* @.str.16, i64 0, i64 0), 2
+  ret %sowo_result_integer_or_string %t9
+L5:
+  br label %L6
+L6:
+  %t10 = insertvalue %sowo_result_integer_or_string zeroinitializer, i1 true, 0
+  %t11 = load i8, i8* %c.1
+  %t12 = sext i8 %t11 to i32
+  %t13 = call { i32, i1 } @llvm.ssub.with.overflow.i32(i32 %t12, i32 48)
+  %t14 = extractvalue { i32, i1 } %t13, 1
+  br i1 %t14, label %L7, label %L8
+L7:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 10, i32 22, i8* getelementptr inbounds ([32 x i8], [32 x i8]* @.str.17, i64 0, i64 0))
+  unreachable
+L8:
+  %t15 = extractvalue { i32, i1 } %t13, 0
+  %t16 = insertvalue %sowo_result_integer_or_string %t10, i32 %t15, 1
+  ret %sowo_result_integer_or_string %t16
+}
+
+define internal %sowo_result_integer_or_string @results__parse_number(i8* %arg0) {
+entry:
+  %s.1 = alloca i8*
+  %n.7 = alloca i32
+  %i.8 = alloca i32
+  store i8* %arg0, i8** %s.1
+  %t2 = load i8*, i8** %s.1
+  %t3 = call i32 @sowo_str_len(i8* %t2)
+  %t4 = icmp eq i32 %t3, 0
+  br i1 %t4, label %L1, label %L2
+L1:
+  %t5 = insertvalue %sowo_result_integer_or_string zeroinitializer, i1 false, 0
+  %t6 = insertvalue %sowo_result_integer_or_string %t5, i8* getelementptr inbounds ([13 x i8], [13 x i8]* @.str.18, i64 0, i64 0), 2
+  ret %sowo_result_integer_or_string %t6
+L2:
+  br label %L3
+L3:
+  store i32 0, i32* %n.7
+  store i32 0, i32* %i.8
+  br label %L4
+L4:
+  %t9 = load i32, i32* %i.8
+  %t10 = load i8*, i8** %s.1
+  %t11 = call i32 @sowo_str_len(i8* %t10)
+  %t12 = icmp slt i32 %t9, %t11
+  br i1 %t12, label %L5, label %L6
+L5:
+  %t13 = load i32, i32* %n.7
+  %t14 = call { i32, i1 } @llvm.smul.with.overflow.i32(i32 %t13, i32 10)
+  %t15 = extractvalue { i32, i1 } %t14, 1
+  br i1 %t15, label %L7, label %L8
+L7:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 20, i32 15, i8* getelementptr inbounds ([35 x i8], [35 x i8]* @.str.19, i64 0, i64 0))
+  unreachable
+L8:
+  %t16 = extractvalue { i32, i1 } %t14, 0
+  store i32 %t16, i32* %n.7
+  %t17 = load i32, i32* %n.7
+  %t18 = load i8*, i8** %s.1
+  %t19 = load i32, i32* %i.8
+  %t20 = sext i32 %t19 to i64
+  %t21 = call signext i8 @sowo_str_index(i8* %t18, i64 %t20, i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 21, i32 30)
+  %t22 = call %sowo_result_integer_or_string @results__parse_digit(i8 %t21)
+  %t23 = extractvalue %sowo_result_integer_or_string %t22, 0
+  br i1 %t23, label %L10, label %L9
+L9:
+  %t24 = extractvalue %sowo_result_integer_or_string %t22, 2
+  %t25 = insertvalue %sowo_result_integer_or_string zeroinitializer, i8* %t24, 2
+  ret %sowo_result_integer_or_string %t25
+L10:
+  %t26 = extractvalue %sowo_result_integer_or_string %t22, 1
+  %t27 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 %t17, i32 %t26)
+  %t28 = extractvalue { i32, i1 } %t27, 1
+  br i1 %t28, label %L11, label %L12
+L11:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 21, i32 15, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.4, i64 0, i64 0))
+  unreachable
+L12:
+  %t29 = extractvalue { i32, i1 } %t27, 0
+  store i32 %t29, i32* %n.7
+  %t30 = load i32, i32* %i.8
+  %t31 = call { i32, i1 } @llvm.sadd.with.overflow.i32(i32 %t30, i32 1)
+  %t32 = extractvalue { i32, i1 } %t31, 1
+  br i1 %t32, label %L13, label %L14
+L13:
+  call void (i8*, i32, i32, i8*, ...) @sowo_panic(i8* getelementptr inbounds ([25 x i8], [25 x i8]* @.str.2, i64 0, i64 0), i32 22, i32 15, i8* getelementptr inbounds ([29 x i8], [29 x i8]* @.str.4, i64 0, i64 0))
+  unreachable
+L14:
+  %t33 = extractvalue { i32, i1 } %t31, 0
+  store i32 %t33, i32* %i.8
+  br label %L4
+L6:
+  %t34 = insertvalue %sowo_result_integer_or_string zeroinitializer, i1 true, 0
+  %t35 = load i32, i32* %n.7
+  %t36 = insertvalue %sowo_result_integer_or_string %t34, i32 %t35, 1
+  ret %sowo_result_integer_or_string %t36
+}
+
+define internal %sowo_result_void_or_string @results__check_positive(i32 %arg0) {
+entry:
+  %n.1 = alloca i32
+  store i32 %arg0, i32* %n.1
+  %t2 = load i32, i32* %n.1
+  %t3 = icmp slt i32 %t2, 1
+  br i1 %t3, label %L1, label %L2
+L1:
+  %t4 = insertvalue %sowo_result_void_or_string zeroinitializer, i1 false, 0
+  %t5 = insertvalue %sowo_result_void_or_string %t4, i8* getelementptr inbounds ([13 x i8], [13 x i8]* @.str.20, i64 0, i64 0), 1
+  ret %sowo_result_void_or_string %t5
+L2:
+  br label %L3
+L3:
+  %t6 = insertvalue %sowo_result_void_or_string zeroinitializer, i1 true, 0
+  ret %sowo_result_void_or_string %t6
+}
+
+define internal %sowo_result_void_or_string @sowo_fn__results__check_positive(i8* %env, i32 %arg0) {
+entry:
+  %t1 = call %sowo_result_void_or_string @results__check_positive(i32 %arg0)
+  ret %sowo_result_void_or_string %t1
+}
+
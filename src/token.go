@@ -10,6 +10,10 @@ type Token struct {
 	Type TokenType
 	// Value of the token.
 	Value string
+	// Position of the first character of the token in the source,
+	// both start from 1.
+	Line int
+	Col  int
 }
 
 func (t Token) String() string {
@@ -26,6 +30,8 @@ const (
 	TokenCloseParen
 	TokenOpenCurly
 	TokenCloseCurly
+	TokenOpenBracket
+	TokenCloseBracket
 	TokenVar
 	TokenColon
 	TokenComma
@@ -40,16 +46,30 @@ const (
 	TokenMinus
 	TokenAsterisk
 	TokenSlash
+	TokenAmpersand
 	TokenIf
 	TokenElse
 	TokenWhile
 	TokenNumberLiteral
+	TokenFloatLiteral
 	TokenStringLiteral
+	TokenCharLiteral
 	TokenHash
 	TokenReturn
 	TokenTrue
 	TokenFalse
 	TokenPrint
+	TokenNew
+	TokenConst
+	TokenImport
+	TokenDot
+	TokenPub
+	TokenExtern
+	TokenInterface
+	TokenOk
+	TokenErr
+	TokenQuestion
+	TokenComment
 )
 
 func (tt TokenType) String() (ret string) {
@@ -66,6 +86,10 @@ func (tt TokenType) String() (ret string) {
 		ret = "OpenCurly"
 	case TokenCloseCurly:
 		ret = "CloseCurly"
+	case TokenOpenBracket:
+		ret = "OpenBracket"
+	case TokenCloseBracket:
+		ret = "CloseBracket"
 	case TokenVar:
 		ret = "Var"
 	case TokenColon:
@@ -94,10 +118,16 @@ func (tt TokenType) String() (ret string) {
 		ret = "TokenAsterisk"
 	case TokenSlash:
 		ret = "TokenSlash"
+	case TokenAmpersand:
+		ret = "Ampersand"
 	case TokenNumberLiteral:
 		ret = "NumberLiteral"
+	case TokenFloatLiteral:
+		ret = "FloatLiteral"
 	case TokenStringLiteral:
 		ret = "StringLiteral"
+	case TokenCharLiteral:
+		ret = "CharLiteral"
 	case TokenHash:
 		ret = "Hash"
 	case TokenIf:
@@ -114,6 +144,28 @@ func (tt TokenType) String() (ret string) {
 		ret = "False"
 	case TokenPrint:
 		ret = "Print"
+	case TokenNew:
+		ret = "New"
+	case TokenConst:
+		ret = "Const"
+	case TokenImport:
+		ret = "Import"
+	case TokenDot:
+		ret = "Dot"
+	case TokenPub:
+		ret = "Pub"
+	case TokenExtern:
+		ret = "Extern"
+	case TokenInterface:
+		ret = "Interface"
+	case TokenOk:
+		ret = "Ok"
+	case TokenErr:
+		ret = "Err"
+	case TokenQuestion:
+		ret = "Question"
+	case TokenComment:
+		ret = "Comment"
 	default:
 		ret = fmt.Sprintf("Unprintable token %d", tt)
 	}
@@ -3,6 +3,8 @@ package src
 import (
 	"fmt"
 	"log"
+	"math"
+	"strings"
 )
 
 type Scope struct {
@@ -13,11 +15,146 @@ var scopes []Scope
 
 var currentModule *Ast = nil
 
+// Modules of the program being checked by name.
+var programModules = map[string]*Ast{}
+
+// Globals defined by the modules checked so far.
+var moduleGlobals = map[string][]VarDef{}
+
 var currentFuncDef *Ast = nil
 
+// A function literal being checked, the locals of the enclosing
+// functions it uses are captured when the literal is evaluated.
+type closureScope struct {
+	literal *Ast
+	// Index of the first scope belonging to the literal.
+	firstScope int
+}
+
+var closureScopes []closureScope
+
 type VarDef struct {
 	Name string
 	Type TypeAnnotation
+	// True for module level constants, that can't be assigned.
+	Constant bool
+	// Module defining the variable, empty for local variables.
+	Module string
+	// True for globals visible from other modules.
+	Public bool
+}
+
+// Represents a function implemented by the runtime library.
+type BuiltinFunc struct {
+	Params     []TypeAnnotation
+	ReturnType TypeAnnotation
+	// Name of the C function implementing the builtin.
+	CName string
+	// Module the builtin belongs to, empty for the builtins
+	// that are visible everywhere.
+	Module string
+	// True for the builtins that can fail, the C function
+	// takes the position of the call as last arguments.
+	Located bool
+}
+
+// Builtins by name, the builtins of a module are registered with
+// the module name as prefix (e.g. `std.exit`). A builtin can have
+// overloads for different argument types.
+var builtinFuncs = map[string][]BuiltinFunc{
+	"len": {
+		{Params: []TypeAnnotation{TypeString}, ReturnType: TypeInteger, CName: "sowo_str_len"},
+		{Params: []TypeAnnotation{sliceOf(TypeString)}, ReturnType: TypeInteger, CName: "sowo_slice_len"},
+	},
+
+	"std.exit":        {{Params: []TypeAnnotation{TypeInteger}, ReturnType: TypeVoid, CName: "exit", Module: "std"}},
+	"std.assert":      {{Params: []TypeAnnotation{TypeBoolean, TypeString}, ReturnType: TypeVoid, CName: "sowo_assert", Module: "std", Located: true}},
+	"std.read_line":   {{ReturnType: TypeString, CName: "sowo_read_line", Module: "std"}},
+	"std.read_int":    {{ReturnType: TypeInteger, CName: "sowo_read_int", Module: "std", Located: true}},
+	"std.contains":    {{Params: []TypeAnnotation{TypeString, TypeString}, ReturnType: TypeBoolean, CName: "sowo_str_contains", Module: "std"}},
+	"std.index_of":    {{Params: []TypeAnnotation{TypeString, TypeString}, ReturnType: TypeInteger, CName: "sowo_str_index_of", Module: "std"}},
+	"std.starts_with": {{Params: []TypeAnnotation{TypeString, TypeString}, ReturnType: TypeBoolean, CName: "sowo_str_starts_with", Module: "std"}},
+	"std.ends_with":   {{Params: []TypeAnnotation{TypeString, TypeString}, ReturnType: TypeBoolean, CName: "sowo_str_ends_with", Module: "std"}},
+	"std.to_upper":    {{Params: []TypeAnnotation{TypeString}, ReturnType: TypeString, CName: "sowo_str_to_upper", Module: "std"}},
+	"std.to_lower":    {{Params: []TypeAnnotation{TypeString}, ReturnType: TypeString, CName: "sowo_str_to_lower", Module: "std"}},
+	"std.trim":        {{Params: []TypeAnnotation{TypeString}, ReturnType: TypeString, CName: "sowo_str_trim", Module: "std"}},
+}
+
+// Returns the key of a builtin of the module in builtinFuncs.
+func builtinKey(module string, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
+
+// Returns the overloads of the builtin called with given name. Unqualified
+// names refer to the global builtins and to the builtins of the current
+// module, qualified names refer to the builtins of an imported module.
+func builtinWithName(name string) ([]BuiltinFunc, bool) {
+	alias, member := splitQualifiedName(name)
+	if alias != "" {
+		module, err := importedModule(alias)
+		if err != nil {
+			return nil, false
+		}
+		overloads, ok := builtinFuncs[builtinKey(module.Name, member)]
+		return overloads, ok
+	}
+	if overloads, ok := builtinFuncs[name]; ok && overloads[0].Module == "" {
+		return overloads, true
+	}
+	if currentModule != nil {
+		overloads, ok := builtinFuncs[builtinKey(currentModule.Name, name)]
+		return overloads, ok
+	}
+	return nil, false
+}
+
+// Returns the overload accepting arguments of given types. A builtin
+// without overloads is always selected, so that wrong arguments are
+// reported like the ones of the other functions.
+func selectOverload(name string, overloads []BuiltinFunc, argTypes []TypeAnnotation) (BuiltinFunc, error) {
+	if len(overloads) == 1 {
+		return overloads[0], nil
+	}
+	for _, overload := range overloads {
+		if len(overload.Params) != len(argTypes) {
+			continue
+		}
+		matches := true
+		for i, param := range overload.Params {
+			matches = matches && param == argTypes[i]
+		}
+		if matches {
+			return overload, nil
+		}
+	}
+	var types []string
+	for _, t := range argTypes {
+		types = append(types, t.String())
+	}
+	return BuiltinFunc{}, fmt.Errorf("no overload of %s accepts arguments (%s)", name, strings.Join(types, ", "))
+}
+
+// Returns the builtin called by the function call, if any.
+func builtinOfCall(ast Ast) (BuiltinFunc, bool, error) {
+	overloads, ok := builtinWithName(ast.Name)
+	if !ok {
+		return BuiltinFunc{}, false, nil
+	}
+	var argTypes []TypeAnnotation
+	if len(overloads) > 1 {
+		for _, arg := range ast.Children {
+			argType, err := typeOfExpression(*arg)
+			if err != nil {
+				return BuiltinFunc{}, true, err
+			}
+			argTypes = append(argTypes, argType)
+		}
+	}
+	builtin, err := selectOverload(ast.Name, overloads, argTypes)
+	return builtin, true, err
 }
 
 func (s Scope) String() string {
@@ -51,101 +188,801 @@ func pushVarDef(ast Ast) {
 	scopes[len(scopes)-1].vars = append(scopes[len(scopes)-1].vars, varDef)
 }
 
-func typeOfVarWithName(name string) (TypeAnnotation, error) {
-	for _, scope := range scopes {
-		for _, vars := range scope.vars {
+// Splits a name qualified by a module alias (e.g. `math.sqrt`),
+// the alias is empty for unqualified names.
+func splitQualifiedName(name string) (alias string, member string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// Returns the module imported by the current module with given alias.
+func importedModule(alias string) (*Ast, error) {
+	for _, def := range currentModule.Children {
+		if def.Type == AstImport && def.Name == alias {
+			return programModules[def.Module], nil
+		}
+	}
+	return nil, fmt.Errorf("no imported module with name %s", alias)
+}
+
+// Returns the definition of the variable with given name looking
+// from the innermost scope to the outermost one. Qualified names
+// refer to the globals of an imported module.
+func varDefWithName(name string) (VarDef, error) {
+	alias, member := splitQualifiedName(name)
+	if alias != "" {
+		module, err := importedModule(alias)
+		if err != nil {
+			return VarDef{}, err
+		}
+		for _, global := range moduleGlobals[module.Name] {
+			if global.Name == member {
+				if !global.Public {
+					return VarDef{}, fmt.Errorf("variable %s is not public in module %s", member, alias)
+				}
+				return global, nil
+			}
+		}
+		return VarDef{}, fmt.Errorf("no variable with name %s in module %s", member, alias)
+	}
+
+	for i := len(scopes) - 1; i >= 0; i-- {
+		for _, vars := range scopes[i].vars {
 			if vars.Name == name {
-				return vars.Type, nil
+				captureVariable(vars, i)
+				return vars, nil
 			}
 		}
 	}
-	return TypeVoid, fmt.Errorf("no variable with name %s", name)
+	return VarDef{}, fmt.Errorf("no variable with name %s", name)
+}
+
+// Records the local variable found in given scope as captured by
+// the function literals defined after it, globals are never captured.
+func captureVariable(varDef VarDef, scope int) {
+	if scope == 0 {
+		return
+	}
+	for _, closure := range closureScopes {
+		if scope >= closure.firstScope {
+			continue
+		}
+		captures := closure.literal.Children[3]
+		captured := false
+		for _, capture := range captures.Children {
+			captured = captured || capture.Name == varDef.Name
+		}
+		if !captured {
+			captures.Children = append(captures.Children, &Ast{
+				Type:     AstVariable,
+				Name:     varDef.Name,
+				Children: []*Ast{{Type: AstTypeAnnotation, DataType: varDef.Type}},
+			})
+		}
+	}
 }
 
-func typeOfFuncWithName(name string) (TypeAnnotation, error) {
+func typeOfVarWithName(name string) (TypeAnnotation, error) {
+	varDef, err := varDefWithName(name)
+	return varDef.Type, err
+}
+
+func funcDefWithName(name string) (*Ast, error) {
 	if currentModule == nil {
 		log.Fatal("[Type Check]: No module found")
 	}
-	for _, funcDef := range currentModule.Children {
-		if funcDef.Name == name {
-			return funcDef.Children[1].Children[0].DataType, nil
+	module := currentModule
+	alias, member := splitQualifiedName(name)
+	if alias != "" {
+		var err error
+		if module, err = importedModule(alias); err != nil {
+			return nil, err
+		}
+	}
+	for _, funcDef := range module.Children {
+		isFunction := funcDef.Type == AstFunction || funcDef.Type == AstExternFunction
+		if isFunction && funcDef.Name == member {
+			if alias != "" && !funcDef.Public {
+				return nil, fmt.Errorf("function %s is not public in module %s", member, alias)
+			}
+			return funcDef, nil
 		}
 	}
-	return TypeVoid, fmt.Errorf("no function with name %s", name)
+	if alias != "" {
+		return nil, fmt.Errorf("no function with name %s in module %s", member, alias)
+	}
+	return nil, fmt.Errorf("no function with name %s", name)
+}
+
+// Returns the receiver and the method of a call of a qualified name
+// that refers to a variable instead of a module (e.g. `shape.area()`).
+func methodCallOfName(name string) (receiver string, method string, ok bool) {
+	alias, member := splitQualifiedName(name)
+	if alias == "" {
+		return "", "", false
+	}
+	if _, err := importedModule(alias); err == nil {
+		return "", "", false
+	}
+	if _, err := varDefWithName(alias); err != nil {
+		return "", "", false
+	}
+	return alias, member, true
+}
+
+// Returns the type of a function used as a value.
+func typeOfFuncValue(name string) (TypeAnnotation, error) {
+	funcDef, err := funcDefWithName(name)
+	if err != nil {
+		return TypeVoid, err
+	}
+	if funcTypeParams(funcDef) != nil {
+		return TypeVoid, fmt.Errorf("generic function %s can't be used as a value", name)
+	}
+	var params []TypeAnnotation
+	for _, param := range funcDef.Children[0].Children {
+		params = append(params, param.Children[0].DataType)
+	}
+	return funcType(params, funcDef.Children[1].Children[0].DataType), nil
+}
+
+// Returns the type of a function literal.
+func typeOfFuncLiteral(ast Ast) TypeAnnotation {
+	var params []TypeAnnotation
+	for _, param := range ast.Children[0].Children {
+		params = append(params, param.Children[0].DataType)
+	}
+	return funcType(params, ast.Children[1].Children[0].DataType)
+}
+
+// Returns the parameter types and the return type of the function or
+// builtin called by the function call. Variables holding a function
+// hide the functions with the same name.
+func funcSignatureOfCall(ast Ast) (params []TypeAnnotation, returnType TypeAnnotation, err error) {
+	if receiver, method, ok := methodCallOfName(ast.Name); ok {
+		receiverType, err := typeOfVarWithName(receiver)
+		if err != nil {
+			return nil, TypeVoid, err
+		}
+		return methodSignature(receiverType, method)
+	}
+	if varDef, err := varDefWithName(ast.Name); err == nil {
+		if !isFuncType(varDef.Type) {
+			return nil, TypeVoid, fmt.Errorf("cannot call %s of type '%s'", ast.Name, varDef.Type)
+		}
+		params, returnType := funcTypeSignature(varDef.Type)
+		return params, returnType, nil
+	}
+	if builtin, ok, err := builtinOfCall(ast); ok {
+		return builtin.Params, builtin.ReturnType, err
+	}
+	funcDef, err := funcDefWithName(ast.Name)
+	if err != nil {
+		return nil, TypeVoid, err
+	}
+	bindings, err := typeArgsOfCall(funcDef, ast)
+	if err != nil {
+		return nil, TypeVoid, err
+	}
+	for _, param := range funcDef.Children[0].Children {
+		params = append(params, substituteType(param.Children[0].DataType, bindings))
+	}
+	return params, substituteType(funcDef.Children[1].Children[0].DataType, bindings), nil
+}
+
+// Infers the types the type parameters of a generic function are
+// bound to from the arguments of the call. The typed arguments are
+// unified first, then the untyped constants take the type bound by
+// them if they fit it (e.g. `max(x, 2)` with x of type i8) or else
+// their default type.
+func typeArgsOfCall(funcDef *Ast, ast Ast) (map[TypeAnnotation]TypeAnnotation, error) {
+	typeParams := funcTypeParams(funcDef)
+	if typeParams == nil {
+		return nil, nil
+	}
+	bindings := map[TypeAnnotation]TypeAnnotation{}
+	params := funcDef.Children[0].Children
+	if len(ast.Children) < len(params) {
+		params = params[:len(ast.Children)]
+	}
+	var constants []int
+	for i, param := range params {
+		if isUntypedConstant(*ast.Children[i]) {
+			constants = append(constants, i)
+			continue
+		}
+		argType, err := typeOfExpression(*ast.Children[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := unifyTypes(param.Children[0].DataType, argType, bindings); err != nil {
+			return nil, fmt.Errorf("call of %s: %s", ast.Name, err)
+		}
+	}
+	for _, i := range constants {
+		paramType := params[i].Children[0].DataType
+		if bound, ok := bindings[paramType]; ok && constantFitsType(*ast.Children[i], bound) {
+			continue
+		}
+		argType, err := typeOfExpression(*ast.Children[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := unifyTypes(paramType, argType, bindings); err != nil {
+			return nil, fmt.Errorf("call of %s: %s", ast.Name, err)
+		}
+	}
+	for _, typeParam := range typeParams {
+		if _, ok := bindings[typeParam]; !ok {
+			return nil, fmt.Errorf("cannot infer type parameter %s of %s", typeParam, ast.Name)
+		}
+	}
+	return bindings, nil
+}
+
+func typeOfFuncCall(ast Ast) (TypeAnnotation, error) {
+	_, returnType, err := funcSignatureOfCall(ast)
+	return returnType, err
+}
+
+func isIntegerType(t TypeAnnotation) bool {
+	switch t {
+	case TypeInteger, TypeI8, TypeI16, TypeI32, TypeI64,
+		TypeU8, TypeU16, TypeU32, TypeU64:
+		return true
+	}
+	return false
+}
+
+func isFloatType(t TypeAnnotation) bool {
+	return t == TypeF32 || t == TypeF64
+}
+
+// Returns true for the integer and float types and for the
+// type parameters that can only be bound to them.
+func isNumericType(t TypeAnnotation) bool {
+	if isTypeParam(t) {
+		return typeParamConstraint(t) == ConstraintNumeric
+	}
+	return isIntegerType(t) || isFloatType(t)
+}
+
+// Returns true if a value of type from can be explicitly converted to type to.
+// Numbers convert between each other, chars convert to and from integers and
+// strings convert to and from integers (chars also convert to strings).
+func isConvertible(from TypeAnnotation, to TypeAnnotation) bool {
+	if from == to {
+		return true
+	}
+	if from == TypeString {
+		return isIntegerType(to)
+	}
+	if to == TypeString {
+		return isIntegerType(from) || from == TypeChar
+	}
+	if from == TypeChar {
+		return isIntegerType(to)
+	}
+	if to == TypeChar {
+		return isIntegerType(from)
+	}
+	return isNumericType(from) && isNumericType(to)
+}
+
+func isArithmeticOperator(op BinaryOperator) bool {
+	return op == OpPlus || op == OpMinus || op == OpTimes || op == OpDivide
+}
+
+func isComparisonOperator(op BinaryOperator) bool {
+	return op == OpEquals || op == OpLessThen || op == OpGreaterThen ||
+		op == OpLessThenEqual || op == OpGreaterThenEqual
+}
+
+// Returns true if the value of a number literal can be stored in a
+// variable of given type. Literals are never negative, the ones above
+// the maximum int are kept as the bits of their u64 value.
+func integerFitsType(value uint64, t TypeAnnotation) bool {
+	switch t {
+	case TypeI8:
+		return value <= math.MaxInt8
+	case TypeI16:
+		return value <= math.MaxInt16
+	case TypeInteger, TypeI32:
+		return value <= math.MaxInt32
+	case TypeU8:
+		return value <= math.MaxUint8
+	case TypeU16:
+		return value <= math.MaxUint16
+	case TypeU32:
+		return value <= math.MaxUint32
+	case TypeU64:
+		return true
+	}
+	return value <= math.MaxInt64
+}
+
+// Returns true if the expression is made only of number literals;
+// these expressions take their type from the context they are used in.
+func isUntypedConstant(ast Ast) bool {
+	switch ast.Type {
+	case AstNumberLiteral, AstFloatLiteral:
+		return true
+	case AstBinaryOp:
+		return isArithmeticOperator(ast.Operator) &&
+			isUntypedConstant(*ast.Children[0]) &&
+			isUntypedConstant(*ast.Children[1])
+	}
+	return false
+}
+
+// Returns true if the untyped constant expression can take given type.
+// Integer literals fit every integer type and float literals fit
+// every float type, there is no implicit conversion between the two.
+func constantFitsType(ast Ast, t TypeAnnotation) bool {
+	defaultType, err := typeOfExpression(ast)
+	if err != nil {
+		return false
+	}
+	if isFloatType(defaultType) {
+		return isFloatType(t)
+	}
+	return isIntegerType(t)
 }
 
 func typeOfExpression(ast Ast) (ret TypeAnnotation, err error) {
 	switch ast.Type {
 	case AstNumberLiteral:
 		ret = TypeInteger
+	case AstFloatLiteral:
+		ret = TypeF64
 	case AstBooleanLiteral:
 		ret = TypeBoolean
 	case AstStringLiteral:
 		ret = TypeString
+	case AstCharLiteral:
+		ret = TypeChar
 	case AstFuncCall:
-		ret, err = typeOfFuncWithName(ast.Name)
+		ret, err = typeOfFuncCall(ast)
 	case AstVariableRef:
 		ret, err = typeOfVarWithName(ast.Name)
-	case AstBinaryOp:
-		lhsType, lErr := typeOfExpression(*ast.Children[0])
-		if lErr != nil {
-			return TypeVoid, lErr
+		if err != nil {
+			if valueType, funcErr := typeOfFuncValue(ast.Name); funcErr == nil {
+				ret, err = valueType, nil
+			}
+		}
+	case AstFuncRef:
+		ret, err = typeOfFuncValue(ast.Name)
+	case AstFuncLiteral:
+		ret = typeOfFuncLiteral(ast)
+	case AstClosureCall:
+		ret, err = typeOfExpression(*ast.Children[0])
+		if err == nil && !isFuncType(ret) {
+			err = fmt.Errorf("cannot call expression of type '%s'", ret)
 		}
-		rhsType, rErr := typeOfExpression(*ast.Children[1])
-		if rErr != nil {
-			return TypeVoid, rErr
+		_, ret = funcTypeSignature(ret)
+	case AstMethodCall:
+		ret, err = typeOfExpression(*ast.Children[0])
+		if err == nil {
+			_, ret, err = methodSignature(ret, ast.Name)
 		}
-		if lhsType != rhsType {
-			err = fmt.Errorf("left operand has type '%s' right operand has type '%s'",
-				lhsType, rhsType)
+	case AstInterfaceValue:
+		ret = ast.DataType
+	case AstResultOk, AstResultErr:
+		ret = ast.DataType
+		if ret == TypeVoid {
+			err = fmt.Errorf("cannot infer the type of the result, use it where a result type is expected")
+		}
+	case AstTry:
+		ret, err = typeOfTry(ast)
+	case AstConversion:
+		ret = ast.DataType
+	case AstIndex:
+		ret, err = typeOfIndexed(*ast.Children[0])
+	case AstSlice:
+		ret = TypeString
+	case AstNew:
+		ret = pointerTo(ast.Children[0].DataType)
+	case AstAddressOf:
+		ret, err = typeOfExpression(*ast.Children[0])
+		ret = pointerTo(ret)
+	case AstDereference:
+		ret, err = typeOfExpression(*ast.Children[0])
+		if err == nil && !isPointerType(ret) {
+			err = fmt.Errorf("cannot dereference value of type '%s'", ret)
+		}
+		ret = pointerElem(ret)
+	case AstBinaryOp:
+		ret, err = typeOfBinaryOperands(ast)
+		if err == nil && isComparisonOperator(ast.Operator) {
+			ret = TypeBoolean
 		}
-		ret = lhsType
 	default:
 		log.Fatalf("[Type Check]: Unsupported expression '%s'", ast.Type)
 	}
 	return ret, err
 }
 
+// Returns the type shared by both operands of a binary operation.
+// An untyped constant operand takes the type of the other operand.
+func typeOfBinaryOperands(ast Ast) (TypeAnnotation, error) {
+	lhs, rhs := *ast.Children[0], *ast.Children[1]
+	if isUntypedConstant(lhs) != isUntypedConstant(rhs) {
+		constant, typed := lhs, rhs
+		if isUntypedConstant(rhs) {
+			constant, typed = rhs, lhs
+		}
+		typedType, err := typeOfExpression(typed)
+		if err != nil {
+			return TypeVoid, err
+		}
+		constantType, _ := typeOfExpression(constant)
+		if !constantFitsType(constant, typedType) {
+			return TypeVoid, fmt.Errorf("mismatched types '%s' and '%s'", constantType, typedType)
+		}
+		return typedType, nil
+	}
+
+	lhsType, lErr := typeOfExpression(lhs)
+	if lErr != nil {
+		return TypeVoid, lErr
+	}
+	rhsType, rErr := typeOfExpression(rhs)
+	if rErr != nil {
+		return TypeVoid, rErr
+	}
+	if lhsType != rhsType {
+		return TypeVoid, fmt.Errorf("left operand has type '%s' right operand has type '%s'",
+			lhsType, rhsType)
+	}
+	return lhsType, nil
+}
+
 func checkTypeOfFuncCall(ast *Ast, expectedType TypeAnnotation) {
-	funcType, err := typeOfFuncWithName(ast.Name)
+	funcType, err := typeOfFuncCall(*ast)
 	if err != nil {
 		log.Fatal(err)
 	}
 	if expectedType != funcType {
 		log.Fatalf("[Type Check]: Expected type '%s' but function has type '%s'", expectedType, funcType)
 	}
+	if receiver, method, ok := methodCallOfName(ast.Name); ok {
+		ast.Type = AstMethodCall
+		ast.Name = method
+		ast.Children = append([]*Ast{{Type: AstVariableRef, Name: receiver}}, ast.Children...)
+		checkTypeOfMethodCall(ast, expectedType)
+		return
+	}
+	checkTypeOfFuncCallArgs(ast)
 	ast.DataType = funcType
+	if varDef, err := varDefWithName(ast.Name); err == nil {
+		// Calls through a variable become calls of the function value
+		callee := &Ast{Type: AstVariableRef, Name: ast.Name}
+		checkTypeOfExpression(callee, varDef.Type)
+		ast.Type = AstClosureCall
+		ast.Name = ""
+		ast.Children = append([]*Ast{callee}, ast.Children...)
+		return
+	}
+	if builtin, ok, _ := builtinOfCall(*ast); ok {
+		ast.Module = builtin.Module
+	} else if funcDef, err := funcDefWithName(ast.Name); err == nil {
+		ast.Module = funcDef.Module
+		if funcDef.Type == AstExternFunction {
+			// C functions are called with their own name
+			ast.Module = ""
+		}
+		bindings, _ := typeArgsOfCall(funcDef, *ast)
+		ast.TypeArgs = nil
+		for _, typeParam := range funcTypeParams(funcDef) {
+			ast.TypeArgs = append(ast.TypeArgs, bindings[typeParam])
+		}
+	}
 }
 
-func checkTypeOfBinaryOp(ast *Ast, expectedType TypeAnnotation) {
-	lhsType, lErr := typeOfExpression(*ast.Children[0])
-	rhsType, rErr := typeOfExpression(*ast.Children[1])
+func checkTypeOfFuncRef(ast *Ast, funcDef *Ast, expectedType TypeAnnotation) {
+	valueType, err := typeOfFuncValue(ast.Name)
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
+	}
+	if valueType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but function '%s' has type '%s'", expectedType, ast.Name, valueType)
+	}
+	ast.Module = funcDef.Module
+	if funcDef.Type == AstExternFunction {
+		ast.Module = ""
+	}
+	ast.DataType = valueType
+}
 
-	if lErr != nil {
-		log.Fatalf("[Type Check]: Binary operation: %s", lErr)
+// Checks a method call, the receiver is the first child. Calls of the
+// methods of an interface are dispatched when the program runs.
+func checkTypeOfMethodCall(ast *Ast, expectedType TypeAnnotation) {
+	receiverType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Method call: %s", err)
 	}
-	if rErr != nil {
-		log.Fatalf("[Type Check]: Binary operation: %s", rErr)
+	params, returnType, err := methodSignature(receiverType, ast.Name)
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
 	}
+	if returnType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but method %s has type '%s'", expectedType, ast.Name, returnType)
+	}
+	args := ast.Children[1:]
+	if len(params) != len(args) {
+		log.Fatalf("[Type Check]: Method '%s' expects %d arguments but got %d", ast.Name, len(params), len(args))
+	}
+	checkTypeOfExpression(ast.Children[0], receiverType)
+	for i, arg := range args {
+		checkTypeOfExpression(arg, params[i])
+	}
+	if !isInterfaceType(receiverType) && !isResultType(receiverType) {
+		method, _ := methodDefWithName(receiverType, ast.Name)
+		ast.Module = method.Module
+	}
+	ast.DataType = returnType
+}
+
+// Checks a call of a function value, the callee is the first child.
+func checkTypeOfClosureCall(ast *Ast, expectedType TypeAnnotation) {
+	calleeType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Call: %s", err)
+	}
+	if !isFuncType(calleeType) {
+		log.Fatalf("[Type Check]: Cannot call expression of type '%s'", calleeType)
+	}
+	params, returnType := funcTypeSignature(calleeType)
+	if returnType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but call has type '%s'", expectedType, returnType)
+	}
+	args := ast.Children[1:]
+	if len(params) != len(args) {
+		log.Fatalf("[Type Check]: Function of type '%s' expects %d arguments but got %d", calleeType, len(params), len(args))
+	}
+	checkTypeOfExpression(ast.Children[0], calleeType)
+	for i, arg := range args {
+		checkTypeOfExpression(arg, params[i])
+	}
+	ast.DataType = returnType
+}
+
+// Wraps a value used where an interface is expected in an interface
+// value, that records the methods implementing the interface.
+func checkTypeOfInterfaceValue(ast *Ast, iface TypeAnnotation) {
+	valueType, err := typeOfExpression(*ast)
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
+	}
+	methods, err := interfaceImplementation(valueType, iface)
+	if err != nil {
+		log.Fatalf("[Type Check]: %s", err)
+	}
+	value := *ast
+	checkTypeOfExpression(&value, valueType)
+	*ast = Ast{Type: AstInterfaceValue, DataType: iface, Children: []*Ast{&value}}
+	for _, method := range methods {
+		ast.Children = append(ast.Children, &Ast{Type: AstMethodRef, Name: method.Name, Module: method.Module})
+	}
+}
+
+// Checks an anonymous function, the function is checked in the scope
+// where it's defined and records the local variables it captures.
+func checkTypeOfFuncLiteral(ast *Ast, expectedType TypeAnnotation) {
+	literalType := typeOfFuncLiteral(*ast)
+	if literalType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but function has type '%s'", expectedType, literalType)
+	}
+	ast.Children = append(ast.Children[:3], &Ast{Type: AstCaptures})
+	closureScopes = append(closureScopes, closureScope{literal: ast, firstScope: len(scopes)})
+	pushScope(ast)
+	returnType := ast.Children[1].Children[0].DataType
+	checkTypeOfBlock(ast.Children[2], returnType)
+	if returnType != TypeVoid && !blockTerminates(ast.Children[2]) {
+		log.Fatalf("[Type Check]: Anonymous function can end without returning a value of type '%s'", returnType)
+	}
+	popScope()
+	closureScopes = closureScopes[:len(closureScopes)-1]
+	ast.DataType = literalType
+}
+
+func checkTypeOfFuncCallArgs(ast *Ast) {
+	params, _, err := funcSignatureOfCall(*ast)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(params) != len(ast.Children) {
+		log.Fatalf("[Type Check]: Function '%s' expects %d arguments but got %d",
+			ast.Name, len(params), len(ast.Children))
+	}
+	for i, arg := range ast.Children {
+		checkTypeOfExpression(arg, params[i])
+	}
+}
+
+func checkTypeOfBinaryOp(ast *Ast, expectedType TypeAnnotation) {
+	operandType, err := typeOfBinaryOperands(*ast)
+	if err != nil {
+		log.Fatalf("[Type Check]: Binary operation mismatch: %s", err)
+	}
+	if isUntypedConstant(*ast) && constantFitsType(*ast, expectedType) {
+		operandType = expectedType
+	}
+
+	var resultType TypeAnnotation
 	switch ast.Operator {
-	case OpPlus, OpMinus, OpTimes, OpDivide,
-		OpEquals, OpLessThen, OpGreaterThen, OpLessThenEqual, OpGreaterThenEqual:
-		if lhsType != rhsType {
-			log.Fatalf("[Type Check]: Binary operation mismatch: left operand has type '%s' right operand has type '%s'",
-				lhsType, rhsType)
+	case OpPlus:
+		if !isNumericType(operandType) && operandType != TypeString {
+			log.Fatalf("[Type Check]: Operator '%s' is not defined for type '%s'", ast.Operator, operandType)
 		}
+		resultType = operandType
+	case OpMinus, OpTimes, OpDivide:
+		if !isNumericType(operandType) {
+			log.Fatalf("[Type Check]: Operator '%s' is not defined for type '%s'", ast.Operator, operandType)
+		}
+		resultType = operandType
+	case OpLessThen, OpGreaterThen, OpLessThenEqual, OpGreaterThenEqual:
+		if !isNumericType(operandType) && operandType != TypeChar {
+			log.Fatalf("[Type Check]: Operator '%s' is not defined for type '%s'", ast.Operator, operandType)
+		}
+		resultType = TypeBoolean
+	case OpEquals:
+		if !satisfiesConstraint(operandType, ConstraintComparable) {
+			log.Fatalf("[Type Check]: Operator '%s' is not defined for type '%s'", ast.Operator, operandType)
+		}
+		resultType = TypeBoolean
 	default:
 		log.Fatalf("[Type Check]: Unsupported binary operator '%s'", ast.Operator)
 	}
+	if resultType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but binary operation has type '%s'", expectedType, resultType)
+	}
+
+	checkTypeOfExpression(ast.Children[0], operandType)
+	checkTypeOfExpression(ast.Children[1], operandType)
+	ast.DataType = resultType
+}
+
+func checkTypeOfConversion(ast *Ast, expectedType TypeAnnotation) {
+	if ast.DataType != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but conversion has type '%s'", expectedType, ast.DataType)
+	}
+	fromType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Conversion: %s", err)
+	}
+	if isUntypedConstant(*ast.Children[0]) && constantFitsType(*ast.Children[0], ast.DataType) {
+		fromType = ast.DataType
+	}
+	if !isConvertible(fromType, ast.DataType) {
+		log.Fatalf("[Type Check]: Cannot convert type '%s' to '%s'", fromType, ast.DataType)
+	}
+	checkTypeOfExpression(ast.Children[0], fromType)
+}
+
+// Checks an expression used as an index or a slice bound,
+// any integer type can be used.
+func checkTypeOfIndexExpression(ast *Ast) {
+	indexType, err := typeOfExpression(*ast)
+	if err != nil {
+		log.Fatalf("[Type Check]: Index: %s", err)
+	}
+	if !isIntegerType(indexType) {
+		log.Fatalf("[Type Check]: Index must be an integer but has type '%s'", indexType)
+	}
+	checkTypeOfExpression(ast, indexType)
+}
+
+// Returns the type of the elements of an indexed expression,
+// strings are indexed by char and slices by element.
+func typeOfIndexed(ast Ast) (TypeAnnotation, error) {
+	baseType, err := typeOfExpression(ast)
+	if err != nil {
+		return TypeVoid, err
+	}
+	switch {
+	case baseType == TypeString:
+		return TypeChar, nil
+	case isSliceType(baseType):
+		return sliceElem(baseType), nil
+	}
+	return TypeVoid, fmt.Errorf("cannot index value of type '%s'", baseType)
+}
+
+func checkTypeOfIndex(ast *Ast, expectedType TypeAnnotation) {
+	elemType, err := typeOfIndexed(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Index: %s", err)
+	}
+	if expectedType != elemType {
+		log.Fatalf("[Type Check]: Expected type '%s' but index has type '%s'", expectedType, elemType)
+	}
+	baseType, _ := typeOfExpression(*ast.Children[0])
+	checkTypeOfExpression(ast.Children[0], baseType)
+	checkTypeOfIndexExpression(ast.Children[1])
+	ast.DataType = elemType
+}
+
+func checkTypeOfSlice(ast *Ast, expectedType TypeAnnotation) {
+	if expectedType != TypeString {
+		log.Fatalf("[Type Check]: Expected type '%s' but slice has type '%s'", expectedType, TypeString)
+	}
+	checkTypeOfExpression(ast.Children[0], TypeString)
+	for _, bound := range ast.Children[1:] {
+		if bound.Type != AstNoop {
+			checkTypeOfIndexExpression(bound)
+		}
+	}
+	ast.DataType = TypeString
+}
+
+// Returns true if the expression refers to a value stored in memory,
+// only these expressions can have their address taken.
+func isAddressable(ast Ast) bool {
+	return ast.Type == AstVariableRef || ast.Type == AstDereference
+}
+
+// Checks taking the address of a variable or of a dereference. The
+// locals whose address is taken live as long as the pointers to them,
+// the backends store them in cells allocated like the ones of new().
+func checkTypeOfAddressOf(ast *Ast, expectedType TypeAnnotation) {
+	if !isAddressable(*ast.Children[0]) {
+		log.Fatalf("[Type Check]: Cannot take the address of a temporary value '%s'", ast.Children[0].Type)
+	}
+	if ast.Children[0].Type == AstVariableRef {
+		if varDef, err := varDefWithName(ast.Children[0].Name); err == nil && varDef.Constant {
+			log.Fatalf("[Type Check]: Cannot take the address of constant '%s'", varDef.Name)
+		}
+	}
+	valueType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Address of: %s", err)
+	}
+	if pointerTo(valueType) != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, pointerTo(valueType))
+	}
+	checkTypeOfExpression(ast.Children[0], valueType)
+	ast.DataType = expectedType
+}
+
+func checkTypeOfDereference(ast *Ast, expectedType TypeAnnotation) {
+	pointerType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Dereference: %s", err)
+	}
+	if !isPointerType(pointerType) {
+		log.Fatalf("[Type Check]: Cannot dereference value of type '%s'", pointerType)
+	}
+	if pointerElem(pointerType) != expectedType {
+		log.Fatalf("[Type Check]: Expected type '%s' but dereference has type '%s'", expectedType, pointerElem(pointerType))
+	}
+	checkTypeOfExpression(ast.Children[0], pointerType)
+	ast.DataType = expectedType
 }
 
 func checkTypeOfExpression(ast *Ast, expectedType TypeAnnotation) {
+	if isInterfaceType(expectedType) && ast.Type != AstInterfaceValue {
+		if valueType, err := typeOfExpression(*ast); err == nil && valueType != expectedType {
+			checkTypeOfInterfaceValue(ast, expectedType)
+			return
+		}
+	}
 	switch ast.Type {
 	case AstNumberLiteral:
-		if expectedType != TypeInteger {
+		if !isIntegerType(expectedType) {
 			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, TypeInteger)
 		}
-		ast.DataType = TypeInteger
+		if !integerFitsType(uint64(ast.NumberDataValue), expectedType) {
+			log.Fatalf("[Type Check]: Constant %d overflows type '%s'", uint64(ast.NumberDataValue), expectedType)
+		}
+		ast.DataType = expectedType
+	case AstFloatLiteral:
+		if !isFloatType(expectedType) {
+			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, TypeF64)
+		}
+		ast.DataType = expectedType
 	case AstBooleanLiteral:
 		if expectedType != TypeBoolean {
 			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, TypeBoolean)
@@ -156,31 +993,97 @@ func checkTypeOfExpression(ast *Ast, expectedType TypeAnnotation) {
 			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, TypeString)
 		}
 		ast.DataType = TypeString
+	case AstCharLiteral:
+		if expectedType != TypeChar {
+			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, TypeChar)
+		}
+		ast.DataType = TypeChar
 	case AstFuncCall:
 		checkTypeOfFuncCall(ast, expectedType)
 	case AstVariableRef:
-		varType, err := typeOfVarWithName(ast.Name)
+		varDef, err := varDefWithName(ast.Name)
+		if err != nil {
+			if funcDef, funcErr := funcDefWithName(ast.Name); funcErr == nil {
+				// Functions used as values
+				ast.Type = AstFuncRef
+				checkTypeOfFuncRef(ast, funcDef, expectedType)
+				break
+			}
+			log.Fatal(err)
+		}
+		if varDef.Type != expectedType {
+			log.Fatalf("[Type Check]: Expected variable reference with type '%s' but got '%s'", expectedType, varDef.Type)
+		}
+		ast.DataType = varDef.Type
+		ast.Module = varDef.Module
+	case AstFuncRef:
+		funcDef, err := funcDefWithName(ast.Name)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if varType != expectedType {
-			log.Fatalf("[Type Check]: Expected variable reference with type '%s' but got '%s'", expectedType, varType)
+		checkTypeOfFuncRef(ast, funcDef, expectedType)
+	case AstFuncLiteral:
+		checkTypeOfFuncLiteral(ast, expectedType)
+	case AstClosureCall:
+		checkTypeOfClosureCall(ast, expectedType)
+	case AstInterfaceValue:
+		if ast.DataType != expectedType {
+			log.Fatalf("[Type Check]: Expected type '%s' but expression has type '%s'", expectedType, ast.DataType)
+		}
+	case AstMethodCall:
+		checkTypeOfMethodCall(ast, expectedType)
+	case AstResultOk, AstResultErr:
+		checkTypeOfResultValue(ast, expectedType)
+	case AstTry:
+		checkTypeOfTry(ast, expectedType)
+	case AstConversion:
+		checkTypeOfConversion(ast, expectedType)
+	case AstIndex:
+		checkTypeOfIndex(ast, expectedType)
+	case AstSlice:
+		checkTypeOfSlice(ast, expectedType)
+	case AstNew:
+		allocType := ast.Children[0].DataType
+		if allocType == TypeVoid {
+			log.Fatal("[Type Check]: Cannot allocate a value of type 'Void'")
+		}
+		if pointerTo(allocType) != expectedType {
+			log.Fatalf("[Type Check]: Expected type '%s' but allocation has type '%s'", expectedType, pointerTo(allocType))
 		}
-		ast.DataType = varType
+		ast.DataType = expectedType
+	case AstAddressOf:
+		checkTypeOfAddressOf(ast, expectedType)
+	case AstDereference:
+		checkTypeOfDereference(ast, expectedType)
 	case AstBinaryOp:
 		checkTypeOfBinaryOp(ast, expectedType)
-		ast.DataType = expectedType
 	default:
 		log.Fatalf("[Type Check]: Unsupported expression '%s'", ast.Type)
 	}
 }
 
 func checkTypeOfAssignment(ast *Ast) {
-	varType, err := typeOfVarWithName(ast.Name)
+	varDef, err := varDefWithName(ast.Name)
 	if err != nil {
 		log.Fatal(err)
 	}
-	checkTypeOfExpression(ast.Children[0], varType)
+	if varDef.Constant {
+		log.Fatalf("[Type Check]: Cannot assign to constant '%s'", ast.Name)
+	}
+	checkTypeOfExpression(ast.Children[0], varDef.Type)
+	ast.Module = varDef.Module
+}
+
+func checkTypeOfDerefAssignment(ast *Ast) {
+	pointerType, err := typeOfExpression(*ast.Children[0])
+	if err != nil {
+		log.Fatalf("[Type Check]: Assignment: %s", err)
+	}
+	if !isPointerType(pointerType) {
+		log.Fatalf("[Type Check]: Cannot assign through value of type '%s'", pointerType)
+	}
+	checkTypeOfExpression(ast.Children[0], pointerType)
+	checkTypeOfExpression(ast.Children[1], pointerElem(pointerType))
 }
 
 func checkTypeOfLocalVar(ast *Ast) {
@@ -206,12 +1109,22 @@ func checkTypeOfReturn(ast *Ast, expectedType TypeAnnotation) {
 	checkTypeOfExpression(ast.Children[0], expectedType)
 }
 
+// Returns true for the types of the values print accepts.
+func isPrintableType(t TypeAnnotation) bool {
+	unprintable := isPointerType(t) || isSliceType(t) || isFuncType(t) || isInterfaceType(t) || isResultType(t) ||
+		(isTypeParam(t) && !isNumericType(t))
+	return t != TypeVoid && !unprintable
+}
+
 func checkTypeOfPrint(ast *Ast) {
 	for _, expr := range ast.Children {
 		exprType, err := typeOfExpression(*expr)
 		if err != nil {
 			log.Fatalf("[Type Check]: %s", err)
 		}
+		if !isPrintableType(exprType) {
+			log.Fatalf("[Type Check]: Cannot print value of type '%s'", exprType)
+		}
 		checkTypeOfExpression(expr, exprType)
 	}
 }
@@ -222,6 +1135,8 @@ func checkTypeOfStatement(ast *Ast, expectedType TypeAnnotation) {
 		checkTypeOfLocalVar(ast)
 	case AstAssignment:
 		checkTypeOfAssignment(ast)
+	case AstDerefAssignment:
+		checkTypeOfDerefAssignment(ast)
 	case AstReturn:
 		checkTypeOfReturn(ast, expectedType)
 	case AstIf:
@@ -230,6 +1145,33 @@ func checkTypeOfStatement(ast *Ast, expectedType TypeAnnotation) {
 		checkTypeOfWhile(ast, expectedType)
 	case AstPrint:
 		checkTypeOfPrint(ast)
+	case AstFuncCall:
+		funcType, err := typeOfFuncCall(*ast)
+		if err != nil {
+			log.Fatalf("[Type Check]: %s", err)
+		}
+		checkResultIsUsed(*ast, funcType)
+		checkTypeOfFuncCall(ast, funcType)
+	case AstMethodCall:
+		methodType, err := typeOfExpression(*ast)
+		if err != nil {
+			log.Fatalf("[Type Check]: %s", err)
+		}
+		checkResultIsUsed(*ast, methodType)
+		checkTypeOfMethodCall(ast, methodType)
+	case AstClosureCall:
+		returnType, err := typeOfExpression(*ast)
+		if err != nil {
+			log.Fatalf("[Type Check]: %s", err)
+		}
+		checkResultIsUsed(*ast, returnType)
+		checkTypeOfClosureCall(ast, returnType)
+	case AstTry:
+		valueType, err := typeOfExpression(*ast)
+		if err != nil {
+			log.Fatalf("[Type Check]: %s", err)
+		}
+		checkTypeOfTry(ast, valueType)
 	default:
 		log.Fatalf("[Type Check]: Unsupported statements '%s'", ast.Type)
 	}
@@ -257,19 +1199,182 @@ func checkTypeOfFunction(ast *Ast) {
 	}
 	currentFuncDef = ast
 	pushScope(ast)
-	checkTypeOfBlock(ast.Children[2], ast.Children[1].Children[0].DataType)
+	returnType := ast.Children[1].Children[0].DataType
+	checkTypeOfBlock(ast.Children[2], returnType)
+	if returnType != TypeVoid && !blockTerminates(ast.Children[2]) {
+		log.Fatalf("[Type Check]: Function '%s' can end without returning a value of type '%s'", ast.Name, returnType)
+	}
 	currentFuncDef = nil
 	popScope()
 }
 
+// Tells if the block never completes, so that the function holding it
+// can't end without returning: its last statement is a return, an if
+// whose branches both never complete or a loop whose condition is true.
+func blockTerminates(ast *Ast) bool {
+	if len(ast.Children) == 0 {
+		return false
+	}
+	last := ast.Children[len(ast.Children)-1]
+	switch last.Type {
+	case AstReturn:
+		return true
+	case AstIf:
+		return len(last.Children) == 3 && blockTerminates(last.Children[1]) && blockTerminates(last.Children[2])
+	case AstWhile:
+		cond := last.Children[0]
+		return cond.Type == AstBooleanLiteral && cond.BooleanDataValue
+	}
+	return false
+}
+
+// Checks the declaration of a C function, its parameters and
+// return type must have a C counterpart.
+func checkTypeOfExternFunction(ast *Ast) {
+	if ast.Name == "main" {
+		log.Fatal("[Type Check]: Function 'main' can't be extern")
+	}
+	for _, param := range ast.Children[0].Children {
+		if !hasCType(param.Children[0].DataType) {
+			log.Fatalf("[Type Check]: Parameter '%s' of extern function '%s' can't have type '%s'",
+				param.Name, ast.Name, param.Children[0].DataType)
+		}
+	}
+	returnType := ast.Children[1].Children[0].DataType
+	if returnType != TypeVoid && !hasCType(returnType) {
+		log.Fatalf("[Type Check]: Extern function '%s' can't return type '%s'", ast.Name, returnType)
+	}
+}
+
+// Returns true if the values of the type can be passed to C functions:
+// numbers, bools (as int), chars, strings (as char*) and pointers to
+// them. Bools are stored in a byte by some backends, so there are no
+// pointers to bools.
+func hasCType(t TypeAnnotation) bool {
+	switch {
+	case isIntegerType(t), isFloatType(t), t == TypeBoolean, t == TypeChar, t == TypeString:
+		return true
+	case isPointerType(t):
+		return pointerElem(t) != TypeBoolean && hasCType(pointerElem(t))
+	}
+	return false
+}
+
+// Checks a module level variable or constant. Globals are initialised
+// in the order they are declared, so the initial value can only refer to
+// the globals declared before it. Functions called by the initial value
+// see the zero value of the globals not initialised yet.
+func checkTypeOfGlobal(ast *Ast) {
+	varType := ast.Children[0].Children[0].DataType
+	if varType == TypeVoid {
+		log.Fatalf("[Type Check]: Global '%s' can't have type '%s'", ast.Name, varType)
+	}
+	checkTypeOfExpression(ast.Children[1], varType)
+	scopes[0].vars = append(scopes[0].vars, VarDef{
+		Name:     ast.Name,
+		Type:     varType,
+		Constant: ast.Type == AstGlobalConstant,
+		Module:   ast.Module,
+		Public:   ast.Public,
+	})
+}
+
+// Checks that a method is declared once for its receiver type, names
+// of methods are recorded with the receiver type (e.g. `string.shout`).
+func checkMethodDeclaration(ast *Ast, definedNames map[string]bool) {
+	receiverType := methodReceiverType(ast)
+	if receiverType == TypeVoid || isInterfaceType(receiverType) || isResultType(receiverType) {
+		log.Fatalf("[Type Check]: Cannot declare method %s on type '%s'", ast.Name, receiverType)
+	}
+	name := receiverType.String() + "." + ast.Name
+	if definedNames[name] {
+		log.Fatalf("[Type Check]: Method %s of type '%s' is already defined in this module", ast.Name, receiverType)
+	}
+	definedNames[name] = true
+}
+
 func checkTypeOfModule(ast *Ast) {
 	currentModule = ast
-	for _, funcDef := range ast.Children {
-		switch funcDef.Type {
-		case AstFunction:
-			checkTypeOfFunction(funcDef)
+	definedNames := map[string]bool{}
+	for _, def := range ast.Children {
+		if def.Type == AstMethod {
+			checkMethodDeclaration(def, definedNames)
+			continue
+		}
+		if definedNames[def.Name] {
+			log.Fatalf("[Type Check]: '%s' is already defined in this module", def.Name)
+		}
+		definedNames[def.Name] = true
+		if _, ok := builtinWithName(def.Name); ok {
+			log.Fatalf("[Type Check]: '%s' redefines a builtin function", def.Name)
+		}
+	}
+
+	// Globals are visible from every function
+	pushScope(nil)
+	for _, def := range ast.Children {
+		switch def.Type {
+		case AstGlobalVariable, AstGlobalConstant:
+			checkTypeOfGlobal(def)
+		case AstExternFunction:
+			checkTypeOfExternFunction(def)
+		case AstFunction, AstMethod, AstInterface, AstImport:
 		default:
-			log.Fatalf("[Type Check]: Unsupported '%s' top level definition", funcDef.Type)
+			log.Fatalf("[Type Check]: Unsupported '%s' top level definition", def.Type)
 		}
 	}
+	moduleGlobals[ast.Name] = scopes[0].vars
+	for _, def := range ast.Children {
+		if def.Type == AstFunction || def.Type == AstMethod {
+			checkTypeOfFunction(def)
+		}
+	}
+	popScope()
+}
+
+// Checks the signature of the entry point of the program, main can
+// take the command line arguments and can return the exit code. When
+// main returns a result, its error is printed and the program fails.
+func checkTypeOfMain(module *Ast) {
+	for _, def := range module.Children {
+		if def.Type != AstFunction || def.Name != "main" {
+			continue
+		}
+		if funcTypeParams(def) != nil {
+			log.Fatal("[Type Check]: Function 'main' can't be generic")
+		}
+		params := def.Children[0].Children
+		if len(params) > 1 || (len(params) == 1 && params[0].Children[0].DataType != sliceOf(TypeString)) {
+			log.Fatalf("[Type Check]: Function 'main' must take no arguments or a single '%s' argument", sliceOf(TypeString))
+		}
+		returnType := def.Children[1].Children[0].DataType
+		if isResultType(returnType) {
+			var errorType TypeAnnotation
+			returnType, errorType = resultTypes(returnType)
+			if !isPrintableType(errorType) {
+				log.Fatalf("[Type Check]: Function 'main' can't return errors of type '%s', they can't be printed", errorType)
+			}
+		}
+		if returnType != TypeVoid && returnType != TypeInteger {
+			log.Fatalf("[Type Check]: Function 'main' must return '%s' or nothing, possibly in a result, not '%s'",
+				TypeInteger, def.Children[1].Children[0].DataType)
+		}
+		return
+	}
+	log.Fatalf("[Type Check]: Missing function 'main' in %s", module.StringDataValue)
+}
+
+// Checks the modules of a program, every module is checked
+// after the modules it imports.
+func checkTypeOfProgram(ast *Ast) {
+	programModules = map[string]*Ast{}
+	moduleGlobals = map[string][]VarDef{}
+	for _, module := range ast.Children {
+		programModules[module.Name] = module
+	}
+	resolveNamedTypes(ast)
+	for _, module := range ast.Children {
+		checkTypeOfModule(module)
+	}
+	checkTypeOfMain(ast.Children[len(ast.Children)-1])
 }
@@ -0,0 +1,273 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Represents the kind of a compound type.
+type TypeKind int
+
+const (
+	KindPointer TypeKind = iota
+	KindSlice
+	KindTypeParam
+	KindFunction
+	KindInterface
+	// Name of a declared type not resolved yet, see resolveNamedTypes.
+	KindNamed
+	KindResult
+)
+
+// Represents the operations a type parameter must support.
+type TypeConstraint int
+
+const (
+	// Any type can be used, the values can only be moved around.
+	ConstraintAny TypeConstraint = iota
+	// Types that can be compared with ==.
+	ConstraintComparable
+	// Integer and float types, they support arithmetic and ordering.
+	ConstraintNumeric
+)
+
+// Describes a type built on top of other types (e.g. `&int`).
+type CompoundType struct {
+	Kind TypeKind
+	// Type of the referenced value for pointers, of the elements
+	// for slices, of the result for functions and of the value
+	// for results.
+	Elem TypeAnnotation
+	// Parameter types of function types, the error type of results.
+	Params []TypeAnnotation
+	// Methods of interface types.
+	Methods []InterfaceMethod
+	// Name and constraint of type parameters, every generic function
+	// gets its own type parameters told apart by Owner.
+	Name       string
+	Constraint TypeConstraint
+	Owner      int
+}
+
+// A method required by an interface, its type doesn't include the receiver.
+type InterfaceMethod struct {
+	Name string
+	Type TypeAnnotation
+}
+
+// First TypeAnnotation assigned to compound types, all
+// the smaller values are reserved for the builtin types.
+const firstCompoundType TypeAnnotation = 1 << 16
+
+// Compound types are interned, so equal types always get the
+// same TypeAnnotation and can still be compared with ==.
+var compoundTypes []CompoundType
+var compoundTypesByKey = map[string]TypeAnnotation{}
+
+func (c CompoundType) String() string {
+	switch c.Kind {
+	case KindPointer:
+		return "&" + c.Elem.String()
+	case KindSlice:
+		return "[]" + c.Elem.String()
+	case KindTypeParam, KindInterface, KindNamed:
+		return c.Name
+	case KindFunction:
+		var params []string
+		for _, param := range c.Params {
+			params = append(params, param.String())
+		}
+		result := "fun(" + strings.Join(params, ", ") + ")"
+		if c.Elem != TypeVoid {
+			result += ": " + c.Elem.String()
+		}
+		return result
+	case KindResult:
+		return fmt.Sprintf("Result[%s, %s]", c.Elem, c.Params[0])
+	default:
+		return fmt.Sprintf("Unknown TypeKind %d", c.Kind)
+	}
+}
+
+// Returns the TypeAnnotation of the compound type,
+// registering it the first time it's used.
+func internType(c CompoundType) TypeAnnotation {
+	// Types built on other types are told apart by the interned
+	// types they are made of, since different type parameters
+	// can have the same name
+	key := fmt.Sprintf("%d %d %v", c.Kind, c.Elem, c.Params)
+	switch c.Kind {
+	case KindTypeParam:
+		key = fmt.Sprintf("%s#%d", c.Name, c.Owner)
+	case KindInterface:
+		key = "interface " + c.Name
+	case KindNamed:
+		key = "named " + c.Name
+	}
+	if t, ok := compoundTypesByKey[key]; ok {
+		return t
+	}
+	t := firstCompoundType + TypeAnnotation(len(compoundTypes))
+	compoundTypes = append(compoundTypes, c)
+	compoundTypesByKey[key] = t
+	return t
+}
+
+// Returns the description of a compound type, or false if
+// the type is a builtin one.
+func compoundTypeOf(t TypeAnnotation) (CompoundType, bool) {
+	if t < firstCompoundType || int(t-firstCompoundType) >= len(compoundTypes) {
+		return CompoundType{}, false
+	}
+	return compoundTypes[t-firstCompoundType], true
+}
+
+func pointerTo(t TypeAnnotation) TypeAnnotation {
+	return internType(CompoundType{Kind: KindPointer, Elem: t})
+}
+
+func isPointerType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindPointer
+}
+
+// Returns the type of the value referenced by a pointer type.
+func pointerElem(t TypeAnnotation) TypeAnnotation {
+	c, ok := compoundTypeOf(t)
+	if !ok || c.Kind != KindPointer {
+		return TypeVoid
+	}
+	return c.Elem
+}
+
+func sliceOf(t TypeAnnotation) TypeAnnotation {
+	return internType(CompoundType{Kind: KindSlice, Elem: t})
+}
+
+func isSliceType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindSlice
+}
+
+func (c TypeConstraint) String() string {
+	switch c {
+	case ConstraintAny:
+		return "any"
+	case ConstraintComparable:
+		return "comparable"
+	case ConstraintNumeric:
+		return "numeric"
+	default:
+		return fmt.Sprintf("Unknown TypeConstraint %d", int(c))
+	}
+}
+
+// Returns the constraint with given name and true, or false
+// if the name is not a known constraint.
+func typeConstraintFromName(name string) (TypeConstraint, bool) {
+	for _, c := range []TypeConstraint{ConstraintAny, ConstraintComparable, ConstraintNumeric} {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return ConstraintAny, false
+}
+
+func typeParam(name string, constraint TypeConstraint, owner int) TypeAnnotation {
+	return internType(CompoundType{Kind: KindTypeParam, Name: name, Constraint: constraint, Owner: owner})
+}
+
+func isTypeParam(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindTypeParam
+}
+
+// Returns the constraint of a type parameter.
+func typeParamConstraint(t TypeAnnotation) TypeConstraint {
+	c, _ := compoundTypeOf(t)
+	return c.Constraint
+}
+
+// Returns the type of the elements of a slice type.
+func sliceElem(t TypeAnnotation) TypeAnnotation {
+	c, ok := compoundTypeOf(t)
+	if !ok || c.Kind != KindSlice {
+		return TypeVoid
+	}
+	return c.Elem
+}
+
+func funcType(params []TypeAnnotation, returnType TypeAnnotation) TypeAnnotation {
+	return internType(CompoundType{Kind: KindFunction, Params: params, Elem: returnType})
+}
+
+func isFuncType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindFunction
+}
+
+// Returns the parameter types and the return type of a function type.
+func funcTypeSignature(t TypeAnnotation) ([]TypeAnnotation, TypeAnnotation) {
+	c, ok := compoundTypeOf(t)
+	if !ok || c.Kind != KindFunction {
+		return nil, TypeVoid
+	}
+	return c.Params, c.Elem
+}
+
+// Returns the placeholder of a type referred by name, the name can
+// be qualified by a module alias.
+func namedType(name string) TypeAnnotation {
+	return internType(CompoundType{Kind: KindNamed, Name: name})
+}
+
+func isNamedType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindNamed
+}
+
+// Returns the interface declared with given name qualified by the
+// name of its module, the methods are set by setInterfaceMethods.
+func interfaceType(name string) TypeAnnotation {
+	return internType(CompoundType{Kind: KindInterface, Name: name})
+}
+
+func isInterfaceType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindInterface
+}
+
+func setInterfaceMethods(t TypeAnnotation, methods []InterfaceMethod) {
+	compoundTypes[t-firstCompoundType].Methods = methods
+}
+
+func interfaceMethods(t TypeAnnotation) []InterfaceMethod {
+	c, _ := compoundTypeOf(t)
+	return c.Methods
+}
+
+// Returns the type of the results holding either a value or an error.
+func resultOf(valueType TypeAnnotation, errorType TypeAnnotation) TypeAnnotation {
+	return internType(CompoundType{Kind: KindResult, Elem: valueType, Params: []TypeAnnotation{errorType}})
+}
+
+func isResultType(t TypeAnnotation) bool {
+	c, ok := compoundTypeOf(t)
+	return ok && c.Kind == KindResult
+}
+
+// Returns the value type and the error type of a result type.
+func resultTypes(t TypeAnnotation) (TypeAnnotation, TypeAnnotation) {
+	c, ok := compoundTypeOf(t)
+	if !ok || c.Kind != KindResult {
+		return TypeVoid, TypeVoid
+	}
+	return c.Elem, c.Params[0]
+}
+
+// Tells if the values of the type refer to memory of the collector,
+// globals of these types are roots of the collector.
+func holdsReference(t TypeAnnotation) bool {
+	return t == TypeString || isPointerType(t) || isSliceType(t) ||
+		isFuncType(t) || isInterfaceType(t) || isResultType(t)
+}
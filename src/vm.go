@@ -0,0 +1,528 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"runtime"
+	"strings"
+)
+
+// The virtual machine runs bytecode with a stack of values and a stack
+// of calls. Values are a number and a reference:
+//   - integers, chars and booleans are stored in n like the
+//     interpreter stores them, floats by the bits of their float64
+//   - strings, pointers (*vmValue), slices ([]vmValue), function
+//     values (*vmClosure), interface values (*vmInterface) and
+//     results (*vmResult) are stored in ref
+//
+// The zero value is the value of every type before being assigned,
+// a nil ref is an empty string and a failed result.
+type vmValue struct {
+	n   int64
+	ref interface{}
+}
+
+type vmClosure struct {
+	function int
+	captures []vmValue
+	// Name of the C function the value refers to.
+	extern string
+}
+
+type vmInterface struct {
+	value  vmValue
+	vtable int
+}
+
+type vmResult struct {
+	ok    bool
+	value vmValue
+	err   vmValue
+}
+
+// An instruction decoded when the bytecode is loaded, the
+// jump targets are indices of the instructions.
+type vmInstruction struct {
+	op         Opcode
+	a, b, c, d int64
+}
+
+type vmFunction struct {
+	name   string
+	params int
+	slots  int
+	code   []vmInstruction
+}
+
+type vmFrame struct {
+	function *vmFunction
+	pc       int
+	// Position of the first local of the call in the stack.
+	base int
+}
+
+// Operators of the integer arithmetic opcodes.
+var vmIntegerOperators = [...]BinaryOperator{BcAdd: OpPlus, BcSub: OpMinus, BcMul: OpTimes, BcDiv: OpDivide}
+
+type vm struct {
+	program   *Bytecode
+	functions []vmFunction
+	globals   []vmValue
+	stack     []vmValue
+	builtins  map[string]BuiltinFunc
+}
+
+// Runs the program compiled to bytecode, args are the command line
+// arguments of the program starting with its name. Returns the exit code.
+func runBytecode(program *Bytecode, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	m := &vm{program: program, globals: make([]vmValue, program.Globals), builtins: map[string]BuiltinFunc{}}
+	for _, overloads := range builtinFuncs {
+		for _, builtin := range overloads {
+			m.builtins[builtin.CName] = builtin
+		}
+	}
+	for _, fn := range program.Functions {
+		m.functions = append(m.functions, vmFunction{name: fn.Name, params: fn.Params, slots: fn.Slots, code: decodeFunction(fn)})
+	}
+
+	options := CompilerOptions{Unchecked: program.Unchecked}
+	return interpRun(stdin, stdout, stderr, options, func() int {
+		defer func() {
+			if r := recover(); r != nil {
+				if err, ok := r.(runtime.Error); ok {
+					interpStdout.Flush()
+					log.Fatalf("[VM]: invalid bytecode: %s", err)
+				}
+				panic(r)
+			}
+		}()
+		m.call(program.Init, nil)
+		var mainArgs []vmValue
+		if program.MainArgs {
+			var argValues []vmValue
+			for _, arg := range args {
+				argValues = append(argValues, vmValue{ref: arg})
+			}
+			mainArgs = append(mainArgs, vmValue{ref: argValues})
+		}
+		result := m.call(program.Main, mainArgs)
+		if program.MainResult {
+			r := vmResultOf(result)
+			if !r.ok {
+				fmt.Fprintf(stderr, "error: %s\n", interpFormat(vmToInterp(r.err, program.MainError), program.MainError))
+				return 1
+			}
+			result = r.value
+		}
+		return int(int32(result.n))
+	})
+}
+
+// Decodes the instructions of a function, checked by verifyBytecode
+// when the bytecode is read from a file.
+func decodeFunction(fn BytecodeFunction) []vmInstruction {
+	var code []vmInstruction
+	indices := map[int64]int64{}
+	for offset := 0; offset < len(fn.Code); {
+		op, operands, next, err := decodeInstruction(fn.Code, offset)
+		if err != nil {
+			log.Fatalf("[VM]: Invalid bytecode in %s: %s", fn.Name, err)
+		}
+		indices[int64(offset)] = int64(len(code))
+		instruction := vmInstruction{op: op}
+		for i, operand := range operands {
+			switch i {
+			case 0:
+				instruction.a = operand
+			case 1:
+				instruction.b = operand
+			case 2:
+				instruction.c = operand
+			case 3:
+				instruction.d = operand
+			}
+		}
+		code = append(code, instruction)
+		offset = next
+	}
+	for i := range code {
+		if code[i].op == BcJump || code[i].op == BcJumpIfFalse {
+			code[i].a = indices[code[i].a]
+		}
+	}
+	return code
+}
+
+// Returns the value of a builtin type as represented by the interpreter.
+func vmToInterp(v vmValue, t TypeAnnotation) interpValue {
+	switch {
+	case isIntegerType(t):
+		return v.n
+	case isFloatType(t):
+		return math.Float64frombits(uint64(v.n))
+	case t == TypeBoolean:
+		return v.n != 0
+	case t == TypeChar:
+		return byte(v.n)
+	case t == TypeString:
+		return vmString(v)
+	case t == TypeVoid:
+		return nil
+	}
+	log.Fatalf("[VM]: Unsupported type '%s'", t)
+	return nil
+}
+
+func vmFromInterp(value interpValue) vmValue {
+	switch v := value.(type) {
+	case int64:
+		return vmValue{n: v}
+	case float64:
+		return vmValue{n: int64(math.Float64bits(v))}
+	case bool:
+		return vmBool(v)
+	case byte:
+		return vmValue{n: int64(v)}
+	case string:
+		return vmValue{ref: v}
+	}
+	return vmValue{}
+}
+
+func vmBool(b bool) vmValue {
+	if b {
+		return vmValue{n: 1}
+	}
+	return vmValue{}
+}
+
+func vmFloat(f float64) vmValue {
+	return vmValue{n: int64(math.Float64bits(f))}
+}
+
+func (v vmValue) float() float64 {
+	return math.Float64frombits(uint64(v.n))
+}
+
+func vmString(v vmValue) string {
+	s, _ := v.ref.(string)
+	return s
+}
+
+func vmResultOf(v vmValue) *vmResult {
+	if r, ok := v.ref.(*vmResult); ok {
+		return r
+	}
+	return &vmResult{}
+}
+
+// Stops the program reporting the operation that failed at the location.
+func (m *vm) panicf(location int64, format string, args ...interface{}) {
+	l := m.program.Locations[location]
+	panic(interpPanic{
+		location: fmt.Sprintf("%s:%d:%d", m.program.Strings[l.File], l.Line, l.Col),
+		message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (m *vm) pointer(v vmValue, location int64) *vmValue {
+	pointer, _ := v.ref.(*vmValue)
+	if pointer == nil {
+		m.panicf(location, "nil pointer dereference")
+	}
+	return pointer
+}
+
+func (m *vm) push(v vmValue) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vm) pop() vmValue {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// Calls a function and runs until it returns.
+func (m *vm) call(function int, args []vmValue) vmValue {
+	m.stack = append(m.stack[:0], args...)
+	fn := &m.functions[function]
+	for i := len(args); i < fn.slots; i++ {
+		m.push(vmValue{})
+	}
+	frames := []vmFrame{{function: fn}}
+	frame := &frames[0]
+
+	// Pushes the frame of a call whose arguments are on the stack.
+	enter := func(function int, captures []vmValue) {
+		fn := &m.functions[function]
+		base := len(m.stack) - fn.params
+		m.stack = append(m.stack, captures...)
+		for i := fn.params + len(captures); i < fn.slots; i++ {
+			m.push(vmValue{})
+		}
+		frames = append(frames, vmFrame{function: fn, base: base})
+		frame = &frames[len(frames)-1]
+	}
+
+	for {
+		instruction := &frame.function.code[frame.pc]
+		frame.pc++
+		switch instruction.op {
+		case BcInt, BcFloat:
+			m.push(vmValue{n: instruction.a})
+		case BcString:
+			m.push(vmValue{ref: m.program.Strings[instruction.a]})
+		case BcPop:
+			m.pop()
+		case BcLoadLocal:
+			m.push(m.stack[frame.base+int(instruction.a)])
+		case BcStoreLocal:
+			m.stack[frame.base+int(instruction.a)] = m.pop()
+		case BcBoxLocal:
+			slot := &m.stack[frame.base+int(instruction.a)]
+			cell := *slot
+			*slot = vmValue{ref: &cell}
+		case BcLoadBoxed:
+			m.push(*m.stack[frame.base+int(instruction.a)].ref.(*vmValue))
+		case BcStoreBoxed:
+			*m.stack[frame.base+int(instruction.a)].ref.(*vmValue) = m.pop()
+		case BcLocalAddr:
+			m.push(m.stack[frame.base+int(instruction.a)])
+		case BcLoadGlobal:
+			m.push(m.globals[instruction.a])
+		case BcStoreGlobal:
+			m.globals[instruction.a] = m.pop()
+		case BcGlobalAddr:
+			m.push(vmValue{ref: &m.globals[instruction.a]})
+		case BcLoad:
+			m.push(*m.pointer(m.pop(), instruction.a))
+		case BcStore:
+			value := m.pop()
+			*m.pointer(m.pop(), instruction.a) = value
+		case BcNew:
+			m.push(vmValue{ref: &vmValue{}})
+		case BcAdd, BcSub, BcMul, BcDiv:
+			b, a := m.pop(), m.pop()
+			result, failure := interpIntegerOperation(vmIntegerOperators[instruction.op], a.n, b.n, TypeAnnotation(instruction.a))
+			if failure != "" {
+				m.panicf(instruction.b, "%s", failure)
+			}
+			m.push(vmValue{n: result})
+		case BcFAdd, BcFSub, BcFMul, BcFDiv:
+			b, a := m.pop().float(), m.pop().float()
+			var result float64
+			switch instruction.op {
+			case BcFAdd:
+				result = a + b
+			case BcFSub:
+				result = a - b
+			case BcFMul:
+				result = a * b
+			case BcFDiv:
+				result = a / b
+			}
+			m.push(vmFloat(interpFloat(result, TypeAnnotation(instruction.a))))
+		case BcConcat:
+			b, a := m.pop(), m.pop()
+			m.push(vmValue{ref: vmString(a) + vmString(b)})
+		case BcEqual:
+			b, a := m.pop(), m.pop()
+			var equal bool
+			switch instruction.a {
+			case compareFloat:
+				equal = a.float() == b.float()
+			case compareString:
+				equal = vmString(a) == vmString(b)
+			case compareReference:
+				equal = a.ref == b.ref
+			default:
+				equal = a.n == b.n
+			}
+			m.push(vmBool(equal))
+		case BcLess, BcGreater, BcLessEqual, BcGreaterEqual:
+			b, a := m.pop(), m.pop()
+			// Ordering of numbers and chars, C chars are signed
+			var less, greater bool
+			switch instruction.a {
+			case compareUnsigned:
+				less, greater = uint64(a.n) < uint64(b.n), uint64(a.n) > uint64(b.n)
+			case compareFloat:
+				less, greater = a.float() < b.float(), a.float() > b.float()
+			case compareChar:
+				less, greater = int8(a.n) < int8(b.n), int8(a.n) > int8(b.n)
+			default:
+				less, greater = a.n < b.n, a.n > b.n
+			}
+			switch instruction.op {
+			case BcLess:
+				m.push(vmBool(less))
+			case BcGreater:
+				m.push(vmBool(greater))
+			case BcLessEqual:
+				m.push(vmBool(!greater))
+			case BcGreaterEqual:
+				m.push(vmBool(!less))
+			}
+		case BcJump:
+			frame.pc = int(instruction.a)
+		case BcJumpIfFalse:
+			if m.pop().n == 0 {
+				frame.pc = int(instruction.a)
+			}
+		case BcCall:
+			enter(int(instruction.a), nil)
+		case BcCallExtern:
+			interpStdout.Flush()
+			log.Fatalf("[VM]: Cannot call C function %s", m.program.Strings[instruction.a])
+		case BcCallClosure:
+			closure, _ := m.pop().ref.(*vmClosure)
+			if closure == nil {
+				m.panicf(instruction.b, "call of nil function")
+			}
+			if closure.extern != "" {
+				interpStdout.Flush()
+				log.Fatalf("[VM]: Cannot call C function %s", closure.extern)
+			}
+			enter(closure.function, closure.captures)
+		case BcCallInterface:
+			receiver := &m.stack[len(m.stack)-int(instruction.b)]
+			iface, _ := receiver.ref.(*vmInterface)
+			if iface == nil {
+				m.panicf(instruction.d, "method %s called on nil interface", m.program.Strings[instruction.c])
+			}
+			*receiver = iface.value
+			enter(m.program.Vtables[iface.vtable][instruction.a], nil)
+		case BcReturn:
+			result := m.pop()
+			m.stack = m.stack[:frame.base]
+			frames = frames[:len(frames)-1]
+			if len(frames) == 0 {
+				return result
+			}
+			frame = &frames[len(frames)-1]
+			m.push(result)
+		case BcClosure:
+			captures := make([]vmValue, instruction.b)
+			copy(captures, m.stack[len(m.stack)-len(captures):])
+			m.stack = m.stack[:len(m.stack)-len(captures)]
+			m.push(vmValue{ref: &vmClosure{function: int(instruction.a), captures: captures}})
+		case BcExternRef:
+			m.push(vmValue{ref: &vmClosure{extern: m.program.Strings[instruction.a]}})
+		case BcInterface:
+			m.push(vmValue{ref: &vmInterface{value: m.pop(), vtable: int(instruction.a)}})
+		case BcOk:
+			m.push(vmValue{ref: &vmResult{ok: true, value: m.pop()}})
+		case BcOkVoid:
+			m.push(vmValue{ref: &vmResult{ok: true}})
+		case BcErr:
+			m.push(vmValue{ref: &vmResult{err: m.pop()}})
+		case BcTry:
+			result := vmResultOf(m.pop())
+			if result.ok {
+				m.push(result.value)
+				break
+			}
+			// The error is returned by the function
+			m.push(vmValue{ref: &vmResult{err: result.err}})
+			frame.pc = len(frame.function.code) - 1
+		case BcResultMethod:
+			var arg vmValue
+			if bytecodeResultMethods[instruction.a] == "value_or" {
+				arg = m.pop()
+			}
+			result := vmResultOf(m.pop())
+			switch bytecodeResultMethods[instruction.a] {
+			case "is_ok":
+				m.push(vmBool(result.ok))
+			case "is_err":
+				m.push(vmBool(!result.ok))
+			case "value":
+				if !result.ok {
+					m.panicf(instruction.b, "value of a failed result")
+				}
+				m.push(result.value)
+			case "error":
+				if result.ok {
+					m.panicf(instruction.b, "error of a successful result")
+				}
+				m.push(result.err)
+			case "value_or":
+				if result.ok {
+					arg = result.value
+				}
+				m.push(arg)
+			}
+		case BcConvert:
+			from, to := TypeAnnotation(instruction.a), TypeAnnotation(instruction.b)
+			result, failure := interpConvert(vmToInterp(m.pop(), from), from, to)
+			if failure != "" {
+				m.panicf(instruction.c, "%s", failure)
+			}
+			m.push(vmFromInterp(result))
+		case BcIndexString:
+			index, s := m.pop().n, vmString(m.pop())
+			if index < 0 || index >= int64(len(s)) {
+				m.panicf(instruction.a, "index %d out of range for string of length %d", index, len(s))
+			}
+			m.push(vmValue{n: int64(s[index])})
+		case BcIndexSlice:
+			index := m.pop().n
+			slice, _ := m.pop().ref.([]vmValue)
+			if index < 0 || index >= int64(len(slice)) {
+				m.panicf(instruction.b, "index %d out of range for slice of length %d", index, len(slice))
+			}
+			m.push(slice[index])
+		case BcSliceString:
+			var from, to int64
+			if instruction.a&sliceHasTo != 0 {
+				to = m.pop().n
+			}
+			if instruction.a&sliceHasFrom != 0 {
+				from = m.pop().n
+			}
+			s := vmString(m.pop())
+			if instruction.a&sliceHasTo == 0 {
+				to = int64(len(s))
+			}
+			if from < 0 || to > int64(len(s)) || from > to {
+				m.panicf(instruction.b, "slice [%d:%d] out of range for string of length %d", from, to, len(s))
+			}
+			m.push(vmValue{ref: s[from:to]})
+		case BcLen:
+			m.push(vmValue{n: int64(len(vmString(m.pop())))})
+		case BcSliceLen:
+			slice, _ := m.pop().ref.([]vmValue)
+			m.push(vmValue{n: int64(int32(len(slice)))})
+		case BcFormat:
+			t := TypeAnnotation(instruction.a)
+			m.push(vmValue{ref: interpFormat(vmToInterp(m.pop(), t), t)})
+		case BcPrint:
+			var line strings.Builder
+			for _, value := range m.stack[len(m.stack)-int(instruction.a):] {
+				line.WriteString(vmString(value) + " ")
+			}
+			m.stack = m.stack[:len(m.stack)-int(instruction.a)]
+			interpStdout.WriteString(line.String() + "\n")
+		case BcBuiltin:
+			name := m.program.Strings[instruction.a]
+			builtin, ok := m.builtins[name]
+			if !ok {
+				log.Fatalf("[VM]: Unsupported builtin %s", name)
+			}
+			args := make([]interpValue, instruction.b)
+			for i := len(args) - 1; i >= 0; i-- {
+				args[i] = vmToInterp(m.pop(), builtin.Params[i])
+			}
+			result, failure := interpBuiltin(name, args)
+			if failure != "" {
+				m.panicf(instruction.c, "%s", failure)
+			}
+			m.push(vmFromInterp(result))
+		default:
+			log.Fatalf("[VM]: Unknown opcode %d in %s", instruction.op, frame.function.name)
+		}
+	}
+}
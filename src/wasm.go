@@ -0,0 +1,1419 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The WebAssembly backend emits a WAT module from the type checked tree,
+// the module is a WASI command: it exports its memory and `_start` and
+// prints with the fd_write function of wasi_snapshot_preview1. Extern
+// functions are imported from the `env` module.
+//
+// Values are i32 (bools, chars and integers up to 32 bits, sign or zero
+// extended from the bits of their type), i64, f32 or f64. Strings are
+// addresses of C strings in linear memory, pointers are addresses of
+// 8 bytes cells and the other compound values are addresses of blocks
+// of 8 bytes slots allocated by the runtime (see wasmRuntime):
+//   - slices: the length and the address of the elements
+//   - function values: the index of the code in the table followed by
+//     the captured variables, the code gets the block as first argument
+//   - interface values: the value and the address of the vtable
+//   - results: the ok flag, the value and the error
+//
+// Local variables are locals of the function, except the ones whose
+// address is taken that live in a cell. Globals live in linear memory.
+type wasmGenerator struct {
+	text    strings.Builder
+	imports strings.Builder
+	types   strings.Builder
+	// Static data placed after the globals.
+	data    []byte
+	strings map[string]int
+	checked bool
+	// Source file of every module by module name.
+	sourceFiles map[string]string
+	funcDefs    map[string]*Ast
+	externs     map[string]*Ast
+	imported    map[string]bool
+	globals     map[string]int
+	// Function types used by call_indirect by signature.
+	signatures map[string]string
+	// Functions in the table, the first entry is left empty so that
+	// the nil function values have index 0.
+	table      []string
+	tableIndex map[string]int
+	// Functions emitted or waiting to be emitted by name.
+	functions map[string]bool
+	pending   []wasmFunctionDef
+	vtables   map[string]int
+	funcRefs  map[string]int
+	literals  int
+
+	// State of the function being emitted.
+	out        strings.Builder
+	locals     []string
+	scopes     []map[string]wasmVariable
+	boxed      map[string]bool
+	names      int
+	depth      int
+	file       string
+	returnType TypeAnnotation
+}
+
+// A function to emit, see llvmFunctionDef.
+type wasmFunctionDef struct {
+	name     string
+	def      *Ast
+	captures []*Ast
+	file     string
+	// Function called by a wrapper and type of the value whose
+	// method is called by a vtable wrapper.
+	callee    string
+	valueType TypeAnnotation
+	wrapper   bool
+}
+
+// A local variable, the local of a boxed variable holds its cell.
+type wasmVariable struct {
+	local string
+	boxed bool
+}
+
+// Generates WebAssembly text, run by a WASI runtime (e.g. wasmtime).
+type wasmBackend struct{}
+
+func (wasmBackend) Name() string      { return "wasm" }
+func (wasmBackend) Extension() string { return ".wat" }
+
+func (wasmBackend) Emit(program Ast, options CompilerOptions) ([]byte, error) {
+	code := generateWasm(program, options)
+	if err := validateWat(code); err != nil {
+		return nil, fmt.Errorf("invalid module: %s", err)
+	}
+	return []byte(code), nil
+}
+
+// Returns the WAT module of a type checked program.
+func generateWasm(ast Ast, options CompilerOptions) string {
+	if ast.Type != AstProgram {
+		log.Fatalf("[WASM]: Unsupported top level %s", ast.Type)
+	}
+	w := &wasmGenerator{
+		strings:     map[string]int{},
+		checked:     !options.Unchecked,
+		sourceFiles: map[string]string{},
+		funcDefs:    map[string]*Ast{},
+		externs:     map[string]*Ast{},
+		imported:    map[string]bool{},
+		globals:     map[string]int{},
+		signatures:  map[string]string{},
+		tableIndex:  map[string]int{},
+		functions:   map[string]bool{},
+		vtables:     map[string]int{},
+		funcRefs:    map[string]int{},
+	}
+	for _, module := range ast.Children {
+		w.sourceFiles[module.Name] = module.StringDataValue
+		for _, def := range module.Children {
+			switch def.Type {
+			case AstFunction:
+				w.funcDefs[irSymbolName(def.Module, def.Name)] = def
+			case AstExternFunction:
+				w.externs[def.Name] = def
+			case AstGlobalVariable, AstGlobalConstant:
+				w.globals[irSymbolName(def.Module, def.Name)] = wasmDataStart + 8*len(w.globals)
+			}
+		}
+	}
+	runtime := w.runtimeStrings(wasmRuntime)
+
+	w.globalsInit(ast)
+	entryModule := ast.Children[len(ast.Children)-1]
+	w.start(irSymbolName(entryModule.Name, "main"))
+	for _, module := range ast.Children {
+		for _, def := range module.Children {
+			switch {
+			case def.Type == AstFunction && funcTypeParams(def) == nil:
+				w.function(irSymbolName(def.Module, def.Name), def)
+			case def.Type == AstMethod:
+				w.function(irMethodName(def.Module, methodReceiverType(def), def.Name), def)
+			}
+		}
+	}
+	for len(w.pending) > 0 {
+		next := w.pending[0]
+		w.pending = w.pending[1:]
+		w.emitFunction(next)
+	}
+
+	staticData := w.staticDataAddress(0)
+	heap := (staticData + len(w.data) + 7) &^ 7
+	var value strings.Builder
+	value.WriteString("(module\n")
+	value.WriteString(w.types.String())
+	value.WriteString(`(import "wasi_snapshot_preview1" "fd_write" (func $wasi_fd_write (param i32 i32 i32 i32) (result i32)))
+(import "wasi_snapshot_preview1" "fd_read" (func $wasi_fd_read (param i32 i32 i32 i32) (result i32)))
+(import "wasi_snapshot_preview1" "args_sizes_get" (func $wasi_args_sizes_get (param i32 i32) (result i32)))
+(import "wasi_snapshot_preview1" "args_get" (func $wasi_args_get (param i32 i32) (result i32)))
+(import "wasi_snapshot_preview1" "proc_exit" (func $wasi_proc_exit (param i32)))
+`)
+	value.WriteString(w.imports.String())
+	fmt.Fprintf(&value, "(memory (export \"memory\") %d)\n", heap>>16+1)
+	fmt.Fprintf(&value, "(global $sowo_heap (mut i32) (i32.const %d))\n", heap)
+	fmt.Fprintf(&value, "(table %d funcref)\n", len(w.table)+1)
+	if len(w.table) > 0 {
+		fmt.Fprintf(&value, "(elem (i32.const 1) $%s)\n", strings.Join(w.table, " $"))
+	}
+	if len(w.data) > 0 {
+		fmt.Fprintf(&value, "(data (i32.const %d) \"%s\")\n", staticData, watString(w.data))
+	}
+	value.WriteString("(export \"_start\" (func $_start))\n")
+	value.WriteString(runtime)
+	value.WriteString("\n")
+	value.WriteString(w.text.String())
+	value.WriteString(")\n")
+	return value.String()
+}
+
+var wasmRuntimeString = regexp.MustCompile(`sowo\.string (".*")`)
+
+// Replaces the strings of the runtime with their address.
+func (w *wasmGenerator) runtimeStrings(runtime string) string {
+	return wasmRuntimeString.ReplaceAllStringFunc(runtime, func(match string) string {
+		s, err := strconv.Unquote(wasmRuntimeString.FindStringSubmatch(match)[1])
+		if err != nil {
+			log.Fatalf("[WASM]: Invalid runtime string %s", match)
+		}
+		return fmt.Sprintf("i32.const %d", w.stringConstant(s))
+	})
+}
+
+// Escapes bytes in a WAT string.
+func watString(data []byte) string {
+	var value strings.Builder
+	for _, b := range data {
+		if b >= ' ' && b <= '~' && b != '"' && b != '\\' {
+			value.WriteByte(b)
+		} else {
+			fmt.Fprintf(&value, "\\%02x", b)
+		}
+	}
+	return value.String()
+}
+
+// Returns the address of the static data at given offset.
+func (w *wasmGenerator) staticDataAddress(offset int) int {
+	return wasmDataStart + 8*len(w.globals) + offset
+}
+
+// Appends static data aligned to 8 bytes, returns its address.
+func (w *wasmGenerator) addData(data []byte) int {
+	for len(w.data)%8 != 0 {
+		w.data = append(w.data, 0)
+	}
+	address := w.staticDataAddress(len(w.data))
+	w.data = append(w.data, data...)
+	return address
+}
+
+// Returns the address of a string constant.
+func (w *wasmGenerator) stringConstant(s string) int {
+	address, ok := w.strings[s]
+	if !ok {
+		address = w.addData(append([]byte(s), 0))
+		w.strings[s] = address
+	}
+	return address
+}
+
+// Returns the index in the table of a function, adding it once.
+func (w *wasmGenerator) tableEntry(name string) int {
+	index, ok := w.tableIndex[name]
+	if !ok {
+		w.table = append(w.table, name)
+		index = len(w.table)
+		w.tableIndex[name] = index
+	}
+	return index
+}
+
+// Requests a function to be emitted, once.
+func (w *wasmGenerator) function(name string, def *Ast) {
+	if !w.functions[name] {
+		w.functions[name] = true
+		w.pending = append(w.pending, wasmFunctionDef{name: name, def: def, file: w.sourceFiles[def.Module]})
+	}
+}
+
+// Returns the WebAssembly type of a sowo type.
+func wasmType(t TypeAnnotation) string {
+	switch t {
+	case TypeVoid:
+		return ""
+	case TypeI64, TypeU64:
+		return "i64"
+	case TypeF32:
+		return "f32"
+	case TypeF64:
+		return "f64"
+	}
+	return "i32"
+}
+
+// Formats an integer constant, small unsigned values are kept
+// zero-extended.
+func wasmInteger(value int64, t TypeAnnotation) string {
+	switch t {
+	case TypeU8:
+		return fmt.Sprint(uint8(value))
+	case TypeU16:
+		return fmt.Sprint(uint16(value))
+	case TypeU32:
+		return fmt.Sprint(uint32(value))
+	}
+	return llvmInteger(value, t)
+}
+
+// Returns the instruction loading a value of given type from memory.
+func wasmLoad(t TypeAnnotation) string {
+	switch t {
+	case TypeBoolean, TypeU8:
+		return "i32.load8_u"
+	case TypeI8, TypeChar:
+		return "i32.load8_s"
+	case TypeI16:
+		return "i32.load16_s"
+	case TypeU16:
+		return "i32.load16_u"
+	}
+	return wasmType(t) + ".load"
+}
+
+// Returns the instruction storing a value of given type in memory.
+func wasmStore(t TypeAnnotation) string {
+	switch t {
+	case TypeBoolean, TypeU8, TypeI8, TypeChar:
+		return "i32.store8"
+	case TypeI16, TypeU16:
+		return "i32.store16"
+	}
+	return wasmType(t) + ".store"
+}
+
+// Returns the type of the functions called through a function value
+// or a vtable, taking the block of the value as first parameter.
+func (w *wasmGenerator) signature(params []TypeAnnotation, returnType TypeAnnotation) string {
+	text := "(param i32"
+	for _, param := range params {
+		text += " " + wasmType(param)
+	}
+	text += ")"
+	if returnType != TypeVoid {
+		text += " (result " + wasmType(returnType) + ")"
+	}
+	name, ok := w.signatures[text]
+	if !ok {
+		name = fmt.Sprintf("$sowo_type_%d", len(w.signatures)+1)
+		w.signatures[text] = name
+		fmt.Fprintf(&w.types, "(type %s (func %s))\n", name, text)
+	}
+	return name
+}
+
+func (w *wasmGenerator) startFunction(returnType TypeAnnotation, file string) {
+	w.out.Reset()
+	w.locals = nil
+	w.scopes = []map[string]wasmVariable{{}}
+	w.boxed = map[string]bool{}
+	w.names = 0
+	w.depth = 1
+	w.file = file
+	w.returnType = returnType
+}
+
+// Appends the function to the text with its locals.
+func (w *wasmGenerator) endFunction(signature string) {
+	if w.returnType != TypeVoid {
+		// Only reached when every path returns
+		w.emit("%s.const 0", wasmType(w.returnType))
+	}
+	fmt.Fprintf(&w.text, "(func %s\n", signature)
+	for _, local := range w.locals {
+		fmt.Fprintf(&w.text, "  (local %s)\n", local)
+	}
+	fmt.Fprintf(&w.text, "%s)\n\n", w.out.String())
+}
+
+func (w *wasmGenerator) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&w.out, "%s%s\n", strings.Repeat("  ", w.depth), fmt.Sprintf(format, args...))
+}
+
+// Emits an instruction starting a block (block, loop or if).
+func (w *wasmGenerator) open(format string, args ...interface{}) {
+	w.emit(format, args...)
+	w.depth++
+}
+
+func (w *wasmGenerator) elseBlock() {
+	w.depth--
+	w.emit("else")
+	w.depth++
+}
+
+func (w *wasmGenerator) end() {
+	w.depth--
+	w.emit("end")
+}
+
+// Declares a local of given WebAssembly type, returns its name.
+func (w *wasmGenerator) local(name string, t string) string {
+	w.names++
+	local := fmt.Sprintf("$%s.%d", name, w.names)
+	w.locals = append(w.locals, local+" "+t)
+	return local
+}
+
+// Returns a fresh label of a block.
+func (w *wasmGenerator) label() string {
+	w.names++
+	return fmt.Sprintf("$L%d", w.names)
+}
+
+// Declares a local variable, the variables whose address is taken
+// get a new cell. The value is stored with setVariable.
+func (w *wasmGenerator) declareLocal(name string, t TypeAnnotation) wasmVariable {
+	var variable wasmVariable
+	if w.boxed[name] {
+		variable = wasmVariable{local: w.local(name, "i32"), boxed: true}
+		w.emit("i32.const 8")
+		w.emit("call $sowo_alloc")
+		w.emit("local.set %s", variable.local)
+	} else {
+		variable = wasmVariable{local: w.local(name, wasmType(t))}
+	}
+	w.scopes[len(w.scopes)-1][name] = variable
+	return variable
+}
+
+// Marks the variables whose address is taken in the node.
+func (w *wasmGenerator) findBoxed(ast *Ast) {
+	if ast.Type == AstAddressOf && ast.Children[0].Type == AstVariableRef && ast.Children[0].Module == "" {
+		w.boxed[ast.Children[0].Name] = true
+	}
+	if ast.Type == AstFuncLiteral {
+		// Literals are emitted as functions of their own
+		return
+	}
+	for _, child := range ast.Children {
+		w.findBoxed(child)
+	}
+}
+
+// Returns the local variable with given name, if any.
+func (w *wasmGenerator) localVariable(module string, name string) (wasmVariable, bool) {
+	if module == "" {
+		for i := len(w.scopes) - 1; i >= 0; i-- {
+			if variable, ok := w.scopes[i][name]; ok {
+				return variable, true
+			}
+		}
+	}
+	return wasmVariable{}, false
+}
+
+// Emits the value of a variable.
+func (w *wasmGenerator) getVariable(module string, name string, t TypeAnnotation) {
+	if variable, ok := w.localVariable(module, name); ok {
+		w.emit("local.get %s", variable.local)
+		if variable.boxed {
+			w.emit(wasmLoad(t))
+		}
+		return
+	}
+	w.emit("i32.const %d", w.globalAddress(module, name))
+	w.emit(wasmLoad(t))
+}
+
+// Emits the assignment of the value computed by emitValue to a variable.
+func (w *wasmGenerator) setVariable(module string, name string, t TypeAnnotation, emitValue func()) {
+	if variable, ok := w.localVariable(module, name); ok {
+		if !variable.boxed {
+			emitValue()
+			w.emit("local.set %s", variable.local)
+			return
+		}
+		w.emit("local.get %s", variable.local)
+	} else {
+		w.emit("i32.const %d", w.globalAddress(module, name))
+	}
+	emitValue()
+	w.emit(wasmStore(t))
+}
+
+func (w *wasmGenerator) globalAddress(module string, name string) int {
+	address, ok := w.globals[irSymbolName(module, name)]
+	if !ok {
+		log.Fatalf("[WASM]: Unknown variable %s", name)
+	}
+	return address
+}
+
+// Emits the initialisation of the globals in the order they are declared.
+func (w *wasmGenerator) globalsInit(ast Ast) {
+	w.startFunction(TypeVoid, "")
+	for _, module := range ast.Children {
+		w.file = module.StringDataValue
+		for _, def := range module.Children {
+			if def.Type != AstGlobalVariable && def.Type != AstGlobalConstant {
+				continue
+			}
+			varType := def.Children[0].Children[0].DataType
+			w.setVariable(def.Module, def.Name, varType, func() { w.expression(def.Children[1]) })
+		}
+	}
+	w.endFunction("$sowo_init_globals")
+}
+
+// Emits the entry point of the WASI command calling the sowo main,
+// see irMain.
+func (w *wasmGenerator) start(name string) {
+	def := w.funcDefs[name]
+	w.startFunction(TypeVoid, w.sourceFiles[def.Module])
+	w.emit("call $sowo_init_globals")
+	if len(def.Children[0].Children) == 1 {
+		w.emit("call $sowo_args")
+	}
+	w.function(name, def)
+	w.emit("call $%s", name)
+
+	returnType := def.Children[1].Children[0].DataType
+	switch {
+	case returnType == TypeVoid:
+		w.emit("i32.const 0")
+	case isResultType(returnType):
+		valueType, errorType := resultTypes(returnType)
+		result := w.local("result", "i32")
+		w.emit("local.set %s", result)
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+		w.open("if")
+		if valueType == TypeVoid {
+			w.emit("i32.const 0")
+		} else {
+			w.emit("local.get %s", result)
+			w.emit("%s offset=8", wasmLoad(valueType))
+		}
+		w.emit("call $sowo_exit")
+		w.end()
+		w.emit("i32.const 2")
+		w.emit("i32.const %d", w.stringConstant("error: "))
+		w.emit("call $sowo_write_str")
+		w.emit("i32.const 2")
+		w.emit("local.get %s", result)
+		w.emit("%s offset=16", wasmLoad(errorType))
+		w.writeValue(errorType)
+		w.emit("i32.const 2")
+		w.emit("i32.const 10")
+		w.emit("call $sowo_write_char")
+		w.emit("i32.const 1")
+	}
+	w.emit("call $sowo_exit")
+	w.endFunction("$_start")
+}
+
+func (w *wasmGenerator) emitFunction(fn wasmFunctionDef) {
+	returnType := fn.def.Children[1].Children[0].DataType
+	w.startFunction(returnType, fn.file)
+	if !fn.wrapper {
+		w.findBoxed(fn.def.Children[2])
+	}
+	var params []string
+	if len(fn.captures) > 0 || fn.wrapper || fn.def.Type == AstFuncLiteral {
+		params = append(params, "(param $env i32)")
+	}
+	for i, param := range fn.def.Children[0].Children {
+		params = append(params, fmt.Sprintf("(param $arg%d %s)", i, wasmType(param.Children[0].DataType)))
+	}
+	if returnType != TypeVoid {
+		params = append(params, fmt.Sprintf("(result %s)", wasmType(returnType)))
+	}
+	signature := strings.Join(append([]string{"$" + fn.name}, params...), " ")
+
+	if fn.wrapper {
+		w.wrapper(fn)
+		w.endFunction(signature)
+		return
+	}
+	// The captured variables are copied to locals
+	for i, capture := range fn.captures {
+		captureType := capture.Children[0].DataType
+		w.declareLocal(capture.Name, captureType)
+		w.setVariable("", capture.Name, captureType, func() {
+			w.emit("local.get $env")
+			w.emit("%s offset=%d", wasmLoad(captureType), 8*(i+1))
+		})
+	}
+	for i, param := range fn.def.Children[0].Children {
+		paramType := param.Children[0].DataType
+		w.declareLocal(param.Name, paramType)
+		w.setVariable("", param.Name, paramType, func() { w.emit("local.get $arg%d", i) })
+	}
+	w.block(fn.def.Children[2])
+	w.endFunction(signature)
+}
+
+// Emits the body of a wrapper: the functions used as values take a
+// block they ignore and the methods called through a vtable take the
+// block of the interface value holding their receiver.
+func (w *wasmGenerator) wrapper(fn wasmFunctionDef) {
+	if fn.valueType != TypeVoid {
+		w.emit("local.get $env")
+		w.emit(wasmLoad(fn.valueType))
+	}
+	for i := range fn.def.Children[0].Children {
+		w.emit("local.get $arg%d", i)
+	}
+	if extern, ok := w.externs[fn.callee]; ok && fn.valueType == TypeVoid {
+		w.emit("call %s", w.importExtern(extern))
+	} else {
+		w.emit("call $%s", fn.callee)
+	}
+	w.emit("return")
+}
+
+// Imports an extern function from the env module, returns its name.
+func (w *wasmGenerator) importExtern(def *Ast) string {
+	name := "$env." + def.Name
+	if !w.imported[def.Name] {
+		w.imported[def.Name] = true
+		var params []string
+		for _, param := range def.Children[0].Children {
+			params = append(params, wasmType(param.Children[0].DataType))
+		}
+		signature := ""
+		if len(params) > 0 {
+			signature += " (param " + strings.Join(params, " ") + ")"
+		}
+		if returnType := def.Children[1].Children[0].DataType; returnType != TypeVoid {
+			signature += " (result " + wasmType(returnType) + ")"
+		}
+		fmt.Fprintf(&w.imports, "(import \"env\" \"%s\" (func %s%s))\n", def.Name, name, signature)
+	}
+	return name
+}
+
+func (w *wasmGenerator) block(ast *Ast) {
+	w.scopes = append(w.scopes, map[string]wasmVariable{})
+	defer func() { w.scopes = w.scopes[:len(w.scopes)-1] }()
+
+	for _, statement := range ast.Children {
+		switch statement.Type {
+		case AstLocalVariable:
+			varType := statement.Children[0].Children[0].DataType
+			name := statement.Children[0].Name
+			value := w.temp(varType, func() { w.expression(statement.Children[1]) })
+			w.declareLocal(name, varType)
+			w.setVariable("", name, varType, func() { w.emit("local.get %s", value) })
+		case AstAssignment:
+			t := statement.Children[0].DataType
+			value := w.temp(t, func() { w.expression(statement.Children[0]) })
+			w.setVariable(statement.Module, statement.Name, t, func() { w.emit("local.get %s", value) })
+		case AstDerefAssignment:
+			t := statement.Children[1].DataType
+			pointer := w.temp(statement.Children[0].DataType, func() { w.expression(statement.Children[0]) })
+			value := w.temp(t, func() { w.expression(statement.Children[1]) })
+			w.nilCheck(pointer, statement, "nil pointer dereference")
+			w.emit("local.get %s", pointer)
+			w.emit("local.get %s", value)
+			w.emit(wasmStore(t))
+		case AstIf:
+			w.expression(statement.Children[0])
+			w.open("if")
+			w.block(statement.Children[1])
+			if len(statement.Children) == 3 {
+				w.elseBlock()
+				w.block(statement.Children[2])
+			}
+			w.end()
+		case AstWhile:
+			done, next := w.label(), w.label()
+			w.open("block %s", done)
+			w.open("loop %s", next)
+			w.expression(statement.Children[0])
+			w.emit("i32.eqz")
+			w.emit("br_if %s", done)
+			w.block(statement.Children[1])
+			w.emit("br %s", next)
+			w.end()
+			w.end()
+		case AstReturn:
+			w.expression(statement.Children[0])
+			w.emit("return")
+		case AstFuncCall, AstClosureCall, AstMethodCall, AstTry:
+			w.expression(statement)
+			if statement.DataType != TypeVoid {
+				w.emit("drop")
+			}
+		case AstPrint:
+			w.print(statement)
+		default:
+			log.Fatalf("[WASM]: Unsupported statement %s", statement.Type)
+		}
+	}
+}
+
+// Evaluates an expression into a new local, returns the local.
+func (w *wasmGenerator) temp(t TypeAnnotation, emitValue func()) string {
+	local := w.local("tmp", wasmType(t))
+	emitValue()
+	w.emit("local.set %s", local)
+	return local
+}
+
+// Writes the value on the stack to the file descriptor pushed before
+// it, formatted like the placeholders of irPrintFormat.
+func (w *wasmGenerator) writeValue(t TypeAnnotation) {
+	switch t {
+	case TypeInteger, TypeBoolean, TypeI8, TypeI16, TypeI32:
+		w.emit("i64.extend_i32_s")
+		w.emit("call $sowo_write_i64")
+	case TypeU8, TypeU16, TypeU32:
+		w.emit("i64.extend_i32_u")
+		w.emit("call $sowo_write_u64")
+	case TypeI64:
+		w.emit("call $sowo_write_i64")
+	case TypeU64:
+		w.emit("call $sowo_write_u64")
+	case TypeF32:
+		w.emit("f64.promote_f32")
+		w.emit("call $sowo_write_f64")
+	case TypeF64:
+		w.emit("call $sowo_write_f64")
+	case TypeChar:
+		w.emit("call $sowo_write_char")
+	case TypeString:
+		w.emit("call $sowo_write_str")
+	default:
+		log.Fatalf("[WASM]: Unsupported parameter %s", t)
+	}
+}
+
+// Prints the values once they're all evaluated, like the other backends
+// nothing is printed when evaluating one of them fails.
+func (w *wasmGenerator) print(ast *Ast) {
+	var values []string
+	for _, param := range ast.Children {
+		param := param
+		values = append(values, w.temp(param.DataType, func() { w.expression(param) }))
+	}
+	for i, param := range ast.Children {
+		w.emit("i32.const 1")
+		w.emit("local.get %s", values[i])
+		w.writeValue(param.DataType)
+		w.emit("i32.const 1")
+		w.emit("i32.const 32")
+		w.emit("call $sowo_write_char")
+	}
+	w.emit("i32.const 1")
+	w.emit("i32.const 10")
+	w.emit("call $sowo_write_char")
+}
+
+// Stops the program reporting a failed operation.
+func (w *wasmGenerator) panicAt(ast *Ast, message string) {
+	w.location(ast)
+	w.emit("i32.const %d", w.stringConstant(message))
+	w.emit("call $sowo_panic")
+	w.emit("unreachable")
+}
+
+// Stops the program when the condition on the stack is true.
+func (w *wasmGenerator) check(ast *Ast, message string) {
+	w.open("if")
+	w.panicAt(ast, message)
+	w.end()
+}
+
+func (w *wasmGenerator) nilCheck(local string, ast *Ast, message string) {
+	if w.checked {
+		w.emit("local.get %s", local)
+		w.emit("i32.eqz")
+		w.check(ast, message)
+	}
+}
+
+// Emits the arguments locating the node, taken by the runtime
+// functions that can fail.
+func (w *wasmGenerator) location(ast *Ast) {
+	w.emit("i32.const %d", w.stringConstant(w.file))
+	w.emit("i32.const %d", ast.Line)
+	w.emit("i32.const %d", ast.Col)
+}
+
+// Converts the integer on the stack to an i64.
+func (w *wasmGenerator) toI64(t TypeAnnotation) {
+	switch {
+	case llvmBits(t) == 64:
+	case isSignedType(t):
+		w.emit("i64.extend_i32_s")
+	default:
+		w.emit("i64.extend_i32_u")
+	}
+}
+
+// Extends the i32 on the stack from the bits of its type.
+func (w *wasmGenerator) canonical(t TypeAnnotation) {
+	switch t {
+	case TypeI8, TypeChar:
+		w.emit("i32.extend8_s")
+	case TypeI16:
+		w.emit("i32.extend16_s")
+	case TypeU8:
+		w.emit("i32.const 255")
+		w.emit("i32.and")
+	case TypeU16:
+		w.emit("i32.const 65535")
+		w.emit("i32.and")
+	case TypeBoolean:
+		w.emit("i32.const 1")
+		w.emit("i32.and")
+	}
+}
+
+// Evaluates the expression, pushing its value.
+func (w *wasmGenerator) expression(ast *Ast) {
+	switch ast.Type {
+	case AstNumberLiteral:
+		if isFloatType(ast.DataType) {
+			w.floatConstant(float64(ast.NumberDataValue), ast.DataType)
+		} else {
+			w.emit("%s.const %s", wasmType(ast.DataType), wasmInteger(int64(ast.NumberDataValue), ast.DataType))
+		}
+	case AstFloatLiteral:
+		w.floatConstant(ast.FloatDataValue, ast.DataType)
+	case AstBooleanLiteral:
+		if ast.BooleanDataValue {
+			w.emit("i32.const 1")
+		} else {
+			w.emit("i32.const 0")
+		}
+	case AstStringLiteral:
+		w.emit("i32.const %d", w.stringConstant(ast.StringDataValue))
+	case AstCharLiteral:
+		w.emit("i32.const %d", int8(ast.CharDataValue))
+	case AstBinaryOp:
+		w.binaryOp(ast)
+	case AstVariableRef:
+		w.getVariable(ast.Module, ast.Name, ast.DataType)
+	case AstFuncCall:
+		w.funcCall(ast)
+	case AstFuncRef:
+		w.funcRef(ast)
+	case AstFuncLiteral:
+		w.funcLiteral(ast)
+	case AstClosureCall:
+		w.closureCall(ast)
+	case AstMethodCall:
+		w.methodCall(ast)
+	case AstInterfaceValue:
+		w.interfaceValue(ast)
+	case AstResultOk, AstResultErr:
+		offset, flag := 16, 0
+		if ast.Type == AstResultOk {
+			offset, flag = 8, 1
+		}
+		result := w.local("result", "i32")
+		w.emit("i32.const 24")
+		w.emit("call $sowo_alloc")
+		w.emit("local.tee %s", result)
+		w.emit("i32.const %d", flag)
+		w.emit("i32.store")
+		if len(ast.Children) > 0 {
+			w.emit("local.get %s", result)
+			w.expression(ast.Children[0])
+			w.emit("%s offset=%d", wasmStore(ast.Children[0].DataType), offset)
+		}
+		w.emit("local.get %s", result)
+	case AstTry:
+		w.try(ast)
+	case AstConversion:
+		w.expression(ast.Children[0])
+		w.conversion(ast)
+	case AstNew:
+		// Cells are zeroed, the nil string is the empty string
+		w.emit("i32.const 8")
+		w.emit("call $sowo_alloc")
+	case AstAddressOf:
+		target := ast.Children[0]
+		if target.Type == AstDereference {
+			w.expression(target.Children[0])
+		} else if variable, ok := w.localVariable(target.Module, target.Name); ok {
+			w.emit("local.get %s", variable.local)
+		} else {
+			w.emit("i32.const %d", w.globalAddress(target.Module, target.Name))
+		}
+	case AstDereference:
+		pointer := w.temp(ast.Children[0].DataType, func() { w.expression(ast.Children[0]) })
+		w.nilCheck(pointer, ast, "nil pointer dereference")
+		w.emit("local.get %s", pointer)
+		w.emit(wasmLoad(ast.DataType))
+	case AstIndex:
+		w.expression(ast.Children[0])
+		w.expression(ast.Children[1])
+		w.toI64(ast.Children[1].DataType)
+		w.location(ast)
+		if !isSliceType(ast.Children[0].DataType) {
+			w.emit("call $sowo_str_index")
+		} else {
+			w.emit("call $sowo_slice_at")
+			w.emit(wasmLoad(ast.DataType))
+		}
+	case AstSlice:
+		w.expression(ast.Children[0])
+		if ast.Children[1].Type != AstNoop {
+			w.expression(ast.Children[1])
+			w.toI64(ast.Children[1].DataType)
+		} else {
+			w.emit("i64.const 0")
+		}
+		if ast.Children[2].Type == AstNoop {
+			w.location(ast)
+			w.emit("call $sowo_str_suffix")
+		} else {
+			w.expression(ast.Children[2])
+			w.toI64(ast.Children[2].DataType)
+			w.location(ast)
+			w.emit("call $sowo_str_slice")
+		}
+	default:
+		log.Fatalf("[WASM]: Unsupported expression %s", ast.Type)
+	}
+}
+
+func (w *wasmGenerator) floatConstant(value float64, t TypeAnnotation) {
+	if t == TypeF32 {
+		w.emit("f32.const %s", strconv.FormatFloat(float64(float32(value)), 'g', -1, 32))
+		return
+	}
+	w.emit("f64.const %s", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (w *wasmGenerator) binaryOp(ast *Ast) {
+	operandType := ast.Children[0].DataType
+	if isIntegerType(operandType) && isArithmeticOperator(ast.Operator) {
+		w.integerOperation(ast, operandType)
+		return
+	}
+	w.expression(ast.Children[0])
+	w.expression(ast.Children[1])
+	t := wasmType(operandType)
+
+	switch {
+	case operandType == TypeString && ast.Operator == OpPlus:
+		w.emit("call $sowo_str_concat")
+		return
+	case operandType == TypeString:
+		w.emit("call $sowo_str_equals")
+		return
+	case isFloatType(operandType):
+		instructions := map[BinaryOperator]string{
+			OpPlus: "add", OpMinus: "sub", OpTimes: "mul", OpDivide: "div",
+			OpEquals: "eq", OpLessThen: "lt", OpGreaterThen: "gt",
+			OpLessThenEqual: "le", OpGreaterThenEqual: "ge",
+		}
+		w.emit("%s.%s", t, instructions[ast.Operator])
+		return
+	}
+	instructions := map[BinaryOperator][2]string{
+		OpEquals:           {"eq", "eq"},
+		OpLessThen:         {"lt_s", "lt_u"},
+		OpGreaterThen:      {"gt_s", "gt_u"},
+		OpLessThenEqual:    {"le_s", "le_u"},
+		OpGreaterThenEqual: {"ge_s", "ge_u"},
+	}
+	instruction, ok := instructions[ast.Operator]
+	if !ok {
+		log.Fatalf("[WASM]: Unsupported operator %s for type '%s'", ast.Operator, operandType)
+	}
+	if isSignedType(operandType) {
+		w.emit("%s.%s", t, instruction[0])
+	} else {
+		w.emit("%s.%s", t, instruction[1])
+	}
+}
+
+// Emits an arithmetic operation between integers, see irIntegerOperation.
+// The operations on integers of 32 bits are checked computing them on
+// 64 bits, the ones on smaller integers computing them on 32 bits.
+func (w *wasmGenerator) integerOperation(ast *Ast, operandType TypeAnnotation) {
+	t := wasmType(operandType)
+	bits := llvmBits(operandType)
+	signed := isSignedType(operandType)
+	operations := map[BinaryOperator][2]string{
+		OpPlus:   {"add", "addition"},
+		OpMinus:  {"sub", "subtraction"},
+		OpTimes:  {"mul", "multiplication"},
+		OpDivide: {"div", "division"},
+	}
+	operation := operations[ast.Operator]
+	extend := "i64.extend_i32_u"
+	if signed {
+		extend = "i64.extend_i32_s"
+	}
+
+	lhs := w.temp(operandType, func() { w.expression(ast.Children[0]) })
+	rhs := w.temp(operandType, func() { w.expression(ast.Children[1]) })
+
+	if ast.Operator == OpDivide {
+		w.division(ast, operandType, lhs, rhs)
+		return
+	}
+	message := "integer overflow in " + operation[1]
+	switch {
+	case !w.checked:
+		w.emit("local.get %s", lhs)
+		w.emit("local.get %s", rhs)
+		w.emit("%s.%s", t, operation[0])
+		w.canonical(operandType)
+	case bits == 32:
+		result := w.local("tmp", "i64")
+		w.emit("local.get %s", lhs)
+		w.emit(extend)
+		w.emit("local.get %s", rhs)
+		w.emit(extend)
+		w.emit("i64.%s", operation[0])
+		w.emit("local.tee %s", result)
+		w.emit("local.get %s", result)
+		w.emit("i32.wrap_i64")
+		w.emit(extend)
+		w.emit("i64.ne")
+		w.check(ast, message)
+		w.emit("local.get %s", result)
+		w.emit("i32.wrap_i64")
+	case bits < 32:
+		result := w.local("tmp", "i32")
+		w.emit("local.get %s", lhs)
+		w.emit("local.get %s", rhs)
+		w.emit("i32.%s", operation[0])
+		w.emit("local.tee %s", result)
+		w.emit("local.get %s", result)
+		w.canonical(operandType)
+		w.emit("i32.ne")
+		w.check(ast, message)
+		w.emit("local.get %s", result)
+	default:
+		result := w.local("tmp", "i64")
+		w.emit("local.get %s", lhs)
+		w.emit("local.get %s", rhs)
+		w.emit("i64.%s", operation[0])
+		w.emit("local.set %s", result)
+		switch {
+		case ast.Operator == OpTimes && signed:
+			w.emit("local.get %s", lhs)
+			w.emit("local.get %s", rhs)
+			w.emit("call $sowo_mul_overflows_i64")
+		case ast.Operator == OpTimes:
+			w.emit("local.get %s", lhs)
+			w.emit("local.get %s", rhs)
+			w.emit("call $sowo_mul_overflows_u64")
+		case signed:
+			// The sign of the result differs from the signs of the
+			// operands (of lhs and -rhs for subtractions)
+			first, second := rhs, result
+			if ast.Operator == OpMinus {
+				first, second = rhs, lhs
+			}
+			w.emit("local.get %s", lhs)
+			w.emit("local.get %s", result)
+			w.emit("i64.xor")
+			w.emit("local.get %s", first)
+			w.emit("local.get %s", second)
+			w.emit("i64.xor")
+			w.emit("i64.and")
+			w.emit("i64.const 0")
+			w.emit("i64.lt_s")
+		case ast.Operator == OpPlus:
+			w.emit("local.get %s", result)
+			w.emit("local.get %s", lhs)
+			w.emit("i64.lt_u")
+		default:
+			w.emit("local.get %s", lhs)
+			w.emit("local.get %s", rhs)
+			w.emit("i64.lt_u")
+		}
+		w.check(ast, message)
+		w.emit("local.get %s", result)
+	}
+}
+
+// Emits a division between integers, the minimum value divided by -1
+// doesn't fit and is negated instead when unchecked.
+func (w *wasmGenerator) division(ast *Ast, operandType TypeAnnotation, lhs string, rhs string) {
+	t := wasmType(operandType)
+	if w.checked {
+		w.emit("local.get %s", rhs)
+		w.emit("%s.eqz", t)
+		w.check(ast, "integer division by zero")
+	}
+	if !isSignedType(operandType) {
+		w.emit("local.get %s", lhs)
+		w.emit("local.get %s", rhs)
+		w.emit("%s.div_u", t)
+		return
+	}
+	minimum := llvmInteger(math.MinInt64>>(64-llvmBits(operandType)), operandType)
+	if w.checked {
+		w.emit("local.get %s", rhs)
+		w.emit("%s.const -1", t)
+		w.emit("%s.eq", t)
+		w.emit("local.get %s", lhs)
+		w.emit("%s.const %s", t, minimum)
+		w.emit("%s.eq", t)
+		w.emit("i32.and")
+		w.check(ast, "integer overflow in division")
+		w.emit("local.get %s", lhs)
+		w.emit("local.get %s", rhs)
+		w.emit("%s.div_s", t)
+		return
+	}
+	w.emit("%s.const 0", t)
+	w.emit("local.get %s", lhs)
+	w.emit("%s.sub", t)
+	w.canonical(operandType)
+	w.emit("local.get %s", lhs)
+	w.emit("%s.const 1", t)
+	w.emit("local.get %s", rhs)
+	w.emit("local.get %s", rhs)
+	w.emit("%s.const -1", t)
+	w.emit("%s.eq", t)
+	w.emit("select")
+	w.emit("%s.div_s", t)
+	w.emit("local.get %s", rhs)
+	w.emit("%s.const -1", t)
+	w.emit("%s.eq", t)
+	w.emit("select")
+}
+
+// Converts the value on the stack like a C cast does, see irConversion.
+func (w *wasmGenerator) conversion(ast *Ast) {
+	from, to := ast.Children[0].DataType, ast.DataType
+	switch {
+	case from == to:
+	case to == TypeString && from == TypeChar:
+		w.emit("call $sowo_char_to_str")
+	case to == TypeString && (from == TypeU64 || from == TypeU32):
+		w.toI64(from)
+		w.emit("call $sowo_uint_to_str")
+	case to == TypeString:
+		w.toI64(from)
+		w.emit("call $sowo_int_to_str")
+	case from == TypeString:
+		w.location(ast)
+		w.emit("call $sowo_str_to_int")
+		if llvmBits(to) != 64 {
+			w.emit("i32.wrap_i64")
+			w.canonical(to)
+		}
+	case isFloatType(from) && isFloatType(to):
+		if from == TypeF32 {
+			w.emit("f64.promote_f32")
+		} else {
+			w.emit("f32.demote_f64")
+		}
+	case isFloatType(from):
+		if from == TypeF32 {
+			w.emit("f64.promote_f32")
+		}
+		value := w.local("tmp", "f64")
+		signed := 0
+		if isSignedType(to) {
+			signed = 1
+		}
+		w.emit("local.set %s", value)
+		if w.checked {
+			w.emit("local.get %s", value)
+			w.emit("i32.const %d", llvmBits(to))
+			w.emit("i32.const %d", signed)
+			w.emit("call $sowo_float_fits")
+			w.emit("i32.eqz")
+			w.check(ast, "integer overflow in conversion")
+		}
+		w.emit("local.get %s", value)
+		w.emit("i32.const %d", llvmBits(to))
+		w.emit("i32.const %d", signed)
+		w.emit("call $sowo_float_to_int")
+		if llvmBits(to) != 64 {
+			w.emit("i32.wrap_i64")
+		}
+	case isFloatType(to):
+		sign := "u"
+		if isSignedType(from) {
+			sign = "s"
+		}
+		w.emit("%s.convert_%s_%s", wasmType(to), wasmType(from), sign)
+	case llvmBits(from) == 64 && llvmBits(to) < 64:
+		w.emit("i32.wrap_i64")
+		w.canonical(to)
+	case llvmBits(to) == 64:
+		w.toI64(from)
+	default:
+		w.canonical(to)
+	}
+}
+
+func (w *wasmGenerator) funcCall(ast *Ast) {
+	for _, arg := range ast.Children {
+		w.expression(arg)
+	}
+
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, arg.DataType)
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[WASM]: %s", err)
+		}
+		if builtin.Located {
+			w.location(ast)
+		}
+		name := builtin.CName
+		if name == "exit" {
+			name = "sowo_exit"
+		}
+		w.emit("call $%s", name)
+		return
+	}
+	if extern, ok := w.externs[member]; ok && ast.Module == "" {
+		w.emit("call %s", w.importExtern(extern))
+		return
+	}
+
+	name := irSymbolName(ast.Module, ast.Name)
+	if def, ok := w.funcDefs[name]; ok && len(ast.TypeArgs) > 0 {
+		// Every list of type arguments gets its own instance
+		bindings := map[TypeAnnotation]TypeAnnotation{}
+		for i, typeParam := range funcTypeParams(def) {
+			bindings[typeParam] = ast.TypeArgs[i]
+		}
+		instance := substituteAst(def, bindings)
+		instance.Children = instance.Children[:3]
+		name += irTypeArgsSuffix(ast.TypeArgs)
+		w.function(name, instance)
+	}
+	w.emit("call $%s", name)
+}
+
+// Pushes a function value calling a function through a wrapper that
+// ignores the block, the block is in the static data.
+func (w *wasmGenerator) funcRef(ast *Ast) {
+	name := irSymbolName(ast.Module, ast.Name)
+	address, ok := w.funcRefs[name]
+	if !ok {
+		wrapper := "sowo_fn__" + name
+		def, ok := w.funcDefs[name]
+		if !ok {
+			name = ast.Name
+			def = w.externs[name]
+		}
+		w.functions[wrapper] = true
+		w.pending = append(w.pending, wasmFunctionDef{name: wrapper, def: def, callee: name, wrapper: true})
+		address = w.addData(wasmWord(w.tableEntry(wrapper)))
+		w.funcRefs[irSymbolName(ast.Module, ast.Name)] = address
+	}
+	w.emit("i32.const %d", address)
+}
+
+// Returns the little endian bytes of an i32.
+func wasmWord(value int) []byte {
+	return []byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)}
+}
+
+// Pushes a function value of a function literal, the literal is emitted
+// as a function taking the block holding the captured variables.
+func (w *wasmGenerator) funcLiteral(ast *Ast) {
+	w.literals++
+	name := fmt.Sprintf("sowo_closure_%d", w.literals)
+	captures := ast.Children[3].Children
+	w.functions[name] = true
+	w.pending = append(w.pending, wasmFunctionDef{name: name, def: ast, captures: captures, file: w.file})
+	index := w.tableEntry(name)
+	if len(captures) == 0 {
+		w.emit("i32.const %d", w.addData(wasmWord(index)))
+		return
+	}
+	closure := w.local("closure", "i32")
+	w.emit("i32.const %d", 8*(len(captures)+1))
+	w.emit("call $sowo_alloc")
+	w.emit("local.tee %s", closure)
+	w.emit("i32.const %d", index)
+	w.emit("i32.store")
+	for i, capture := range captures {
+		captureType := capture.Children[0].DataType
+		w.emit("local.get %s", closure)
+		w.getVariable("", capture.Name, captureType)
+		w.emit("%s offset=%d", wasmStore(captureType), 8*(i+1))
+	}
+	w.emit("local.get %s", closure)
+}
+
+func (w *wasmGenerator) closureCall(ast *Ast) {
+	closure := w.temp(ast.Children[0].DataType, func() { w.expression(ast.Children[0]) })
+	w.emit("local.get %s", closure)
+	for _, arg := range ast.Children[1:] {
+		w.expression(arg)
+	}
+	w.nilCheck(closure, ast, "call of nil function")
+	w.emit("local.get %s", closure)
+	w.emit("i32.load")
+	params, returnType := funcTypeSignature(ast.Children[0].DataType)
+	w.emit("call_indirect (type %s)", w.signature(params, returnType))
+}
+
+// Emits a method call, methods of interfaces are called through the
+// vtable of the interface value and the methods of results are inlined.
+func (w *wasmGenerator) methodCall(ast *Ast) {
+	receiverType := ast.Children[0].DataType
+	if isResultType(receiverType) {
+		w.resultMethod(ast)
+		return
+	}
+	if !isInterfaceType(receiverType) {
+		for _, arg := range ast.Children {
+			w.expression(arg)
+		}
+		w.emit("call $%s", irMethodName(ast.Module, receiverType, ast.Name))
+		return
+	}
+	index := 0
+	var method InterfaceMethod
+	for i, m := range interfaceMethods(receiverType) {
+		if m.Name == ast.Name {
+			index, method = i, m
+		}
+	}
+	receiver := w.temp(receiverType, func() { w.expression(ast.Children[0]) })
+	w.emit("local.get %s", receiver)
+	for _, arg := range ast.Children[1:] {
+		w.expression(arg)
+	}
+	w.nilCheck(receiver, ast, fmt.Sprintf("method %s called on nil interface", ast.Name))
+	w.emit("local.get %s", receiver)
+	w.emit("i32.load offset=8")
+	w.emit("i32.load offset=%d", 4*index)
+	params, returnType := funcTypeSignature(method.Type)
+	w.emit("call_indirect (type %s)", w.signature(params, returnType))
+}
+
+// Pushes an interface value, the value is copied in a new block.
+func (w *wasmGenerator) interfaceValue(ast *Ast) {
+	valueType := ast.Children[0].DataType
+	value := w.local("interface", "i32")
+	w.emit("i32.const 16")
+	w.emit("call $sowo_alloc")
+	w.emit("local.tee %s", value)
+	w.expression(ast.Children[0])
+	w.emit(wasmStore(valueType))
+	w.emit("local.get %s", value)
+	w.emit("i32.const %d", w.vtable(ast.DataType, valueType, ast.Children[1:]))
+	w.emit("i32.store offset=8")
+	w.emit("local.get %s", value)
+}
+
+// Returns the address of the vtable of the type for the interface,
+// holding the table indices of wrappers calling the methods.
+func (w *wasmGenerator) vtable(iface TypeAnnotation, valueType TypeAnnotation, refs []*Ast) int {
+	key := irTypeName(iface) + "/" + irTypeName(valueType)
+	if address, ok := w.vtables[key]; ok {
+		return address
+	}
+	var entries []byte
+	for _, method := range interfaceMethods(iface) {
+		for _, ref := range refs {
+			if ref.Name != method.Name {
+				continue
+			}
+			wrapper := fmt.Sprintf("sowo_vtable_%d__%s", len(w.vtables)+1, method.Name)
+			w.functions[wrapper] = true
+			w.pending = append(w.pending, wasmFunctionDef{
+				name:      wrapper,
+				def:       interfaceMethodDef(method),
+				callee:    irMethodName(ref.Module, valueType, ref.Name),
+				valueType: valueType,
+				wrapper:   true,
+			})
+			entries = append(entries, wasmWord(w.tableEntry(wrapper))...)
+		}
+	}
+	address := w.addData(entries)
+	w.vtables[key] = address
+	return address
+}
+
+// Emits a method of a result, see irResultMethodCall.
+func (w *wasmGenerator) resultMethod(ast *Ast) {
+	resultType := ast.Children[0].DataType
+	valueType, errorType := resultTypes(resultType)
+	result := w.temp(resultType, func() { w.expression(ast.Children[0]) })
+	switch ast.Name {
+	case "is_ok":
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+	case "is_err":
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+		w.emit("i32.eqz")
+	case "value_or":
+		// The value of a nil result reads as a zero
+		fallback := w.temp(ast.DataType, func() { w.expression(ast.Children[1]) })
+		w.emit("local.get %s", result)
+		w.emit("%s offset=8", wasmLoad(valueType))
+		w.emit("local.get %s", fallback)
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+		w.emit("select")
+	case "value":
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+		w.emit("i32.eqz")
+		w.check(ast, "value of a failed result")
+		if valueType != TypeVoid {
+			w.emit("local.get %s", result)
+			w.emit("%s offset=8", wasmLoad(valueType))
+		}
+	case "error":
+		w.emit("local.get %s", result)
+		w.emit("call $sowo_result_ok")
+		w.check(ast, "error of a successful result")
+		w.emit("local.get %s", result)
+		w.emit("%s offset=16", wasmLoad(errorType))
+	default:
+		log.Fatalf("[WASM]: Unknown method %s of results", ast.Name)
+	}
+}
+
+// Emits the propagation of the error of a result, see irTry. The
+// failed result is returned as is, the error has the same place
+// in the results of every type.
+func (w *wasmGenerator) try(ast *Ast) {
+	resultType := ast.Children[0].DataType
+	result := w.temp(resultType, func() { w.expression(ast.Children[0]) })
+	w.emit("local.get %s", result)
+	w.emit("call $sowo_result_ok")
+	w.emit("i32.eqz")
+	w.open("if")
+	w.emit("local.get %s", result)
+	w.emit("return")
+	w.end()
+	if ast.DataType != TypeVoid {
+		w.emit("local.get %s", result)
+		w.emit("%s offset=8", wasmLoad(ast.DataType))
+	}
+}
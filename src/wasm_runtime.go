@@ -0,0 +1,1700 @@
+package src
+
+// Start of the globals of the WebAssembly programs, followed by the
+// static data. The runtime uses the memory below: the first 32 bytes are
+// never written, so a nil string reads as the empty string and the fields
+// of a nil result read as zeros, 32..63 hold the WASI iovec and sizes,
+// 64..127 the number being formatted, 1024 and 5120 the 4096 bytes
+// buffers of the standard output and of the standard input.
+const wasmDataStart = 9216
+
+// WAT source of the runtime library emitted in every WebAssembly module,
+// the counterpart of cRuntime. Lines `sowo.string "..."` are replaced by
+// the address of the string in the static data.
+//
+// The heap is a bump allocator in linear memory that grows the memory
+// when needed, blocks are never freed. The standard output is buffered
+// and flushed when the program exits. The bounds of strings and slices
+// are checked even in unchecked mode, since the checks keep the program
+// inside its own data.
+const wasmRuntime = `
+(global $sowo_out_len (mut i32) (i32.const 0))
+(global $sowo_in_pos (mut i32) (i32.const 0))
+(global $sowo_in_len (mut i32) (i32.const 0))
+
+;; Writes bytes to a file descriptor without buffering.
+(func $sowo_write_fd (param $fd i32) (param $ptr i32) (param $len i32)
+  i32.const 32
+  local.get $ptr
+  i32.store
+  i32.const 36
+  local.get $len
+  i32.store
+  local.get $fd
+  i32.const 32
+  i32.const 1
+  i32.const 40
+  call $wasi_fd_write
+  drop
+)
+
+(func $sowo_flush
+  global.get $sowo_out_len
+  if
+    i32.const 1
+    i32.const 1024
+    global.get $sowo_out_len
+    call $sowo_write_fd
+    i32.const 0
+    global.set $sowo_out_len
+  end
+)
+
+;; Writes bytes to a file descriptor, the standard output is buffered.
+(func $sowo_write (param $fd i32) (param $ptr i32) (param $len i32)
+  local.get $fd
+  i32.const 1
+  i32.ne
+  if
+    call $sowo_flush
+    local.get $fd
+    local.get $ptr
+    local.get $len
+    call $sowo_write_fd
+    return
+  end
+  global.get $sowo_out_len
+  local.get $len
+  i32.add
+  i32.const 4096
+  i32.gt_u
+  if
+    call $sowo_flush
+  end
+  local.get $len
+  i32.const 4096
+  i32.gt_u
+  if
+    local.get $fd
+    local.get $ptr
+    local.get $len
+    call $sowo_write_fd
+    return
+  end
+  i32.const 1024
+  global.get $sowo_out_len
+  i32.add
+  local.get $ptr
+  local.get $len
+  call $sowo_copy
+  global.get $sowo_out_len
+  local.get $len
+  i32.add
+  global.set $sowo_out_len
+)
+
+(func $sowo_write_str (param $fd i32) (param $s i32)
+  local.get $fd
+  local.get $s
+  local.get $s
+  call $sowo_str_len
+  call $sowo_write
+)
+
+(func $sowo_write_char (param $fd i32) (param $c i32)
+  i32.const 64
+  local.get $c
+  i32.store8
+  local.get $fd
+  i32.const 64
+  i32.const 1
+  call $sowo_write
+)
+
+(func $sowo_write_i64 (param $fd i32) (param $value i64)
+  local.get $fd
+  local.get $value
+  call $sowo_format_i64
+  call $sowo_write_str
+)
+
+(func $sowo_write_u64 (param $fd i32) (param $value i64)
+  local.get $fd
+  local.get $value
+  i32.const 0
+  call $sowo_format_u64
+  call $sowo_write_str
+)
+
+(func $sowo_write_f64 (param $fd i32) (param $value f64)
+  local.get $fd
+  local.get $value
+  call $sowo_format_f64
+  call $sowo_write_str
+)
+
+(func $sowo_exit (param $code i32)
+  call $sowo_flush
+  local.get $code
+  call $wasi_proc_exit
+)
+
+(func $sowo_runtime_error (param $message i32)
+  i32.const 2
+  sowo.string "Runtime error: "
+  call $sowo_write_str
+  i32.const 2
+  local.get $message
+  call $sowo_write_str
+  i32.const 2
+  i32.const 10
+  call $sowo_write_char
+  i32.const 1
+  call $sowo_exit
+)
+
+;; Stops the program reporting the sowo operation that failed.
+(func $sowo_panic (param $file i32) (param $line i32) (param $col i32) (param $message i32)
+  i32.const 2
+  local.get $file
+  call $sowo_write_str
+  i32.const 2
+  i32.const 58
+  call $sowo_write_char
+  i32.const 2
+  local.get $line
+  i64.extend_i32_s
+  call $sowo_write_i64
+  i32.const 2
+  i32.const 58
+  call $sowo_write_char
+  i32.const 2
+  local.get $col
+  i64.extend_i32_s
+  call $sowo_write_i64
+  i32.const 2
+  sowo.string ": panic: "
+  call $sowo_write_str
+  i32.const 2
+  local.get $message
+  call $sowo_write_str
+  i32.const 2
+  i32.const 10
+  call $sowo_write_char
+  i32.const 1
+  call $sowo_exit
+)
+
+;; Allocates a zero initialized block of memory, aligned to 8 bytes.
+(func $sowo_alloc (param $size i32) (result i32) (local $block i32) (local $end i32) (local $pages i32)
+  global.get $sowo_heap
+  i32.const 7
+  i32.add
+  i32.const -8
+  i32.and
+  local.tee $block
+  local.get $size
+  i32.add
+  local.tee $end
+  local.get $block
+  i32.lt_u
+  local.get $end
+  i32.const -65536
+  i32.gt_u
+  i32.or
+  if
+    sowo.string "out of memory"
+    call $sowo_runtime_error
+  end
+  local.get $end
+  i32.const 65535
+  i32.add
+  i32.const 16
+  i32.shr_u
+  memory.size
+  i32.sub
+  local.tee $pages
+  i32.const 0
+  i32.gt_s
+  if
+    local.get $pages
+    memory.grow
+    i32.const -1
+    i32.eq
+    if
+      sowo.string "out of memory"
+      call $sowo_runtime_error
+    end
+  end
+  local.get $end
+  global.set $sowo_heap
+  local.get $block
+)
+
+(func $sowo_copy (param $to i32) (param $from i32) (param $len i32)
+  block $done
+    loop $next
+      local.get $len
+      i32.eqz
+      br_if $done
+      local.get $to
+      local.get $from
+      i32.load8_u
+      i32.store8
+      local.get $to
+      i32.const 1
+      i32.add
+      local.set $to
+      local.get $from
+      i32.const 1
+      i32.add
+      local.set $from
+      local.get $len
+      i32.const 1
+      i32.sub
+      local.set $len
+      br $next
+    end
+  end
+)
+
+;; Returns a new string holding len bytes of s.
+(func $sowo_str_from (param $s i32) (param $len i32) (result i32) (local $result i32)
+  local.get $len
+  i32.const 1
+  i32.add
+  call $sowo_alloc
+  local.tee $result
+  local.get $s
+  local.get $len
+  call $sowo_copy
+  local.get $result
+)
+
+(func $sowo_str_len (param $s i32) (result i32) (local $p i32)
+  local.get $s
+  local.set $p
+  block $done
+    loop $next
+      local.get $p
+      i32.load8_u
+      i32.eqz
+      br_if $done
+      local.get $p
+      i32.const 1
+      i32.add
+      local.set $p
+      br $next
+    end
+  end
+  local.get $p
+  local.get $s
+  i32.sub
+)
+
+(func $sowo_str_concat (param $a i32) (param $b i32) (result i32) (local $a_len i32) (local $b_len i32) (local $result i32)
+  local.get $a
+  call $sowo_str_len
+  local.set $a_len
+  local.get $b
+  call $sowo_str_len
+  local.set $b_len
+  local.get $a_len
+  local.get $b_len
+  i32.add
+  i32.const 1
+  i32.add
+  call $sowo_alloc
+  local.tee $result
+  local.get $a
+  local.get $a_len
+  call $sowo_copy
+  local.get $result
+  local.get $a_len
+  i32.add
+  local.get $b
+  local.get $b_len
+  call $sowo_copy
+  local.get $result
+)
+
+(func $sowo_str_equals (param $a i32) (param $b i32) (result i32) (local $c i32)
+  loop $next
+    local.get $a
+    i32.load8_u
+    local.tee $c
+    local.get $b
+    i32.load8_u
+    i32.ne
+    if
+      i32.const 0
+      return
+    end
+    local.get $c
+    i32.eqz
+    if
+      i32.const 1
+      return
+    end
+    local.get $a
+    i32.const 1
+    i32.add
+    local.set $a
+    local.get $b
+    i32.const 1
+    i32.add
+    local.set $b
+    br $next
+  end
+  unreachable
+)
+
+(func $sowo_str_index (param $s i32) (param $i i64) (param $file i32) (param $line i32) (param $col i32) (result i32) (local $len i64)
+  local.get $s
+  call $sowo_str_len
+  i64.extend_i32_u
+  local.set $len
+  local.get $i
+  i64.const 0
+  i64.lt_s
+  local.get $i
+  local.get $len
+  i64.ge_s
+  i32.or
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    sowo.string "index "
+    local.get $i
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    sowo.string " out of range for string of length "
+    call $sowo_str_concat
+    local.get $len
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+  local.get $s
+  local.get $i
+  i32.wrap_i64
+  i32.add
+  i32.load8_s
+)
+
+(func $sowo_str_slice (param $s i32) (param $from i64) (param $to i64) (param $file i32) (param $line i32) (param $col i32) (result i32) (local $len i64)
+  local.get $s
+  call $sowo_str_len
+  i64.extend_i32_u
+  local.set $len
+  local.get $from
+  i64.const 0
+  i64.lt_s
+  local.get $to
+  local.get $len
+  i64.gt_s
+  i32.or
+  local.get $from
+  local.get $to
+  i64.gt_s
+  i32.or
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    sowo.string "slice ["
+    local.get $from
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    sowo.string ":"
+    call $sowo_str_concat
+    local.get $to
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    sowo.string "] out of range for string of length "
+    call $sowo_str_concat
+    local.get $len
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+  local.get $s
+  local.get $from
+  i32.wrap_i64
+  i32.add
+  local.get $to
+  local.get $from
+  i64.sub
+  i32.wrap_i64
+  call $sowo_str_from
+)
+
+(func $sowo_str_suffix (param $s i32) (param $from i64) (param $file i32) (param $line i32) (param $col i32) (result i32)
+  local.get $s
+  local.get $from
+  local.get $s
+  call $sowo_str_len
+  i64.extend_i32_u
+  local.get $file
+  local.get $line
+  local.get $col
+  call $sowo_str_slice
+)
+
+;; Formats an unsigned integer in the format buffer, preceded by
+;; a minus sign if negative is set, returns the formatted string.
+(func $sowo_format_u64 (param $value i64) (param $negative i32) (result i32) (local $p i32)
+  i32.const 127
+  local.tee $p
+  i32.const 0
+  i32.store8
+  loop $next
+    local.get $p
+    i32.const 1
+    i32.sub
+    local.tee $p
+    local.get $value
+    i64.const 10
+    i64.rem_u
+    i32.wrap_i64
+    i32.const 48
+    i32.add
+    i32.store8
+    local.get $value
+    i64.const 10
+    i64.div_u
+    local.tee $value
+    i64.const 0
+    i64.ne
+    br_if $next
+  end
+  local.get $negative
+  if
+    local.get $p
+    i32.const 1
+    i32.sub
+    local.tee $p
+    i32.const 45
+    i32.store8
+  end
+  local.get $p
+)
+
+(func $sowo_format_i64 (param $value i64) (result i32)
+  local.get $value
+  i64.const 0
+  i64.lt_s
+  if
+    i64.const 0
+    local.get $value
+    i64.sub
+    i32.const 1
+    call $sowo_format_u64
+    return
+  end
+  local.get $value
+  i32.const 0
+  call $sowo_format_u64
+)
+
+;; Stores a byte at p, returns the address following it.
+(func $sowo_put (param $p i32) (param $c i32) (result i32)
+  local.get $p
+  local.get $c
+  i32.store8
+  local.get $p
+  i32.const 1
+  i32.add
+)
+
+(func $sowo_pow10 (param $n i32) (result f64) (local $result f64)
+  f64.const 1
+  local.set $result
+  block $done
+    loop $next
+      local.get $n
+      i32.const 0
+      i32.le_s
+      br_if $done
+      local.get $result
+      f64.const 10
+      f64.mul
+      local.set $result
+      local.get $n
+      i32.const 1
+      i32.sub
+      local.set $n
+      br $next
+    end
+  end
+  local.get $result
+)
+
+;; Returns value * 10^n.
+(func $sowo_scale10 (param $value f64) (param $n i32) (result f64)
+  local.get $n
+  i32.const 290
+  i32.gt_s
+  if
+    local.get $value
+    f64.const 1e290
+    f64.mul
+    local.set $value
+    local.get $n
+    i32.const 290
+    i32.sub
+    local.set $n
+  end
+  local.get $n
+  i32.const 0
+  i32.ge_s
+  if
+    local.get $value
+    local.get $n
+    call $sowo_pow10
+    f64.mul
+    return
+  end
+  local.get $value
+  i32.const 0
+  local.get $n
+  i32.sub
+  call $sowo_pow10
+  f64.div
+)
+
+;; Formats a double in the format buffer like printf with %g.
+(func $sowo_format_f64 (param $value f64) (result i32) (local $p i32) (local $e i32) (local $m i64) (local $n i32) (local $i i32)
+  i32.const 64
+  local.set $p
+  local.get $value
+  i64.reinterpret_f64
+  i64.const 0
+  i64.lt_s
+  if
+    local.get $p
+    i32.const 45
+    call $sowo_put
+    local.set $p
+    local.get $value
+    f64.neg
+    local.set $value
+  end
+  block $finish
+    local.get $value
+    local.get $value
+    f64.ne
+    if
+      local.get $p
+      i32.const 110
+      call $sowo_put
+      i32.const 97
+      call $sowo_put
+      i32.const 110
+      call $sowo_put
+      local.set $p
+      br $finish
+    end
+    local.get $value
+    f64.const inf
+    f64.eq
+    if
+      local.get $p
+      i32.const 105
+      call $sowo_put
+      i32.const 110
+      call $sowo_put
+      i32.const 102
+      call $sowo_put
+      local.set $p
+      br $finish
+    end
+    local.get $value
+    f64.const 0
+    f64.eq
+    if
+      local.get $p
+      i32.const 48
+      call $sowo_put
+      local.set $p
+      br $finish
+    end
+    ;; Estimate the exponent, then round to 6 significant digits
+    block $found
+      loop $up
+        local.get $value
+        local.get $e
+        i32.const 1
+        i32.add
+        call $sowo_pow10
+        f64.lt
+        br_if $found
+        local.get $e
+        i32.const 1
+        i32.add
+        local.set $e
+        br $up
+      end
+    end
+    block $found
+      loop $down
+        f64.const 1
+        local.get $e
+        call $sowo_scale10
+        local.get $value
+        f64.le
+        br_if $found
+        local.get $e
+        i32.const 1
+        i32.sub
+        local.set $e
+        br $down
+      end
+    end
+    loop $normalize
+      local.get $value
+      i32.const 5
+      local.get $e
+      i32.sub
+      call $sowo_scale10
+      f64.nearest
+      i64.trunc_sat_f64_s
+      local.tee $m
+      i64.const 1000000
+      i64.ge_s
+      if
+        local.get $e
+        i32.const 1
+        i32.add
+        local.set $e
+        br $normalize
+      end
+      local.get $m
+      i64.const 100000
+      i64.lt_s
+      if
+        local.get $e
+        i32.const 1
+        i32.sub
+        local.set $e
+        br $normalize
+      end
+    end
+    ;; Digits in 100..105 without the trailing zeros
+    i32.const 6
+    local.set $i
+    loop $digit
+      local.get $i
+      i32.const 1
+      i32.sub
+      local.tee $i
+      i32.const 100
+      i32.add
+      local.get $m
+      i64.const 10
+      i64.rem_u
+      i32.wrap_i64
+      i32.const 48
+      i32.add
+      i32.store8
+      local.get $m
+      i64.const 10
+      i64.div_u
+      local.set $m
+      local.get $i
+      br_if $digit
+    end
+    i32.const 6
+    local.set $n
+    block $trimmed
+      loop $trim
+        local.get $n
+        i32.const 1
+        i32.le_s
+        br_if $trimmed
+        local.get $n
+        i32.const 99
+        i32.add
+        i32.load8_u
+        i32.const 48
+        i32.ne
+        br_if $trimmed
+        local.get $n
+        i32.const 1
+        i32.sub
+        local.set $n
+        br $trim
+      end
+    end
+    local.get $e
+    i32.const -4
+    i32.lt_s
+    local.get $e
+    i32.const 6
+    i32.ge_s
+    i32.or
+    if
+      ;; Scientific notation
+      local.get $p
+      i32.const 100
+      i32.load8_u
+      call $sowo_put
+      local.set $p
+      local.get $n
+      i32.const 1
+      i32.gt_s
+      if
+        local.get $p
+        i32.const 46
+        call $sowo_put
+        local.set $p
+        i32.const 1
+        local.set $i
+        block $done
+          loop $next
+            local.get $i
+            local.get $n
+            i32.ge_s
+            br_if $done
+            local.get $p
+            local.get $i
+            i32.const 100
+            i32.add
+            i32.load8_u
+            call $sowo_put
+            local.set $p
+            local.get $i
+            i32.const 1
+            i32.add
+            local.set $i
+            br $next
+          end
+        end
+      end
+      local.get $p
+      i32.const 101
+      call $sowo_put
+      local.set $p
+      local.get $e
+      i32.const 0
+      i32.lt_s
+      if
+        local.get $p
+        i32.const 45
+        call $sowo_put
+        local.set $p
+        i32.const 0
+        local.get $e
+        i32.sub
+        local.set $e
+      else
+        local.get $p
+        i32.const 43
+        call $sowo_put
+        local.set $p
+      end
+      local.get $e
+      i32.const 100
+      i32.ge_s
+      if
+        local.get $p
+        local.get $e
+        i32.const 100
+        i32.div_s
+        i32.const 48
+        i32.add
+        call $sowo_put
+        local.set $p
+        local.get $e
+        i32.const 100
+        i32.rem_s
+        local.set $e
+      end
+      local.get $p
+      local.get $e
+      i32.const 10
+      i32.div_s
+      i32.const 48
+      i32.add
+      call $sowo_put
+      local.get $e
+      i32.const 10
+      i32.rem_s
+      i32.const 48
+      i32.add
+      call $sowo_put
+      local.set $p
+      br $finish
+    end
+    local.get $e
+    i32.const 0
+    i32.lt_s
+    if
+      ;; 0.000ddd
+      local.get $p
+      i32.const 48
+      call $sowo_put
+      i32.const 46
+      call $sowo_put
+      local.set $p
+      block $done
+        loop $next
+          local.get $e
+          i32.const -1
+          i32.ge_s
+          br_if $done
+          local.get $p
+          i32.const 48
+          call $sowo_put
+          local.set $p
+          local.get $e
+          i32.const 1
+          i32.add
+          local.set $e
+          br $next
+        end
+      end
+      i32.const 0
+      local.set $i
+    else
+      ;; ddd.ddd
+      i32.const 0
+      local.set $i
+      block $done
+        loop $next
+          local.get $p
+          local.get $i
+          i32.const 100
+          i32.add
+          i32.load8_u
+          call $sowo_put
+          local.set $p
+          local.get $i
+          i32.const 1
+          i32.add
+          local.tee $i
+          local.get $e
+          i32.gt_s
+          br_if $done
+          br $next
+        end
+      end
+      local.get $i
+      local.get $n
+      i32.ge_s
+      br_if $finish
+      local.get $p
+      i32.const 46
+      call $sowo_put
+      local.set $p
+    end
+    block $done
+      loop $next
+        local.get $i
+        local.get $n
+        i32.ge_s
+        br_if $done
+        local.get $p
+        local.get $i
+        i32.const 100
+        i32.add
+        i32.load8_u
+        call $sowo_put
+        local.set $p
+        local.get $i
+        i32.const 1
+        i32.add
+        local.set $i
+        br $next
+      end
+    end
+  end
+  local.get $p
+  i32.const 0
+  i32.store8
+  i32.const 64
+)
+
+(func $sowo_int_to_str (param $value i64) (result i32) (local $s i32)
+  local.get $value
+  call $sowo_format_i64
+  local.tee $s
+  local.get $s
+  call $sowo_str_len
+  call $sowo_str_from
+)
+
+(func $sowo_uint_to_str (param $value i64) (result i32) (local $s i32)
+  local.get $value
+  i32.const 0
+  call $sowo_format_u64
+  local.tee $s
+  local.get $s
+  call $sowo_str_len
+  call $sowo_str_from
+)
+
+(func $sowo_char_to_str (param $c i32) (result i32)
+  i32.const 2
+  call $sowo_alloc
+  local.get $c
+  call $sowo_put
+  i32.const 1
+  i32.sub
+)
+
+(func $sowo_is_space (param $c i32) (result i32)
+  local.get $c
+  i32.const 32
+  i32.eq
+  local.get $c
+  i32.const 9
+  i32.sub
+  i32.const 5
+  i32.lt_u
+  i32.or
+)
+
+;; Parses a decimal integer like strtoll, the whole string must be used.
+(func $sowo_str_to_int (param $s i32) (param $file i32) (param $line i32) (param $col i32) (result i64) (local $p i32) (local $start i32) (local $negative i32) (local $overflow i32) (local $c i32) (local $value i64) (local $digit i64)
+  local.get $s
+  local.set $p
+  block $done
+    loop $next
+      local.get $p
+      i32.load8_u
+      call $sowo_is_space
+      i32.eqz
+      br_if $done
+      local.get $p
+      i32.const 1
+      i32.add
+      local.set $p
+      br $next
+    end
+  end
+  local.get $p
+  i32.load8_u
+  i32.const 45
+  i32.eq
+  local.tee $negative
+  local.get $p
+  i32.load8_u
+  i32.const 43
+  i32.eq
+  i32.or
+  if
+    local.get $p
+    i32.const 1
+    i32.add
+    local.set $p
+  end
+  local.get $p
+  local.set $start
+  ;; The value is accumulated as a negative number to reach the minimum
+  block $done
+    loop $next
+      local.get $p
+      i32.load8_u
+      i32.const 48
+      i32.sub
+      local.tee $c
+      i32.const 10
+      i32.ge_u
+      br_if $done
+      local.get $c
+      i64.extend_i32_u
+      local.set $digit
+      local.get $value
+      i64.const -922337203685477580
+      i64.lt_s
+      local.get $value
+      i64.const -922337203685477580
+      i64.eq
+      local.get $digit
+      i64.const 8
+      i64.gt_s
+      i32.and
+      i32.or
+      if
+        i32.const 1
+        local.set $overflow
+      else
+        local.get $value
+        i64.const 10
+        i64.mul
+        local.get $digit
+        i64.sub
+        local.set $value
+      end
+      local.get $p
+      i32.const 1
+      i32.add
+      local.set $p
+      br $next
+    end
+  end
+  local.get $negative
+  i32.eqz
+  local.get $value
+  i64.const -9223372036854775808
+  i64.eq
+  i32.and
+  local.get $overflow
+  i32.or
+  local.get $p
+  local.get $start
+  i32.eq
+  i32.or
+  local.get $p
+  i32.load8_u
+  i32.const 0
+  i32.ne
+  i32.or
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    sowo.string "cannot convert \""
+    local.get $s
+    call $sowo_str_concat
+    sowo.string "\" to an integer"
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+  local.get $negative
+  if
+    local.get $value
+    return
+  end
+  i64.const 0
+  local.get $value
+  i64.sub
+)
+
+;; Assertions are checked even in unchecked mode.
+(func $sowo_assert (param $cond i32) (param $message i32) (param $file i32) (param $line i32) (param $col i32)
+  local.get $cond
+  i32.eqz
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    sowo.string "assertion failed: "
+    local.get $message
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+)
+
+;; Returns the next byte of the standard input, -1 at the end.
+(func $sowo_read_byte (result i32)
+  global.get $sowo_in_pos
+  global.get $sowo_in_len
+  i32.eq
+  if
+    i32.const 32
+    i32.const 5120
+    i32.store
+    i32.const 36
+    i32.const 4096
+    i32.store
+    i32.const 0
+    i32.const 32
+    i32.const 1
+    i32.const 40
+    call $wasi_fd_read
+    i32.const 40
+    i32.load
+    i32.eqz
+    i32.or
+    if
+      i32.const -1
+      return
+    end
+    i32.const 0
+    global.set $sowo_in_pos
+    i32.const 40
+    i32.load
+    global.set $sowo_in_len
+  end
+  global.get $sowo_in_pos
+  i32.const 5120
+  i32.add
+  i32.load8_u
+  global.get $sowo_in_pos
+  i32.const 1
+  i32.add
+  global.set $sowo_in_pos
+)
+
+;; Reads a line from stdin without the line break,
+;; returns the empty string at the end of the input.
+(func $sowo_read_line (result i32) (local $buffer i32) (local $capacity i32) (local $len i32) (local $c i32) (local $grown i32)
+  i32.const 64
+  local.tee $capacity
+  call $sowo_alloc
+  local.set $buffer
+  call $sowo_flush
+  block $done
+    loop $next
+      call $sowo_read_byte
+      local.tee $c
+      i32.const -1
+      i32.eq
+      local.get $c
+      i32.const 10
+      i32.eq
+      i32.or
+      br_if $done
+      local.get $len
+      i32.const 1
+      i32.add
+      local.get $capacity
+      i32.eq
+      if
+        local.get $capacity
+        i32.const 2
+        i32.mul
+        local.tee $capacity
+        call $sowo_alloc
+        local.tee $grown
+        local.get $buffer
+        local.get $len
+        call $sowo_copy
+        local.get $grown
+        local.set $buffer
+      end
+      local.get $buffer
+      local.get $len
+      i32.add
+      local.get $c
+      i32.store8
+      local.get $len
+      i32.const 1
+      i32.add
+      local.set $len
+      br $next
+    end
+  end
+  local.get $len
+  if
+    local.get $buffer
+    local.get $len
+    i32.add
+    i32.const 1
+    i32.sub
+    i32.load8_u
+    i32.const 13
+    i32.eq
+    if
+      local.get $len
+      i32.const 1
+      i32.sub
+      local.set $len
+    end
+  end
+  local.get $buffer
+  local.get $len
+  call $sowo_str_from
+)
+
+(func $sowo_read_int (param $file i32) (param $line i32) (param $col i32) (result i32) (local $value i64)
+  call $sowo_read_line
+  local.get $file
+  local.get $line
+  local.get $col
+  call $sowo_str_to_int
+  local.tee $value
+  local.get $value
+  i32.wrap_i64
+  i64.extend_i32_s
+  i64.ne
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    local.get $value
+    call $sowo_int_to_str
+    sowo.string " does not fit in an int"
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+  local.get $value
+  i32.wrap_i64
+)
+
+;; Returns 1 if s starts with prefix.
+(func $sowo_str_starts_with (param $s i32) (param $prefix i32) (result i32) (local $c i32)
+  loop $next
+    local.get $prefix
+    i32.load8_u
+    local.tee $c
+    i32.eqz
+    if
+      i32.const 1
+      return
+    end
+    local.get $s
+    i32.load8_u
+    local.get $c
+    i32.ne
+    if
+      i32.const 0
+      return
+    end
+    local.get $s
+    i32.const 1
+    i32.add
+    local.set $s
+    local.get $prefix
+    i32.const 1
+    i32.add
+    local.set $prefix
+    br $next
+  end
+  unreachable
+)
+
+(func $sowo_str_index_of (param $s i32) (param $sub i32) (result i32) (local $i i32)
+  loop $next
+    local.get $s
+    local.get $i
+    i32.add
+    local.get $sub
+    call $sowo_str_starts_with
+    if
+      local.get $i
+      return
+    end
+    local.get $s
+    local.get $i
+    i32.add
+    i32.load8_u
+    i32.eqz
+    if
+      i32.const -1
+      return
+    end
+    local.get $i
+    i32.const 1
+    i32.add
+    local.set $i
+    br $next
+  end
+  unreachable
+)
+
+(func $sowo_str_contains (param $s i32) (param $sub i32) (result i32)
+  local.get $s
+  local.get $sub
+  call $sowo_str_index_of
+  i32.const 0
+  i32.ge_s
+)
+
+(func $sowo_str_ends_with (param $s i32) (param $suffix i32) (result i32) (local $s_len i32) (local $suffix_len i32)
+  local.get $s
+  call $sowo_str_len
+  local.tee $s_len
+  local.get $suffix
+  call $sowo_str_len
+  local.tee $suffix_len
+  i32.lt_u
+  if
+    i32.const 0
+    return
+  end
+  local.get $s
+  local.get $s_len
+  i32.add
+  local.get $suffix_len
+  i32.sub
+  local.get $suffix
+  call $sowo_str_equals
+)
+
+;; Returns a copy of s with the letters between from and from + 25
+;; shifted by delta, used to change the case of ASCII letters.
+(func $sowo_str_shift_letters (param $s i32) (param $from i32) (param $delta i32) (result i32) (local $result i32) (local $p i32) (local $c i32)
+  local.get $s
+  local.get $s
+  call $sowo_str_len
+  call $sowo_str_from
+  local.tee $result
+  local.set $p
+  block $done
+    loop $next
+      local.get $p
+      i32.load8_u
+      local.tee $c
+      i32.eqz
+      br_if $done
+      local.get $c
+      local.get $from
+      i32.sub
+      i32.const 26
+      i32.lt_u
+      if
+        local.get $p
+        local.get $c
+        local.get $delta
+        i32.add
+        i32.store8
+      end
+      local.get $p
+      i32.const 1
+      i32.add
+      local.set $p
+      br $next
+    end
+  end
+  local.get $result
+)
+
+(func $sowo_str_to_upper (param $s i32) (result i32)
+  local.get $s
+  i32.const 97
+  i32.const -32
+  call $sowo_str_shift_letters
+)
+
+(func $sowo_str_to_lower (param $s i32) (result i32)
+  local.get $s
+  i32.const 65
+  i32.const 32
+  call $sowo_str_shift_letters
+)
+
+(func $sowo_str_trim (param $s i32) (result i32) (local $from i32) (local $to i32)
+  local.get $s
+  call $sowo_str_len
+  local.set $to
+  block $done
+    loop $next
+      local.get $from
+      local.get $to
+      i32.ge_u
+      br_if $done
+      local.get $s
+      local.get $from
+      i32.add
+      i32.load8_u
+      call $sowo_is_space
+      i32.eqz
+      br_if $done
+      local.get $from
+      i32.const 1
+      i32.add
+      local.set $from
+      br $next
+    end
+  end
+  block $done
+    loop $next
+      local.get $to
+      local.get $from
+      i32.le_u
+      br_if $done
+      local.get $s
+      local.get $to
+      i32.add
+      i32.const 1
+      i32.sub
+      i32.load8_u
+      call $sowo_is_space
+      i32.eqz
+      br_if $done
+      local.get $to
+      i32.const 1
+      i32.sub
+      local.set $to
+      br $next
+    end
+  end
+  local.get $s
+  local.get $from
+  i32.add
+  local.get $to
+  local.get $from
+  i32.sub
+  call $sowo_str_from
+)
+
+;; Slices are blocks holding the length and the address of the
+;; elements, every element takes 8 bytes. Nil slices have length 0.
+(func $sowo_slice_len (param $s i32) (result i32)
+  local.get $s
+  i32.load
+)
+
+;; Returns the address of an element of a slice.
+(func $sowo_slice_at (param $s i32) (param $i i64) (param $file i32) (param $line i32) (param $col i32) (result i32) (local $len i64)
+  local.get $s
+  i32.load
+  i64.extend_i32_u
+  local.set $len
+  local.get $i
+  i64.const 0
+  i64.lt_s
+  local.get $i
+  local.get $len
+  i64.ge_s
+  i32.or
+  if
+    local.get $file
+    local.get $line
+    local.get $col
+    sowo.string "index "
+    local.get $i
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    sowo.string " out of range for slice of length "
+    call $sowo_str_concat
+    local.get $len
+    call $sowo_int_to_str
+    call $sowo_str_concat
+    call $sowo_panic
+  end
+  local.get $s
+  i32.load offset=8
+  local.get $i
+  i32.wrap_i64
+  i32.const 8
+  i32.mul
+  i32.add
+)
+
+;; Returns the command line arguments, the first one is the program name.
+(func $sowo_args (result i32) (local $argc i32) (local $argv i32) (local $slice i32) (local $data i32) (local $i i32)
+  i32.const 44
+  i32.const 48
+  call $wasi_args_sizes_get
+  drop
+  i32.const 44
+  i32.load
+  local.tee $argc
+  i32.const 4
+  i32.mul
+  call $sowo_alloc
+  local.tee $argv
+  i32.const 48
+  i32.load
+  call $sowo_alloc
+  call $wasi_args_get
+  drop
+  local.get $argc
+  i32.const 8
+  i32.mul
+  call $sowo_alloc
+  local.set $data
+  block $done
+    loop $next
+      local.get $i
+      local.get $argc
+      i32.ge_u
+      br_if $done
+      local.get $data
+      local.get $i
+      i32.const 8
+      i32.mul
+      i32.add
+      local.get $argv
+      local.get $i
+      i32.const 4
+      i32.mul
+      i32.add
+      i32.load
+      i32.store
+      local.get $i
+      i32.const 1
+      i32.add
+      local.set $i
+      br $next
+    end
+  end
+  i32.const 16
+  call $sowo_alloc
+  local.tee $slice
+  local.get $argc
+  i32.store
+  local.get $slice
+  local.get $data
+  i32.store offset=8
+  local.get $slice
+)
+
+;; Results are blocks holding the ok flag, the value and the error.
+;; The zero value of results is a nil block, a failed result.
+(func $sowo_result_ok (param $result i32) (result i32)
+  local.get $result
+  i32.load
+)
+
+;; Returns 1 if the product of a and b doesn't fit in an i64.
+(func $sowo_mul_overflows_i64 (param $a i64) (param $b i64) (result i32)
+  local.get $a
+  i64.const -1
+  i64.eq
+  if
+    local.get $b
+    i64.const -9223372036854775808
+    i64.eq
+    return
+  end
+  local.get $a
+  i64.eqz
+  if
+    i32.const 0
+    return
+  end
+  local.get $a
+  local.get $b
+  i64.mul
+  local.get $a
+  i64.div_s
+  local.get $b
+  i64.ne
+)
+
+;; Returns 1 if the product of a and b doesn't fit in an u64.
+(func $sowo_mul_overflows_u64 (param $a i64) (param $b i64) (result i32)
+  local.get $a
+  i64.eqz
+  if
+    i32.const 0
+    return
+  end
+  local.get $a
+  local.get $b
+  i64.mul
+  local.get $a
+  i64.div_u
+  local.get $b
+  i64.ne
+)
+
+;; Returns 2^bits as a float.
+(func $sowo_float_limit (param $bits i32) (result f64)
+  i64.const 1
+  local.get $bits
+  i32.const 1
+  i32.sub
+  i64.extend_i32_u
+  i64.shl
+  f64.convert_i64_u
+  f64.const 2
+  f64.mul
+)
+
+;; Returns 1 if the float truncated toward zero fits in the integer
+;; type of given bits, see sowo_float_to_int in cRuntime.
+(func $sowo_float_fits (param $value f64) (param $bits i32) (param $signed i32) (result i32) (local $limit f64)
+  local.get $signed
+  if (result i32)
+    local.get $bits
+    i32.const 1
+    i32.sub
+    call $sowo_float_limit
+    local.set $limit
+    ;; -limit - 1 rounds to -limit for 64 bits, no double is between them
+    local.get $value
+    local.get $limit
+    f64.neg
+    f64.ge
+    local.get $value
+    local.get $limit
+    f64.neg
+    f64.const 1
+    f64.sub
+    f64.gt
+    i32.or
+    local.get $value
+    local.get $limit
+    f64.lt
+    i32.and
+  else
+    local.get $value
+    f64.const -1
+    f64.gt
+    local.get $value
+    local.get $bits
+    call $sowo_float_limit
+    f64.lt
+    i32.and
+  end
+)
+
+;; Converts a float to an integer type of given bits truncating toward
+;; zero, out of range values saturate and NaN converts to 0.
+(func $sowo_float_to_int (param $value f64) (param $bits i32) (param $signed i32) (result i64) (local $max i64)
+  local.get $value
+  local.get $bits
+  local.get $signed
+  call $sowo_float_fits
+  if
+    local.get $signed
+    if
+      local.get $value
+      i64.trunc_f64_s
+      return
+    end
+    local.get $value
+    i64.trunc_f64_u
+    return
+  end
+  local.get $value
+  local.get $value
+  f64.ne
+  if
+    i64.const 0
+    return
+  end
+  local.get $signed
+  if
+    i64.const 1
+    local.get $bits
+    i32.const 1
+    i32.sub
+    i64.extend_i32_u
+    i64.shl
+    i64.const 1
+    i64.sub
+    local.set $max
+    local.get $value
+    f64.const 0
+    f64.lt
+    if
+      i64.const 0
+      local.get $max
+      i64.sub
+      i64.const 1
+      i64.sub
+      return
+    end
+    local.get $max
+    return
+  end
+  local.get $value
+  f64.const 0
+  f64.lt
+  if
+    i64.const 0
+    return
+  end
+  local.get $bits
+  i32.const 64
+  i32.eq
+  if
+    i64.const -1
+    return
+  end
+  i64.const 1
+  local.get $bits
+  i64.extend_i32_u
+  i64.shl
+  i64.const 1
+  i64.sub
+)
+`
@@ -0,0 +1,1235 @@
+package src
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The WAT validator checks a module in WebAssembly text format without
+// any external tool, so that the modules emitted by the wasm backend are
+// checked offline: every build validates the module before writing it.
+// It follows the validation algorithm of the specification (an operand
+// stack and a stack of control frames) for the subset of the text format
+// the backend emits: module fields in their abbreviated forms and
+// function bodies written as plain instructions, not folded.
+
+// A node of the S-expressions of a module: an atom, a string or a list.
+type watNode struct {
+	atom     string
+	str      []byte
+	isString bool
+	list     []*watNode
+	isList   bool
+	line     int
+}
+
+func (n *watNode) String() string {
+	switch {
+	case n.isList:
+		return "(...)"
+	case n.isString:
+		return strconv.Quote(string(n.str))
+	}
+	return n.atom
+}
+
+// Returns the keyword at the head of a list, if any.
+func (n *watNode) head() string {
+	if n.isList && len(n.list) > 0 && !n.list[0].isList && !n.list[0].isString {
+		return n.list[0].atom
+	}
+	return ""
+}
+
+type watFuncType struct {
+	params  []string
+	results []string
+}
+
+func (t watFuncType) String() string {
+	return fmt.Sprintf("[%s] -> [%s]", strings.Join(t.params, " "), strings.Join(t.results, " "))
+}
+
+func (t watFuncType) equals(other watFuncType) bool {
+	return strings.Join(t.params, " ") == strings.Join(other.params, " ") &&
+		strings.Join(t.results, " ") == strings.Join(other.results, " ")
+}
+
+type watGlobal struct {
+	valueType string
+	mutable   bool
+}
+
+// An index space of a module (functions, types, ...) with the ids
+// naming its entries.
+type watSpace struct {
+	kind  string
+	count int
+	ids   map[string]int
+}
+
+func newWatSpace(kind string) *watSpace {
+	return &watSpace{kind: kind, ids: map[string]int{}}
+}
+
+// Adds an entry, named if id is not empty, returns its index.
+func (s *watSpace) add(id string, line int) (int, error) {
+	if id != "" {
+		if _, ok := s.ids[id]; ok {
+			return 0, fmt.Errorf("line %d: duplicate %s %s", line, s.kind, id)
+		}
+		s.ids[id] = s.count
+	}
+	s.count++
+	return s.count - 1, nil
+}
+
+// Returns the index referred by an id or a number, line locates
+// the reference when the node is missing.
+func (s *watSpace) resolve(node *watNode, line int) (int, error) {
+	if node == nil || node.isList || node.isString {
+		return 0, fmt.Errorf("line %d: expected a %s index", line, s.kind)
+	}
+	if strings.HasPrefix(node.atom, "$") {
+		if index, ok := s.ids[node.atom]; ok {
+			return index, nil
+		}
+		return 0, fmt.Errorf("line %d: unknown %s %s", node.line, s.kind, node.atom)
+	}
+	index, err := strconv.ParseUint(node.atom, 10, 32)
+	if err != nil || int(index) >= s.count {
+		return 0, fmt.Errorf("line %d: unknown %s %s", node.line, s.kind, node.atom)
+	}
+	return int(index), nil
+}
+
+type watModule struct {
+	types     []watFuncType
+	funcs     []watFuncType
+	globals   []watGlobal
+	typeSpace *watSpace
+	funcSpace *watSpace
+	global    *watSpace
+	tables    int
+	tableMin  uint64
+	memories  int
+	memoryMin uint64
+	exports   map[string]bool
+	bodies    []*watNode
+}
+
+// Validates a module in WebAssembly text format.
+func validateWat(source string) error {
+	nodes, err := parseWat(source)
+	if err != nil {
+		return err
+	}
+	if len(nodes) != 1 || nodes[0].head() != "module" {
+		return fmt.Errorf("expected a single module")
+	}
+	m := &watModule{
+		typeSpace: newWatSpace("type"),
+		funcSpace: newWatSpace("function"),
+		global:    newWatSpace("global"),
+		exports:   map[string]bool{},
+	}
+	fields := nodes[0].list[1:]
+	if len(fields) > 0 && !fields[0].isList && strings.HasPrefix(fields[0].atom, "$") {
+		fields = fields[1:]
+	}
+	// Types and definitions are collected first since fields can
+	// refer to the ones that follow them
+	defined := false
+	for _, field := range fields {
+		var err error
+		switch field.head() {
+		case "type":
+			err = m.typeField(field)
+		case "import":
+			if defined {
+				return fmt.Errorf("line %d: import after a definition", field.line)
+			}
+			err = m.importField(field)
+		case "func":
+			defined = true
+			err = m.funcField(field)
+		case "global":
+			defined = true
+			err = m.globalField(field)
+		case "table":
+			defined = true
+			err = m.tableField(field)
+		case "memory":
+			defined = true
+			err = m.memoryField(field)
+		case "export", "elem", "data", "start":
+		default:
+			return fmt.Errorf("line %d: unknown module field %s", field.line, field)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, field := range fields {
+		var err error
+		switch field.head() {
+		case "export":
+			err = m.exportField(field)
+		case "elem":
+			err = m.elemField(field)
+		case "data":
+			err = m.dataField(field)
+		case "start":
+			err = m.startField(field)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	imported := len(m.funcs) - len(m.bodies)
+	for i, body := range m.bodies {
+		if err := m.validateFunction(body, m.funcs[imported+i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parses the S-expressions of a module.
+func parseWat(source string) ([]*watNode, error) {
+	stack := [][]*watNode{nil}
+	starts := []*watNode{nil}
+	line := 1
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], ";;"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "(;"):
+			depth := 0
+			for ; i < len(source); i++ {
+				if strings.HasPrefix(source[i:], "(;") {
+					depth++
+					i++
+				} else if strings.HasPrefix(source[i:], ";)") {
+					depth--
+					i++
+					if depth == 0 {
+						i++
+						break
+					}
+				} else if source[i] == '\n' {
+					line++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+		case c == '(':
+			stack = append(stack, nil)
+			starts = append(starts, &watNode{isList: true, line: line})
+			i++
+		case c == ')':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %d: unexpected )", line)
+			}
+			node := starts[len(starts)-1]
+			node.list = stack[len(stack)-1]
+			stack, starts = stack[:len(stack)-1], starts[:len(starts)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], node)
+			i++
+		case c == '"':
+			value, end, err := parseWatString(source, i)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], &watNode{str: value, isString: true, line: line})
+			i = end
+		default:
+			start := i
+			for i < len(source) && !strings.ContainsRune(" \t\r\n()\";", rune(source[i])) {
+				i++
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], &watNode{atom: source[start:i], line: line})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("line %d: unclosed (", starts[len(starts)-1].line)
+	}
+	return stack[0], nil
+}
+
+// Parses the string starting at the quote, returns its bytes and
+// the position following it.
+func parseWatString(source string, start int) ([]byte, int, error) {
+	var value []byte
+	for i := start + 1; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '"':
+			return value, i + 1, nil
+		case c == '\n':
+			return nil, 0, fmt.Errorf("unterminated string")
+		case c != '\\':
+			value = append(value, c)
+			i++
+		case i+1 >= len(source):
+			return nil, 0, fmt.Errorf("unterminated string")
+		default:
+			escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '"': '"', '\'': '\'', '\\': '\\'}
+			if b, ok := escapes[source[i+1]]; ok {
+				value = append(value, b)
+				i += 2
+			} else if strings.HasPrefix(source[i+1:], "u{") {
+				end := strings.IndexByte(source[i:], '}')
+				if end < 0 {
+					return nil, 0, fmt.Errorf("unterminated string")
+				}
+				code, err := strconv.ParseUint(source[i+3:i+end], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return nil, 0, fmt.Errorf("invalid escape in string")
+				}
+				value = append(value, string(rune(code))...)
+				i += end + 1
+			} else {
+				if i+3 > len(source) {
+					return nil, 0, fmt.Errorf("unterminated string")
+				}
+				b, err := strconv.ParseUint(source[i+1:i+3], 16, 8)
+				if err != nil {
+					return nil, 0, fmt.Errorf("invalid escape in string")
+				}
+				value = append(value, byte(b))
+				i += 3
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("unterminated string")
+}
+
+func isWatValueType(t string) bool {
+	return t == "i32" || t == "i64" || t == "f32" || t == "f64"
+}
+
+// Returns the id at position i of the list of a field, if any,
+// and the position following it.
+func watId(field *watNode, i int) (string, int) {
+	if i < len(field.list) && !field.list[i].isList && strings.HasPrefix(field.list[i].atom, "$") {
+		return field.list[i].atom, i + 1
+	}
+	return "", i
+}
+
+// Parses the params and the results of a function type starting at
+// position i of the list, the params are named in locals when not nil.
+// Returns the position following them.
+func (m *watModule) typeUse(list []*watNode, i int, locals *watSpace) (watFuncType, int, error) {
+	var t watFuncType
+	declared := -1
+	if i < len(list) && list[i].head() == "type" {
+		if len(list[i].list) != 2 {
+			return t, 0, fmt.Errorf("line %d: invalid type use", list[i].line)
+		}
+		index, err := m.typeSpace.resolve(list[i].list[1], list[i].line)
+		if err != nil {
+			return t, 0, err
+		}
+		declared = index
+		i++
+	}
+	explicit := false
+	for ; i < len(list) && (list[i].head() == "param" || list[i].head() == "result"); i++ {
+		explicit = true
+		node := list[i]
+		types := node.list[1:]
+		if node.head() == "param" {
+			if id, _ := watId(node, 1); id != "" {
+				if len(types) != 2 {
+					return t, 0, fmt.Errorf("line %d: a named param has one type", node.line)
+				}
+				if locals != nil {
+					if _, err := locals.add(id, node.line); err != nil {
+						return t, 0, err
+					}
+				}
+				types = types[1:]
+			} else if locals != nil {
+				locals.count += len(types)
+			}
+		}
+		for _, typeNode := range types {
+			if typeNode.isList || !isWatValueType(typeNode.atom) {
+				return t, 0, fmt.Errorf("line %d: invalid value type %s", node.line, typeNode)
+			}
+			if node.head() == "param" {
+				if len(t.results) > 0 {
+					return t, 0, fmt.Errorf("line %d: param after result", node.line)
+				}
+				t.params = append(t.params, typeNode.atom)
+			} else {
+				t.results = append(t.results, typeNode.atom)
+			}
+		}
+	}
+	if declared >= 0 {
+		if explicit && !t.equals(m.types[declared]) {
+			return t, 0, fmt.Errorf("line %d: type %s doesn't match its use %s", list[0].line, m.types[declared], t)
+		}
+		if !explicit && locals != nil {
+			locals.count += len(m.types[declared].params)
+		}
+		t = m.types[declared]
+	}
+	return t, i, nil
+}
+
+func (m *watModule) typeField(field *watNode) error {
+	id, i := watId(field, 1)
+	if i+1 != len(field.list) || field.list[i].head() != "func" {
+		return fmt.Errorf("line %d: invalid type", field.line)
+	}
+	t, end, err := m.typeUse(field.list[i].list, 1, nil)
+	if err != nil {
+		return err
+	}
+	if end != len(field.list[i].list) {
+		return fmt.Errorf("line %d: invalid function type", field.line)
+	}
+	if _, err := m.typeSpace.add(id, field.line); err != nil {
+		return err
+	}
+	m.types = append(m.types, t)
+	return nil
+}
+
+func (m *watModule) importField(field *watNode) error {
+	if len(field.list) != 4 || !field.list[1].isString || !field.list[2].isString || field.list[3].head() != "func" {
+		return fmt.Errorf("line %d: only the import of functions is supported", field.line)
+	}
+	desc := field.list[3]
+	id, i := watId(desc, 1)
+	t, end, err := m.typeUse(desc.list, i, nil)
+	if err != nil {
+		return err
+	}
+	if end != len(desc.list) {
+		return fmt.Errorf("line %d: invalid import", field.line)
+	}
+	if _, err := m.funcSpace.add(id, field.line); err != nil {
+		return err
+	}
+	m.funcs = append(m.funcs, t)
+	return nil
+}
+
+func (m *watModule) funcField(field *watNode) error {
+	id, i := watId(field, 1)
+	for i < len(field.list) && field.list[i].head() == "export" {
+		if err := m.addExport(field.list[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	t, _, err := m.typeUse(field.list, i, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := m.funcSpace.add(id, field.line); err != nil {
+		return err
+	}
+	m.funcs = append(m.funcs, t)
+	m.bodies = append(m.bodies, field)
+	return nil
+}
+
+func (m *watModule) globalField(field *watNode) error {
+	id, i := watId(field, 1)
+	if i+2 != len(field.list) {
+		return fmt.Errorf("line %d: invalid global", field.line)
+	}
+	var global watGlobal
+	typeNode := field.list[i]
+	if typeNode.head() == "mut" && len(typeNode.list) == 2 {
+		global.mutable = true
+		typeNode = typeNode.list[1]
+	}
+	if typeNode.isList || !isWatValueType(typeNode.atom) {
+		return fmt.Errorf("line %d: invalid global type", field.line)
+	}
+	global.valueType = typeNode.atom
+	if err := m.constant(field.list[i+1], global.valueType); err != nil {
+		return err
+	}
+	if _, err := m.global.add(id, field.line); err != nil {
+		return err
+	}
+	m.globals = append(m.globals, global)
+	return nil
+}
+
+// Checks a constant expression written as a folded const instruction,
+// returns its value for the i32 constants.
+func (m *watModule) constant(node *watNode, t string) error {
+	if len(node.list) != 2 || node.head() != t+".const" {
+		return fmt.Errorf("line %d: expected a %s constant", node.line, t)
+	}
+	_, err := parseWatNumber(t, node.list[1])
+	return err
+}
+
+// Parses the limits of a table or a memory at position i.
+func watLimits(field *watNode, i int) (uint64, int, error) {
+	if i >= len(field.list) {
+		return 0, 0, fmt.Errorf("line %d: missing limits", field.line)
+	}
+	minimum, err := strconv.ParseUint(field.list[i].atom, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("line %d: invalid limits", field.line)
+	}
+	i++
+	if i < len(field.list) && !field.list[i].isList {
+		if maximum, err := strconv.ParseUint(field.list[i].atom, 10, 32); err == nil {
+			if maximum < minimum {
+				return 0, 0, fmt.Errorf("line %d: maximum smaller than the minimum", field.line)
+			}
+			i++
+		}
+	}
+	return minimum, i, nil
+}
+
+func (m *watModule) tableField(field *watNode) error {
+	_, i := watId(field, 1)
+	minimum, i, err := watLimits(field, i)
+	if err != nil {
+		return err
+	}
+	if i+1 != len(field.list) || field.list[i].atom != "funcref" {
+		return fmt.Errorf("line %d: only tables of funcref are supported", field.line)
+	}
+	m.tables++
+	m.tableMin = minimum
+	if m.tables > 1 {
+		return fmt.Errorf("line %d: multiple tables", field.line)
+	}
+	return nil
+}
+
+func (m *watModule) memoryField(field *watNode) error {
+	_, i := watId(field, 1)
+	for i < len(field.list) && field.list[i].head() == "export" {
+		if err := m.addExport(field.list[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	minimum, i, err := watLimits(field, i)
+	if err != nil {
+		return err
+	}
+	if i != len(field.list) || minimum > 65536 {
+		return fmt.Errorf("line %d: invalid memory", field.line)
+	}
+	m.memories++
+	m.memoryMin = minimum
+	if m.memories > 1 {
+		return fmt.Errorf("line %d: multiple memories", field.line)
+	}
+	return nil
+}
+
+// Adds the name of an export, names must be unique.
+func (m *watModule) addExport(node *watNode) error {
+	if len(node.list) < 2 || !node.list[1].isString {
+		return fmt.Errorf("line %d: invalid export", node.line)
+	}
+	name := string(node.list[1].str)
+	if m.exports[name] {
+		return fmt.Errorf("line %d: duplicate export %q", node.line, name)
+	}
+	m.exports[name] = true
+	return nil
+}
+
+func (m *watModule) exportField(field *watNode) error {
+	if len(field.list) != 3 || len(field.list[2].list) != 2 {
+		return fmt.Errorf("line %d: invalid export", field.line)
+	}
+	if err := m.addExport(field); err != nil {
+		return err
+	}
+	desc := field.list[2]
+	switch desc.head() {
+	case "func":
+		_, err := m.funcSpace.resolve(desc.list[1], desc.line)
+		return err
+	case "global":
+		_, err := m.global.resolve(desc.list[1], desc.line)
+		return err
+	case "memory":
+		if m.memories == 0 {
+			return fmt.Errorf("line %d: export of a missing memory", field.line)
+		}
+	case "table":
+		if m.tables == 0 {
+			return fmt.Errorf("line %d: export of a missing table", field.line)
+		}
+	default:
+		return fmt.Errorf("line %d: invalid export", field.line)
+	}
+	return nil
+}
+
+func (m *watModule) elemField(field *watNode) error {
+	if m.tables == 0 {
+		return fmt.Errorf("line %d: elements without a table", field.line)
+	}
+	if len(field.list) < 2 {
+		return fmt.Errorf("line %d: invalid elements", field.line)
+	}
+	offset, err := m.offset(field.list[1])
+	if err != nil {
+		return err
+	}
+	funcs := field.list[2:]
+	if len(funcs) > 0 && funcs[0].atom == "func" {
+		funcs = funcs[1:]
+	}
+	for _, f := range funcs {
+		if _, err := m.funcSpace.resolve(f, f.line); err != nil {
+			return err
+		}
+	}
+	if offset+uint64(len(funcs)) > m.tableMin {
+		return fmt.Errorf("line %d: elements out of the table", field.line)
+	}
+	return nil
+}
+
+func (m *watModule) dataField(field *watNode) error {
+	if m.memories == 0 {
+		return fmt.Errorf("line %d: data without a memory", field.line)
+	}
+	if len(field.list) < 2 {
+		return fmt.Errorf("line %d: invalid data", field.line)
+	}
+	offset, err := m.offset(field.list[1])
+	if err != nil {
+		return err
+	}
+	for _, s := range field.list[2:] {
+		if !s.isString {
+			return fmt.Errorf("line %d: invalid data", field.line)
+		}
+		offset += uint64(len(s.str))
+	}
+	if offset > m.memoryMin*65536 {
+		return fmt.Errorf("line %d: data out of the memory", field.line)
+	}
+	return nil
+}
+
+// Returns the offset of elements or data, an i32 constant.
+func (m *watModule) offset(node *watNode) (uint64, error) {
+	if node.head() == "offset" && len(node.list) == 2 {
+		node = node.list[1]
+	}
+	if err := m.constant(node, "i32"); err != nil {
+		return 0, err
+	}
+	value, _ := parseWatNumber("i32", node.list[1])
+	return uint64(uint32(value.(int64))), nil
+}
+
+func (m *watModule) startField(field *watNode) error {
+	if len(field.list) != 2 {
+		return fmt.Errorf("line %d: invalid start", field.line)
+	}
+	index, err := m.funcSpace.resolve(field.list[1], field.line)
+	if err != nil {
+		return err
+	}
+	if t := m.funcs[index]; len(t.params) > 0 || len(t.results) > 0 {
+		return fmt.Errorf("line %d: the start function has type %s", field.line, t)
+	}
+	return nil
+}
+
+// Parses a constant of given type: an int64 holding the bits of the
+// integers or a float64.
+func parseWatNumber(t string, node *watNode) (interface{}, error) {
+	invalid := fmt.Errorf("line %d: invalid %s constant %s", node.line, t, node)
+	if node.isList || node.isString {
+		return nil, invalid
+	}
+	text := strings.ReplaceAll(node.atom, "_", "")
+	if t == "i32" || t == "i64" {
+		bits := 32
+		if t == "i64" {
+			bits = 64
+		}
+		negative := strings.HasPrefix(text, "-")
+		digits := strings.TrimLeft(text, "+-")
+		base := 10
+		if strings.HasPrefix(digits, "0x") {
+			base, digits = 16, digits[2:]
+		}
+		magnitude, err := strconv.ParseUint(digits, base, bits)
+		if err != nil || len(text)-len(digits) > 3 {
+			return nil, invalid
+		}
+		if negative {
+			if magnitude > 1<<(bits-1) {
+				return nil, invalid
+			}
+			return -int64(magnitude), nil
+		}
+		return int64(magnitude), nil
+	}
+	sign := 1.0
+	if strings.HasPrefix(text, "-") {
+		sign = -1
+	}
+	unsigned := strings.TrimLeft(text, "+-")
+	if len(text)-len(unsigned) > 1 {
+		return nil, invalid
+	}
+	switch {
+	case unsigned == "inf":
+		return sign * math.Inf(1), nil
+	case unsigned == "nan" || strings.HasPrefix(unsigned, "nan:0x"):
+		return math.NaN(), nil
+	case strings.HasPrefix(unsigned, "0x") && !strings.ContainsAny(unsigned, "pP"):
+		unsigned += "p0"
+	case strings.ContainsAny(unsigned, "in"):
+		return nil, invalid
+	}
+	bits := 64
+	if t == "f32" {
+		bits = 32
+	}
+	value, err := strconv.ParseFloat(unsigned, bits)
+	if err != nil {
+		return nil, invalid
+	}
+	return sign * value, nil
+}
+
+// A control frame of the validation of a function body.
+type watFrame struct {
+	opcode      string
+	label       string
+	params      []string
+	results     []string
+	height      int
+	unreachable bool
+}
+
+// Returns the types taken by a branch to the frame.
+func (f *watFrame) labelTypes() []string {
+	if f.opcode == "loop" {
+		return f.params
+	}
+	return f.results
+}
+
+// Validation state of a function body.
+type watValidator struct {
+	m      *watModule
+	locals []string
+	local  *watSpace
+	stack  []string
+	frames []*watFrame
+	line   int
+}
+
+// The unknown type of the values of an unreachable stack.
+const watUnknown = ""
+
+func (v *watValidator) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", v.line, fmt.Sprintf(format, args...))
+}
+
+func (v *watValidator) push(types ...string) {
+	v.stack = append(v.stack, types...)
+}
+
+func (v *watValidator) pop(expected string) (string, error) {
+	frame := v.frames[len(v.frames)-1]
+	if len(v.stack) == frame.height {
+		if frame.unreachable {
+			return expected, nil
+		}
+		if expected == watUnknown {
+			return "", v.errorf("missing operand")
+		}
+		return "", v.errorf("missing operand of type %s", expected)
+	}
+	actual := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	if actual != expected && actual != watUnknown && expected != watUnknown {
+		return "", v.errorf("expected an operand of type %s, found %s", expected, actual)
+	}
+	if actual == watUnknown {
+		return expected, nil
+	}
+	return actual, nil
+}
+
+// Pops operands of given types, the last one is on top.
+func (v *watValidator) popTypes(types []string) error {
+	for i := len(types) - 1; i >= 0; i-- {
+		if _, err := v.pop(types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *watValidator) pushFrame(opcode string, label string, params []string, results []string) {
+	v.frames = append(v.frames, &watFrame{opcode: opcode, label: label, params: params, results: results, height: len(v.stack)})
+	v.push(params...)
+}
+
+// Checks that the stack holds the results of the frame at its end.
+func (v *watValidator) endFrame() error {
+	frame := v.frames[len(v.frames)-1]
+	if err := v.popTypes(frame.results); err != nil {
+		return err
+	}
+	if len(v.stack) != frame.height {
+		return v.errorf("%d values left on the stack at the end of the %s", len(v.stack)-frame.height, frame.opcode)
+	}
+	return nil
+}
+
+func (v *watValidator) setUnreachable() {
+	frame := v.frames[len(v.frames)-1]
+	v.stack = v.stack[:frame.height]
+	frame.unreachable = true
+}
+
+// Returns the frame targeted by a branch to a label or a depth.
+func (v *watValidator) branchTarget(node *watNode) (*watFrame, error) {
+	if node == nil || node.isList || node.isString {
+		return nil, v.errorf("expected a label")
+	}
+	if strings.HasPrefix(node.atom, "$") {
+		for i := len(v.frames) - 1; i >= 0; i-- {
+			if v.frames[i].label == node.atom {
+				return v.frames[i], nil
+			}
+		}
+		return nil, v.errorf("unknown label %s", node.atom)
+	}
+	depth, err := strconv.ParseUint(node.atom, 10, 32)
+	if err != nil || int(depth) >= len(v.frames) {
+		return nil, v.errorf("unknown label %s", node.atom)
+	}
+	return v.frames[len(v.frames)-1-int(depth)], nil
+}
+
+// Returns the natural alignment of the memory instructions, in bytes.
+func watMemoryAccess(opcode string) (valueType string, size int, store bool, ok bool) {
+	dot := strings.IndexByte(opcode, '.')
+	if dot < 0 || !isWatValueType(opcode[:dot]) {
+		return "", 0, false, false
+	}
+	valueType = opcode[:dot]
+	op := opcode[dot+1:]
+	size = 4
+	if valueType == "i64" || valueType == "f64" {
+		size = 8
+	}
+	switch op {
+	case "load", "store":
+	case "load8_s", "load8_u", "store8":
+		size = 1
+	case "load16_s", "load16_u", "store16":
+		size = 2
+	case "load32_s", "load32_u", "store32":
+		if valueType != "i64" {
+			return "", 0, false, false
+		}
+		size = 4
+	default:
+		return "", 0, false, false
+	}
+	if size < 4 && valueType[0] == 'f' {
+		return "", 0, false, false
+	}
+	return valueType, size, strings.HasPrefix(op, "store"), true
+}
+
+// Types of the numeric instructions by opcode, built by watNumericOps.
+var watNumeric = watNumericOps()
+
+func watNumericOps() map[string]watFuncType {
+	ops := map[string]watFuncType{}
+	for _, t := range []string{"i32", "i64"} {
+		for _, op := range []string{"clz", "ctz", "popcnt", "extend8_s", "extend16_s"} {
+			ops[t+"."+op] = watFuncType{[]string{t}, []string{t}}
+		}
+		ops[t+".eqz"] = watFuncType{[]string{t}, []string{"i32"}}
+		for _, op := range []string{"add", "sub", "mul", "div_s", "div_u", "rem_s", "rem_u", "and", "or", "xor", "shl", "shr_s", "shr_u", "rotl", "rotr"} {
+			ops[t+"."+op] = watFuncType{[]string{t, t}, []string{t}}
+		}
+		for _, op := range []string{"eq", "ne", "lt_s", "lt_u", "gt_s", "gt_u", "le_s", "le_u", "ge_s", "ge_u"} {
+			ops[t+"."+op] = watFuncType{[]string{t, t}, []string{"i32"}}
+		}
+		for _, f := range []string{"f32", "f64"} {
+			for _, sign := range []string{"s", "u"} {
+				ops[fmt.Sprintf("%s.trunc_%s_%s", t, f, sign)] = watFuncType{[]string{f}, []string{t}}
+				ops[fmt.Sprintf("%s.trunc_sat_%s_%s", t, f, sign)] = watFuncType{[]string{f}, []string{t}}
+				ops[fmt.Sprintf("%s.convert_%s_%s", f, t, sign)] = watFuncType{[]string{t}, []string{f}}
+			}
+		}
+	}
+	for _, t := range []string{"f32", "f64"} {
+		for _, op := range []string{"abs", "neg", "ceil", "floor", "trunc", "nearest", "sqrt"} {
+			ops[t+"."+op] = watFuncType{[]string{t}, []string{t}}
+		}
+		for _, op := range []string{"add", "sub", "mul", "div", "min", "max", "copysign"} {
+			ops[t+"."+op] = watFuncType{[]string{t, t}, []string{t}}
+		}
+		for _, op := range []string{"eq", "ne", "lt", "gt", "le", "ge"} {
+			ops[t+"."+op] = watFuncType{[]string{t, t}, []string{"i32"}}
+		}
+	}
+	ops["i64.extend32_s"] = watFuncType{[]string{"i64"}, []string{"i64"}}
+	ops["i32.wrap_i64"] = watFuncType{[]string{"i64"}, []string{"i32"}}
+	ops["i64.extend_i32_s"] = watFuncType{[]string{"i32"}, []string{"i64"}}
+	ops["i64.extend_i32_u"] = watFuncType{[]string{"i32"}, []string{"i64"}}
+	ops["f32.demote_f64"] = watFuncType{[]string{"f64"}, []string{"f32"}}
+	ops["f64.promote_f32"] = watFuncType{[]string{"f32"}, []string{"f64"}}
+	ops["i32.reinterpret_f32"] = watFuncType{[]string{"f32"}, []string{"i32"}}
+	ops["i64.reinterpret_f64"] = watFuncType{[]string{"f64"}, []string{"i64"}}
+	ops["f32.reinterpret_i32"] = watFuncType{[]string{"i32"}, []string{"f32"}}
+	ops["f64.reinterpret_i64"] = watFuncType{[]string{"i64"}, []string{"f64"}}
+	return ops
+}
+
+// Validates the body of a function of given type.
+func (m *watModule) validateFunction(field *watNode, t watFuncType) error {
+	v := &watValidator{m: m, local: newWatSpace("local"), line: field.line}
+	_, i := watId(field, 1)
+	for i < len(field.list) && field.list[i].head() == "export" {
+		i++
+	}
+	_, i, err := m.typeUse(field.list, i, v.local)
+	if err != nil {
+		return err
+	}
+	v.locals = append(v.locals, t.params...)
+	for ; i < len(field.list) && field.list[i].head() == "local"; i++ {
+		node := field.list[i]
+		types := node.list[1:]
+		if id, _ := watId(node, 1); id != "" {
+			if len(types) != 2 {
+				return fmt.Errorf("line %d: a named local has one type", node.line)
+			}
+			if _, err := v.local.add(id, node.line); err != nil {
+				return err
+			}
+			types = types[1:]
+		} else {
+			v.local.count += len(types)
+		}
+		for _, typeNode := range types {
+			if typeNode.isList || !isWatValueType(typeNode.atom) {
+				return fmt.Errorf("line %d: invalid local type %s", node.line, typeNode)
+			}
+			v.locals = append(v.locals, typeNode.atom)
+		}
+	}
+
+	v.pushFrame("function", "", nil, t.results)
+	body := field.list[i:]
+	for i := 0; i < len(body); i++ {
+		node := body[i]
+		v.line = node.line
+		if node.isList {
+			return v.errorf("folded instructions are not supported")
+		}
+		if node.isString {
+			return v.errorf("unexpected string")
+		}
+		// Returns the next node if it's an atom, used by the immediates
+		next := func() *watNode {
+			if i+1 < len(body) && !body[i+1].isList && !body[i+1].isString {
+				i++
+				return body[i]
+			}
+			return nil
+		}
+		if err := v.instruction(node.atom, next, body, &i); err != nil {
+			return err
+		}
+	}
+	if len(v.frames) != 1 {
+		return v.errorf("%d blocks not closed at the end of the function", len(v.frames)-1)
+	}
+	return v.endFrame()
+}
+
+// Validates an instruction, the immediates following it are read with
+// next and the lists (e.g. block types) with body and i.
+func (v *watValidator) instruction(opcode string, next func() *watNode, body []*watNode, i *int) error {
+	if t, ok := watNumeric[opcode]; ok {
+		if err := v.popTypes(t.params); err != nil {
+			return err
+		}
+		v.push(t.results...)
+		return nil
+	}
+	if valueType, size, store, ok := watMemoryAccess(opcode); ok {
+		if v.m.memories == 0 {
+			return v.errorf("%s without a memory", opcode)
+		}
+		for *i+1 < len(body) && !body[*i+1].isList && strings.Contains(body[*i+1].atom, "=") {
+			arg := next()
+			parts := strings.SplitN(arg.atom, "=", 2)
+			value, err := strconv.ParseUint(parts[1], 0, 32)
+			switch {
+			case err != nil:
+				return v.errorf("invalid memory argument %s", arg.atom)
+			case parts[0] == "align" && (value == 0 || value&(value-1) != 0 || value > uint64(size)):
+				return v.errorf("invalid alignment %s for %s", parts[1], opcode)
+			case parts[0] != "align" && parts[0] != "offset":
+				return v.errorf("invalid memory argument %s", arg.atom)
+			}
+		}
+		if store {
+			if _, err := v.pop(valueType); err != nil {
+				return err
+			}
+			_, err := v.pop("i32")
+			return err
+		}
+		if _, err := v.pop("i32"); err != nil {
+			return err
+		}
+		v.push(valueType)
+		return nil
+	}
+
+	switch opcode {
+	case "i32.const", "i64.const", "f32.const", "f64.const":
+		t := opcode[:3]
+		arg := next()
+		if arg == nil {
+			return v.errorf("missing operand of %s", opcode)
+		}
+		if _, err := parseWatNumber(t, arg); err != nil {
+			return err
+		}
+		v.push(t)
+	case "nop":
+	case "unreachable":
+		v.setUnreachable()
+	case "drop":
+		_, err := v.pop(watUnknown)
+		return err
+	case "select":
+		if _, err := v.pop("i32"); err != nil {
+			return err
+		}
+		first, err := v.pop(watUnknown)
+		if err != nil {
+			return err
+		}
+		second, err := v.pop(first)
+		if err != nil {
+			return err
+		}
+		v.push(second)
+	case "local.get", "local.set", "local.tee":
+		index, err := v.local.resolve(next(), v.line)
+		if err != nil {
+			return err
+		}
+		t := v.locals[index]
+		if opcode != "local.get" {
+			if _, err := v.pop(t); err != nil {
+				return err
+			}
+		}
+		if opcode != "local.set" {
+			v.push(t)
+		}
+	case "global.get", "global.set":
+		index, err := v.m.global.resolve(next(), v.line)
+		if err != nil {
+			return err
+		}
+		global := v.m.globals[index]
+		if opcode == "global.get" {
+			v.push(global.valueType)
+		} else if !global.mutable {
+			return v.errorf("global.set of an immutable global")
+		} else if _, err := v.pop(global.valueType); err != nil {
+			return err
+		}
+	case "memory.size", "memory.grow":
+		if v.m.memories == 0 {
+			return v.errorf("%s without a memory", opcode)
+		}
+		if opcode == "memory.grow" {
+			if _, err := v.pop("i32"); err != nil {
+				return err
+			}
+		}
+		v.push("i32")
+	case "call":
+		index, err := v.m.funcSpace.resolve(next(), v.line)
+		if err != nil {
+			return err
+		}
+		t := v.m.funcs[index]
+		if err := v.popTypes(t.params); err != nil {
+			return err
+		}
+		v.push(t.results...)
+	case "call_indirect":
+		if v.m.tables == 0 {
+			return v.errorf("call_indirect without a table")
+		}
+		t, end, err := v.m.typeUse(body, *i+1, nil)
+		if err != nil {
+			return err
+		}
+		*i = end - 1
+		if _, err := v.pop("i32"); err != nil {
+			return err
+		}
+		if err := v.popTypes(t.params); err != nil {
+			return err
+		}
+		v.push(t.results...)
+	case "block", "loop", "if":
+		label := ""
+		if watIsLabel(body, *i+1) && strings.HasPrefix(body[*i+1].atom, "$") {
+			label = next().atom
+		}
+		t, end, err := v.m.typeUse(body, *i+1, nil)
+		if err != nil {
+			return err
+		}
+		*i = end - 1
+		if opcode == "if" {
+			if _, err := v.pop("i32"); err != nil {
+				return err
+			}
+		}
+		if err := v.popTypes(t.params); err != nil {
+			return err
+		}
+		v.pushFrame(opcode, label, t.params, t.results)
+	case "else":
+		frame := v.frames[len(v.frames)-1]
+		if frame.opcode != "if" {
+			return v.errorf("else without if")
+		}
+		v.skipLabel(next, body, i, frame)
+		if err := v.endFrame(); err != nil {
+			return err
+		}
+		v.frames = v.frames[:len(v.frames)-1]
+		v.pushFrame("else", frame.label, frame.params, frame.results)
+	case "end":
+		frame := v.frames[len(v.frames)-1]
+		v.skipLabel(next, body, i, frame)
+		if err := v.endFrame(); err != nil {
+			return err
+		}
+		if frame.opcode == "if" && strings.Join(frame.params, " ") != strings.Join(frame.results, " ") {
+			return v.errorf("if without else must leave its params on the stack")
+		}
+		v.frames = v.frames[:len(v.frames)-1]
+		if frame.opcode == "function" {
+			return v.errorf("end of the function in its body")
+		}
+		v.push(frame.results...)
+	case "br", "br_if":
+		target, err := v.branchTarget(next())
+		if err != nil {
+			return err
+		}
+		if opcode == "br_if" {
+			if _, err := v.pop("i32"); err != nil {
+				return err
+			}
+		}
+		if err := v.popTypes(target.labelTypes()); err != nil {
+			return err
+		}
+		if opcode == "br" {
+			v.setUnreachable()
+		} else {
+			v.push(target.labelTypes()...)
+		}
+	case "br_table":
+		var targets []*watFrame
+		for watIsLabel(body, *i+1) {
+			target, err := v.branchTarget(next())
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			return v.errorf("br_table without labels")
+		}
+		if _, err := v.pop("i32"); err != nil {
+			return err
+		}
+		arity := len(targets[len(targets)-1].labelTypes())
+		for _, target := range targets {
+			if len(target.labelTypes()) != arity {
+				return v.errorf("labels of br_table with different types")
+			}
+		}
+		if err := v.popTypes(targets[len(targets)-1].labelTypes()); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case "return":
+		if err := v.popTypes(v.frames[0].results); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	default:
+		return v.errorf("unknown instruction %s", opcode)
+	}
+	return nil
+}
+
+// Skips the label repeated after else and end, which must be the
+// label of the block.
+func (v *watValidator) skipLabel(next func() *watNode, body []*watNode, i *int, frame *watFrame) {
+	if watIsLabel(body, *i+1) && frame.label != "" && body[*i+1].atom == frame.label {
+		next()
+	}
+}
+
+// Returns true if the node at position i is a label or a depth.
+func watIsLabel(body []*watNode, i int) bool {
+	if i >= len(body) || body[i].isList || body[i].isString {
+		return false
+	}
+	if strings.HasPrefix(body[i].atom, "$") {
+		return true
+	}
+	_, err := strconv.ParseUint(body[i].atom, 10, 32)
+	return err == nil
+}
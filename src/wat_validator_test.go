@@ -0,0 +1,59 @@
+package src
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The modules emitted for every example must be valid.
+func TestValidateWatExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.sowo"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			options := CompilerOptions{InputFile: file, Target: "wasm"}
+			code := generateWasm(*loadAndCheckProgram(options), options)
+			if err := validateWat(code); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Wraps the instructions in a function returning an i32.
+func watFunction(body string) string {
+	return "(module\n  (func $f (result i32)\n" + body + "\n  )\n)"
+}
+
+func TestValidateWatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+		err    string
+	}{
+		{"valid", watFunction("    i32.const 1\n    i32.const 2\n    i32.add"), ""},
+		{"wrong operand type", watFunction("    i32.const 1\n    i64.const 2\n    i32.add"),
+			"line 5: expected an operand of type i32, found i64"},
+		{"values left", watFunction("    i32.const 1\n    i32.const 2"),
+			"line 4: 1 values left on the stack at the end of the function"},
+		{"missing operand", watFunction("    i32.const 1\n    i32.add"),
+			"line 4: missing operand of type i32"},
+		{"unknown function", watFunction("    call $missing"),
+			"line 3: unknown function $missing"},
+		{"unknown instruction", watFunction("    i32.frobnicate"),
+			"line 3: unknown instruction i32.frobnicate"},
+	}
+	for _, test := range tests {
+		err := validateWat(test.module)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,1317 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// The x86-64 backend emits GNU assembler code for Linux from the type
+// checked tree. Functions follow the System V calling convention, so
+// they can call the C library and the runtime library (see cRuntime)
+// linked with the program, except for the receiver of methods that is
+// always passed in %rdi so that methods can be called through vtables.
+//
+// Every value is a 64 bits word: integers are sign or zero extended
+// from the bits of their type, f32 values hold the bits of a float in
+// the low half and f64 values the bits of a double. Strings are C
+// strings, pointers are addresses and the other compound values are
+// addresses of blocks allocated with sowo_alloc:
+//   - slices: the length and the address of the elements
+//   - function values: the address of the code followed by the captured
+//     variables, the code gets the block in %r10 (the static chain)
+//   - interface values: the value and the address of the vtable
+//   - results: the ok flag, the value and the error
+//
+// Local variables live in the stack frame, expressions are evaluated
+// in %rax and the intermediate values are pushed on the stack.
+type asmGenerator struct {
+	text    strings.Builder
+	data    strings.Builder
+	rodata  strings.Builder
+	strings map[string]string
+	labels  int
+	checked bool
+	// Source file of every module by module name.
+	sourceFiles map[string]string
+	funcDefs    map[string]*Ast
+	// Functions emitted or waiting to be emitted by name.
+	functions map[string]bool
+	pending   []asmFunctionDef
+	vtables   map[string]string
+	funcRefs  map[string]string
+
+	// State of the function being emitted.
+	out    strings.Builder
+	scopes []map[string]int
+	// Locals whose address is taken, their slot holds a cell (see irBoxed).
+	boxed map[string]bool
+	frame int
+	// Words pushed on the stack by the expression being evaluated,
+	// used to align the stack before calls.
+	depth       int
+	file        string
+	returnLabel string
+	returnType  TypeAnnotation
+}
+
+// A function to emit: a function, a method, an instance of a generic
+// function or a function literal getting its captures in %r10.
+type asmFunctionDef struct {
+	name     string
+	def      *Ast
+	method   bool
+	captures []*Ast
+	file     string
+}
+
+// Classes of the System V calling convention for sowo values.
+type asmClass int
+
+const (
+	asmClassInteger asmClass = iota
+	asmClassF32
+	asmClassF64
+)
+
+var asmIntegerRegisters = []string{"%rdi", "%rsi", "%rdx", "%rcx", "%r8", "%r9"}
+
+// Number of xmm registers used for arguments.
+const asmFloatRegisters = 8
+
+func asmClassOf(t TypeAnnotation) asmClass {
+	switch t {
+	case TypeF32:
+		return asmClassF32
+	case TypeF64:
+		return asmClassF64
+	}
+	return asmClassInteger
+}
+
+// Generates x86-64 assembly, assembled and linked with the runtime
+// library by the C compiler.
+type x86_64Backend struct{}
+
+func (x86_64Backend) Name() string      { return "x86_64" }
+func (x86_64Backend) Extension() string { return ".s" }
+
+func (x86_64Backend) Emit(program Ast, options CompilerOptions) ([]byte, error) {
+	return []byte(generateAsm(program, options)), nil
+}
+
+func (x86_64Backend) BuildExecutable(sourceFile string, exeFile string, options CompilerOptions) error {
+	return compileWithRuntime([]string{sourceFile}, exeFile, options)
+}
+
+// Returns the GNU assembler code of a type checked program.
+func generateAsm(ast Ast, options CompilerOptions) string {
+	if ast.Type != AstProgram {
+		log.Fatalf("[Asm]: Unsupported top level %s", ast.Type)
+	}
+	a := &asmGenerator{
+		strings:     map[string]string{},
+		checked:     !options.Unchecked,
+		sourceFiles: map[string]string{},
+		funcDefs:    map[string]*Ast{},
+		functions:   map[string]bool{},
+		vtables:     map[string]string{},
+		funcRefs:    map[string]string{},
+	}
+	for _, module := range ast.Children {
+		a.sourceFiles[module.Name] = module.StringDataValue
+		for _, def := range module.Children {
+			switch def.Type {
+			case AstFunction:
+				a.funcDefs[irSymbolName(def.Module, def.Name)] = def
+			case AstMethod:
+				a.funcDefs[irMethodName(def.Module, methodReceiverType(def), def.Name)] = def
+			}
+		}
+	}
+
+	a.globals(ast)
+	entryModule := ast.Children[len(ast.Children)-1]
+	mainName := irSymbolName(entryModule.Name, "main")
+	main := a.funcDefs[mainName]
+	a.main(mainName, main)
+	for _, module := range ast.Children {
+		for _, def := range module.Children {
+			switch {
+			case def.Type == AstFunction && funcTypeParams(def) == nil:
+				a.function(irSymbolName(def.Module, def.Name), def, false)
+			case def.Type == AstMethod:
+				a.function(irMethodName(def.Module, methodReceiverType(def), def.Name), def, true)
+			}
+		}
+	}
+	for len(a.pending) > 0 {
+		next := a.pending[0]
+		a.pending = a.pending[1:]
+		a.emitFunction(next)
+	}
+
+	var value strings.Builder
+	value.WriteString("\t.text\n")
+	value.WriteString(a.text.String())
+	value.WriteString("\t.data\n")
+	value.WriteString(a.data.String())
+	value.WriteString("\t.section .rodata\n")
+	value.WriteString(a.rodata.String())
+	value.WriteString("\t.section .note.GNU-stack,\"\",@progbits\n")
+	return value.String()
+}
+
+// Requests a function to be emitted, once.
+func (a *asmGenerator) function(name string, def *Ast, method bool) {
+	if !a.functions[name] {
+		a.functions[name] = true
+		a.pending = append(a.pending, asmFunctionDef{name: name, def: def, method: method, file: a.sourceFiles[def.Module]})
+	}
+}
+
+// Emits the globals and the function initialising them in the order
+// they are declared, before that they hold the zero value of their type.
+// The globals holding references are roots of the garbage collector.
+func (a *asmGenerator) globals(ast Ast) {
+	a.startFunction(TypeVoid)
+	for _, module := range ast.Children {
+		a.file = module.StringDataValue
+		for _, def := range module.Children {
+			if def.Type != AstGlobalVariable && def.Type != AstGlobalConstant {
+				continue
+			}
+			name := irSymbolName(def.Module, def.Name)
+			varType := def.Children[0].Children[0].DataType
+			zero := "0"
+			if varType == TypeString {
+				zero = a.stringLabel("")
+			}
+			fmt.Fprintf(&a.data, "%s:\n\t.quad %s\n", name, zero)
+			a.expression(def.Children[1])
+			a.emit("movq %%rax, %s(%%rip)", name)
+			if holdsReference(varType) {
+				a.emit("leaq %s(%%rip), %%rdi", name)
+				a.emit("movl $8, %%esi")
+				a.callAligned("sowo_gc_add_root")
+			}
+		}
+	}
+	a.endFunction("sowo_init_globals")
+}
+
+// Emits the C entry point calling the sowo main, see irMain.
+func (a *asmGenerator) main(name string, def *Ast) {
+	a.startFunction(TypeInteger)
+	argc, argv := a.declareLocal("argc"), a.declareLocal("argv")
+	a.emit("movq %%rdi, %d(%%rbp)", argc)
+	a.emit("movq %%rsi, %d(%%rbp)", argv)
+	a.emit("movq %%rbp, %%rdi")
+	a.callAligned("sowo_gc_init")
+	a.callAligned("sowo_init_globals")
+	if len(def.Children[0].Children) == 1 {
+		a.emit("movl %d(%%rbp), %%edi", argc)
+		a.emit("movq %d(%%rbp), %%rsi", argv)
+		a.callAligned("sowo_args")
+		a.emit("movq %%rax, %%rcx")
+		a.allocBlock(2)
+		a.emit("movq %%rcx, (%%rax)")
+		a.emit("movq %%rdx, 8(%%rax)")
+		a.emit("movq %%rax, %%rdi")
+	}
+	a.callAligned(name)
+	a.function(name, def, false)
+
+	returnType := def.Children[1].Children[0].DataType
+	if isResultType(returnType) {
+		valueType, errorType := resultTypes(returnType)
+		ok := a.label()
+		a.emit("testq %%rax, %%rax")
+		failed := a.label()
+		a.emit("jz %s", failed)
+		a.emit("cmpq $0, (%%rax)")
+		a.emit("jne %s", ok)
+		a.placeLabel(failed)
+		a.emit("movq %%rax, %%rbx")
+		a.emit("movq stderr(%%rip), %%rdi")
+		a.emit("leaq %s(%%rip), %%rsi", a.stringLabel("error: "+asmPrintFormat(errorType)+"\n"))
+		a.emit("xorl %%edx, %%edx")
+		a.emit("testq %%rbx, %%rbx")
+		noError := a.label()
+		a.emit("jz %s", noError)
+		a.emit("movq 16(%%rbx), %%rdx")
+		a.placeLabel(noError)
+		a.printArgument(errorType, "%rdx", "%rdx")
+		a.callAligned("fprintf")
+		a.emit("movl $1, %%eax")
+		a.emit("jmp %s", a.returnLabel)
+		a.placeLabel(ok)
+		if valueType == TypeVoid {
+			a.emit("xorl %%eax, %%eax")
+		} else {
+			a.emit("movq 8(%%rax), %%rax")
+		}
+	} else if returnType == TypeVoid {
+		a.emit("xorl %%eax, %%eax")
+	}
+	a.emit("movl %%eax, %%eax")
+	a.endFunction("main")
+	fmt.Fprintf(&a.text, "\t.globl main\n")
+}
+
+func (a *asmGenerator) startFunction(returnType TypeAnnotation) {
+	a.out.Reset()
+	a.scopes = []map[string]int{{}}
+	a.boxed = map[string]bool{}
+	a.frame = 0
+	a.depth = 0
+	a.returnType = returnType
+	a.returnLabel = a.label()
+	// Saved registers, used by the entry point
+	a.frame = 16
+}
+
+// Appends the function to the text with its prologue and epilogue, the
+// size of the frame is known only once the body is emitted.
+func (a *asmGenerator) endFunction(name string) {
+	frame := (a.frame + 15) &^ 15
+	fmt.Fprintf(&a.text, "%s:\n", name)
+	fmt.Fprintf(&a.text, "\tpushq %%rbp\n\tmovq %%rsp, %%rbp\n\tsubq $%d, %%rsp\n", frame)
+	fmt.Fprintf(&a.text, "\tmovq %%rbx, -8(%%rbp)\n\tmovq %%r12, -16(%%rbp)\n")
+	a.text.WriteString(a.out.String())
+	fmt.Fprintf(&a.text, "%s:\n", a.returnLabel)
+	switch asmClassOf(a.returnType) {
+	case asmClassF32:
+		fmt.Fprintf(&a.text, "\tmovd %%eax, %%xmm0\n")
+	case asmClassF64:
+		fmt.Fprintf(&a.text, "\tmovq %%rax, %%xmm0\n")
+	}
+	fmt.Fprintf(&a.text, "\tmovq -8(%%rbp), %%rbx\n\tmovq -16(%%rbp), %%r12\n\tleave\n\tret\n")
+}
+
+func (a *asmGenerator) emitFunction(fn asmFunctionDef) {
+	a.startFunction(fn.def.Children[1].Children[0].DataType)
+	a.file = fn.file
+	irAddressTaken(fn.def.Children[2], a.boxed)
+	if len(fn.captures) > 0 {
+		// The closure block is in %r10, the captures follow the code
+		a.emit("movq %%r10, %%r11")
+		for i, capture := range fn.captures {
+			slot := a.declareLocal(capture.Name)
+			a.emit("movq %d(%%r11), %%rax", 8*(i+1))
+			a.emit("movq %%rax, %d(%%rbp)", slot)
+		}
+	}
+	var classes []asmClass
+	for i, param := range fn.def.Children[0].Children {
+		class := asmClassOf(param.Children[0].DataType)
+		if fn.method && i == 0 {
+			class = asmClassInteger
+		}
+		classes = append(classes, class)
+	}
+	locations := asmArgumentLocations(classes)
+	for i, param := range fn.def.Children[0].Children {
+		slot := a.declareLocal(param.Name)
+		switch location := locations[i]; {
+		case strings.HasPrefix(location, "%xmm") && classes[i] == asmClassF32:
+			a.emit("movd %s, %%eax", location)
+			a.emit("movq %%rax, %d(%%rbp)", slot)
+		case strings.HasPrefix(location, "%xmm"):
+			a.emit("movq %s, %d(%%rbp)", location, slot)
+		case strings.HasPrefix(location, "%"):
+			a.emit("movq %s, %d(%%rbp)", location, slot)
+		default:
+			// Passed on the stack, above the return address
+			a.emit("movq %s(%%rbp), %%rax", location)
+			a.emit("movq %%rax, %d(%%rbp)", slot)
+		}
+	}
+	// Once every argument is read, allocating the cells clobbers them
+	a.boxLocals(fn.captures)
+	a.boxLocals(fn.def.Children[0].Children)
+	a.block(fn.def.Children[2])
+	a.emit("xorl %%eax, %%eax")
+	a.endFunction(fn.name)
+}
+
+// Returns where the arguments of given classes are passed: a register
+// or the offset from the frame pointer of the callee for the arguments
+// passed on the stack.
+func asmArgumentLocations(classes []asmClass) []string {
+	var locations []string
+	integers, floats, stack := 0, 0, 0
+	for _, class := range classes {
+		switch {
+		case class == asmClassInteger && integers < len(asmIntegerRegisters):
+			locations = append(locations, asmIntegerRegisters[integers])
+			integers++
+		case class != asmClassInteger && floats < asmFloatRegisters:
+			locations = append(locations, fmt.Sprintf("%%xmm%d", floats))
+			floats++
+		default:
+			locations = append(locations, fmt.Sprint(16+8*stack))
+			stack++
+		}
+	}
+	return locations
+}
+
+func (a *asmGenerator) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&a.out, "\t"+format+"\n", args...)
+}
+
+func (a *asmGenerator) label() string {
+	a.labels++
+	return fmt.Sprintf(".L%d", a.labels)
+}
+
+func (a *asmGenerator) placeLabel(label string) {
+	fmt.Fprintf(&a.out, "%s:\n", label)
+}
+
+// Returns the label of a string constant in the read only data.
+func (a *asmGenerator) stringLabel(s string) string {
+	label, ok := a.strings[s]
+	if !ok {
+		label = fmt.Sprintf(".Lstr%d", len(a.strings))
+		a.strings[s] = label
+		fmt.Fprintf(&a.rodata, "%s:\n\t.string %s\n", label, irStringLiteral(s))
+	}
+	return label
+}
+
+func (a *asmGenerator) push() {
+	a.emit("pushq %%rax")
+	a.depth++
+}
+
+func (a *asmGenerator) pop(register string) {
+	a.emit("popq %s", register)
+	a.depth--
+}
+
+// Calls a function whose arguments are already in the registers,
+// aligning the stack to 16 bytes as required by the convention.
+func (a *asmGenerator) callAligned(target string) {
+	if a.depth%2 == 1 {
+		a.emit("subq $8, %%rsp")
+	}
+	a.emit("call %s", target)
+	if a.depth%2 == 1 {
+		a.emit("addq $8, %%rsp")
+	}
+}
+
+// Calls a function with the arguments pushed on the stack, the first
+// one pushed first. The call instruction is emitted by call once the
+// arguments are in place. The result is left in %rax.
+func (a *asmGenerator) callPushed(classes []asmClass, variadic bool, returnType TypeAnnotation, call func()) {
+	n := len(classes)
+	locations := asmArgumentLocations(classes)
+	var stack []int
+	for i, location := range locations {
+		if !strings.HasPrefix(location, "%") {
+			stack = append(stack, i)
+		}
+	}
+	padding := (a.depth + len(stack)) % 2
+	if padding == 1 {
+		a.emit("subq $8, %%rsp")
+	}
+	// The argument i is at 8*(n-1-i) from the stack pointer before
+	// pushing the arguments passed on the stack
+	for j := len(stack) - 1; j >= 0; j-- {
+		pushed := len(stack) - 1 - j
+		a.emit("pushq %d(%%rsp)", 8*(n-1-stack[j]+padding+pushed))
+	}
+	for i, location := range locations {
+		offset := 8 * (n - 1 - i + padding + len(stack))
+		switch {
+		case strings.HasPrefix(location, "%xmm"):
+			a.emit("movq %d(%%rsp), %s", offset, location)
+		case strings.HasPrefix(location, "%"):
+			a.emit("movq %d(%%rsp), %s", offset, location)
+		}
+	}
+	if variadic {
+		floats := 0
+		for _, class := range classes {
+			if class != asmClassInteger {
+				floats++
+			}
+		}
+		a.emit("movl $%d, %%eax", floats)
+	}
+	call()
+	a.emit("addq $%d, %%rsp", 8*(n+padding+len(stack)))
+	a.depth -= n
+	switch asmClassOf(returnType) {
+	case asmClassF32:
+		a.emit("movd %%xmm0, %%eax")
+	case asmClassF64:
+		a.emit("movq %%xmm0, %%rax")
+	default:
+		a.normalize(returnType)
+	}
+}
+
+// Extends the value in %rax from the bits of its type, the C functions
+// only set the bits of their return type.
+func (a *asmGenerator) normalize(t TypeAnnotation) {
+	switch t {
+	case TypeInteger, TypeBoolean, TypeI32:
+		a.emit("movslq %%eax, %%rax")
+	case TypeI8, TypeChar:
+		a.emit("movsbq %%al, %%rax")
+	case TypeI16:
+		a.emit("movswq %%ax, %%rax")
+	case TypeU8:
+		a.emit("movzbq %%al, %%rax")
+	case TypeU16:
+		a.emit("movzwq %%ax, %%rax")
+	case TypeU32, TypeF32:
+		a.emit("movl %%eax, %%eax")
+	}
+}
+
+// Allocates a zeroed block of given number of words, the address is
+// left in %rax. %rcx and %rdx are preserved.
+func (a *asmGenerator) allocBlock(words int) {
+	a.emit("movq %%rcx, %%rbx")
+	a.emit("movq %%rdx, %%r12")
+	a.emit("movl $%d, %%edi", 8*words)
+	a.callAligned("sowo_alloc")
+	a.emit("movq %%rbx, %%rcx")
+	a.emit("movq %%r12, %%rdx")
+}
+
+// Stops the program reporting the failed operation, up to two
+// integer arguments of the message are taken from %r8 and %r9.
+func (a *asmGenerator) panicAt(ast *Ast, message string) {
+	a.emit("leaq %s(%%rip), %%rdi", a.stringLabel(a.file))
+	a.emit("movl $%d, %%esi", ast.Line)
+	a.emit("movl $%d, %%edx", ast.Col)
+	a.emit("leaq %s(%%rip), %%rcx", a.stringLabel(message))
+	a.emit("andq $-16, %%rsp")
+	a.emit("xorl %%eax, %%eax")
+	a.emit("call sowo_panic")
+}
+
+func (a *asmGenerator) declareLocal(name string) int {
+	a.frame += 8
+	a.scopes[len(a.scopes)-1][name] = -a.frame
+	return -a.frame
+}
+
+// Moves the value of the locals whose address is taken to a new cell,
+// their slot holds the cell then.
+func (a *asmGenerator) boxLocals(locals []*Ast) {
+	for _, local := range locals {
+		if slot, ok := a.cell("", local.Name); ok {
+			a.emit("movq %d(%%rbp), %%rcx", slot)
+			a.allocBlock(1)
+			a.emit("movq %%rcx, (%%rax)")
+			a.emit("movq %%rax, %d(%%rbp)", slot)
+		}
+	}
+}
+
+// Returns the slot holding the cell of a local whose address is taken.
+func (a *asmGenerator) cell(module string, name string) (int, bool) {
+	if module != "" || !a.boxed[name] {
+		return 0, false
+	}
+	for i := len(a.scopes) - 1; i >= 0; i-- {
+		if slot, ok := a.scopes[i][name]; ok {
+			return slot, true
+		}
+	}
+	return 0, false
+}
+
+// Loads the value of a variable, a local or a global, in the register.
+func (a *asmGenerator) loadVariable(module string, name string, register string) {
+	if slot, ok := a.cell(module, name); ok {
+		a.emit("movq %d(%%rbp), %s", slot, register)
+		a.emit("movq (%s), %s", register, register)
+		return
+	}
+	a.emit("movq %s, %s", a.variable(module, name), register)
+}
+
+// Returns the operand addressing a variable, a local or a global.
+func (a *asmGenerator) variable(module string, name string) string {
+	if module == "" {
+		for i := len(a.scopes) - 1; i >= 0; i-- {
+			if slot, ok := a.scopes[i][name]; ok {
+				return fmt.Sprintf("%d(%%rbp)", slot)
+			}
+		}
+	}
+	return irSymbolName(module, name) + "(%rip)"
+}
+
+func (a *asmGenerator) block(ast *Ast) {
+	a.scopes = append(a.scopes, map[string]int{})
+	defer func() { a.scopes = a.scopes[:len(a.scopes)-1] }()
+
+	for _, statement := range ast.Children {
+		switch statement.Type {
+		case AstLocalVariable:
+			a.expression(statement.Children[1])
+			a.emit("movq %%rax, %d(%%rbp)", a.declareLocal(statement.Children[0].Name))
+			a.boxLocals(statement.Children[:1])
+		case AstAssignment:
+			a.expression(statement.Children[0])
+			if slot, ok := a.cell(statement.Module, statement.Name); ok {
+				a.emit("movq %d(%%rbp), %%rcx", slot)
+				a.emit("movq %%rax, (%%rcx)")
+			} else {
+				a.emit("movq %%rax, %s", a.variable(statement.Module, statement.Name))
+			}
+		case AstDerefAssignment:
+			a.expression(statement.Children[0])
+			a.push()
+			a.expression(statement.Children[1])
+			a.pop("%rcx")
+			a.nilCheck("%rcx", statement, "nil pointer dereference")
+			a.emit("movq %%rax, (%%rcx)")
+		case AstIf:
+			a.expression(statement.Children[0])
+			elseLabel, endLabel := a.label(), a.label()
+			a.emit("testq %%rax, %%rax")
+			a.emit("jz %s", elseLabel)
+			a.block(statement.Children[1])
+			a.emit("jmp %s", endLabel)
+			a.placeLabel(elseLabel)
+			if len(statement.Children) == 3 {
+				a.block(statement.Children[2])
+			}
+			a.placeLabel(endLabel)
+		case AstWhile:
+			startLabel, endLabel := a.label(), a.label()
+			a.placeLabel(startLabel)
+			a.expression(statement.Children[0])
+			a.emit("testq %%rax, %%rax")
+			a.emit("jz %s", endLabel)
+			a.block(statement.Children[1])
+			a.emit("jmp %s", startLabel)
+			a.placeLabel(endLabel)
+		case AstReturn:
+			a.expression(statement.Children[0])
+			a.emit("jmp %s", a.returnLabel)
+		case AstFuncCall, AstClosureCall, AstMethodCall, AstTry:
+			a.expression(statement)
+		case AstPrint:
+			a.print(statement)
+		default:
+			log.Fatalf("[Asm]: Unsupported statement %s", statement.Type)
+		}
+	}
+}
+
+// Returns the printf placeholder of a value of given type, see irPrintFormat.
+func asmPrintFormat(t TypeAnnotation) string {
+	switch t {
+	case TypeInteger, TypeBoolean:
+		return "%d"
+	case TypeI8, TypeI16, TypeI32, TypeI64:
+		return "%lld"
+	case TypeU8, TypeU16, TypeU32, TypeU64:
+		return "%llu"
+	case TypeF32, TypeF64:
+		return "%g"
+	case TypeChar:
+		return "%c"
+	case TypeString:
+		return "%s"
+	}
+	log.Fatalf("[Asm]: Unsupported parameter %s", t)
+	return ""
+}
+
+// Moves a value to the register printf reads it from, floats are
+// passed as doubles in %xmm0. Returns the number of xmm registers used.
+func (a *asmGenerator) printArgument(t TypeAnnotation, value string, register string) int {
+	switch t {
+	case TypeF32:
+		a.emit("movd %s, %%xmm0", strings.Replace(value, "%r", "%e", 1))
+		a.emit("cvtss2sd %%xmm0, %%xmm0")
+	case TypeF64:
+		a.emit("movq %s, %%xmm0", value)
+	default:
+		if value != register {
+			a.emit("movq %s, %s", value, register)
+		}
+		a.emit("xorl %%eax, %%eax")
+		return 0
+	}
+	a.emit("movl $1, %%eax")
+	return 1
+}
+
+// Prints the values separated by spaces, all the values are
+// evaluated before printing as for the C backend.
+func (a *asmGenerator) print(ast *Ast) {
+	for _, param := range ast.Children {
+		a.expression(param)
+		a.push()
+	}
+	n := len(ast.Children)
+	for i, param := range ast.Children {
+		// The stack is aligned before loading the value
+		aligned := a.depth%2 == 1
+		offset := 8 * (n - 1 - i)
+		if aligned {
+			a.emit("subq $8, %%rsp")
+			offset += 8
+		}
+		a.emit("leaq %s(%%rip), %%rdi", a.stringLabel(asmPrintFormat(param.DataType)+" "))
+		a.emit("movq %d(%%rsp), %%rsi", offset)
+		a.printArgument(param.DataType, "%rsi", "%rsi")
+		a.emit("call printf")
+		if aligned {
+			a.emit("addq $8, %%rsp")
+		}
+	}
+	if n > 0 {
+		a.emit("addq $%d, %%rsp", 8*n)
+		a.depth -= n
+	}
+	a.emit("movl $10, %%edi")
+	a.callAligned("putchar")
+}
+
+// Evaluates the expression, the value is left in %rax.
+func (a *asmGenerator) expression(ast *Ast) {
+	switch ast.Type {
+	case AstNumberLiteral:
+		switch ast.DataType {
+		case TypeF32:
+			a.emit("movl $%d, %%eax", math.Float32bits(float32(ast.NumberDataValue)))
+		case TypeF64:
+			a.emit("movabsq $%d, %%rax", int64(math.Float64bits(float64(ast.NumberDataValue))))
+		default:
+			a.emit("movabsq $%d, %%rax", ast.NumberDataValue)
+			a.normalize(ast.DataType)
+		}
+	case AstFloatLiteral:
+		if ast.DataType == TypeF32 {
+			a.emit("movl $%d, %%eax", math.Float32bits(float32(ast.FloatDataValue)))
+		} else {
+			a.emit("movabsq $%d, %%rax", int64(math.Float64bits(ast.FloatDataValue)))
+		}
+	case AstBooleanLiteral:
+		if ast.BooleanDataValue {
+			a.emit("movl $1, %%eax")
+		} else {
+			a.emit("xorl %%eax, %%eax")
+		}
+	case AstStringLiteral:
+		a.emit("leaq %s(%%rip), %%rax", a.stringLabel(ast.StringDataValue))
+	case AstCharLiteral:
+		a.emit("movq $%d, %%rax", int8(ast.CharDataValue))
+	case AstBinaryOp:
+		a.binaryOp(ast)
+	case AstVariableRef:
+		a.loadVariable(ast.Module, ast.Name, "%rax")
+	case AstFuncCall:
+		a.funcCall(ast)
+	case AstFuncRef:
+		a.emit("leaq %s(%%rip), %%rax", a.funcRef(ast))
+	case AstFuncLiteral:
+		a.funcLiteral(ast)
+	case AstClosureCall:
+		// The callee is evaluated first and stays below the arguments
+		a.expression(ast.Children[0])
+		a.push()
+		var classes []asmClass
+		for _, arg := range ast.Children[1:] {
+			a.expression(arg)
+			a.push()
+			classes = append(classes, asmClassOf(arg.DataType))
+		}
+		a.emit("movq %d(%%rsp), %%r10", 8*len(classes))
+		a.nilCheck("%r10", ast, "call of nil function")
+		a.callPushed(classes, false, ast.DataType, func() { a.emit("call *(%%r10)") })
+		a.pop("%rcx")
+	case AstMethodCall:
+		a.methodCall(ast)
+	case AstInterfaceValue:
+		a.expression(ast.Children[0])
+		a.emit("movq %%rax, %%rcx")
+		a.allocBlock(2)
+		a.emit("movq %%rcx, (%%rax)")
+		a.emit("leaq %s(%%rip), %%rcx", a.vtable(ast.DataType, ast.Children[0].DataType, ast.Children[1:]))
+		a.emit("movq %%rcx, 8(%%rax)")
+	case AstResultOk, AstResultErr:
+		a.emit("xorl %%ecx, %%ecx")
+		if len(ast.Children) > 0 {
+			a.expression(ast.Children[0])
+			a.emit("movq %%rax, %%rcx")
+		}
+		a.allocBlock(3)
+		if ast.Type == AstResultOk {
+			a.emit("movq $1, (%%rax)")
+			a.emit("movq %%rcx, 8(%%rax)")
+		} else {
+			a.emit("movq %%rcx, 16(%%rax)")
+		}
+	case AstTry:
+		// Failed results are returned as they are, they have the
+		// same layout whatever their value type
+		a.expression(ast.Children[0])
+		a.emit("testq %%rax, %%rax")
+		a.emit("jz %s", a.returnLabel)
+		a.emit("cmpq $0, (%%rax)")
+		a.emit("je %s", a.returnLabel)
+		a.emit("movq 8(%%rax), %%rax")
+	case AstConversion:
+		a.expression(ast.Children[0])
+		a.conversion(ast)
+	case AstNew:
+		if ast.Children[0].DataType == TypeString {
+			a.callAligned("sowo_new_str")
+		} else {
+			a.allocBlock(1)
+		}
+	case AstAddressOf:
+		target := ast.Children[0]
+		if target.Type == AstDereference {
+			a.expression(target.Children[0])
+		} else if slot, ok := a.cell(target.Module, target.Name); ok {
+			a.emit("movq %d(%%rbp), %%rax", slot)
+		} else {
+			a.emit("leaq %s, %%rax", a.variable(target.Module, target.Name))
+		}
+	case AstDereference:
+		a.expression(ast.Children[0])
+		a.nilCheck("%rax", ast, "nil pointer dereference")
+		a.emit("movq (%%rax), %%rax")
+	case AstIndex:
+		a.index(ast)
+	case AstSlice:
+		a.expression(ast.Children[0])
+		a.push()
+		if ast.Children[1].Type != AstNoop {
+			a.expression(ast.Children[1])
+		} else {
+			a.emit("xorl %%eax, %%eax")
+		}
+		a.push()
+		classes := []asmClass{asmClassInteger, asmClassInteger}
+		target := "sowo_str_suffix"
+		if ast.Children[2].Type != AstNoop {
+			a.expression(ast.Children[2])
+			a.push()
+			classes = append(classes, asmClassInteger)
+			target = "sowo_str_slice"
+		}
+		classes = append(classes, a.pushLocation(ast)...)
+		a.callPushed(classes, false, TypeString, func() { a.emit("call %s", target) })
+	default:
+		log.Fatalf("[Asm]: Unsupported expression %s", ast.Type)
+	}
+}
+
+// Pushes the arguments locating the node, taken by the runtime
+// functions that can fail.
+func (a *asmGenerator) pushLocation(ast *Ast) []asmClass {
+	a.emit("leaq %s(%%rip), %%rax", a.stringLabel(a.file))
+	a.push()
+	a.emit("movq $%d, %%rax", ast.Line)
+	a.push()
+	a.emit("movq $%d, %%rax", ast.Col)
+	a.push()
+	return []asmClass{asmClassInteger, asmClassInteger, asmClassInteger}
+}
+
+func (a *asmGenerator) nilCheck(register string, ast *Ast, message string) {
+	if !a.checked {
+		return
+	}
+	ok := a.label()
+	a.emit("testq %s, %s", register, register)
+	a.emit("jnz %s", ok)
+	a.panicAt(ast, message)
+	a.placeLabel(ok)
+}
+
+func (a *asmGenerator) binaryOp(ast *Ast) {
+	t := ast.Children[0].DataType
+	a.expression(ast.Children[0])
+	a.push()
+	a.expression(ast.Children[1])
+	a.emit("movq %%rax, %%rcx")
+	a.pop("%rax")
+
+	switch {
+	case t == TypeString:
+		a.emit("movq %%rax, %%rdi")
+		a.emit("movq %%rcx, %%rsi")
+		if ast.Operator == OpPlus {
+			a.callAligned("sowo_str_concat")
+		} else {
+			a.callAligned("sowo_str_equals")
+			a.normalize(TypeBoolean)
+		}
+	case isIntegerType(t) && isArithmeticOperator(ast.Operator):
+		a.integerOperation(ast, t)
+	case isFloatType(t) && isArithmeticOperator(ast.Operator):
+		suffix := "sd"
+		if t == TypeF32 {
+			suffix = "ss"
+			a.emit("movd %%eax, %%xmm0")
+			a.emit("movd %%ecx, %%xmm1")
+		} else {
+			a.emit("movq %%rax, %%xmm0")
+			a.emit("movq %%rcx, %%xmm1")
+		}
+		ops := map[BinaryOperator]string{OpPlus: "add", OpMinus: "sub", OpTimes: "mul", OpDivide: "div"}
+		a.emit("%s%s %%xmm1, %%xmm0", ops[ast.Operator], suffix)
+		if t == TypeF32 {
+			a.emit("movd %%xmm0, %%eax")
+		} else {
+			a.emit("movq %%xmm0, %%rax")
+		}
+	case isFloatType(t):
+		a.floatComparison(ast.Operator, t)
+	default:
+		// Values of the other types are words extended from their
+		// type, the unsigned ones are compared as unsigned
+		unsigned := t == TypeU8 || t == TypeU16 || t == TypeU32 || t == TypeU64
+		conditions := map[BinaryOperator][2]string{
+			OpEquals:           {"e", "e"},
+			OpLessThen:         {"l", "b"},
+			OpGreaterThen:      {"g", "a"},
+			OpLessThenEqual:    {"le", "be"},
+			OpGreaterThenEqual: {"ge", "ae"},
+		}
+		condition, ok := conditions[ast.Operator]
+		if !ok {
+			log.Fatalf("[Asm]: Unsupported operator %s for type '%s'", ast.Operator, t)
+		}
+		a.emit("cmpq %%rcx, %%rax")
+		if unsigned {
+			a.emit("set%s %%al", condition[1])
+		} else {
+			a.emit("set%s %%al", condition[0])
+		}
+		a.emit("movzbl %%al, %%eax")
+	}
+}
+
+// Compares the floats in %rax and %rcx, comparisons with NaN are false.
+func (a *asmGenerator) floatComparison(op BinaryOperator, t TypeAnnotation) {
+	compare, move := "ucomisd", "movq"
+	lhs, rhs := "%rax", "%rcx"
+	if t == TypeF32 {
+		compare, move = "ucomiss", "movd"
+		lhs, rhs = "%eax", "%ecx"
+	}
+	// a < b and a <= b are computed as b > a and b >= a
+	if op == OpLessThen || op == OpLessThenEqual {
+		lhs, rhs = rhs, lhs
+	}
+	a.emit("%s %s, %%xmm0", move, lhs)
+	a.emit("%s %s, %%xmm1", move, rhs)
+	a.emit("%s %%xmm1, %%xmm0", compare)
+	switch op {
+	case OpEquals:
+		a.emit("sete %%al")
+		a.emit("setnp %%cl")
+		a.emit("andb %%cl, %%al")
+	case OpLessThen, OpGreaterThen:
+		a.emit("seta %%al")
+	case OpLessThenEqual, OpGreaterThenEqual:
+		a.emit("setae %%al")
+	default:
+		log.Fatalf("[Asm]: Unsupported operator %s for type '%s'", op, t)
+	}
+	a.emit("movzbl %%al, %%eax")
+}
+
+// Computes an arithmetic operation between the integers in %rax and
+// %rcx, see irIntegerOperation. The 64 bits operations are checked
+// with the overflow and carry flags, the results of the smaller types
+// always fit in 64 bits and are checked against their extended bits.
+func (a *asmGenerator) integerOperation(ast *Ast, t TypeAnnotation) {
+	unsigned := t == TypeU8 || t == TypeU16 || t == TypeU32 || t == TypeU64
+	overflow := a.label()
+	done := a.label()
+	var operation string
+	switch ast.Operator {
+	case OpPlus:
+		operation = "addition"
+		a.emit("addq %%rcx, %%rax")
+	case OpMinus:
+		operation = "subtraction"
+		a.emit("subq %%rcx, %%rax")
+	case OpTimes:
+		operation = "multiplication"
+		if t == TypeU64 {
+			a.emit("mulq %%rcx")
+		} else {
+			a.emit("imulq %%rcx, %%rax")
+		}
+	case OpDivide:
+		operation = "division"
+		if a.checked {
+			ok := a.label()
+			a.emit("testq %%rcx, %%rcx")
+			a.emit("jnz %s", ok)
+			a.panicAt(ast, "integer division by zero")
+			a.placeLabel(ok)
+		}
+		if unsigned {
+			a.emit("xorl %%edx, %%edx")
+			a.emit("divq %%rcx")
+		} else {
+			// The minimum i64 divided by -1 traps, it's negated instead
+			divide := a.label()
+			a.emit("cmpq $-1, %%rcx")
+			a.emit("jne %s", divide)
+			a.emit("negq %%rax")
+			if t == TypeI64 && a.checked {
+				a.emit("jo %s", overflow)
+			}
+			a.emit("jmp %s", done)
+			a.placeLabel(divide)
+			a.emit("cqto")
+			a.emit("idivq %%rcx")
+		}
+	}
+	a.placeLabel(done)
+
+	if a.checked {
+		ok := a.label()
+		switch {
+		case t == TypeI64:
+			if ast.Operator != OpDivide {
+				a.emit("jo %s", overflow)
+			}
+		case t == TypeU64:
+			if ast.Operator == OpTimes {
+				a.emit("jo %s", overflow)
+			} else if ast.Operator != OpDivide {
+				a.emit("jc %s", overflow)
+			}
+		default:
+			a.emit("movq %%rax, %%rdx")
+			a.normalize(t)
+			a.emit("cmpq %%rax, %%rdx")
+			a.emit("jne %s", overflow)
+		}
+		a.emit("jmp %s", ok)
+		a.placeLabel(overflow)
+		a.panicAt(ast, "integer overflow in "+operation)
+		a.placeLabel(ok)
+	} else {
+		a.placeLabel(overflow)
+	}
+	a.normalize(t)
+}
+
+// Converts the value in %rax, see irConversion.
+func (a *asmGenerator) conversion(ast *Ast) {
+	from, to := ast.Children[0].DataType, ast.DataType
+	switch {
+	case from == to:
+	case to == TypeString:
+		a.emit("movq %%rax, %%rdi")
+		switch {
+		case from == TypeChar:
+			a.callAligned("sowo_char_to_str")
+		case from == TypeU64 || from == TypeU32:
+			a.callAligned("sowo_uint_to_str")
+		default:
+			a.callAligned("sowo_int_to_str")
+		}
+	case from == TypeString:
+		a.push()
+		classes := append([]asmClass{asmClassInteger}, a.pushLocation(ast)...)
+		a.callPushed(classes, false, TypeI64, func() { a.emit("call sowo_str_to_int") })
+		a.normalize(to)
+	case isFloatType(from) && isFloatType(to):
+		if from == TypeF32 {
+			a.emit("movd %%eax, %%xmm0")
+			a.emit("cvtss2sd %%xmm0, %%xmm0")
+			a.emit("movq %%xmm0, %%rax")
+		} else {
+			a.emit("movq %%rax, %%xmm0")
+			a.emit("cvtsd2ss %%xmm0, %%xmm0")
+			a.emit("movd %%xmm0, %%eax")
+		}
+	case isFloatType(from):
+		// Out of range values are handled by the runtime
+		if from == TypeF32 {
+			a.emit("movd %%eax, %%xmm0")
+			a.emit("cvtss2sd %%xmm0, %%xmm0")
+			a.emit("movq %%xmm0, %%rax")
+		}
+		a.push()
+		a.emit("movq $%d, %%rax", llvmBits(to))
+		a.push()
+		classes := append([]asmClass{asmClassF64, asmClassInteger}, a.pushLocation(ast)...)
+		function := "sowo_float_to_uint"
+		if isSignedType(to) {
+			function = "sowo_float_to_int"
+		}
+		a.callPushed(classes, false, TypeI64, func() { a.emit("call %s", function) })
+		a.normalize(to)
+	case isFloatType(to):
+		suffix := "sd"
+		if to == TypeF32 {
+			suffix = "ss"
+		}
+		if from == TypeU64 {
+			// Values from 2^63 are halved keeping the rounding bit
+			large, done := a.label(), a.label()
+			a.emit("testq %%rax, %%rax")
+			a.emit("js %s", large)
+			a.emit("cvtsi2%sq %%rax, %%xmm0", suffix)
+			a.emit("jmp %s", done)
+			a.placeLabel(large)
+			a.emit("movq %%rax, %%rcx")
+			a.emit("shrq %%rcx")
+			a.emit("andl $1, %%eax")
+			a.emit("orq %%rax, %%rcx")
+			a.emit("cvtsi2%sq %%rcx, %%xmm0", suffix)
+			a.emit("add%s %%xmm0, %%xmm0", suffix)
+			a.placeLabel(done)
+		} else {
+			a.emit("cvtsi2%sq %%rax, %%xmm0", suffix)
+		}
+		if to == TypeF32 {
+			a.emit("movd %%xmm0, %%eax")
+		} else {
+			a.emit("movq %%xmm0, %%rax")
+		}
+	default:
+		a.normalize(to)
+	}
+}
+
+func (a *asmGenerator) index(ast *Ast) {
+	a.expression(ast.Children[0])
+	a.push()
+	a.expression(ast.Children[1])
+	if !isSliceType(ast.Children[0].DataType) {
+		a.push()
+		classes := append([]asmClass{asmClassInteger, asmClassInteger}, a.pushLocation(ast)...)
+		a.callPushed(classes, false, TypeChar, func() { a.emit("call sowo_str_index") })
+		return
+	}
+	a.emit("movq %%rax, %%rcx")
+	a.pop("%rax")
+	if a.checked {
+		// Nil slices have length 0, negative indices are
+		// larger than every length when compared as unsigned
+		empty, ok := a.label(), a.label()
+		a.emit("xorl %%edx, %%edx")
+		a.emit("testq %%rax, %%rax")
+		a.emit("jz %s", empty)
+		a.emit("movq (%%rax), %%rdx")
+		a.placeLabel(empty)
+		a.emit("cmpq %%rdx, %%rcx")
+		a.emit("jb %s", ok)
+		a.emit("movq %%rcx, %%r8")
+		a.emit("movq %%rdx, %%r9")
+		a.panicAt(ast, "index %lld out of range for slice of length %lld")
+		a.placeLabel(ok)
+	}
+	a.emit("movq 8(%%rax), %%rax")
+	a.emit("movq (%%rax,%%rcx,8), %%rax")
+}
+
+func (a *asmGenerator) funcCall(ast *Ast) {
+	var classes []asmClass
+	for _, arg := range ast.Children {
+		a.expression(arg)
+		a.push()
+		classes = append(classes, asmClassOf(arg.DataType))
+	}
+
+	_, member := splitQualifiedName(ast.Name)
+	if overloads, ok := builtinFuncs[builtinKey(ast.Module, member)]; ok {
+		var argTypes []TypeAnnotation
+		for _, arg := range ast.Children {
+			argTypes = append(argTypes, arg.DataType)
+		}
+		builtin, err := selectOverload(ast.Name, overloads, argTypes)
+		if err != nil {
+			log.Fatalf("[Asm]: %s", err)
+		}
+		if builtin.CName == "sowo_slice_len" {
+			// Nil slices have length 0
+			empty := a.label()
+			a.pop("%rax")
+			a.emit("testq %%rax, %%rax")
+			a.emit("jz %s", empty)
+			a.emit("movq (%%rax), %%rax")
+			a.placeLabel(empty)
+			a.normalize(TypeInteger)
+			return
+		}
+		if builtin.Located {
+			classes = append(classes, a.pushLocation(ast)...)
+		}
+		a.callPushed(classes, false, builtin.ReturnType, func() { a.emit("call %s", builtin.CName) })
+		return
+	}
+
+	name := irSymbolName(ast.Module, ast.Name)
+	if def, ok := a.funcDefs[name]; ok && len(ast.TypeArgs) > 0 {
+		// Every list of type arguments gets its own instance
+		bindings := map[TypeAnnotation]TypeAnnotation{}
+		for i, typeParam := range funcTypeParams(def) {
+			bindings[typeParam] = ast.TypeArgs[i]
+		}
+		instance := substituteAst(def, bindings)
+		instance.Children = instance.Children[:3]
+		name += irTypeArgsSuffix(ast.TypeArgs)
+		a.function(name, instance, false)
+	}
+	a.callPushed(classes, false, ast.DataType, func() { a.emit("call %s", name) })
+}
+
+// Returns a label of a function value referring to a function,
+// it's a block holding only the address of the function.
+func (a *asmGenerator) funcRef(ast *Ast) string {
+	name := irSymbolName(ast.Module, ast.Name)
+	if _, ok := a.funcDefs[name]; !ok {
+		// C functions are referred with their own name
+		name = ast.Name
+	}
+	label, ok := a.funcRefs[name]
+	if !ok {
+		label = fmt.Sprintf(".Lfn%d", len(a.funcRefs))
+		a.funcRefs[name] = label
+		fmt.Fprintf(&a.rodata, "\t.balign 8\n%s:\n\t.quad %s\n", label, name)
+	}
+	return label
+}
+
+// Emits a function literal as a function taking its block in %r10,
+// the value is a block with the captured variables after the code.
+func (a *asmGenerator) funcLiteral(ast *Ast) {
+	name := fmt.Sprintf("sowo_literal_%d", a.labels)
+	a.labels++
+	captures := ast.Children[3].Children
+	a.pending = append(a.pending, asmFunctionDef{name: name, def: ast, captures: captures, file: a.file})
+	a.functions[name] = true
+
+	a.allocBlock(1 + len(captures))
+	a.emit("leaq %s(%%rip), %%rcx", name)
+	a.emit("movq %%rcx, (%%rax)")
+	for i, capture := range captures {
+		a.loadVariable("", capture.Name, "%rcx")
+		a.emit("movq %%rcx, %d(%%rax)", 8*(i+1))
+	}
+}
+
+// Emits a method call, methods of interfaces are called through the
+// vtable of the interface value and the methods of results are inlined.
+func (a *asmGenerator) methodCall(ast *Ast) {
+	receiverType := ast.Children[0].DataType
+	if isResultType(receiverType) {
+		a.resultMethod(ast)
+		return
+	}
+	classes := []asmClass{asmClassInteger}
+	for _, arg := range ast.Children {
+		a.expression(arg)
+		a.push()
+	}
+	for _, arg := range ast.Children[1:] {
+		classes = append(classes, asmClassOf(arg.DataType))
+	}
+	if !isInterfaceType(receiverType) {
+		name := irMethodName(ast.Module, receiverType, ast.Name)
+		a.callPushed(classes, false, ast.DataType, func() { a.emit("call %s", name) })
+		return
+	}
+
+	// The receiver is replaced by the value of the interface
+	index := -1
+	for i, method := range interfaceMethods(receiverType) {
+		if method.Name == ast.Name {
+			index = i
+		}
+	}
+	offset := 8 * (len(ast.Children) - 1)
+	a.emit("movq %d(%%rsp), %%rax", offset)
+	a.nilCheck("%rax", ast, fmt.Sprintf("method %s called on nil interface", ast.Name))
+	a.emit("movq 8(%%rax), %%r11")
+	a.emit("movq (%%rax), %%rax")
+	a.emit("movq %%rax, %d(%%rsp)", offset)
+	a.callPushed(classes, false, ast.DataType, func() { a.emit("call *%d(%%r11)", 8*index) })
+}
+
+// Emits a method of a result, the zero value of results is a nil
+// block and behaves like a failed result.
+func (a *asmGenerator) resultMethod(ast *Ast) {
+	a.expression(ast.Children[0])
+	if ast.Name == "value_or" {
+		a.push()
+		a.expression(ast.Children[1])
+		a.emit("movq %%rax, %%rcx")
+		a.pop("%rax")
+	}
+	failed, done := a.label(), a.label()
+	a.emit("testq %%rax, %%rax")
+	a.emit("jz %s", failed)
+	a.emit("cmpq $0, (%%rax)")
+	a.emit("je %s", failed)
+	switch ast.Name {
+	case "is_ok", "is_err":
+		ok := 1
+		if ast.Name == "is_err" {
+			ok = 0
+		}
+		a.emit("movl $%d, %%eax", ok)
+		a.emit("jmp %s", done)
+		a.placeLabel(failed)
+		a.emit("movl $%d, %%eax", 1-ok)
+	case "value", "value_or":
+		a.emit("movq 8(%%rax), %%rax")
+		a.emit("jmp %s", done)
+		a.placeLabel(failed)
+		if ast.Name == "value_or" {
+			a.emit("movq %%rcx, %%rax")
+		} else {
+			a.panicAt(ast, "value of a failed result")
+		}
+	case "error":
+		a.panicAt(ast, "error of a successful result")
+		a.placeLabel(failed)
+		a.emit("testq %%rax, %%rax")
+		a.emit("jz %s", done)
+		a.emit("movq 16(%%rax), %%rax")
+	default:
+		log.Fatalf("[Asm]: Unknown method %s of results", ast.Name)
+	}
+	a.placeLabel(done)
+}
+
+// Returns the label of the vtable of the type for the interface,
+// holding the methods in the order the interface declares them.
+func (a *asmGenerator) vtable(iface TypeAnnotation, valueType TypeAnnotation, refs []*Ast) string {
+	key := irTypeName(iface) + "/" + irTypeName(valueType)
+	if label, ok := a.vtables[key]; ok {
+		return label
+	}
+	label := fmt.Sprintf(".Lvtable%d", len(a.vtables))
+	a.vtables[key] = label
+	fmt.Fprintf(&a.rodata, "\t.balign 8\n%s:\n", label)
+	for _, method := range interfaceMethods(iface) {
+		for _, ref := range refs {
+			if ref.Name == method.Name {
+				fmt.Fprintf(&a.rodata, "\t.quad %s\n", irMethodName(ref.Module, valueType, ref.Name))
+			}
+		}
+	}
+	return label
+}